@@ -0,0 +1,409 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// apiMaxBodyBytes caps request bodies; routing requests are tiny
+const apiMaxBodyBytes = 4096
+
+// apiShutdownRetryAfter is the Retry-After, in seconds, of changes refused while the bot shuts
+// down; a restarted container is usually back well within it
+const apiShutdownRetryAfter = "30"
+
+// openAPISpec describes the API; it is served at /api/openapi.json and tests check the handlers against it
+//
+//go:embed openapi.json
+var openAPISpec []byte
+
+// APIToken is a bearer token identifying an API client
+type APIToken struct {
+	Name  string
+	Token string
+}
+
+// parseAPITokens parses "name:token" pairs
+func parseAPITokens(values []string) ([]APIToken, error) {
+	tokens := make([]APIToken, 0, len(values))
+	for _, value := range values {
+		name, token, ok := strings.Cut(value, ":")
+		if !ok || name == "" || token == "" {
+			return nil, fmt.Errorf("invalid API token %q (use name:token)", value)
+		}
+		tokens = append(tokens, APIToken{Name: name, Token: token})
+	}
+	return tokens, nil
+}
+
+// RoutingState is the routing of the default rule
+type RoutingState struct {
+	Outbound string `json:"outbound"`
+	Mode     string `json:"mode"` // "vpn", "direct" or "other"
+}
+
+// RoutingRequest changes the default rule; exactly one of the fields must be set
+type RoutingRequest struct {
+	Mode     string `json:"mode,omitempty"`     // "vpn" or "direct"
+	Outbound string `json:"outbound,omitempty"` // Tag of an outbound that connects to a server
+}
+
+// StatusResponse is the routing of the default rule and the service state
+type StatusResponse struct {
+	RoutingState
+	Service ServiceState `json:"service"`
+}
+
+// ServiceResponse reports the service state after a service action
+type ServiceResponse struct {
+	Action string       `json:"action"`
+	State  ServiceState `json:"state"`
+}
+
+// RoutingRule is a routing rule with its position in the configuration
+type RoutingRule struct {
+	Index   int  `json:"index"`
+	Default bool `json:"default"` // Whether this is the rule the bot switches
+	Rule
+}
+
+// RulesResponse lists the routing rules
+type RulesResponse struct {
+	Rules []RoutingRule `json:"rules"`
+}
+
+// APIError is the body of every error response
+type APIError struct {
+	Error string `json:"error"`
+}
+
+// serviceActions maps /api/v1/service/{action} to router actions
+var serviceActions = map[string]Action{
+	"start":   ActionStartService,
+	"stop":    ActionStopService,
+	"restart": ActionRestartService,
+}
+
+// APIServer serves the REST API for automation, authenticating clients by bearer token or client certificate
+type APIServer struct {
+	vpnManager *VPNManager
+	tokens     []APIToken
+	logger     *logrus.Logger
+	notify     func(action Action, client string, err error)
+}
+
+// NewAPIServer creates the API for vpnManager accepting tokens
+func NewAPIServer(vpnManager *VPNManager, tokens []APIToken, logger *logrus.Logger) *APIServer {
+	return &APIServer{
+		vpnManager: vpnManager,
+		tokens:     tokens,
+		logger:     logger,
+	}
+}
+
+// SetNotifier registers a callback invoked after every router-changing API call
+func (api *APIServer) SetNotifier(notify func(action Action, client string, err error)) {
+	api.notify = notify
+}
+
+// Handler returns the authenticated API routes under /api/v1/ and the OpenAPI document
+func (api *APIServer) Handler() http.Handler {
+	v1 := http.NewServeMux()
+	v1.HandleFunc("/api/v1/status", api.handleStatus)
+	v1.HandleFunc("/api/v1/routing", api.handleRouting)
+	v1.HandleFunc("/api/v1/service/", api.handleService)
+	v1.HandleFunc("/api/v1/rules", api.handleRules)
+	v1.HandleFunc("/api/v1/", func(w http.ResponseWriter, r *http.Request) {
+		writeAPIError(w, http.StatusNotFound, "not found")
+	})
+
+	mux := http.NewServeMux()
+	mux.Handle("/api/v1/", api.authenticate(v1))
+	mux.HandleFunc("/api/openapi.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(openAPISpec)
+	})
+	return mux
+}
+
+// authenticate rejects requests without a verified client certificate or a known bearer token,
+// and attaches the client as the actor of the request
+func (api *APIServer) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		client, ok := api.clientName(r)
+		if !ok {
+			api.logger.WithField("remote_addr", r.RemoteAddr).Warn("Unauthorized API request")
+			w.Header().Set("WWW-Authenticate", `Bearer realm="vpn-commander"`)
+			writeAPIError(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+
+		ctx := withActor(r.Context(), Actor{Source: "api:" + client})
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// clientName identifies the client by its verified certificate or bearer token
+func (api *APIServer) clientName(r *http.Request) (string, bool) {
+	if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 && len(r.TLS.VerifiedChains[0]) > 0 {
+		return "cert:" + r.TLS.VerifiedChains[0][0].Subject.CommonName, true
+	}
+
+	provided, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !found || provided == "" {
+		return "", false
+	}
+	// Compare against every token so the response time does not reveal which one matched
+	name := ""
+	for _, token := range api.tokens {
+		if subtle.ConstantTimeCompare([]byte(provided), []byte(token.Token)) == 1 {
+			name = token.Name
+		}
+	}
+	return name, name != ""
+}
+
+// handleStatus serves GET /api/v1/status
+func (api *APIServer) handleStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		writeAPIError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	outbound, err := api.vpnManager.GetActiveOutbound()
+	if err != nil {
+		api.writeRouterError(w, err, "could not read the routing")
+		return
+	}
+	service, err := api.vpnManager.GetServiceState()
+	if err != nil {
+		api.writeRouterError(w, err, "could not read the service state")
+		return
+	}
+	writeJSON(w, http.StatusOK, StatusResponse{
+		RoutingState: RoutingState{Outbound: outbound, Mode: routingModeLabel(outbound)},
+		Service:      service,
+	})
+}
+
+// handleRouting serves GET and PUT /api/v1/routing
+func (api *APIServer) handleRouting(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		api.writeRoutingState(w)
+	case http.MethodPut:
+		var request RoutingRequest
+		decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, apiMaxBodyBytes))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&request); err != nil {
+			writeAPIError(w, http.StatusBadRequest, "invalid JSON body")
+			return
+		}
+
+		var action Action
+		var run func(ctx context.Context) error
+		switch {
+		case request.Mode != "" && request.Outbound != "":
+			writeAPIError(w, http.StatusBadRequest, "set either mode or outbound, not both")
+			return
+		case request.Mode == "vpn":
+			action, run = ActionEnableVPN, api.vpnManager.EnableVPN
+		case request.Mode == "direct":
+			action, run = ActionDisableVPN, api.vpnManager.DisableVPN
+		case request.Mode != "":
+			writeAPIError(w, http.StatusBadRequest, `mode must be "vpn" or "direct"`)
+			return
+		case request.Outbound != "":
+			if err := api.vpnManager.checkOutbound(request.Outbound); errors.Is(err, errUnknownOutbound) {
+				writeAPIError(w, http.StatusBadRequest, "unknown outbound")
+				return
+			} else if err != nil {
+				api.writeRouterError(w, err, "could not read the outbounds")
+				return
+			}
+			action = ActionSelectOutbound
+			run = func(ctx context.Context) error {
+				return api.vpnManager.SwitchOutbound(ctx, ActionSelectOutbound, request.Outbound)
+			}
+		default:
+			writeAPIError(w, http.StatusBadRequest, "mode or outbound is required")
+			return
+		}
+
+		// perform has logged the error
+		if err := api.perform(r, action, run); err != nil {
+			writePerformError(w, err, "routing change failed")
+			return
+		}
+		api.writeRoutingState(w)
+	default:
+		w.Header().Set("Allow", "GET, PUT")
+		writeAPIError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// writeRoutingState responds with the current routing
+func (api *APIServer) writeRoutingState(w http.ResponseWriter) {
+	outbound, err := api.vpnManager.GetActiveOutbound()
+	if err != nil {
+		api.writeRouterError(w, err, "could not read the routing")
+		return
+	}
+	writeJSON(w, http.StatusOK, RoutingState{Outbound: outbound, Mode: routingModeLabel(outbound)})
+}
+
+// handleService serves POST /api/v1/service/{start,stop,restart}
+func (api *APIServer) handleService(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/api/v1/service/")
+	action, ok := serviceActions[name]
+	if !ok {
+		writeAPIError(w, http.StatusNotFound, "unknown service action")
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		writeAPIError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	err := api.perform(r, action, func(ctx context.Context) error {
+		return api.vpnManager.Perform(ctx, action)
+	})
+	if err != nil {
+		writePerformError(w, err, "service action failed")
+		return
+	}
+
+	state, err := api.vpnManager.GetServiceState()
+	if err != nil {
+		api.logger.WithError(err).Warn("Failed to read service state after API action")
+	}
+	writeJSON(w, http.StatusOK, ServiceResponse{Action: name, State: state})
+}
+
+// handleRules serves GET /api/v1/rules
+func (api *APIServer) handleRules(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		writeAPIError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	rules, err := listRoutingRules(api.vpnManager)
+	if err != nil {
+		api.writeRouterError(w, err, "could not read the routing rules")
+		return
+	}
+	writeJSON(w, http.StatusOK, RulesResponse{Rules: rules})
+}
+
+// listRoutingRules returns the routing rules with their positions, marking the default rule
+func listRoutingRules(vpnManager *VPNManager) ([]RoutingRule, error) {
+	rules, err := vpnManager.GetRoutingRules()
+	if err != nil {
+		return nil, err
+	}
+
+	routingRules := make([]RoutingRule, 0, len(rules))
+	for i, rule := range rules {
+		routingRules = append(routingRules, RoutingRule{
+			Index:   i,
+			Default: i == len(rules)-1 && vpnManager.isTargetRule(rule),
+			Rule:    rule,
+		})
+	}
+	return routingRules, nil
+}
+
+// perform runs a router-changing action for the authenticated client and reports it
+func (api *APIServer) perform(r *http.Request, action Action, run func(ctx context.Context) error) error {
+	client := strings.TrimPrefix(actorFromContext(r.Context()).Source, "api:")
+	err := run(r.Context())
+
+	fields := logrus.Fields{
+		"client": client,
+		"action": action,
+	}
+	if err != nil {
+		api.logger.WithError(err).WithFields(fields).Error("API action failed")
+	} else {
+		api.logger.WithFields(fields).Info("API action completed")
+	}
+
+	if api.notify != nil {
+		api.notify(action, client, err)
+	}
+	return err
+}
+
+// writeRouterError logs a failed router read and responds with message, keeping
+// router details such as paths and SSH errors out of the response
+func (api *APIServer) writeRouterError(w http.ResponseWriter, err error, message string) {
+	api.logger.WithError(err).WithField("response", message).Error("API request failed")
+	writeAPIError(w, http.StatusBadGateway, message)
+}
+
+// writePerformError responds to a router change perform has already logged as failed: 503 with
+// Retry-After when the bot is shutting down, or 502 with message when the router failed
+func writePerformError(w http.ResponseWriter, err error, message string) {
+	if errors.Is(err, ErrShuttingDown) {
+		w.Header().Set("Retry-After", apiShutdownRetryAfter)
+		writeAPIError(w, http.StatusServiceUnavailable, "shutting down, retry later")
+		return
+	}
+	writeAPIError(w, http.StatusBadGateway, message)
+}
+
+// writeJSON writes value as a JSON response
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
+
+// writeAPIError writes an APIError response
+func writeAPIError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, APIError{Error: message})
+}
+
+// newAPITLSConfig loads the server certificate and, when clientCAFile is set, requires
+// client certificates signed by it
+func newAPITLSConfig(certFile, keyFile, clientCAFile string) (*tls.Config, error) {
+	certificate, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load API certificate: %w", err)
+	}
+
+	config := &tls.Config{
+		Certificates: []tls.Certificate{certificate},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if clientCAFile == "" {
+		return config, nil
+	}
+
+	caPEM, err := os.ReadFile(clientCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read API client CA: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caPEM) {
+		return nil, errors.New("API client CA contains no certificates")
+	}
+	config.ClientCAs = pool
+	// Clients without a certificate may still use a bearer token
+	config.ClientAuth = tls.VerifyClientCertIfGiven
+	return config, nil
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newTestAPIServer(t *testing.T) *APIServer {
+	t.Helper()
+	vm := newOfflineVPNManager(t)
+	return NewAPIServer(vm, []APIToken{{Name: "ci", Token: "secret"}, {Name: "ops", Token: "other"}}, vm.logger)
+}
+
+func apiRequest(t *testing.T, handler http.Handler, method, path, token, body string) (*httptest.ResponseRecorder, APIError) {
+	t.Helper()
+
+	request := httptest.NewRequest(method, path, strings.NewReader(body))
+	if token != "" {
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+
+	var apiErr APIError
+	if recorder.Code >= 400 {
+		if err := json.NewDecoder(recorder.Body).Decode(&apiErr); err != nil {
+			t.Fatalf("Error response is not JSON: %v", err)
+		}
+	}
+	return recorder, apiErr
+}
+
+func TestAPIAuthentication(t *testing.T) {
+	handler := newTestAPIServer(t).Handler()
+
+	for _, token := range []string{"", "wrong"} {
+		recorder, _ := apiRequest(t, handler, http.MethodGet, "/api/v1/routing", token, "")
+		if recorder.Code != http.StatusUnauthorized {
+			t.Errorf("Token %q: expected 401, got %d", token, recorder.Code)
+		}
+		if recorder.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("Token %q: expected a WWW-Authenticate header", token)
+		}
+	}
+
+	// A valid token reaches the router, which is offline here
+	recorder, apiErr := apiRequest(t, handler, http.MethodGet, "/api/v1/routing", "other", "")
+	if recorder.Code != http.StatusBadGateway || apiErr.Error != "could not read the routing" {
+		t.Errorf("Expected 502 with a generic error from the offline router, got %d %+v", recorder.Code, apiErr)
+	}
+}
+
+func TestAPIClientCertificate(t *testing.T) {
+	api := newTestAPIServer(t)
+	request := httptest.NewRequest(http.MethodGet, "/api/v1/rules", nil)
+	request.TLS = &tls.ConnectionState{
+		VerifiedChains: [][]*x509.Certificate{{{Subject: pkix.Name{CommonName: "home-assistant"}}}},
+	}
+
+	client, ok := api.clientName(request)
+	if !ok || client != "cert:home-assistant" {
+		t.Errorf("Expected the certificate CN to identify the client, got %q %v", client, ok)
+	}
+}
+
+func TestAPIRoutingValidation(t *testing.T) {
+	handler := newTestAPIServer(t).Handler()
+
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"invalid JSON", "{"},
+		{"unknown field", `{"routing":"vpn"}`},
+		{"empty", `{}`},
+		{"both fields", `{"mode":"vpn","outbound":"direct"}`},
+		{"unknown mode", `{"mode":"tor"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder, _ := apiRequest(t, handler, http.MethodPut, "/api/v1/routing", "secret", tt.body)
+			if recorder.Code != http.StatusBadRequest {
+				t.Errorf("Expected 400, got %d", recorder.Code)
+			}
+		})
+	}
+
+	recorder, _ := apiRequest(t, handler, http.MethodDelete, "/api/v1/routing", "secret", "")
+	if recorder.Code != http.StatusMethodNotAllowed || recorder.Header().Get("Allow") != "GET, PUT" {
+		t.Errorf("Expected 405 with Allow header, got %d", recorder.Code)
+	}
+}
+
+func TestAPIRoutingRejectsUnknownOutbound(t *testing.T) {
+	vm, router := newFakeRouterManager(t, "direct")
+	handler := NewAPIServer(vm, []APIToken{{Name: "ci", Token: "secret"}}, vm.logger).Handler()
+
+	for _, outbound := range []string{"vless-typo", "block"} {
+		recorder, apiErr := apiRequest(t, handler, http.MethodPut, "/api/v1/routing", "secret", `{"outbound":"`+outbound+`"}`)
+		if recorder.Code != http.StatusBadRequest || apiErr.Error != "unknown outbound" {
+			t.Errorf("Outbound %q: expected 400 unknown outbound, got %d %+v", outbound, recorder.Code, apiErr)
+		}
+	}
+	if router.Restarts() != 0 {
+		t.Error("Expected an unknown outbound to leave the router alone")
+	}
+
+	recorder, _ := apiRequest(t, handler, http.MethodPut, "/api/v1/routing", "secret", `{"outbound":"vless-reality"}`)
+	if recorder.Code != http.StatusOK {
+		t.Errorf("Expected a configured outbound to be accepted, got %d", recorder.Code)
+	}
+}
+
+func TestAPIServiceRoutes(t *testing.T) {
+	api := newTestAPIServer(t)
+	var notified []string
+	api.SetNotifier(func(action Action, client string, err error) {
+		if err == nil {
+			t.Error("Expected the action to fail against an offline router")
+		}
+		notified = append(notified, client+":"+string(action))
+	})
+	handler := api.Handler()
+
+	if recorder, _ := apiRequest(t, handler, http.MethodPost, "/api/v1/service/reboot", "secret", ""); recorder.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown action, got %d", recorder.Code)
+	}
+	if recorder, _ := apiRequest(t, handler, http.MethodGet, "/api/v1/service/start", "secret", ""); recorder.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405 for GET, got %d", recorder.Code)
+	}
+
+	recorder, _ := apiRequest(t, handler, http.MethodPost, "/api/v1/service/restart", "secret", "")
+	if recorder.Code != http.StatusBadGateway {
+		t.Errorf("Expected 502 from the offline router, got %d", recorder.Code)
+	}
+	if len(notified) != 1 || notified[0] != "ci:restart_service" {
+		t.Errorf("Expected one notification for ci, got %v", notified)
+	}
+}
+
+func TestParseAPITokens(t *testing.T) {
+	tokens, err := parseAPITokens([]string{"ci:abc", "ops:x:y"})
+	if err != nil {
+		t.Fatalf("parseAPITokens failed: %v", err)
+	}
+	if tokens[0] != (APIToken{Name: "ci", Token: "abc"}) || tokens[1] != (APIToken{Name: "ops", Token: "x:y"}) {
+		t.Errorf("Unexpected tokens %+v", tokens)
+	}
+
+	for _, invalid := range []string{"abc", ":abc", "ci:"} {
+		if _, err := parseAPITokens([]string{invalid}); err == nil {
+			t.Errorf("Expected %q to be rejected", invalid)
+		}
+	}
+}
+
+func TestAPIRefusesChangesWhileShuttingDown(t *testing.T) {
+	doc := loadOpenAPIDocument(t)
+	api := newTestAPIServer(t)
+	api.vpnManager.Shutdown(context.Background())
+	handler := api.Handler()
+
+	tests := []struct {
+		method string
+		target string
+		path   string // Documented path
+		body   string
+	}{
+		{http.MethodPut, "/api/v1/routing", "/api/v1/routing", `{"mode":"vpn"}`},
+		{http.MethodPost, "/api/v1/service/restart", "/api/v1/service/{action}", ""},
+	}
+	for _, tt := range tests {
+		recorder, _ := apiRequest(t, handler, tt.method, tt.target, "secret", tt.body)
+		if recorder.Code != http.StatusServiceUnavailable || recorder.Header().Get("Retry-After") == "" {
+			t.Errorf("%s %s: expected 503 with Retry-After, got %d %v", tt.method, tt.target, recorder.Code, recorder.Header())
+			continue
+		}
+		doc.responseSchema(t, tt.path, tt.method, recorder.Code)
+	}
+}
@@ -0,0 +1,325 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Audit outcomes
+const (
+	AuditOutcomeSuccess = "success"
+	AuditOutcomeFailure = "failure"
+)
+
+// AuditEntry records a single router-changing action
+type AuditEntry struct {
+	Time     time.Time `json:"time"`
+	UserID   int64     `json:"user_id,omitempty"`
+	Username string    `json:"username,omitempty"`
+	Source   string    `json:"source"`
+	Action   Action    `json:"action"`
+	Router   string    `json:"router"`
+	Before   string    `json:"before,omitempty"`
+	After    string    `json:"after,omitempty"`
+	Outcome  string    `json:"outcome"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// AuditSink receives audit entries; implementations must be safe for concurrent use
+type AuditSink interface {
+	Write(entry AuditEntry) error
+	Close() error
+}
+
+// AuditQuerier is implemented by sinks that can read back recorded entries
+type AuditQuerier interface {
+	Query(limit int) ([]AuditEntry, error)
+}
+
+// AuditLog fans audit entries out to all configured sinks
+type AuditLog struct {
+	sinks  []AuditSink
+	logger *logrus.Logger
+	last   *AuditEntry // Most recent entry recorded or read back
+	mutex  sync.Mutex
+}
+
+// NewAuditLog creates an audit log writing to the given sinks
+func NewAuditLog(logger *logrus.Logger, sinks ...AuditSink) *AuditLog {
+	return &AuditLog{
+		sinks:  sinks,
+		logger: logger,
+	}
+}
+
+// Record writes an entry to every sink; sink failures are logged but never block the action
+func (a *AuditLog) Record(entry AuditEntry) {
+	if a == nil {
+		return
+	}
+	if entry.Time.IsZero() {
+		entry.Time = time.Now().UTC()
+	}
+
+	a.mutex.Lock()
+	a.last = &entry
+	a.mutex.Unlock()
+
+	for _, sink := range a.sinks {
+		if err := sink.Write(entry); err != nil {
+			a.logger.WithError(err).WithField("action", entry.Action).Error("Failed to write audit entry")
+		}
+	}
+}
+
+// Recent returns up to limit of the most recent entries, newest first
+func (a *AuditLog) Recent(limit int) ([]AuditEntry, error) {
+	if a == nil {
+		return nil, errors.New("audit log is not configured")
+	}
+
+	for _, sink := range a.sinks {
+		if querier, ok := sink.(AuditQuerier); ok {
+			return querier.Query(limit)
+		}
+	}
+	return nil, errors.New("no queryable audit sink configured")
+}
+
+// Last returns the most recent entry, reading it back from a sink once after startup
+func (a *AuditLog) Last() (AuditEntry, bool) {
+	if a == nil {
+		return AuditEntry{}, false
+	}
+
+	a.mutex.Lock()
+	last := a.last
+	a.mutex.Unlock()
+	if last != nil {
+		return *last, true
+	}
+
+	entries, err := a.Recent(1)
+	if err != nil || len(entries) == 0 {
+		return AuditEntry{}, false
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if a.last == nil {
+		a.last = &entries[0]
+	}
+	return *a.last, true
+}
+
+// Close closes every sink
+func (a *AuditLog) Close() error {
+	if a == nil {
+		return nil
+	}
+
+	var errs []error
+	for _, sink := range a.sinks {
+		if err := sink.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// FileAuditSink appends entries as JSON lines to a file
+type FileAuditSink struct {
+	path  string
+	file  *os.File
+	mutex sync.Mutex
+}
+
+// NewFileAuditSink opens (or creates) an append-only JSON lines audit file
+func NewFileAuditSink(path string) (*FileAuditSink, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create audit directory: %w", err)
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log %s: %w", path, err)
+	}
+
+	return &FileAuditSink{path: path, file: file}, nil
+}
+
+// Write appends a single entry and syncs it to disk
+func (s *FileAuditSink) Write(entry AuditEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to marshal audit entry: %w", err)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, err := s.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to append audit entry: %w", err)
+	}
+	return s.file.Sync()
+}
+
+// Query reads the file and returns up to limit of the newest entries, newest first
+// A limit of zero or less returns every entry
+func (s *FileAuditSink) Query(limit int) ([]AuditEntry, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	file, err := os.Open(s.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	defer file.Close()
+
+	var entries []AuditEntry
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var entry AuditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			continue // Skip a torn line rather than hiding the whole history
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read audit log: %w", err)
+	}
+
+	// Reverse so the newest entry comes first
+	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+		entries[i], entries[j] = entries[j], entries[i]
+	}
+	if limit > 0 && len(entries) > limit {
+		entries = entries[:limit]
+	}
+	return entries, nil
+}
+
+// Close closes the underlying file
+func (s *FileAuditSink) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.file.Close()
+}
+
+// LogAuditSink mirrors audit entries into the structured application log
+type LogAuditSink struct {
+	logger *logrus.Logger
+}
+
+// NewLogAuditSink creates a sink writing to logger
+func NewLogAuditSink(logger *logrus.Logger) *LogAuditSink {
+	return &LogAuditSink{logger: logger}
+}
+
+// Write logs the entry at info level
+func (s *LogAuditSink) Write(entry AuditEntry) error {
+	s.logger.WithFields(logrus.Fields{
+		"audit":    true,
+		"user_id":  entry.UserID,
+		"username": entry.Username,
+		"source":   entry.Source,
+		"action":   entry.Action,
+		"router":   entry.Router,
+		"before":   entry.Before,
+		"after":    entry.After,
+		"outcome":  entry.Outcome,
+		"error":    entry.Error,
+	}).Info("Audit")
+	return nil
+}
+
+// Close is a no-op
+func (s *LogAuditSink) Close() error {
+	return nil
+}
+
+// Actor identifies who triggered a router-changing action
+type Actor struct {
+	UserID   int64
+	Username string
+	Source   string // e.g. "telegram"
+}
+
+type actorContextKey struct{}
+
+// withActor attaches the acting user to ctx
+func withActor(ctx context.Context, actor Actor) context.Context {
+	return context.WithValue(ctx, actorContextKey{}, actor)
+}
+
+// actorFromContext returns the acting user from ctx, or a system actor if none is set
+func actorFromContext(ctx context.Context) Actor {
+	if actor, ok := ctx.Value(actorContextKey{}).(Actor); ok {
+		return actor
+	}
+	return Actor{Source: "system"}
+}
+
+// newAuditExportHandler serves audit entries over HTTP, newest first
+// Query parameters: limit (default all) and format ("json" array or "jsonl")
+// Requests must carry token as a bearer token; an empty token refuses every request
+func newAuditExportHandler(auditLog *AuditLog, token string, logger *logrus.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		provided := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if token == "" || subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		limit := 0
+		if value := r.URL.Query().Get("limit"); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil || parsed < 0 {
+				http.Error(w, "Invalid limit", http.StatusBadRequest)
+				return
+			}
+			limit = parsed
+		}
+
+		entries, err := auditLog.Recent(limit)
+		if err != nil {
+			logger.WithError(err).Error("Failed to export audit log")
+			http.Error(w, "Audit log unavailable", http.StatusServiceUnavailable)
+			return
+		}
+
+		switch r.URL.Query().Get("format") {
+		case "jsonl":
+			w.Header().Set("Content-Type", "application/x-ndjson")
+			encoder := json.NewEncoder(w)
+			for _, entry := range entries {
+				encoder.Encode(entry)
+			}
+		default:
+			if entries == nil {
+				entries = []AuditEntry{}
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(entries)
+		}
+	})
+}
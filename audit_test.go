@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func newTestAuditLog(t *testing.T) *AuditLog {
+	t.Helper()
+
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+
+	sink, err := NewFileAuditSink(filepath.Join(t.TempDir(), "audit.jsonl"))
+	if err != nil {
+		t.Fatalf("NewFileAuditSink failed: %v", err)
+	}
+	auditLog := NewAuditLog(logger, sink, NewLogAuditSink(logger))
+	t.Cleanup(func() { auditLog.Close() })
+	return auditLog
+}
+
+func TestAuditLogRecent(t *testing.T) {
+	auditLog := newTestAuditLog(t)
+
+	auditLog.Record(AuditEntry{Action: ActionDisableVPN, Before: "vless-reality", After: "direct", Outcome: AuditOutcomeSuccess})
+	auditLog.Record(AuditEntry{Action: ActionStopService, Before: "running", After: "stopped", Outcome: AuditOutcomeSuccess})
+	auditLog.Record(AuditEntry{Action: ActionEnableVPN, Outcome: AuditOutcomeFailure, Error: "boom"})
+
+	entries, err := auditLog.Recent(2)
+	if err != nil {
+		t.Fatalf("Recent failed: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("Expected 2 entries, got %d", len(entries))
+	}
+	if entries[0].Action != ActionEnableVPN || entries[1].Action != ActionStopService {
+		t.Errorf("Expected newest first, got %s then %s", entries[0].Action, entries[1].Action)
+	}
+	if entries[0].Time.IsZero() {
+		t.Error("Expected entry time to be filled in")
+	}
+}
+
+func TestAuditLogLast(t *testing.T) {
+	auditLog := newTestAuditLog(t)
+
+	if _, ok := auditLog.Last(); ok {
+		t.Fatal("Expected no last entry in an empty log")
+	}
+
+	auditLog.Record(AuditEntry{Action: ActionDisableVPN, Outcome: AuditOutcomeSuccess})
+	auditLog.Record(AuditEntry{Action: ActionStartService, Outcome: AuditOutcomeSuccess})
+
+	last, ok := auditLog.Last()
+	if !ok || last.Action != ActionStartService {
+		t.Errorf("Expected last entry %s, got %s (ok=%v)", ActionStartService, last.Action, ok)
+	}
+
+	// A fresh log over the same sink reads the last entry back after a restart
+	restarted := NewAuditLog(auditLog.logger, auditLog.sinks...)
+	if last, ok := restarted.Last(); !ok || last.Action != ActionStartService {
+		t.Errorf("Expected last entry %s after restart, got %s (ok=%v)", ActionStartService, last.Action, ok)
+	}
+}
+
+func TestVPNManagerRecordAudit(t *testing.T) {
+	auditLog := newTestAuditLog(t)
+	manager := &VPNManager{router: &SSHClient{host: "router"}, auditLog: auditLog}
+
+	ctx := withActor(context.Background(), Actor{UserID: 7, Username: "alice", Source: "telegram"})
+	entry := manager.newAuditEntry(ctx, ActionDisableVPN)
+	entry.Before, entry.After = "vless-reality", "direct"
+	manager.recordAudit(entry, errors.New("write failed"))
+
+	entries, _ := auditLog.Recent(1)
+	got := entries[0]
+	if got.Username != "alice" || got.Router != "router" || got.Outcome != AuditOutcomeFailure {
+		t.Errorf("Unexpected entry: %+v", got)
+	}
+	if got.After != "vless-reality" {
+		t.Errorf("Failed action should leave state unchanged, got after=%s", got.After)
+	}
+}
+
+func TestAuditExportHandler(t *testing.T) {
+	auditLog := newTestAuditLog(t)
+	auditLog.Record(AuditEntry{Action: ActionStartService, Outcome: AuditOutcomeSuccess})
+
+	handler := newAuditExportHandler(auditLog, "secret", auditLog.logger)
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/audit", nil))
+	if recorder.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 without token, got %d", recorder.Code)
+	}
+
+	request := httptest.NewRequest(http.MethodGet, "/audit?limit=5", nil)
+	request.Header.Set("Authorization", "Bearer secret")
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", recorder.Code)
+	}
+
+	var entries []AuditEntry
+	if err := json.Unmarshal(recorder.Body.Bytes(), &entries); err != nil {
+		t.Fatalf("Invalid JSON: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Action != ActionStartService {
+		t.Errorf("Unexpected export: %+v", entries)
+	}
+
+	// Without a token the export never falls back to open access
+	unconfigured := newAuditExportHandler(auditLog, "", auditLog.logger)
+	recorder = httptest.NewRecorder()
+	unconfigured.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/audit", nil))
+	if recorder.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 with no token configured, got %d", recorder.Code)
+	}
+	recorder = httptest.NewRecorder()
+	createHealthCheckHandler(nil, nil, auditLog, nil, nil, nil, "", nil).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/audit", nil))
+	if recorder.Code != http.StatusNotFound {
+		t.Errorf("Expected /audit not to be mounted without a token, got %d", recorder.Code)
+	}
+}
+
+func TestParseServiceState(t *testing.T) {
+	tests := map[string]ServiceState{
+		"Прокси-клиент \033[31mне запущен\033[0m": ServiceStateStopped,
+		"Прокси-клиент запущен":                   ServiceStateRunning,
+		"  ": ServiceStateUnknown,
+	}
+	for output, expected := range tests {
+		if got := parseServiceState(output); got != expected {
+			t.Errorf("%q: expected %s, got %s", output, expected, got)
+		}
+	}
+}
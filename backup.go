@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// backupTimeLayout matches the suffix SSHClient.WriteFile appends to backups
+const backupTimeLayout = "20060102-150405"
+
+// ConfigBackup is a copy of the routing configuration made before it was overwritten
+type ConfigBackup struct {
+	Name      string    `json:"name"` // Timestamp suffix identifying the backup
+	Path      string    `json:"path"`
+	CreatedAt time.Time `json:"created_at"` // Router local time
+}
+
+// ListBackups returns the backups of the routing configuration, newest first
+func (vm *VPNManager) ListBackups() ([]ConfigBackup, error) {
+	// ls exits non-zero when the glob matches nothing, which just means there are no backups
+	output, err := vm.router.ExecuteCommand(fmt.Sprintf("ls -1 %s.backup.* 2>/dev/null || true", vm.configPath))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list backups: %w", err)
+	}
+	return parseBackupList(vm.configPath, output), nil
+}
+
+// parseBackupList extracts the backups of configPath from ls output, skipping unrelated files
+func parseBackupList(configPath, output string) []ConfigBackup {
+	prefix := configPath + ".backup."
+	var backups []ConfigBackup
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		name, found := strings.CutPrefix(line, prefix)
+		if !found {
+			continue
+		}
+		createdAt, err := time.Parse(backupTimeLayout, name)
+		if err != nil {
+			continue
+		}
+		backups = append(backups, ConfigBackup{Name: name, Path: line, CreatedAt: createdAt})
+	}
+
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].CreatedAt.After(backups[j].CreatedAt)
+	})
+	return backups
+}
+
+// RestoreBackup replaces the routing configuration with the backup called name, or the newest
+// backup when name is "latest", and restarts the service. The replaced configuration is backed up in turn.
+func (vm *VPNManager) RestoreBackup(ctx context.Context, name string) (_ ConfigBackup, err error) {
+	end, err := vm.beginMutation(ctx, ActionRestoreBackup)
+	if err != nil {
+		return ConfigBackup{}, err
+	}
+	defer end()
+
+	entry := vm.newAuditEntry(ctx, ActionRestoreBackup)
+	defer func() { vm.recordAudit(entry, err) }()
+	defer func() { vm.metrics.ObserveConfigApply(err) }()
+
+	backups, err := vm.ListBackups()
+	if err != nil {
+		return ConfigBackup{}, err
+	}
+	backup, ok := findBackup(backups, name)
+	if !ok {
+		return ConfigBackup{}, fmt.Errorf("backup %q not found", name)
+	}
+
+	content, err := vm.router.ReadFile(backup.Path)
+	if err != nil {
+		return backup, fmt.Errorf("failed to read backup: %w", err)
+	}
+	var config XrayConfig
+	if err := json.Unmarshal([]byte(content), &config); err != nil {
+		return backup, fmt.Errorf("backup is not valid JSON: %w", err)
+	}
+	if config.Routing == nil || len(config.Routing.Rules) == 0 {
+		return backup, fmt.Errorf("backup has no routing rules")
+	}
+
+	// Record the default outbound on either side of the restore
+	if current, err := vm.GetActiveOutbound(); err == nil {
+		entry.Before = current
+	}
+	entry.After = config.Routing.Rules[len(config.Routing.Rules)-1].OutboundTag
+
+	vm.logger.WithField("backup", backup.Path).Info("Restoring routing configuration backup")
+	if err := vm.router.WriteFile(vm.configPath, strings.TrimRight(content, "\n")); err != nil {
+		return backup, fmt.Errorf("failed to write config: %w", err)
+	}
+
+	if err := vm.restartXrayService(); err != nil {
+		vm.logger.WithError(err).Warn("Failed to restart Xray service, changes may not be applied immediately")
+	}
+	vm.metrics.SetRouting(vm.RouterName(), entry.After)
+	return backup, nil
+}
+
+// findBackup looks a backup up by name, full path or "latest"
+func findBackup(backups []ConfigBackup, name string) (ConfigBackup, bool) {
+	if name == "latest" {
+		if len(backups) == 0 {
+			return ConfigBackup{}, false
+		}
+		return backups[0], true
+	}
+	for _, backup := range backups {
+		if backup.Name == name || backup.Path == name || path.Base(backup.Path) == name {
+			return backup, true
+		}
+	}
+	return ConfigBackup{}, false
+}
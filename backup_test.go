@@ -0,0 +1,50 @@
+package main
+
+import "testing"
+
+func TestParseBackupList(t *testing.T) {
+	output := `/opt/etc/xray/configs/05_routing.json.backup.20240101-120000
+/opt/etc/xray/configs/05_routing.json.backup.20240315-080910
+/opt/etc/xray/configs/05_routing.json.backup.manual
+/opt/etc/xray/configs/04_outbounds.json.backup.20240401-000000
+`
+	backups := parseBackupList("/opt/etc/xray/configs/05_routing.json", output)
+	if len(backups) != 2 {
+		t.Fatalf("Expected 2 backups, got %+v", backups)
+	}
+	if backups[0].Name != "20240315-080910" || backups[1].Name != "20240101-120000" {
+		t.Errorf("Expected newest first, got %+v", backups)
+	}
+	if backups[0].Path != "/opt/etc/xray/configs/05_routing.json.backup.20240315-080910" {
+		t.Errorf("Unexpected path %q", backups[0].Path)
+	}
+
+	if backups := parseBackupList("/opt/etc/xray/configs/05_routing.json", ""); len(backups) != 0 {
+		t.Errorf("Expected no backups, got %+v", backups)
+	}
+}
+
+func TestFindBackup(t *testing.T) {
+	backups := parseBackupList("/etc/routing.json", "/etc/routing.json.backup.20240315-080910\n/etc/routing.json.backup.20240101-120000")
+
+	tests := []struct {
+		name  string
+		found string
+	}{
+		{"latest", "20240315-080910"},
+		{"20240101-120000", "20240101-120000"},
+		{"routing.json.backup.20240101-120000", "20240101-120000"},
+		{"/etc/routing.json.backup.20240315-080910", "20240315-080910"},
+		{"20230101-000000", ""},
+	}
+	for _, tt := range tests {
+		backup, ok := findBackup(backups, tt.name)
+		if ok != (tt.found != "") || backup.Name != tt.found {
+			t.Errorf("findBackup(%q) = %+v, %v; expected %q", tt.name, backup, ok, tt.found)
+		}
+	}
+
+	if _, ok := findBackup(nil, "latest"); ok {
+		t.Error("Expected no latest backup without backups")
+	}
+}
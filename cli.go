@@ -0,0 +1,540 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/joho/godotenv"
+	"github.com/sirupsen/logrus"
+
+	"vpn-commander/client"
+)
+
+// CLI exit codes
+const (
+	cliExitOK      = 0
+	cliExitFailure = 1 // The command failed on the router or the API
+	cliExitUsage   = 2 // Invalid arguments
+)
+
+// errBackupsNeedSSH is returned by backup commands run against the API
+var errBackupsNeedSSH = errors.New("backups are only available over SSH; run without --api")
+
+// cliUsage describes the subcommands
+const cliUsage = `Usage: vpn-commander [command] [flags]
+
+Commands:
+  serve                             Run the Telegram bot (default)
+  status                            Show routing and service state
+  route vpn|direct|<outbound>       Point the default rule at the VPN, direct or a configured outbound
+  service start|stop|restart        Control the VPN service
+  rules list                        List the routing rules
+  backup list                       List routing config backups (SSH only)
+  backup restore <name>|latest      Restore a routing config backup (SSH only)
+  help                              Show this help
+
+Flags for router commands:
+  --output json|table               Output format (default table)
+  --api URL                         Use a running instance's API instead of SSH ($VPN_COMMANDER_API_URL)
+  --token TOKEN                     API bearer token ($VPN_COMMANDER_API_TOKEN)
+  --timeout DURATION                Give up after this long (default 2m)
+
+Without --api, commands connect to the router over SSH using ROUTER_HOST,
+ROUTER_USERNAME and ROUTER_PASSWORD from the environment or .env.
+`
+
+// cliBackend performs router commands over SSH or through a running instance's API
+type cliBackend interface {
+	Status(ctx context.Context) (StatusResponse, error)
+	Route(ctx context.Context, target string) (RoutingState, error)
+	Service(ctx context.Context, action string) (ServiceResponse, error)
+	Rules(ctx context.Context) ([]RoutingRule, error)
+	Backups(ctx context.Context) ([]ConfigBackup, error)
+	RestoreBackup(ctx context.Context, name string) (ConfigBackup, error)
+	Close() error
+}
+
+// cliCommand is a router subcommand
+type cliCommand struct {
+	usage string
+	valid func(args []string) bool // Checked before connecting to the router
+	run   func(ctx context.Context, backend cliBackend, args []string) (cliOutput, error)
+}
+
+// cliCommands are the subcommands that operate on the router
+var cliCommands = map[string]cliCommand{
+	"status": {
+		usage: "status",
+		valid: func(args []string) bool { return len(args) == 0 },
+		run:   runStatusCommand,
+	},
+	"route": {
+		usage: "route vpn|direct|<outbound>",
+		valid: func(args []string) bool { return len(args) == 1 && args[0] != "" },
+		run:   runRouteCommand,
+	},
+	"service": {
+		usage: "service start|stop|restart",
+		valid: func(args []string) bool {
+			_, ok := serviceActions[firstArg(args)]
+			return ok && len(args) == 1
+		},
+		run: runServiceCommand,
+	},
+	"rules": {
+		usage: "rules list",
+		valid: func(args []string) bool { return len(args) == 1 && args[0] == "list" },
+		run:   runRulesCommand,
+	},
+	"backup": {
+		usage: "backup list|restore <name>|latest",
+		valid: func(args []string) bool {
+			return (firstArg(args) == "list" && len(args) == 1) || (firstArg(args) == "restore" && len(args) == 2)
+		},
+		run: runBackupCommand,
+	},
+}
+
+// firstArg returns the first argument, or "" without arguments
+func firstArg(args []string) string {
+	if len(args) == 0 {
+		return ""
+	}
+	return args[0]
+}
+
+// cliOutput is a command result, encoded as-is for --output json or rendered as a table
+type cliOutput struct {
+	value  interface{}
+	header []string
+	rows   [][]string
+}
+
+// write renders the output in format
+func (o cliOutput) write(w io.Writer, format string) error {
+	if format == "json" {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(o.value)
+	}
+
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, strings.Join(o.header, "\t"))
+	for _, row := range o.rows {
+		fmt.Fprintln(table, strings.Join(row, "\t"))
+	}
+	return table.Flush()
+}
+
+// newCLIBackend connects to the API when apiURL is set and to the router over SSH otherwise
+func newCLIBackend(apiURL, token string, logger *logrus.Logger) (cliBackend, error) {
+	if apiURL != "" {
+		return &apiCLIBackend{client: client.New(apiURL, token)}, nil
+	}
+
+	// Best effort: the bot's settings usually live in .env
+	godotenv.Load()
+	for _, envVar := range []string{"ROUTER_HOST", "ROUTER_USERNAME", "ROUTER_PASSWORD"} {
+		if os.Getenv(envVar) == "" {
+			return nil, fmt.Errorf("%s is not set; set it or use --api", envVar)
+		}
+	}
+
+	sshClient, err := NewSSHClient(os.Getenv("ROUTER_HOST"), os.Getenv("ROUTER_USERNAME"), os.Getenv("ROUTER_PASSWORD"), logger)
+	if err != nil {
+		return nil, err
+	}
+	vpnManager := NewVPNManager(sshClient, logger)
+	if path := os.Getenv("XRAY_CONFIG_PATH"); path != "" {
+		vpnManager.SetConfigPath(path)
+	}
+	if path := os.Getenv("XRAY_OUTBOUNDS_PATH"); path != "" {
+		vpnManager.SetOutboundsPath(path)
+	}
+	return &sshCLIBackend{sshClient: sshClient, vpnManager: vpnManager}, nil
+}
+
+// runCLI runs a router subcommand and returns the exit code
+func runCLI(name string, args []string, stdout, stderr io.Writer) int {
+	command := cliCommands[name]
+
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() { fmt.Fprint(stderr, cliUsage) }
+	output := flags.String("output", "table", "Output format: json or table")
+	apiURL := flags.String("api", os.Getenv("VPN_COMMANDER_API_URL"), "Base URL of a running instance's API")
+	token := flags.String("token", os.Getenv("VPN_COMMANDER_API_TOKEN"), "API bearer token")
+	timeout := flags.Duration("timeout", 2*time.Minute, "Give up after this long")
+
+	positional, err := parseInterspersed(flags, args)
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return cliExitOK
+		}
+		return cliExitUsage
+	}
+	if *output != "json" && *output != "table" {
+		fmt.Fprintf(stderr, "invalid --output %q: use json or table\n", *output)
+		return cliExitUsage
+	}
+	if !command.valid(positional) {
+		fmt.Fprintln(stderr, "usage: vpn-commander "+command.usage)
+		return cliExitUsage
+	}
+
+	// Logs go to stderr so they never mix with the output
+	logger := logrus.New()
+	logger.SetOutput(stderr)
+	logger.SetLevel(logrus.WarnLevel)
+	if os.Getenv("LOG_LEVEL") == "debug" {
+		logger.SetLevel(logrus.DebugLevel)
+	}
+
+	backend, err := newCLIBackend(*apiURL, *token, logger)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		return cliExitFailure
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	ctx = withActor(ctx, Actor{Username: os.Getenv("USER"), Source: "cli"})
+
+	// The SSH client does not take a context, so the deadline is enforced here. A command that
+	// overruns it is abandoned, not closed, as closing would wait for it; exiting drops the connection
+	type commandResult struct {
+		output cliOutput
+		err    error
+	}
+	done := make(chan commandResult, 1)
+	go func() {
+		output, err := command.run(ctx, backend, positional)
+		done <- commandResult{output, err}
+	}()
+
+	var result cliOutput
+	select {
+	case finished := <-done:
+		backend.Close()
+		if finished.err != nil {
+			fmt.Fprintf(stderr, "Error: %v\n", finished.err)
+			return cliExitFailure
+		}
+		result = finished.output
+	case <-ctx.Done():
+		fmt.Fprintf(stderr, "Error: no answer within %s; a routing or service change may still have been applied\n", *timeout)
+		return cliExitFailure
+	}
+
+	if err := result.write(stdout, *output); err != nil {
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		return cliExitFailure
+	}
+	return cliExitOK
+}
+
+// parseInterspersed parses flags anywhere among args, so both
+// "route vpn --output json" and "route --output json vpn" work
+func parseInterspersed(flags *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := flags.Parse(args); err != nil {
+			return nil, err
+		}
+		rest := flags.Args()
+		if len(rest) == 0 {
+			return positional, nil
+		}
+		// Everything after "--" is positional
+		if consumed := len(args) - len(rest); consumed > 0 && args[consumed-1] == "--" {
+			return append(positional, rest...), nil
+		}
+		positional = append(positional, rest[0])
+		args = rest[1:]
+	}
+}
+
+// runStatusCommand shows the routing and service state
+func runStatusCommand(ctx context.Context, backend cliBackend, args []string) (cliOutput, error) {
+	status, err := backend.Status(ctx)
+	if err != nil {
+		return cliOutput{}, err
+	}
+	return cliOutput{
+		value:  status,
+		header: []string{"OUTBOUND", "MODE", "SERVICE"},
+		rows:   [][]string{{status.Outbound, status.Mode, string(status.Service)}},
+	}, nil
+}
+
+// runRouteCommand points the default rule at the VPN, direct or an outbound
+func runRouteCommand(ctx context.Context, backend cliBackend, args []string) (cliOutput, error) {
+	state, err := backend.Route(ctx, args[0])
+	if err != nil {
+		return cliOutput{}, err
+	}
+	return cliOutput{
+		value:  state,
+		header: []string{"OUTBOUND", "MODE"},
+		rows:   [][]string{{state.Outbound, state.Mode}},
+	}, nil
+}
+
+// runServiceCommand starts, stops or restarts the VPN service
+func runServiceCommand(ctx context.Context, backend cliBackend, args []string) (cliOutput, error) {
+	response, err := backend.Service(ctx, args[0])
+	if err != nil {
+		return cliOutput{}, err
+	}
+	return cliOutput{
+		value:  response,
+		header: []string{"ACTION", "STATE"},
+		rows:   [][]string{{response.Action, string(response.State)}},
+	}, nil
+}
+
+// runRulesCommand lists the routing rules
+func runRulesCommand(ctx context.Context, backend cliBackend, args []string) (cliOutput, error) {
+	rules, err := backend.Rules(ctx)
+	if err != nil {
+		return cliOutput{}, err
+	}
+
+	output := cliOutput{
+		value:  RulesResponse{Rules: rules},
+		header: []string{"#", "DEFAULT", "OUTBOUND", "MATCH"},
+	}
+	for _, rule := range rules {
+		isDefault := ""
+		if rule.Default {
+			isDefault = "*"
+		}
+		output.rows = append(output.rows, []string{strconv.Itoa(rule.Index), isDefault, rule.OutboundTag, describeRuleMatch(rule.Rule)})
+	}
+	return output, nil
+}
+
+// runBackupCommand lists or restores routing config backups
+func runBackupCommand(ctx context.Context, backend cliBackend, args []string) (cliOutput, error) {
+	header := []string{"NAME", "CREATED", "PATH"}
+	row := func(backup ConfigBackup) []string {
+		return []string{backup.Name, backup.CreatedAt.Format("2006-01-02 15:04:05"), backup.Path}
+	}
+
+	if args[0] == "list" {
+		backups, err := backend.Backups(ctx)
+		if err != nil {
+			return cliOutput{}, err
+		}
+		output := cliOutput{value: backups, header: header}
+		if backups == nil {
+			output.value = []ConfigBackup{}
+		}
+		for _, backup := range backups {
+			output.rows = append(output.rows, row(backup))
+		}
+		return output, nil
+	}
+
+	backup, err := backend.RestoreBackup(ctx, args[1])
+	if err != nil {
+		return cliOutput{}, err
+	}
+	return cliOutput{value: backup, header: header, rows: [][]string{row(backup)}}, nil
+}
+
+// describeRuleMatch summarises what a rule matches for the rules table
+func describeRuleMatch(rule Rule) string {
+	var parts []string
+	add := func(name string, value interface{}) {
+		switch v := value.(type) {
+		case nil:
+		case string:
+			if v != "" {
+				parts = append(parts, name+"="+v)
+			}
+		case []string:
+			if len(v) > 0 {
+				parts = append(parts, name+"="+strings.Join(v, ","))
+			}
+		case []interface{}:
+			values := make([]string, 0, len(v))
+			for _, item := range v {
+				values = append(values, fmt.Sprint(item))
+			}
+			if len(values) > 0 {
+				parts = append(parts, name+"="+strings.Join(values, ","))
+			}
+		default:
+			parts = append(parts, fmt.Sprintf("%s=%v", name, v))
+		}
+	}
+
+	add("inbound", rule.InboundTag)
+	add("network", rule.Network)
+	add("domain", rule.Domain)
+	add("ip", rule.IP)
+	add("port", rule.Port)
+	add("protocol", rule.Protocol)
+	if len(parts) == 0 {
+		return "*"
+	}
+	return strings.Join(parts, " ")
+}
+
+// sshCLIBackend runs commands directly on the router
+type sshCLIBackend struct {
+	sshClient  *SSHClient
+	vpnManager *VPNManager
+}
+
+func (b *sshCLIBackend) Status(ctx context.Context) (StatusResponse, error) {
+	outbound, err := b.vpnManager.GetActiveOutbound()
+	if err != nil {
+		return StatusResponse{}, err
+	}
+	service, err := b.vpnManager.GetServiceState()
+	if err != nil {
+		return StatusResponse{}, err
+	}
+	return StatusResponse{
+		RoutingState: RoutingState{Outbound: outbound, Mode: routingModeLabel(outbound)},
+		Service:      service,
+	}, nil
+}
+
+func (b *sshCLIBackend) Route(ctx context.Context, target string) (RoutingState, error) {
+	var err error
+	switch target {
+	case "vpn":
+		err = b.vpnManager.EnableVPN(ctx)
+	case "direct":
+		err = b.vpnManager.DisableVPN(ctx)
+	default:
+		// Writing an unknown tag would leave the router without a working default rule
+		if err = b.vpnManager.checkOutbound(target); err == nil {
+			err = b.vpnManager.SwitchOutbound(ctx, ActionSelectOutbound, target)
+		}
+	}
+	if err != nil {
+		return RoutingState{}, err
+	}
+
+	outbound, err := b.vpnManager.GetActiveOutbound()
+	if err != nil {
+		return RoutingState{}, err
+	}
+	return RoutingState{Outbound: outbound, Mode: routingModeLabel(outbound)}, nil
+}
+
+func (b *sshCLIBackend) Service(ctx context.Context, action string) (ServiceResponse, error) {
+	if err := b.vpnManager.Perform(ctx, serviceActions[action]); err != nil {
+		return ServiceResponse{}, err
+	}
+	state, err := b.vpnManager.GetServiceState()
+	if err != nil {
+		return ServiceResponse{}, err
+	}
+	return ServiceResponse{Action: action, State: state}, nil
+}
+
+func (b *sshCLIBackend) Rules(ctx context.Context) ([]RoutingRule, error) {
+	return listRoutingRules(b.vpnManager)
+}
+
+func (b *sshCLIBackend) Backups(ctx context.Context) ([]ConfigBackup, error) {
+	return b.vpnManager.ListBackups()
+}
+
+func (b *sshCLIBackend) RestoreBackup(ctx context.Context, name string) (ConfigBackup, error) {
+	return b.vpnManager.RestoreBackup(ctx, name)
+}
+
+func (b *sshCLIBackend) Close() error {
+	return b.sshClient.Disconnect()
+}
+
+// apiCLIBackend runs commands through a running instance's API, so they are audited and announced there
+type apiCLIBackend struct {
+	client *client.Client
+}
+
+func (b *apiCLIBackend) Status(ctx context.Context) (StatusResponse, error) {
+	status, err := b.client.GetStatus(ctx)
+	if err != nil {
+		return StatusResponse{}, err
+	}
+	return StatusResponse{
+		RoutingState: RoutingState{Outbound: status.Outbound, Mode: status.Mode},
+		Service:      ServiceState(status.Service),
+	}, nil
+}
+
+func (b *apiCLIBackend) Route(ctx context.Context, target string) (RoutingState, error) {
+	var state *client.RoutingState
+	var err error
+	switch target {
+	case "vpn", "direct":
+		state, err = b.client.SetMode(ctx, target)
+	default:
+		state, err = b.client.SetOutbound(ctx, target)
+	}
+	if err != nil {
+		return RoutingState{}, err
+	}
+	return RoutingState{Outbound: state.Outbound, Mode: state.Mode}, nil
+}
+
+func (b *apiCLIBackend) Service(ctx context.Context, action string) (ServiceResponse, error) {
+	response, err := b.client.ServiceAction(ctx, action)
+	if err != nil {
+		return ServiceResponse{}, err
+	}
+	return ServiceResponse{Action: response.Action, State: ServiceState(response.State)}, nil
+}
+
+func (b *apiCLIBackend) Rules(ctx context.Context) ([]RoutingRule, error) {
+	rules, err := b.client.GetRules(ctx)
+	if err != nil {
+		return nil, err
+	}
+	routingRules := make([]RoutingRule, 0, len(rules))
+	for _, rule := range rules {
+		routingRules = append(routingRules, RoutingRule{
+			Index:   rule.Index,
+			Default: rule.Default,
+			Rule: Rule{
+				Type:        rule.Type,
+				InboundTag:  rule.InboundTag,
+				OutboundTag: rule.OutboundTag,
+				Network:     rule.Network,
+				Domain:      rule.Domain,
+				IP:          rule.IP,
+				Port:        rule.Port,
+				Protocol:    rule.Protocol,
+			},
+		})
+	}
+	return routingRules, nil
+}
+
+func (b *apiCLIBackend) Backups(ctx context.Context) ([]ConfigBackup, error) {
+	return nil, errBackupsNeedSSH
+}
+
+func (b *apiCLIBackend) RestoreBackup(ctx context.Context, name string) (ConfigBackup, error) {
+	return ConfigBackup{}, errBackupsNeedSSH
+}
+
+func (b *apiCLIBackend) Close() error {
+	return nil
+}
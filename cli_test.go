@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// startFakeAPI serves canned API responses, recording the requests it receives
+func startFakeAPI(t *testing.T) (string, *[]string) {
+	t.Helper()
+
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body bytes.Buffer
+		body.ReadFrom(r.Body)
+		requests = append(requests, strings.TrimSpace(r.Method+" "+r.URL.Path+" "+body.String()))
+
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			writeAPIError(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+		switch r.URL.Path {
+		case "/api/v1/status":
+			writeJSON(w, http.StatusOK, StatusResponse{RoutingState: RoutingState{Outbound: "direct", Mode: "direct"}, Service: ServiceStateRunning})
+		case "/api/v1/routing":
+			writeJSON(w, http.StatusOK, RoutingState{Outbound: "vless-reality", Mode: "vpn"})
+		case "/api/v1/service/stop":
+			writeJSON(w, http.StatusOK, ServiceResponse{Action: "stop", State: ServiceStateStopped})
+		case "/api/v1/rules":
+			writeJSON(w, http.StatusOK, RulesResponse{Rules: []RoutingRule{
+				{Index: 0, Rule: Rule{Type: "field", Domain: []string{"geosite:ru"}, OutboundTag: "direct"}},
+				{Index: 1, Default: true, Rule: Rule{Type: "field", InboundTag: []string{"redirect", "tproxy"}, Network: "tcp,udp", OutboundTag: "vless-reality"}},
+			}})
+		default:
+			writeAPIError(w, http.StatusBadGateway, "router unreachable")
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server.URL, &requests
+}
+
+func runDispatch(args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	code := dispatch(args, &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestCLIThroughAPI(t *testing.T) {
+	url, requests := startFakeAPI(t)
+	t.Setenv("VPN_COMMANDER_API_URL", url)
+	t.Setenv("VPN_COMMANDER_API_TOKEN", "secret")
+
+	t.Run("status table", func(t *testing.T) {
+		code, stdout, stderr := runDispatch("status")
+		if code != cliExitOK {
+			t.Fatalf("Expected exit code 0, got %d: %s", code, stderr)
+		}
+		lines := strings.Split(strings.TrimSpace(stdout), "\n")
+		if len(lines) != 2 || !strings.HasPrefix(lines[0], "OUTBOUND") || strings.Join(strings.Fields(lines[1]), " ") != "direct direct running" {
+			t.Errorf("Unexpected table:\n%s", stdout)
+		}
+	})
+
+	t.Run("route with trailing flag", func(t *testing.T) {
+		*requests = nil
+		code, stdout, stderr := runDispatch("route", "vpn", "--output", "json")
+		if code != cliExitOK {
+			t.Fatalf("Expected exit code 0, got %d: %s", code, stderr)
+		}
+		if len(*requests) != 1 || (*requests)[0] != `PUT /api/v1/routing {"mode":"vpn"}` {
+			t.Errorf("Unexpected requests %q", *requests)
+		}
+		var state RoutingState
+		if err := json.Unmarshal([]byte(stdout), &state); err != nil || state.Outbound != "vless-reality" {
+			t.Errorf("Unexpected JSON output %q (%v)", stdout, err)
+		}
+	})
+
+	t.Run("route to an outbound", func(t *testing.T) {
+		*requests = nil
+		if code, _, stderr := runDispatch("route", "--output=json", "warp"); code != cliExitOK {
+			t.Fatalf("Expected exit code 0, got %d: %s", code, stderr)
+		}
+		if len(*requests) != 1 || (*requests)[0] != `PUT /api/v1/routing {"outbound":"warp"}` {
+			t.Errorf("Unexpected requests %q", *requests)
+		}
+	})
+
+	t.Run("service", func(t *testing.T) {
+		code, stdout, _ := runDispatch("service", "stop")
+		if code != cliExitOK || !strings.Contains(stdout, "stopped") {
+			t.Errorf("Unexpected result %d %q", code, stdout)
+		}
+	})
+
+	t.Run("rules list", func(t *testing.T) {
+		code, stdout, _ := runDispatch("rules", "list")
+		if code != cliExitOK {
+			t.Fatalf("Expected exit code 0, got %d", code)
+		}
+		if !strings.Contains(stdout, "domain=geosite:ru") || !strings.Contains(stdout, "inbound=redirect,tproxy network=tcp,udp") {
+			t.Errorf("Unexpected rules table:\n%s", stdout)
+		}
+	})
+
+	t.Run("backups need SSH", func(t *testing.T) {
+		code, _, stderr := runDispatch("backup", "list")
+		if code != cliExitFailure || !strings.Contains(stderr, "only available over SSH") {
+			t.Errorf("Unexpected result %d %q", code, stderr)
+		}
+	})
+
+	t.Run("API errors", func(t *testing.T) {
+		code, _, stderr := runDispatch("status", "--token", "wrong")
+		if code != cliExitFailure || !strings.Contains(stderr, "401 unauthorized") {
+			t.Errorf("Unexpected result %d %q", code, stderr)
+		}
+	})
+}
+
+func TestCLIRouteRejectsUnknownOutbound(t *testing.T) {
+	vm, router := newFakeRouterManager(t, "direct")
+	backend := &sshCLIBackend{vpnManager: vm}
+
+	if _, err := backend.Route(context.Background(), "vless-typo"); !errors.Is(err, errUnknownOutbound) {
+		t.Errorf("Expected an unknown outbound error, got %v", err)
+	}
+	if outbound, _ := vm.GetActiveOutbound(); outbound != "direct" || router.Restarts() != 0 {
+		t.Errorf("Expected the routing to be left alone, got %q after %d restarts", outbound, router.Restarts())
+	}
+
+	state, err := backend.Route(context.Background(), "vless-reality")
+	if err != nil || state.Outbound != "vless-reality" {
+		t.Errorf("Expected a configured outbound to be accepted, got %+v (%v)", state, err)
+	}
+}
+
+func TestCLIUsageErrors(t *testing.T) {
+	url, requests := startFakeAPI(t)
+	t.Setenv("VPN_COMMANDER_API_URL", url)
+
+	tests := [][]string{
+		{"unknown"},
+		{"status", "extra"},
+		{"route"},
+		{"route", "vpn", "direct"},
+		{"service", "reboot"},
+		{"rules"},
+		{"backup", "restore"},
+		{"status", "--output", "yaml"},
+		{"status", "--bogus"},
+	}
+	for _, args := range tests {
+		code, _, stderr := runDispatch(args...)
+		if code != cliExitUsage {
+			t.Errorf("%q: expected exit code %d, got %d", args, cliExitUsage, code)
+		}
+		if stderr == "" {
+			t.Errorf("%q: expected usage on stderr", args)
+		}
+	}
+	if len(*requests) != 0 {
+		t.Errorf("Invalid commands must not reach the API, got %q", *requests)
+	}
+
+	if code, stdout, _ := runDispatch("help"); code != cliExitOK || !strings.Contains(stdout, "backup restore") {
+		t.Errorf("Unexpected help %d %q", code, stdout)
+	}
+}
+
+func TestCLIRequiresRouterSettings(t *testing.T) {
+	t.Setenv("VPN_COMMANDER_API_URL", "")
+	t.Setenv("ROUTER_HOST", "")
+
+	code, _, stderr := runDispatch("status")
+	if code != cliExitFailure || !strings.Contains(stderr, "ROUTER_HOST is not set") {
+		t.Errorf("Unexpected result %d %q", code, stderr)
+	}
+
+	// Invalid arguments are reported before connecting
+	if code, _, stderr := runDispatch("route"); code != cliExitUsage || !strings.Contains(stderr, "usage: vpn-commander route") {
+		t.Errorf("Unexpected result %d %q", code, stderr)
+	}
+}
+
+func TestCLITimeoutOverSSH(t *testing.T) {
+	// A router that accepts the connection but never completes the SSH handshake
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	accepted := make(chan net.Conn, 1)
+	t.Cleanup(func() {
+		listener.Close()
+		// Closing the connection ends the abandoned handshake
+		select {
+		case conn := <-accepted:
+			conn.Close()
+		default:
+		}
+	})
+	go func() {
+		if conn, err := listener.Accept(); err == nil {
+			accepted <- conn
+		}
+	}()
+
+	t.Setenv("VPN_COMMANDER_API_URL", "")
+	t.Setenv("ROUTER_HOST", listener.Addr().String())
+	t.Setenv("ROUTER_USERNAME", "user")
+	t.Setenv("ROUTER_PASSWORD", "password")
+
+	started := time.Now()
+	code, _, stderr := runDispatch("status", "--timeout", "200ms")
+	if code != cliExitFailure || !strings.Contains(stderr, "no answer within 200ms") {
+		t.Errorf("Unexpected result %d %q", code, stderr)
+	}
+	if elapsed := time.Since(started); elapsed > 5*time.Second {
+		t.Errorf("Expected --timeout to bound the SSH command, took %s", elapsed)
+	}
+}
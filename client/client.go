@@ -0,0 +1,201 @@
+// Package client is a Go client for the vpn-commander REST API described by openapi.json
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Routing modes accepted by SetMode
+const (
+	ModeVPN    = "vpn"
+	ModeDirect = "direct"
+)
+
+// Service actions accepted by ServiceAction
+const (
+	ServiceStart   = "start"
+	ServiceStop    = "stop"
+	ServiceRestart = "restart"
+)
+
+// RoutingState is the routing of the default rule
+type RoutingState struct {
+	Outbound string `json:"outbound"`
+	Mode     string `json:"mode"` // "vpn", "direct" or "other"
+}
+
+// Status is the routing of the default rule and the service state
+type Status struct {
+	RoutingState
+	Service string `json:"service"` // "running", "stopped" or "unknown"
+}
+
+// RoutingRequest changes the default rule; exactly one of the fields must be set
+type RoutingRequest struct {
+	Mode     string `json:"mode,omitempty"`
+	Outbound string `json:"outbound,omitempty"`
+}
+
+// ServiceResponse reports the service state after a service action
+type ServiceResponse struct {
+	Action string `json:"action"`
+	State  string `json:"state"` // "running", "stopped" or "unknown"
+}
+
+// RoutingRule is a routing rule with its position in the configuration
+type RoutingRule struct {
+	Index       int         `json:"index"`
+	Default     bool        `json:"default"` // Whether this is the rule the bot switches
+	Type        string      `json:"type,omitempty"`
+	InboundTag  []string    `json:"inboundTag,omitempty"`
+	OutboundTag string      `json:"outboundTag,omitempty"`
+	Network     string      `json:"network,omitempty"`
+	Domain      interface{} `json:"domain,omitempty"`
+	IP          interface{} `json:"ip,omitempty"`
+	Port        string      `json:"port,omitempty"`
+	Protocol    interface{} `json:"protocol,omitempty"`
+}
+
+// RulesResponse lists the routing rules
+type RulesResponse struct {
+	Rules []RoutingRule `json:"rules"`
+}
+
+// Error is returned for every non-2xx response
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+// Error implements the error interface
+func (e *Error) Error() string {
+	return fmt.Sprintf("vpn-commander API: %d %s", e.StatusCode, e.Message)
+}
+
+// Client calls the vpn-commander API
+type Client struct {
+	BaseURL    string       // e.g. "https://router-bot:8443"
+	Token      string       // Bearer token; empty when authenticating with a client certificate
+	HTTPClient *http.Client // Set a custom client for TLS client certificates
+}
+
+// New creates a client for the API at baseURL authenticating with token
+func New(baseURL, token string) *Client {
+	return &Client{
+		BaseURL:    strings.TrimRight(baseURL, "/"),
+		Token:      token,
+		HTTPClient: &http.Client{Timeout: 60 * time.Second},
+	}
+}
+
+// GetStatus returns the routing of the default rule and the service state
+func (c *Client) GetStatus(ctx context.Context) (*Status, error) {
+	var status Status
+	if err := c.do(ctx, http.MethodGet, "/api/v1/status", nil, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// GetRouting returns the outbound of the default rule
+func (c *Client) GetRouting(ctx context.Context) (*RoutingState, error) {
+	var state RoutingState
+	if err := c.do(ctx, http.MethodGet, "/api/v1/routing", nil, &state); err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+// SetRouting changes the default rule and returns the resulting routing
+func (c *Client) SetRouting(ctx context.Context, request RoutingRequest) (*RoutingState, error) {
+	var state RoutingState
+	if err := c.do(ctx, http.MethodPut, "/api/v1/routing", request, &state); err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+// SetMode routes traffic through the VPN (ModeVPN) or directly (ModeDirect)
+func (c *Client) SetMode(ctx context.Context, mode string) (*RoutingState, error) {
+	return c.SetRouting(ctx, RoutingRequest{Mode: mode})
+}
+
+// SetOutbound points the default rule at a configured outbound; unknown tags are rejected
+func (c *Client) SetOutbound(ctx context.Context, outbound string) (*RoutingState, error) {
+	return c.SetRouting(ctx, RoutingRequest{Outbound: outbound})
+}
+
+// ServiceAction starts, stops or restarts the VPN service
+func (c *Client) ServiceAction(ctx context.Context, action string) (*ServiceResponse, error) {
+	var response ServiceResponse
+	if err := c.do(ctx, http.MethodPost, "/api/v1/service/"+action, nil, &response); err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+// GetRules lists the routing rules in order
+func (c *Client) GetRules(ctx context.Context) ([]RoutingRule, error) {
+	var response RulesResponse
+	if err := c.do(ctx, http.MethodGet, "/api/v1/rules", nil, &response); err != nil {
+		return nil, err
+	}
+	return response.Rules, nil
+}
+
+// do sends a request with an optional JSON body and decodes the JSON response into out
+func (c *Client) do(ctx context.Context, method, path string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to encode request: %w", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, method, c.BaseURL+path, reader)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+	request.Header.Set("Accept", "application/json")
+	if c.Token != "" {
+		request.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	response, err := httpClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		apiErr := &Error{StatusCode: response.StatusCode, Message: http.StatusText(response.StatusCode)}
+		var payload struct {
+			Error string `json:"error"`
+		}
+		if json.NewDecoder(response.Body).Decode(&payload) == nil && payload.Error != "" {
+			apiErr.Message = payload.Error
+		}
+		return apiErr
+	}
+
+	if err := json.NewDecoder(response.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientRequests(t *testing.T) {
+	var method, path, auth string
+	var body RoutingRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method, path, auth = r.Method, r.URL.Path, r.Header.Get("Authorization")
+		body = RoutingRequest{}
+		if r.Body != nil {
+			json.NewDecoder(r.Body).Decode(&body)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/api/v1/status":
+			w.Write([]byte(`{"outbound":"direct","mode":"direct","service":"stopped"}`))
+		case "/api/v1/routing":
+			w.Write([]byte(`{"outbound":"vless-reality","mode":"vpn"}`))
+		case "/api/v1/service/restart":
+			w.Write([]byte(`{"action":"restart","state":"running"}`))
+		case "/api/v1/rules":
+			w.Write([]byte(`{"rules":[{"index":0,"default":true,"type":"field","inboundTag":["redirect"],"outboundTag":"direct"}]}`))
+		}
+	}))
+	defer server.Close()
+
+	c := New(server.URL+"/", "secret")
+	ctx := context.Background()
+
+	state, err := c.SetMode(ctx, ModeVPN)
+	if err != nil {
+		t.Fatalf("SetMode failed: %v", err)
+	}
+	if method != http.MethodPut || path != "/api/v1/routing" || body.Mode != ModeVPN || body.Outbound != "" {
+		t.Errorf("Unexpected request %s %s %+v", method, path, body)
+	}
+	if auth != "Bearer secret" {
+		t.Errorf("Expected bearer token, got %q", auth)
+	}
+	if state.Outbound != "vless-reality" || state.Mode != "vpn" {
+		t.Errorf("Unexpected state %+v", state)
+	}
+
+	status, err := c.GetStatus(ctx)
+	if err != nil {
+		t.Fatalf("GetStatus failed: %v", err)
+	}
+	if method != http.MethodGet || status.Outbound != "direct" || status.Mode != "direct" || status.Service != "stopped" {
+		t.Errorf("Unexpected status call %s %+v", method, status)
+	}
+
+	service, err := c.ServiceAction(ctx, ServiceRestart)
+	if err != nil {
+		t.Fatalf("ServiceAction failed: %v", err)
+	}
+	if method != http.MethodPost || service.Action != "restart" || service.State != "running" {
+		t.Errorf("Unexpected service call %s %+v", method, service)
+	}
+
+	rules, err := c.GetRules(ctx)
+	if err != nil {
+		t.Fatalf("GetRules failed: %v", err)
+	}
+	if len(rules) != 1 || !rules[0].Default || rules[0].OutboundTag != "direct" || rules[0].InboundTag[0] != "redirect" {
+		t.Errorf("Unexpected rules %+v", rules)
+	}
+}
+
+func TestClientErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/v1/rules" {
+			w.WriteHeader(http.StatusBadGateway)
+			w.Write([]byte("not json"))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"error":"unauthorized"}`))
+	}))
+	defer server.Close()
+
+	c := New(server.URL, "wrong")
+
+	_, err := c.GetRouting(context.Background())
+	var apiErr *Error
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnauthorized || apiErr.Message != "unauthorized" {
+		t.Errorf("Expected a 401 API error, got %v", err)
+	}
+
+	// A body without an error field falls back to the status text
+	_, err = c.GetRules(context.Background())
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadGateway || apiErr.Message != "Bad Gateway" {
+		t.Errorf("Expected a 502 API error, got %v", err)
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// getEnv returns the value of an environment variable or a default
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+// getEnvBool parses a boolean environment variable, falling back to a default
+func getEnvBool(key string, defaultValue bool, logger *logrus.Logger) bool {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		logger.WithField("variable", key).Warn("Invalid boolean value, using default")
+		return defaultValue
+	}
+	return parsed
+}
+
+// getEnvInt parses an integer environment variable, falling back to a default
+func getEnvInt(key string, defaultValue int, logger *logrus.Logger) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		logger.WithField("variable", key).Warn("Invalid integer value, using default")
+		return defaultValue
+	}
+	return parsed
+}
+
+// getEnvDuration parses a duration environment variable (e.g. "5m"), falling back to a default
+func getEnvDuration(key string, defaultValue time.Duration, logger *logrus.Logger) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		logger.WithField("variable", key).Warn("Invalid duration value, using default")
+		return defaultValue
+	}
+	return parsed
+}
+
+// getEnvList splits a comma-separated environment variable into trimmed, non-empty items
+func getEnvList(key, defaultValue string) []string {
+	var items []string
+	for _, item := range strings.Split(getEnv(key, defaultValue), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// parseUserIDs converts a list of Telegram user IDs
+func parseUserIDs(values []string) ([]int64, error) {
+	userIDs := make([]int64, 0, len(values))
+	for _, value := range values {
+		userID, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid user ID %q: %w", value, err)
+		}
+		userIDs = append(userIDs, userID)
+	}
+	return userIDs, nil
+}
@@ -0,0 +1,317 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// FailoverConfig configures the VPN health prober
+type FailoverConfig struct {
+	Interval          time.Duration // How often the VPN outbound is probed
+	FailureThreshold  int           // Consecutive failed probes before failing over
+	RecoveryThreshold int           // Consecutive successful probes before failing back
+	PrimaryOutbound   string        // Outbound the default rule normally uses
+	FallbackOutbound  string        // Outbound used while the primary is down
+	SocksAddress      string        // Router-local socks inbound that is always routed through the primary outbound
+	ProbeURL          string        // URL fetched through the socks inbound
+	ProbeTimeout      time.Duration // Maximum time a single probe may take
+}
+
+// withDefaults fills unset fields with sensible values
+func (c FailoverConfig) withDefaults() FailoverConfig {
+	if c.Interval <= 0 {
+		c.Interval = time.Minute
+	}
+	if c.FailureThreshold <= 0 {
+		c.FailureThreshold = 3
+	}
+	if c.RecoveryThreshold <= 0 {
+		c.RecoveryThreshold = 3
+	}
+	if c.PrimaryOutbound == "" {
+		c.PrimaryOutbound = "vless-reality"
+	}
+	if c.FallbackOutbound == "" {
+		c.FallbackOutbound = "direct"
+	}
+	if c.SocksAddress == "" {
+		c.SocksAddress = "127.0.0.1:10808"
+	}
+	if c.ProbeURL == "" {
+		c.ProbeURL = "https://www.gstatic.com/generate_204"
+	}
+	if c.ProbeTimeout <= 0 {
+		c.ProbeTimeout = 10 * time.Second
+	}
+	return c
+}
+
+// FailoverEvent describes a switch made, or attempted, by the prober
+type FailoverEvent struct {
+	Action   Action // ActionFailover or ActionFailback
+	From     string
+	To       string
+	Failures int    // Consecutive failed probes that triggered a failover
+	LastErr  string // Error of the last failed probe
+	Err      error  // Error switching the outbound, if any
+}
+
+// FailoverState is the prober state persisted across restarts
+type FailoverState struct {
+	Active bool      `json:"active"` // Whether the default rule was switched to the fallback outbound
+	Since  time.Time `json:"since,omitempty"`
+}
+
+// HealthProber probes the primary outbound and fails over to a fallback outbound while it is down
+type HealthProber struct {
+	path       string
+	config     FailoverConfig
+	router     RouterClient
+	vpnManager *VPNManager
+	logger     *logrus.Logger
+	state      FailoverState
+	failures   int
+	successes  int
+	lastErr    error
+	lastProbe  time.Time
+	notify     func(event FailoverEvent)
+	mutex      sync.Mutex // Guards the state and counters; never held across router I/O
+	checking   sync.Mutex // Serializes checks, held while the router is switched
+	now        func() time.Time
+
+	// Router access, replaceable in tests
+	probe          func(ctx context.Context) error
+	activeOutbound func() (string, error)
+	switchOutbound func(ctx context.Context, action Action, outboundTag string) error
+}
+
+// NewHealthProber creates a prober persisting its failover state to path
+func NewHealthProber(path string, config FailoverConfig, router RouterClient, vpnManager *VPNManager, logger *logrus.Logger) (*HealthProber, error) {
+	hp := &HealthProber{
+		path:       path,
+		config:     config.withDefaults(),
+		router:     router,
+		vpnManager: vpnManager,
+		logger:     logger,
+		now:        time.Now,
+	}
+	hp.probe = hp.probeThroughSocks
+	hp.activeOutbound = vpnManager.GetActiveOutbound
+	hp.switchOutbound = vpnManager.SwitchOutbound
+
+	if err := loadJSONFile(path, &hp.state); err != nil {
+		return nil, fmt.Errorf("failed to load failover state: %w", err)
+	}
+
+	return hp, nil
+}
+
+// SetNotifier registers a callback invoked after every switch attempt
+func (hp *HealthProber) SetNotifier(notify func(event FailoverEvent)) {
+	hp.mutex.Lock()
+	defer hp.mutex.Unlock()
+	hp.notify = notify
+}
+
+// Status returns whether the prober has failed over, and since when
+func (hp *HealthProber) Status() FailoverState {
+	if hp == nil {
+		return FailoverState{}
+	}
+
+	hp.mutex.Lock()
+	defer hp.mutex.Unlock()
+	return hp.state
+}
+
+// Run probes every interval until ctx is cancelled
+func (hp *HealthProber) Run(ctx context.Context) {
+	hp.logger.WithFields(logrus.Fields{
+		"interval":           hp.config.Interval,
+		"failure_threshold":  hp.config.FailureThreshold,
+		"recovery_threshold": hp.config.RecoveryThreshold,
+		"fallback_outbound":  hp.config.FallbackOutbound,
+		"failed_over":        hp.state.Active,
+	}).Info("Health prober started")
+
+	ticker := time.NewTicker(hp.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			hp.Check(ctx)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Check runs one probe and fails over or back once a threshold is reached
+// The router is switched without holding hp.mutex, so Status never waits on SSH
+func (hp *HealthProber) Check(ctx context.Context) {
+	hp.checking.Lock()
+	defer hp.checking.Unlock()
+
+	probeCtx, cancel := context.WithTimeout(ctx, hp.config.ProbeTimeout+5*time.Second)
+	err := hp.probe(probeCtx)
+	cancel()
+
+	hp.mutex.Lock()
+	hp.lastProbe = hp.now()
+	hp.lastErr = err
+	if err != nil {
+		hp.failures++
+		hp.successes = 0
+		hp.logger.WithError(err).WithField("failures", hp.failures).Warn("VPN health probe failed")
+	} else {
+		hp.successes++
+		hp.failures = 0
+		hp.logger.WithField("successes", hp.successes).Debug("VPN health probe succeeded")
+	}
+	failOver := !hp.state.Active && hp.failures >= hp.config.FailureThreshold
+	failBack := hp.state.Active && hp.successes >= hp.config.RecoveryThreshold
+	failures := hp.failures
+	hp.mutex.Unlock()
+
+	var event *FailoverEvent
+	switch {
+	case failOver:
+		event = hp.failover(ctx, failures, err)
+	case failBack:
+		event = hp.failback(ctx)
+	}
+
+	hp.mutex.Lock()
+	notify := hp.notify
+	hp.mutex.Unlock()
+
+	if event != nil && notify != nil {
+		notify(*event)
+	}
+}
+
+// failover switches the default rule to the fallback outbound if it still uses the primary one
+// Caller must hold hp.checking but not hp.mutex
+func (hp *HealthProber) failover(ctx context.Context, failures int, lastErr error) *FailoverEvent {
+	current, err := hp.activeOutbound()
+	if err != nil {
+		hp.logger.WithError(err).Error("Failover skipped: could not read the active outbound")
+		return nil
+	}
+	if current != hp.config.PrimaryOutbound {
+		// Someone already chose another outbound; the tunnel being down does not affect it
+		hp.logger.WithField("outbound", current).Debug("Failover skipped: primary outbound not in use")
+		return nil
+	}
+
+	event := &FailoverEvent{
+		Action:   ActionFailover,
+		From:     current,
+		To:       hp.config.FallbackOutbound,
+		Failures: failures,
+	}
+	if lastErr != nil {
+		event.LastErr = lastErr.Error()
+	}
+
+	event.Err = hp.switchOutbound(withActor(ctx, Actor{Source: "failover"}), ActionFailover, hp.config.FallbackOutbound)
+
+	hp.mutex.Lock()
+	defer hp.mutex.Unlock()
+	if event.Err != nil {
+		hp.logger.WithError(event.Err).Error("Failover failed")
+		// Retry on the next failed probe rather than waiting for another full threshold
+		hp.failures = hp.config.FailureThreshold - 1
+		return event
+	}
+
+	hp.setState(FailoverState{Active: true, Since: hp.now()})
+	hp.logger.WithFields(logrus.Fields{
+		"from": event.From,
+		"to":   event.To,
+	}).Warn("VPN outbound is down, failed over")
+	return event
+}
+
+// failback restores the primary outbound unless the routing was changed by hand meanwhile
+// Caller must hold hp.checking but not hp.mutex
+func (hp *HealthProber) failback(ctx context.Context) *FailoverEvent {
+	current, err := hp.activeOutbound()
+	if err != nil {
+		hp.logger.WithError(err).Error("Failback skipped: could not read the active outbound")
+		return nil
+	}
+	if current != hp.config.FallbackOutbound {
+		// Routing was changed by hand while failed over; leave it alone
+		hp.logger.WithField("outbound", current).Info("Failover ended without failback: routing was changed meanwhile")
+		hp.mutex.Lock()
+		hp.setState(FailoverState{})
+		hp.mutex.Unlock()
+		return nil
+	}
+
+	event := &FailoverEvent{
+		Action: ActionFailback,
+		From:   current,
+		To:     hp.config.PrimaryOutbound,
+	}
+	event.Err = hp.switchOutbound(withActor(ctx, Actor{Source: "failover"}), ActionFailback, hp.config.PrimaryOutbound)
+
+	hp.mutex.Lock()
+	defer hp.mutex.Unlock()
+	if event.Err != nil {
+		hp.logger.WithError(event.Err).Error("Failback failed")
+		hp.successes = hp.config.RecoveryThreshold - 1
+		return event
+	}
+
+	hp.setState(FailoverState{})
+	hp.logger.WithField("outbound", event.To).Info("VPN outbound recovered, failed back")
+	return event
+}
+
+// setState updates and persists the failover state
+// Caller must hold hp.mutex
+func (hp *HealthProber) setState(state FailoverState) {
+	hp.state = state
+	if err := saveJSONFile(hp.path, hp.state); err != nil {
+		hp.logger.WithError(err).Error("Failed to save failover state")
+	}
+}
+
+// probeThroughSocks fetches the probe URL on the router through the socks inbound
+func (hp *HealthProber) probeThroughSocks(ctx context.Context) error {
+	command := fmt.Sprintf("curl -s -o /dev/null -w '%%{http_code}' -m %d --socks5-hostname %s '%s'",
+		int(hp.config.ProbeTimeout.Seconds()), hp.config.SocksAddress, hp.config.ProbeURL)
+
+	output, err := hp.router.ExecuteCommand(command)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return parseProbeOutput(output, err)
+}
+
+// parseProbeOutput interprets the HTTP status printed by curl; curl prints 000 when no response arrived
+func parseProbeOutput(output string, err error) error {
+	code, convErr := strconv.Atoi(strings.TrimSpace(output))
+	if convErr != nil {
+		if err != nil {
+			return fmt.Errorf("probe command failed: %w", err)
+		}
+		return fmt.Errorf("unexpected probe output %q", strings.TrimSpace(output))
+	}
+	if code == 0 {
+		return fmt.Errorf("no response through the VPN outbound")
+	}
+	if code >= 500 {
+		return fmt.Errorf("probe returned HTTP %d", code)
+	}
+	return nil
+}
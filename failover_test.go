@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// fakeFailoverRouter stands in for the router behind a HealthProber
+type fakeFailoverRouter struct {
+	outbound  string
+	probeErr  error
+	switchErr error
+	switches  []Action
+}
+
+func newTestHealthProber(t *testing.T, path string, router *fakeFailoverRouter) (*HealthProber, *[]FailoverEvent) {
+	t.Helper()
+
+	vm := newOfflineVPNManager(t)
+	hp, err := NewHealthProber(path, FailoverConfig{FailureThreshold: 3, RecoveryThreshold: 2}, vm.router, vm, vm.logger)
+	if err != nil {
+		t.Fatalf("NewHealthProber failed: %v", err)
+	}
+
+	hp.probe = func(ctx context.Context) error { return router.probeErr }
+	hp.activeOutbound = func() (string, error) { return router.outbound, nil }
+	hp.switchOutbound = func(ctx context.Context, action Action, outboundTag string) error {
+		if actor := actorFromContext(ctx); actor.Source != "failover" {
+			t.Errorf("Expected actor source failover, got %q", actor.Source)
+		}
+		router.switches = append(router.switches, action)
+		if router.switchErr != nil {
+			return router.switchErr
+		}
+		router.outbound = outboundTag
+		return nil
+	}
+
+	var events []FailoverEvent
+	hp.SetNotifier(func(event FailoverEvent) { events = append(events, event) })
+	return hp, &events
+}
+
+func checkTimes(hp *HealthProber, n int) {
+	for i := 0; i < n; i++ {
+		hp.Check(context.Background())
+	}
+}
+
+func TestHealthProberFailoverAndBack(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "failover.json")
+	router := &fakeFailoverRouter{outbound: "vless-reality", probeErr: errors.New("timeout")}
+	hp, events := newTestHealthProber(t, path, router)
+
+	checkTimes(hp, 2)
+	if len(router.switches) != 0 {
+		t.Fatalf("Failed over before the threshold: %v", router.switches)
+	}
+
+	checkTimes(hp, 1)
+	if router.outbound != "direct" || !hp.Status().Active {
+		t.Fatalf("Expected failover to direct, outbound=%s state=%+v", router.outbound, hp.Status())
+	}
+	if len(*events) != 1 || (*events)[0].Action != ActionFailover || (*events)[0].Failures != 3 {
+		t.Fatalf("Unexpected events: %+v", *events)
+	}
+
+	// Hysteresis: a single success followed by a failure does not fail back
+	router.probeErr = nil
+	checkTimes(hp, 1)
+	router.probeErr = errors.New("timeout")
+	checkTimes(hp, 1)
+	router.probeErr = nil
+	checkTimes(hp, 1)
+	if router.outbound != "direct" {
+		t.Fatal("Failed back before the recovery threshold")
+	}
+
+	checkTimes(hp, 1)
+	if router.outbound != "vless-reality" || hp.Status().Active {
+		t.Fatalf("Expected failback, outbound=%s state=%+v", router.outbound, hp.Status())
+	}
+	if len(*events) != 2 || (*events)[1].Action != ActionFailback {
+		t.Fatalf("Unexpected events: %+v", *events)
+	}
+}
+
+func TestHealthProberIgnoresDirectRouting(t *testing.T) {
+	router := &fakeFailoverRouter{outbound: "direct", probeErr: errors.New("timeout")}
+	hp, events := newTestHealthProber(t, filepath.Join(t.TempDir(), "failover.json"), router)
+
+	checkTimes(hp, 5)
+	if len(router.switches) != 0 || len(*events) != 0 || hp.Status().Active {
+		t.Errorf("Expected no failover while routing is direct, switches=%v", router.switches)
+	}
+}
+
+func TestHealthProberLeavesManualChangeAlone(t *testing.T) {
+	router := &fakeFailoverRouter{outbound: "vless-reality", probeErr: errors.New("timeout")}
+	hp, _ := newTestHealthProber(t, filepath.Join(t.TempDir(), "failover.json"), router)
+
+	checkTimes(hp, 3)
+	router.outbound = "other-vpn" // Switched by hand while failed over
+	router.probeErr = nil
+	checkTimes(hp, 2)
+
+	if router.outbound != "other-vpn" || hp.Status().Active {
+		t.Errorf("Expected the manual change to stick and failover to end, outbound=%s state=%+v", router.outbound, hp.Status())
+	}
+	if len(router.switches) != 1 {
+		t.Errorf("Expected only the failover switch, got %v", router.switches)
+	}
+}
+
+func TestHealthProberRetriesFailedSwitch(t *testing.T) {
+	router := &fakeFailoverRouter{outbound: "vless-reality", probeErr: errors.New("timeout"), switchErr: errors.New("ssh down")}
+	hp, events := newTestHealthProber(t, filepath.Join(t.TempDir(), "failover.json"), router)
+
+	checkTimes(hp, 3)
+	if len(*events) != 1 || (*events)[0].Err == nil || hp.Status().Active {
+		t.Fatalf("Expected a failed failover event, got %+v", *events)
+	}
+
+	router.switchErr = nil
+	checkTimes(hp, 1)
+	if router.outbound != "direct" {
+		t.Errorf("Expected failover to be retried on the next failed probe, outbound=%s", router.outbound)
+	}
+}
+
+func TestHealthProberStatusDuringSwitch(t *testing.T) {
+	router := &fakeFailoverRouter{outbound: "vless-reality", probeErr: errors.New("timeout")}
+	hp, _ := newTestHealthProber(t, filepath.Join(t.TempDir(), "failover.json"), router)
+	checkTimes(hp, 2)
+
+	// A slow router must not stall dashboards reading the status
+	switching := make(chan struct{})
+	release := make(chan struct{})
+	hp.switchOutbound = func(ctx context.Context, action Action, outboundTag string) error {
+		close(switching)
+		<-release
+		router.outbound = outboundTag
+		return nil
+	}
+	done := make(chan struct{})
+	go func() {
+		hp.Check(context.Background())
+		close(done)
+	}()
+	<-switching
+
+	status := make(chan FailoverState)
+	go func() { status <- hp.Status() }()
+	select {
+	case state := <-status:
+		if state.Active {
+			t.Error("Expected the failover to be recorded only after the switch")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Status blocked while the outbound was being switched")
+	}
+
+	close(release)
+	<-done
+	if !hp.Status().Active {
+		t.Error("Expected the failover to be recorded after the switch")
+	}
+}
+
+func TestHealthProberPersistsState(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "failover.json")
+	router := &fakeFailoverRouter{outbound: "vless-reality", probeErr: errors.New("timeout")}
+	hp, _ := newTestHealthProber(t, path, router)
+	checkTimes(hp, 3)
+
+	reloaded, _ := newTestHealthProber(t, path, router)
+	if !reloaded.Status().Active {
+		t.Fatal("Expected failover state to survive a restart")
+	}
+
+	router.probeErr = nil
+	checkTimes(reloaded, 2)
+	if router.outbound != "vless-reality" {
+		t.Errorf("Expected failback after restart, outbound=%s", router.outbound)
+	}
+}
+
+func TestParseProbeOutput(t *testing.T) {
+	commandErr := errors.New("command execution failed: exit status 28")
+	tests := []struct {
+		name    string
+		output  string
+		err     error
+		wantErr bool
+	}{
+		{"no content", "204", nil, false},
+		{"redirect", "301\n", nil, false},
+		{"no response", "000", commandErr, true},
+		{"server error", "502", nil, true},
+		{"curl missing", "sh: curl: not found", commandErr, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := parseProbeOutput(tt.output, tt.err); (err != nil) != tt.wantErr {
+				t.Errorf("parseProbeOutput(%q) error = %v, wantErr %v", tt.output, err, tt.wantErr)
+			}
+		})
+	}
+}
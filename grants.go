@@ -0,0 +1,112 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var (
+	errGrantNotFound = errors.New("user has no role grant")
+	errGrantReplaced = errors.New("role grant was replaced by a later one")
+)
+
+// RoleGrant is the role a user was given by an invite; unlike a session it survives
+// logouts, expiry and restarts until an admin revokes it
+type RoleGrant struct {
+	UserID    int64     `json:"user_id"`
+	Role      Role      `json:"role"`
+	GrantedBy int64     `json:"granted_by"`
+	GrantedAt time.Time `json:"granted_at"`
+	InviteID  string    `json:"invite_id,omitempty"`
+}
+
+// GrantStore persists role grants separately from the in-memory sessions
+type GrantStore struct {
+	path   string
+	grants map[int64]*RoleGrant // userID -> grant
+	mutex  sync.Mutex
+	now    func() time.Time
+}
+
+// NewGrantStore loads role grants from path
+func NewGrantStore(path string) (*GrantStore, error) {
+	store := &GrantStore{
+		path:   path,
+		grants: make(map[int64]*RoleGrant),
+		now:    time.Now,
+	}
+
+	if err := loadJSONFile(path, &store.grants); err != nil {
+		return nil, fmt.Errorf("failed to load role grants: %w", err)
+	}
+	return store, nil
+}
+
+// Grant gives userID role, replacing any earlier grant
+func (s *GrantStore) Grant(userID int64, role Role, grantedBy int64, inviteID string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	previous, existed := s.grants[userID]
+	s.grants[userID] = &RoleGrant{
+		UserID:    userID,
+		Role:      role,
+		GrantedBy: grantedBy,
+		GrantedAt: s.now(),
+		InviteID:  inviteID,
+	}
+	if err := s.save(); err != nil {
+		if existed {
+			s.grants[userID] = previous
+		} else {
+			delete(s.grants, userID)
+		}
+		return err
+	}
+	return nil
+}
+
+// RevokeInvite deletes the grant of userID only if inviteID gave it, so revoking an old
+// invite cannot take away a role granted later
+func (s *GrantStore) RevokeInvite(userID int64, inviteID string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	grant, exists := s.grants[userID]
+	if !exists {
+		return errGrantNotFound
+	}
+	if grant.InviteID != inviteID {
+		return errGrantReplaced
+	}
+
+	delete(s.grants, userID)
+	if err := s.save(); err != nil {
+		s.grants[userID] = grant
+		return err
+	}
+	return nil
+}
+
+// Get returns a copy of the grant of userID
+func (s *GrantStore) Get(userID int64) (RoleGrant, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	grant, exists := s.grants[userID]
+	if !exists {
+		return RoleGrant{}, false
+	}
+	return *grant, true
+}
+
+// save persists grants to disk
+// Caller must hold s.mutex
+func (s *GrantStore) save() error {
+	if err := saveJSONFile(s.path, s.grants); err != nil {
+		return fmt.Errorf("failed to save role grants: %w", err)
+	}
+	return nil
+}
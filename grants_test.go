@@ -0,0 +1,46 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestGrantStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "grants.json")
+	store, err := NewGrantStore(path)
+	if err != nil {
+		t.Fatalf("NewGrantStore failed: %v", err)
+	}
+
+	if err := store.Grant(2, RoleViewer, 1, "abcd1234"); err != nil {
+		t.Fatalf("Grant failed: %v", err)
+	}
+	if err := store.Grant(2, RoleOperator, 1, "beef5678"); err != nil {
+		t.Fatalf("Grant failed: %v", err)
+	}
+
+	// Grants survive a restart, a new invite replaces the old grant
+	reloaded, err := NewGrantStore(path)
+	if err != nil {
+		t.Fatalf("Reloading failed: %v", err)
+	}
+	grant, ok := reloaded.Get(2)
+	if !ok || grant.Role != RoleOperator || grant.GrantedBy != 1 || grant.InviteID != "beef5678" || grant.GrantedAt.IsZero() {
+		t.Fatalf("Expected the operator grant to be persisted, got %+v %v", grant, ok)
+	}
+
+	// Revoking the replaced invite keeps the newer grant
+	if err := reloaded.RevokeInvite(2, "abcd1234"); err != errGrantReplaced {
+		t.Fatalf("Expected errGrantReplaced, got %v", err)
+	}
+	if err := reloaded.RevokeInvite(2, "beef5678"); err != nil {
+		t.Fatalf("RevokeInvite failed: %v", err)
+	}
+	if err := reloaded.RevokeInvite(2, "beef5678"); err != errGrantNotFound {
+		t.Errorf("Expected errGrantNotFound, got %v", err)
+	}
+	reloaded, _ = NewGrantStore(path)
+	if _, ok := reloaded.Get(2); ok {
+		t.Error("Expected the revocation to be persisted")
+	}
+}
@@ -0,0 +1,1020 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Language is a language the bot can answer in
+type Language string
+
+const (
+	LanguageEnglish Language = "en"
+	LanguageRussian Language = "ru"
+
+	defaultLanguage = LanguageEnglish // Used when a user's language is unsupported and for missing translations
+)
+
+// languageNames are the names /lang shows, each in its own language
+var languageNames = map[Language]string{
+	LanguageEnglish: "English",
+	LanguageRussian: "Русский",
+}
+
+// parseLanguage maps a Telegram language code such as "ru" or "en-US" to a supported language
+func parseLanguage(code string) (Language, bool) {
+	base, _, _ := strings.Cut(strings.ToLower(strings.TrimSpace(code)), "-")
+	language := Language(base)
+	_, ok := languageNames[language]
+	return language, ok
+}
+
+// messageKey identifies a user-facing message in the catalog
+type messageKey string
+
+const (
+	msgWelcome            messageKey = "welcome"
+	msgPanelTitle         messageKey = "panel_title"
+	msgUnknownCommand     messageKey = "unknown_command"
+	msgUnknownAction      messageKey = "unknown_action"
+	msgUnauthorizedCode   messageKey = "unauthorized_code"
+	msgUnauthorizedInvite messageKey = "unauthorized_invite"
+	msgShutdownAbandoned  messageKey = "shutdown_abandoned"
+	msgBusy               messageKey = "busy"
+
+	msgAuthDisabled   messageKey = "auth_disabled"
+	msgAuthUsage      messageKey = "auth_usage"
+	msgAuthInvalid    messageKey = "auth_invalid"
+	msgAuthSuccess    messageKey = "auth_success"
+	msgRoutingVPN     messageKey = "routing_vpn"
+	msgRoutingDirect  messageKey = "routing_direct"
+	msgRoutingUnknown messageKey = "routing_unknown"
+
+	msgStatusChecking   messageKey = "status_checking"
+	msgStatusProgress   messageKey = "status_progress"
+	msgStatusFailed     messageKey = "status_failed"
+	msgStatusVPN        messageKey = "status_vpn"
+	msgStatusDirect     messageKey = "status_direct"
+	msgStatusUnknown    messageKey = "status_unknown"
+	msgEnableSwitching  messageKey = "enable_switching"
+	msgEnableProgress   messageKey = "enable_progress"
+	msgEnableFailed     messageKey = "enable_failed"
+	msgEnableDone       messageKey = "enable_done"
+	msgDisableSwitching messageKey = "disable_switching"
+	msgDisableProgress  messageKey = "disable_progress"
+	msgDisableFailed    messageKey = "disable_failed"
+	msgDisableDone      messageKey = "disable_done"
+
+	msgServiceStarting      messageKey = "service_starting"
+	msgServiceStartProgress messageKey = "service_start_progress"
+	msgServiceStartFailed   messageKey = "service_start_failed"
+	msgServiceStarted       messageKey = "service_started"
+	msgServiceStopping      messageKey = "service_stopping"
+	msgServiceStopProgress  messageKey = "service_stop_progress"
+	msgServiceStopFailed    messageKey = "service_stop_failed"
+	msgServiceStopped       messageKey = "service_stopped"
+	msgServiceChecking      messageKey = "service_checking"
+	msgServiceProgress      messageKey = "service_progress"
+	msgServiceFailed        messageKey = "service_failed"
+	msgServiceRunning       messageKey = "service_running"
+	msgServiceNotRunning    messageKey = "service_not_running"
+	msgServiceUnknown       messageKey = "service_unknown"
+
+	msgLangCurrent     messageKey = "lang_current"
+	msgLangAuto        messageKey = "lang_auto"
+	msgLangOverride    messageKey = "lang_override"
+	msgLangSet         messageKey = "lang_set"
+	msgLangReset       messageKey = "lang_reset"
+	msgLangUnsupported messageKey = "lang_unsupported"
+	msgLangSaveFailed  messageKey = "lang_save_failed"
+
+	msgButtonStatus        messageKey = "button_status"
+	msgButtonServiceStatus messageKey = "button_service_status"
+	msgButtonEnableVPN     messageKey = "button_enable_vpn"
+	msgButtonDisableVPN    messageKey = "button_disable_vpn"
+	msgButtonStartVPN      messageKey = "button_start_vpn"
+	msgButtonStopVPN       messageKey = "button_stop_vpn"
+	msgButtonCancel        messageKey = "button_cancel"
+	msgButtonConfirm       messageKey = "button_confirm"
+	msgButtonKeepRouting   messageKey = "button_keep_routing"
+	msgButtonRefresh       messageKey = "button_refresh"
+	msgPanelOutdated       messageKey = "panel_outdated"
+	msgUnauthorizedAlert   messageKey = "unauthorized_alert"
+
+	msgActionEnableVPN      messageKey = "action_enable_vpn"
+	msgActionDisableVPN     messageKey = "action_disable_vpn"
+	msgActionStartService   messageKey = "action_start_service"
+	msgActionStopService    messageKey = "action_stop_service"
+	msgActionRestartService messageKey = "action_restart_service"
+	msgActionFailover       messageKey = "action_failover"
+	msgActionFailback       messageKey = "action_failback"
+	msgActionSelectOutbound messageKey = "action_select_outbound"
+	msgActionRestoreBackup  messageKey = "action_restore_backup"
+	msgOutcomeDone          messageKey = "outcome_done"
+	msgOutcomeFailed        messageKey = "outcome_failed"
+	msgDurationDays         messageKey = "duration_days"
+	msgDurationHours        messageKey = "duration_hours"
+	msgDurationMinutes      messageKey = "duration_minutes"
+	msgLayoutDate           messageKey = "layout_date"
+	msgLayoutWeekday        messageKey = "layout_weekday"
+	msgLayoutHistory        messageKey = "layout_history"
+	msgLayoutNextRun        messageKey = "layout_next_run"
+
+	msgConfirmToast        messageKey = "confirm_toast"
+	msgConfirmPrompt       messageKey = "confirm_prompt"
+	msgConfirmTimedOut     messageKey = "confirm_timed_out"
+	msgConfirmNothing      messageKey = "confirm_nothing"
+	msgConfirmNotRequester messageKey = "confirm_not_requester"
+	msgConfirmed           messageKey = "confirmed"
+	msgCancelNothing       messageKey = "cancel_nothing"
+	msgCancelNotRequester  messageKey = "cancel_not_requester"
+	msgCancelled           messageKey = "cancelled"
+	msgActionCancelled     messageKey = "action_cancelled"
+	msgRoleForbidsAction   messageKey = "role_forbids_action"
+	msgWarnEnableVPN       messageKey = "warn_enable_vpn"
+	msgWarnDisableVPN      messageKey = "warn_disable_vpn"
+	msgWarnStartService    messageKey = "warn_start_service"
+	msgWarnStopService     messageKey = "warn_stop_service"
+	msgWarnRestartService  messageKey = "warn_restart_service"
+	msgWarnSelectOutbound  messageKey = "warn_select_outbound"
+	msgWarnChangeConfig    messageKey = "warn_change_config"
+
+	msgTOTPNotEnabled    messageKey = "totp_not_enabled"
+	msgTOTPRequiredToast messageKey = "totp_required_toast"
+	msgTOTPEnrollFirst   messageKey = "totp_enroll_first"
+	msgTOTPCodeToast     messageKey = "totp_code_toast"
+	msgTOTPCodeRequired  messageKey = "totp_code_required"
+	msgOTPUsage          messageKey = "otp_usage"
+	msgOTPInvalid        messageKey = "otp_invalid"
+	msgOTPNotEnrolled    messageKey = "otp_not_enrolled"
+	msgOTPLocked         messageKey = "otp_locked"
+	msgOTPAccepted       messageKey = "otp_accepted"
+	msgTOTPConfirmFailed messageKey = "totp_confirm_failed"
+	msgTOTPActivated     messageKey = "totp_activated"
+	msgTOTPDisableFailed messageKey = "totp_disable_failed"
+	msgTOTPDeactivated   messageKey = "totp_deactivated"
+	msgTOTPStateActive   messageKey = "totp_state_active"
+	msgTOTPStateNone     messageKey = "totp_state_none"
+	msgTOTPHelp          messageKey = "totp_help"
+	msgTOTPEnrollFailed  messageKey = "totp_enroll_failed"
+	msgTOTPAlreadyOn     messageKey = "totp_already_on"
+	msgTOTPQRFailed      messageKey = "totp_qr_failed"
+	msgTOTPQRCaption     messageKey = "totp_qr_caption"
+
+	msgInvitesNotEnabled  messageKey = "invites_not_enabled"
+	msgInviteInvalid      messageKey = "invite_invalid"
+	msgInviteExpired      messageKey = "invite_expired"
+	msgInviteUsed         messageKey = "invite_used"
+	msgInviteRevoked      messageKey = "invite_revoked"
+	msgInviteUsage        messageKey = "invite_usage"
+	msgInviteTTLInvalid   messageKey = "invite_ttl_invalid"
+	msgInviteCreateFailed messageKey = "invite_create_failed"
+	msgInviteCreated      messageKey = "invite_created"
+	msgInvitesEmpty       messageKey = "invites_empty"
+	msgInvitesRecent      messageKey = "invites_recent"
+	msgInviteLine         messageKey = "invite_line"
+	msgInviteStateActive  messageKey = "invite_state_active"
+	msgInviteStateUsed    messageKey = "invite_state_used"
+	msgInviteStateRevoked messageKey = "invite_state_revoked"
+	msgInviteStateExpired messageKey = "invite_state_expired"
+	msgRevokeUsage        messageKey = "revoke_usage"
+	msgRevokeUnknown      messageKey = "revoke_unknown"
+	msgRevokeInactive     messageKey = "revoke_inactive"
+	msgRevokeFailed       messageKey = "revoke_failed"
+	msgRevokeDone         messageKey = "revoke_done"
+	msgGrantRevokeFailed  messageKey = "grant_revoke_failed"
+	msgGrantRevoked       messageKey = "grant_revoked"
+	msgGrantReplaced      messageKey = "grant_replaced"
+	msgInvitesAdminOnly   messageKey = "invites_admin_only"
+
+	msgSessionHintAuth  messageKey = "session_hint_auth"
+	msgSessionHintStart messageKey = "session_hint_start"
+	msgLoggedOut        messageKey = "logged_out"
+	msgAccessRevoked    messageKey = "access_revoked"
+	msgSessionIdle      messageKey = "session_idle"
+	msgSessionExpired   messageKey = "session_expired"
+
+	msgNotificationsNotEnabled messageKey = "notifications_not_enabled"
+	msgSubscribeFailed         messageKey = "subscribe_failed"
+	msgSubscribed              messageKey = "subscribed"
+	msgUnsubscribeFailed       messageKey = "unsubscribe_failed"
+	msgUnsubscribed            messageKey = "unsubscribed"
+	msgDriftTitle              messageKey = "drift_title"
+	msgDriftRouting            messageKey = "drift_routing"
+	msgDriftService            messageKey = "drift_service"
+	msgDriftDetected           messageKey = "drift_detected"
+	msgAPIAction               messageKey = "api_action"
+	msgFailoverFailed          messageKey = "failover_failed"
+	msgFailoverDown            messageKey = "failover_down"
+	msgFailoverRecovered       messageKey = "failover_recovered"
+	msgFailoverStatus          messageKey = "failover_status"
+	msgShutdownInterruptedYou  messageKey = "shutdown_interrupted_you"
+	msgShutdownInterrupted     messageKey = "shutdown_interrupted"
+
+	msgHistoryUsage       messageKey = "history_usage"
+	msgHistoryUnavailable messageKey = "history_unavailable"
+	msgHistoryEmpty       messageKey = "history_empty"
+	msgHistoryTitle       messageKey = "history_title"
+
+	msgScheduleNotEnabled   messageKey = "schedule_not_enabled"
+	msgScheduleAdminOnly    messageKey = "schedule_admin_only"
+	msgScheduleRemoveUsage  messageKey = "schedule_remove_usage"
+	msgScheduleNotFound     messageKey = "schedule_not_found"
+	msgScheduleRemoveFailed messageKey = "schedule_remove_failed"
+	msgScheduleRemoved      messageKey = "schedule_removed"
+	msgScheduleSaveFailed   messageKey = "schedule_save_failed"
+	msgScheduleAdded        messageKey = "schedule_added"
+	msgScheduleEmpty        messageKey = "schedule_empty"
+	msgScheduleList         messageKey = "schedule_list"
+	msgScheduleListLine     messageKey = "schedule_list_line"
+	msgScheduledAction      messageKey = "scheduled_action"
+	msgScheduleUsage        messageKey = "schedule_usage"
+	msgScheduleBadDays      messageKey = "schedule_bad_days"
+	msgScheduleBadTime      messageKey = "schedule_bad_time"
+	msgScheduleBadAction    messageKey = "schedule_bad_action"
+
+	msgPingUsage          messageKey = "ping_usage"
+	msgPingProgress       messageKey = "ping_progress"
+	msgPingFailed         messageKey = "ping_failed"
+	msgPingNoneReachable  messageKey = "ping_none_reachable"
+	msgPingAlreadyFastest messageKey = "ping_already_fastest"
+	msgPingTitle          messageKey = "ping_title"
+	msgPingOutbound       messageKey = "ping_outbound"
+	msgPingProbeFailed    messageKey = "ping_probe_failed"
+	msgPingActive         messageKey = "ping_active"
+	msgOutboundSwitching  messageKey = "outbound_switching"
+	msgOutboundProgress   messageKey = "outbound_progress"
+	msgOutboundFailed     messageKey = "outbound_failed"
+	msgOutboundDone       messageKey = "outbound_done"
+
+	msgTimedNotEnabled    messageKey = "timed_not_enabled"
+	msgTimedUsage         messageKey = "timed_usage"
+	msgTimedReadFailed    messageKey = "timed_read_failed"
+	msgTimedRevertFailed  messageKey = "timed_revert_failed"
+	msgTimedSwitched      messageKey = "timed_switched"
+	msgRevertNone         messageKey = "revert_none"
+	msgRevertCancelToast  messageKey = "revert_cancel_toast"
+	msgRevertCancelled    messageKey = "revert_cancelled"
+	msgRevertBadExtension messageKey = "revert_bad_extension"
+	msgRevertTooFar       messageKey = "revert_too_far"
+	msgRevertExtendToast  messageKey = "revert_extend_toast"
+	msgRevertPostponed    messageKey = "revert_postponed"
+	msgRoleForbidsRouting messageKey = "role_forbids_routing"
+	msgRevertStatus       messageKey = "revert_status"
+	msgRevertTargetVPN    messageKey = "revert_target_vpn"
+	msgRevertTargetDirect messageKey = "revert_target_direct"
+	msgRevertFailed       messageKey = "revert_failed"
+	msgRevertDone         messageKey = "revert_done"
+
+	msgDashboardNotEnabled messageKey = "dashboard_not_enabled"
+	msgDashboardRemoved    messageKey = "dashboard_removed"
+	msgDashboardOutdated   messageKey = "dashboard_outdated"
+	msgDashboardRefreshing messageKey = "dashboard_refreshing"
+	msgDashboardTitle      messageKey = "dashboard_title"
+	msgDashRoutingUnknown  messageKey = "dash_routing_unknown"
+	msgDashRoutingVPN      messageKey = "dash_routing_vpn"
+	msgDashRoutingDirect   messageKey = "dash_routing_direct"
+	msgDashOutboundUnknown messageKey = "dash_outbound_unknown"
+	msgDashOutbound        messageKey = "dash_outbound"
+	msgDashServiceUnknown  messageKey = "dash_service_unknown"
+	msgDashServiceRunning  messageKey = "dash_service_running"
+	msgDashServiceStopped  messageKey = "dash_service_stopped"
+	msgDashUptimeUnknown   messageKey = "dash_uptime_unknown"
+	msgDashUptime          messageKey = "dash_uptime"
+	msgDashNoChange        messageKey = "dash_no_change"
+	msgDashChange          messageKey = "dash_change"
+	msgDashUpdated         messageKey = "dash_updated"
+	msgChangeBy            messageKey = "change_by"
+	msgChangeFailed        messageKey = "change_failed"
+	msgChangeExternal      messageKey = "change_external"
+	msgChangeFieldRouting  messageKey = "change_field_routing"
+	msgChangeFieldService  messageKey = "change_field_service"
+	msgChangeFieldsJoin    messageKey = "change_fields_join"
+)
+
+// catalog holds the bot's messages per language; English is complete, other languages may lag behind
+var catalog = map[Language]map[messageKey]string{
+	LanguageEnglish: {
+		msgWelcome: `🚀 **VPN Commander Bot**
+
+🎯 **What this bot controls:**
+• 🔋 **VPN Service** - Start/stop the VPN daemon
+• 🔐 **Traffic Routing** - Choose VPN tunnel or direct internet
+
+🔐 **Authentication required**
+Send: /auth YOUR_CODE
+
+📋 **Control panel buttons after authentication:**
+🔍 Quick Status - Check current traffic routing
+🔋 Service Status - Check if VPN daemon is running
+🔐 Route via VPN - Send traffic through secure tunnel
+🔓 Route Direct - Send traffic directly to internet
+🟢 Start VPN - Power on the VPN service
+🔴 Stop VPN - Power off the VPN service
+
+💡 **Pro tip:** Check status first, then choose your routing preference!
+🎛️ Lost the panel? Send /panel to bring it back.
+🌐 Язык после входа: /lang ru`,
+		msgPanelTitle:         "🎛️ **VPN Commander**\n↳ Choose an action below",
+		msgUnknownCommand:     "❓ Unknown command. Please use the buttons below.",
+		msgUnknownAction:      "❓ Unknown action",
+		msgUnauthorizedCode:   "🚫 Unauthorized access. Please authenticate first using /auth YOUR_CODE",
+		msgUnauthorizedInvite: "🚫 Unauthorized access. Please open an invite link from an admin.",
+		msgShutdownAbandoned:  "⚠️ The bot is shutting down and did not get to your last %d request(s). Please send them again once it is back.",
+		msgBusy:               "⏳ Still working on your earlier requests; this one was skipped. Please try again in a moment.",
+
+		msgAuthDisabled:   "🎟️ Code authentication is disabled. Ask an admin for an invite link.",
+		msgAuthUsage:      "❌ Please provide the authentication code: /auth YOUR_CODE",
+		msgAuthInvalid:    "❌ Invalid authentication code. Access denied.",
+		msgAuthSuccess:    "✅ **Authentication successful!**\n\n%s\n👤 Role: %s\n\n🎛️ Use the buttons below to control the VPN.",
+		msgRoutingVPN:     "🔐 Current routing: VPN TUNNEL",
+		msgRoutingDirect:  "🔓 Current routing: DIRECT",
+		msgRoutingUnknown: "❓ Current routing: UNKNOWN",
+
+		msgStatusChecking:   "🔍 Checking routing...",
+		msgStatusProgress:   "🔍 Checking traffic routing status...",
+		msgStatusFailed:     "❌ Status check failed",
+		msgStatusVPN:        "🔐 **VPN ROUTING ACTIVE**\n↳ All traffic routes through VPN tunnel\n📊 Checked at %s",
+		msgStatusDirect:     "🔓 **DIRECT ROUTING ACTIVE**\n↳ Traffic goes directly to internet\n📊 Checked at %s",
+		msgStatusUnknown:    "❓ **ROUTING STATUS UNKNOWN** • %s",
+		msgEnableSwitching:  "🔐 Switching to VPN...",
+		msgEnableProgress:   "⏳ Switching traffic to VPN...",
+		msgEnableFailed:     "❌ Failed to enable VPN",
+		msgEnableDone:       "✅ **ROUTING SWITCHED TO VPN**\n🔐 Traffic now flows through secure tunnel\n⚡ Applied instantly",
+		msgDisableSwitching: "🔓 Switching to direct...",
+		msgDisableProgress:  "⏳ Switching traffic to direct...",
+		msgDisableFailed:    "❌ Failed to disable VPN",
+		msgDisableDone:      "✅ **ROUTING SWITCHED TO DIRECT**\n🔓 Traffic now goes directly to internet\n⚡ Applied instantly",
+
+		msgServiceStarting:      "🟢 Starting service...",
+		msgServiceStartProgress: "⏳ Starting VPN daemon...",
+		msgServiceStartFailed:   "❌ Failed to start service",
+		msgServiceStarted:       "✅ **VPN SERVICE STARTED**\n🟢 Daemon is now running and ready\n⚙️ Service initialized",
+		msgServiceStopping:      "🔴 Stopping service...",
+		msgServiceStopProgress:  "⏳ Stopping VPN daemon...",
+		msgServiceStopFailed:    "❌ Failed to stop service",
+		msgServiceStopped:       "✅ **VPN SERVICE STOPPED**\n🔴 Daemon has been shut down\n⚙️ Service terminated",
+		msgServiceChecking:      "🔋 Checking service...",
+		msgServiceProgress:      "🔋 Checking VPN daemon status...",
+		msgServiceFailed:        "❌ Service status check failed",
+		msgServiceRunning:       "🟢 **VPN SERVICE RUNNING**\n↳ Daemon is active and ready\n🔋 Checked at %s",
+		msgServiceNotRunning:    "🔴 **VPN SERVICE STOPPED**\n↳ Daemon is not running\n🔋 Checked at %s",
+		msgServiceUnknown:       "🟡 **VPN SERVICE STATUS UNKNOWN** • %s",
+
+		msgLangCurrent:     "🌐 Language: %s (%s)\nUse /lang en, /lang ru or /lang auto to follow your Telegram settings.",
+		msgLangAuto:        "from Telegram",
+		msgLangOverride:    "chosen with /lang",
+		msgLangSet:         "🌐 Language set to English.",
+		msgLangReset:       "🌐 Language now follows your Telegram settings.",
+		msgLangUnsupported: "❌ Unsupported language %q. Available: %s",
+		msgLangSaveFailed:  "❌ Failed to save the language",
+
+		msgButtonStatus:        CommandStatus,
+		msgButtonServiceStatus: CommandServiceStatus,
+		msgButtonEnableVPN:     CommandEnableVPN,
+		msgButtonDisableVPN:    CommandDisableVPN,
+		msgButtonStartVPN:      CommandStartVPN,
+		msgButtonStopVPN:       CommandStopVPN,
+		msgButtonCancel:        CommandCancel,
+		msgButtonConfirm:       "✅ Confirm",
+		msgButtonKeepRouting:   "⏹ Keep routing",
+		msgButtonRefresh:       "🔄 Refresh",
+		msgPanelOutdated:       "⌛ These buttons are outdated. Use the latest control panel.",
+		msgUnauthorizedAlert:   "🚫 Unauthorized access. Please authenticate first.",
+
+		msgActionEnableVPN:      "Route via VPN",
+		msgActionDisableVPN:     "Route Direct",
+		msgActionStartService:   "Start VPN",
+		msgActionStopService:    "Stop VPN",
+		msgActionRestartService: "Restart VPN",
+		msgActionFailover:       "Automatic failover",
+		msgActionFailback:       "Automatic failback",
+		msgActionSelectOutbound: "Switch outbound",
+		msgActionRestoreBackup:  "Restore config backup",
+		msgOutcomeDone:          "✅ Done",
+		msgOutcomeFailed:        "❌ Failed",
+		msgDurationDays:         "%dd %dh %dm",
+		msgDurationHours:        "%dh %dm",
+		msgDurationMinutes:      "%dm",
+		msgLayoutDate:           "Jan 2 15:04",
+		msgLayoutWeekday:        "Mon 15:04",
+		msgLayoutHistory:        "02 Jan 15:04",
+		msgLayoutNextRun:        "Mon Jan 2 15:04",
+
+		msgConfirmToast:        "⚠️ Please confirm",
+		msgConfirmPrompt:       "⚠️ **Confirm: %s**\n↳ %s\n⏳ Auto-cancels in %ds",
+		msgConfirmTimedOut:     "❌ **%s cancelled**\n↳ Not confirmed within %s",
+		msgConfirmNothing:      "⌛ There is nothing to confirm.",
+		msgConfirmNotRequester: "🚫 Only the user who asked can confirm this.",
+		msgConfirmed:           "✅ Confirmed",
+		msgCancelNothing:       "❓ There is nothing to cancel.",
+		msgCancelNotRequester:  "🚫 Only the user who asked can cancel this.",
+		msgCancelled:           "❌ Cancelled",
+		msgActionCancelled:     "❌ **%s cancelled**\n↳ Nothing was changed",
+		msgRoleForbidsAction:   "🚫 Your role (%s) does not allow: %s",
+		msgWarnEnableVPN:       "All traffic will be routed through the VPN tunnel",
+		msgWarnDisableVPN:      "All traffic will bypass the VPN tunnel",
+		msgWarnStartService:    "The VPN daemon will be started",
+		msgWarnStopService:     "The VPN daemon will stop and every device loses the tunnel",
+		msgWarnRestartService:  "The VPN daemon will restart and devices briefly lose the tunnel",
+		msgWarnSelectOutbound:  "All traffic will be routed through the fastest outbound",
+		msgWarnChangeConfig:    "This changes the router configuration",
+
+		msgTOTPNotEnabled:    "❓ Two-factor authentication is not enabled.",
+		msgTOTPRequiredToast: "🔑 Two-factor authentication required",
+		msgTOTPEnrollFirst:   "🔑 **Two-factor authentication required**\n↳ %s is a protected action\n📲 Enroll first with %s enroll",
+		msgTOTPCodeToast:     "🔑 Confirmation required",
+		msgTOTPCodeRequired:  "🔑 **Confirmation required**\n↳ %s is a protected action\n📲 Send %s CODE from your authenticator app within %d minutes",
+		msgOTPUsage:          "❌ Please provide the code: %s CODE",
+		msgOTPInvalid:        "❌ Invalid or already used code. Try the next one.",
+		msgOTPNotEnrolled:    "❌ Two-factor authentication is not enrolled. Use %s enroll",
+		msgOTPLocked:         "⏳ Too many invalid codes. Try again in %s",
+		msgOTPAccepted:       "✅ Code accepted. Protected actions are unlocked for a short while.",
+		msgTOTPConfirmFailed: "❌ Could not confirm enrollment. Please try again.",
+		msgTOTPActivated:     "✅ Two-factor authentication is now active.",
+		msgTOTPDisableFailed: "❌ Could not disable two-factor authentication. Please try again.",
+		msgTOTPDeactivated:   "🔓 Two-factor authentication disabled.",
+		msgTOTPStateActive:   "active",
+		msgTOTPStateNone:     "not enrolled",
+		msgTOTPHelp:          "🔑 **Two-factor authentication:** %s\n\n%s enroll - set up an authenticator app\n%s confirm CODE - finish enrollment\n%s disable CODE - remove enrollment\n%s CODE - confirm a protected action",
+		msgTOTPEnrollFailed:  "❌ Could not start enrollment. Please try again.",
+		msgTOTPAlreadyOn:     "ℹ️ Two-factor authentication is already enrolled. To start over, remove it with %s disable CODE",
+		msgTOTPQRFailed:      "❌ Failed to generate QR code",
+		msgTOTPQRCaption:     "📲 Scan this code with your authenticator app\n🔑 Or enter the secret manually: `%s`\n\nThen send %s confirm CODE",
+
+		msgInvitesNotEnabled:  "❌ Invite links are not enabled.",
+		msgInviteInvalid:      "❌ This invite link is not valid.",
+		msgInviteExpired:      "⌛ This invite link has expired. Ask an admin for a new one.",
+		msgInviteUsed:         "❌ This invite link has already been used.",
+		msgInviteRevoked:      "❌ This invite link has been revoked.",
+		msgInviteUsage:        "❌ Unknown role %q. Use: %s [admin|operator|viewer] [ttl]",
+		msgInviteTTLInvalid:   "❌ Invalid TTL. Use a duration like 30m or 48h (max %s)",
+		msgInviteCreateFailed: "❌ Failed to create invite",
+		msgInviteCreated:      "🎟️ Invite created\n👤 Role: %s\n⌛ Expires: %s\n🆔 ID: %s\n\nThe link works once:\n%s\n\nRevoke with %s %s",
+		msgInvitesEmpty:       "🎟️ No invites yet.",
+		msgInvitesRecent:      "🎟️ Recent invites:\n%s",
+		msgInviteLine:         "%s • %s • %s • by %d",
+		msgInviteStateActive:  "active",
+		msgInviteStateUsed:    "used",
+		msgInviteStateRevoked: "revoked",
+		msgInviteStateExpired: "expired",
+		msgRevokeUsage:        "❌ Please provide the invite ID: %s ID",
+		msgRevokeUnknown:      "❌ There is no invite with ID %s.",
+		msgRevokeInactive:     "ℹ️ Invite %s is already %s.",
+		msgRevokeFailed:       "❌ Could not revoke invite. Please try again.",
+		msgRevokeDone:         "🗑️ Invite %s revoked.",
+		msgGrantRevokeFailed:  "❌ Could not revoke access. Please try again.",
+		msgGrantRevoked:       "🗑️ Access granted by invite %s revoked for user %d.",
+		msgGrantReplaced:      "ℹ️ Invite %s no longer gives user %d their role; the newer grant was kept.",
+		msgInvitesAdminOnly:   "🚫 Only admins can manage invites.",
+
+		msgSessionHintAuth:  "↳ Authenticate again to regain access",
+		msgSessionHintStart: "↳ Send %s to sign in again",
+		msgLoggedOut:        "👋 **Logged out**\n%s",
+		msgAccessRevoked:    "🚫 **Access revoked**\n↳ An admin withdrew your invite",
+		msgSessionIdle:      "⌛ **Session expired due to inactivity**\n%s",
+		msgSessionExpired:   "⌛ **Session expired**\n%s",
+
+		msgNotificationsNotEnabled: "❓ Notifications are not enabled.",
+		msgSubscribeFailed:         "❌ Failed to subscribe",
+		msgSubscribed:              "🔔 Subscribed to router notifications. Use %s to stop.",
+		msgUnsubscribeFailed:       "❌ Failed to unsubscribe",
+		msgUnsubscribed:            "🔕 Unsubscribed from router notifications.",
+		msgDriftTitle:              "⚠️ **Router state changed outside the bot**",
+		msgDriftRouting:            "🔀 Routing: `%s` → `%s`",
+		msgDriftService:            "🔋 Service: `%s` → `%s`",
+		msgDriftDetected:           "🕒 Detected at %s",
+		msgAPIAction:               "🤖 **API action**\n↳ %s by `%s`\n%s",
+		msgFailoverFailed:          "❌ **%s failed**\n↳ Could not switch `%s` → `%s`; will retry",
+		msgFailoverDown:            "🚨 **VPN tunnel is down**\n↳ %d probes failed in a row: `%s`\n🔀 Switched `%s` → `%s` until it recovers",
+		msgFailoverRecovered:       "✅ **VPN tunnel recovered**\n🔀 Switched back `%s` → `%s`",
+		msgFailoverStatus:          "🚨 Failed over since %s, waiting for the VPN tunnel to recover",
+		msgShutdownInterruptedYou:  "⚠️ The bot is shutting down while %s was still running (%s). The router may be mid-change; check %s once the bot is back.",
+		msgShutdownInterrupted:     "⚠️ **Shutdown interrupted a router change**\n↳ %s by `%s` was still running after %s",
+
+		msgHistoryUsage:       "❌ Usage: %s [N]",
+		msgHistoryUnavailable: "❌ History is not available",
+		msgHistoryEmpty:       "📜 No actions recorded yet.",
+		msgHistoryTitle:       "📜 Last %d actions:\n%s",
+
+		msgScheduleNotEnabled:   "❓ Scheduling is not enabled.",
+		msgScheduleAdminOnly:    "🚫 Only admins can manage schedules.",
+		msgScheduleRemoveUsage:  "❌ Usage: %s remove ID",
+		msgScheduleNotFound:     "❌ There is no schedule rule with ID %s.",
+		msgScheduleRemoveFailed: "❌ Could not remove schedule rule. Please try again.",
+		msgScheduleRemoved:      "🗑️ Removed: %s",
+		msgScheduleSaveFailed:   "❌ Failed to save schedule rule",
+		msgScheduleAdded:        "🗓️ Scheduled: %s\n⏭️ Next run: %s",
+		msgScheduleEmpty:        "🗓️ No scheduled actions.\n\n%s",
+		msgScheduleList:         "🗓️ Scheduled actions (%s):",
+		msgScheduleListLine:     "%s • next %s",
+		msgScheduledAction:      "🗓️ **Scheduled action**\n↳ %s (rule %s)\n%s",
+		msgScheduleUsage: `Usage:
+%s - list rules
+%s add DAYS HH:MM ACTION - add a rule
+%s remove ID - remove a rule
+
+DAYS: daily, weekdays, weekends, or days like mon,wed,fri or mon-fri
+ACTION: vpn, direct, start or stop
+
+Example: %s add weekdays 09:00 direct`,
+		msgScheduleBadDays:   "❌ Invalid days %q\n\n%s",
+		msgScheduleBadTime:   "❌ Invalid time %q (use HH:MM)\n\n%s",
+		msgScheduleBadAction: "❌ Unknown action %q (use vpn, direct, start or stop)\n\n%s",
+
+		msgPingUsage:          "❌ Usage: %s [fastest]",
+		msgPingProgress:       "📡 Probing outbounds from the router...",
+		msgPingFailed:         "❌ Failed to probe outbounds",
+		msgPingNoneReachable:  "❌ No outbound is reachable",
+		msgPingAlreadyFastest: "⚡ `%s` is already the fastest",
+		msgPingTitle:          "📡 **Outbound latency from the router**",
+		msgPingOutbound:       "Outbound",
+		msgPingProbeFailed:    "failed",
+		msgPingActive:         "\\* active outbound",
+		msgOutboundSwitching:  "⚡ Switching outbound...",
+		msgOutboundProgress:   "⏳ Switching traffic to `%s`...",
+		msgOutboundFailed:     "❌ Failed to switch to `%s`",
+		msgOutboundDone:       "✅ **Switched to the fastest outbound**\n🔀 Default rule now uses `%s`",
+
+		msgTimedNotEnabled:    "❓ Timed routing is not enabled.",
+		msgTimedUsage:         "❌ Usage: %s DURATION, e.g. 30m or 2h (from %s to %s)",
+		msgTimedReadFailed:    "❌ Could not read the current routing, nothing was changed",
+		msgTimedRevertFailed:  "⚠️ Routing switched, but the automatic revert could not be scheduled",
+		msgTimedSwitched:      "✅ **Routing switched for %s**\n%s",
+		msgRevertNone:         "⌛ There is no pending revert.",
+		msgRevertCancelToast:  "⏹ Revert cancelled",
+		msgRevertCancelled:    "⏹ **Automatic revert cancelled**\n↳ Routing will not switch back to %s; current routing stays",
+		msgRevertBadExtension: "❓ Unknown extension",
+		msgRevertTooFar:       "⚠️ Reverts cannot be more than %s away.",
+		msgRevertExtendToast:  "➕ Extended by %s",
+		msgRevertPostponed:    "➕ **Revert postponed**\n%s",
+		msgRoleForbidsRouting: "🚫 Your role (%s) does not allow changing routing",
+		msgRevertStatus:       "⏳ Reverts to %s in %s (at %s)",
+		msgRevertTargetVPN:    "VPN",
+		msgRevertTargetDirect: "direct",
+		msgRevertFailed:       "❌ **Automatic revert failed**\n↳ Switching back to %s failed, retrying every %s",
+		msgRevertDone:         "⏰ **Timed routing ended**\n↳ Switched back to %s automatically",
+
+		msgDashboardNotEnabled: "❓ Dashboards are not enabled.",
+		msgDashboardRemoved:    "📊 Dashboard removed. Send %s to create a new one.",
+		msgDashboardOutdated:   "⌛ This dashboard is outdated. Use the pinned one.",
+		msgDashboardRefreshing: "🔄 Refreshing...",
+		msgDashboardTitle:      "📊 **VPN Commander Dashboard**",
+		msgDashRoutingUnknown:  "❓ Routing: **unknown**",
+		msgDashRoutingVPN:      "🔐 Routing: **VPN tunnel**",
+		msgDashRoutingDirect:   "🔓 Routing: **direct**",
+		msgDashOutboundUnknown: "🔀 Active outbound: unknown",
+		msgDashOutbound:        "🔀 Active outbound: `%s`",
+		msgDashServiceUnknown:  "🟡 Service: **unknown**",
+		msgDashServiceRunning:  "🟢 Service: **running**",
+		msgDashServiceStopped:  "🔴 Service: **stopped**",
+		msgDashUptimeUnknown:   "⏱️ Router uptime: unknown",
+		msgDashUptime:          "⏱️ Router uptime: %s",
+		msgDashNoChange:        "📝 Last change: none recorded",
+		msgDashChange:          "📝 Last change: %s • %s",
+		msgDashUpdated:         "🕒 Updated %s",
+		msgChangeBy:            "%s by %s",
+		msgChangeFailed:        "%s (failed)",
+		msgChangeExternal:      "%s changed outside the bot",
+		msgChangeFieldRouting:  "routing",
+		msgChangeFieldService:  "service",
+		msgChangeFieldsJoin:    " and ",
+	},
+	LanguageRussian: {
+		msgWelcome: `🚀 **VPN Commander Bot**
+
+🎯 **Чем управляет бот:**
+• 🔋 **VPN-сервис** - запуск и остановка VPN-демона
+• 🔐 **Маршрутизация трафика** - через VPN-туннель или напрямую в интернет
+
+🔐 **Нужна авторизация**
+Отправьте: /auth ВАШ_КОД
+
+📋 **Кнопки панели после авторизации:**
+🔍 Статус - текущая маршрутизация трафика
+🔋 Состояние сервиса - работает ли VPN-демон
+🔐 Через VPN - пустить трафик через защищённый туннель
+🔓 Напрямую - пустить трафик напрямую в интернет
+🟢 Запустить VPN - запустить VPN-сервис
+🔴 Остановить VPN - остановить VPN-сервис
+
+💡 **Совет:** сначала проверьте статус, потом выбирайте маршрут!
+🎛️ Пропала панель? Отправьте /panel, чтобы вернуть её.
+🌐 Language after signing in: /lang en`,
+		msgPanelTitle:         "🎛️ **VPN Commander**\n↳ Выберите действие ниже",
+		msgUnknownCommand:     "❓ Неизвестная команда. Воспользуйтесь кнопками ниже.",
+		msgUnknownAction:      "❓ Неизвестное действие",
+		msgUnauthorizedCode:   "🚫 Доступ запрещён. Сначала авторизуйтесь: /auth ВАШ_КОД",
+		msgUnauthorizedInvite: "🚫 Доступ запрещён. Откройте ссылку-приглашение от администратора.",
+		msgShutdownAbandoned:  "⚠️ Бот останавливается и не успел обработать ваши последние запросы (%d). Отправьте их снова, когда он вернётся.",
+		msgBusy:               "⏳ Бот ещё выполняет ваши предыдущие запросы, этот пропущен. Попробуйте снова чуть позже.",
+
+		msgAuthDisabled:   "🎟️ Вход по коду отключён. Попросите у администратора ссылку-приглашение.",
+		msgAuthUsage:      "❌ Укажите код авторизации: /auth ВАШ_КОД",
+		msgAuthInvalid:    "❌ Неверный код авторизации. Доступ запрещён.",
+		msgAuthSuccess:    "✅ **Авторизация успешна!**\n\n%s\n👤 Роль: %s\n\n🎛️ Управляйте VPN кнопками ниже.",
+		msgRoutingVPN:     "🔐 Текущий маршрут: VPN-ТУННЕЛЬ",
+		msgRoutingDirect:  "🔓 Текущий маршрут: НАПРЯМУЮ",
+		msgRoutingUnknown: "❓ Текущий маршрут: НЕИЗВЕСТЕН",
+
+		msgStatusChecking:   "🔍 Проверяю маршрут...",
+		msgStatusProgress:   "🔍 Проверяю маршрутизацию трафика...",
+		msgStatusFailed:     "❌ Не удалось проверить статус",
+		msgStatusVPN:        "🔐 **ТРАФИК ИДЁТ ЧЕРЕЗ VPN**\n↳ Весь трафик проходит через VPN-туннель\n📊 Проверено в %s",
+		msgStatusDirect:     "🔓 **ТРАФИК ИДЁТ НАПРЯМУЮ**\n↳ Трафик идёт прямо в интернет\n📊 Проверено в %s",
+		msgStatusUnknown:    "❓ **МАРШРУТ НЕИЗВЕСТЕН** • %s",
+		msgEnableSwitching:  "🔐 Переключаю на VPN...",
+		msgEnableProgress:   "⏳ Переключаю трафик на VPN...",
+		msgEnableFailed:     "❌ Не удалось включить VPN",
+		msgEnableDone:       "✅ **ТРАФИК ПЕРЕКЛЮЧЁН НА VPN**\n🔐 Трафик идёт через защищённый туннель\n⚡ Применено сразу",
+		msgDisableSwitching: "🔓 Переключаю напрямую...",
+		msgDisableProgress:  "⏳ Переключаю трафик напрямую...",
+		msgDisableFailed:    "❌ Не удалось выключить VPN",
+		msgDisableDone:      "✅ **ТРАФИК ПЕРЕКЛЮЧЁН НАПРЯМУЮ**\n🔓 Трафик идёт прямо в интернет\n⚡ Применено сразу",
+
+		msgServiceStarting:      "🟢 Запускаю сервис...",
+		msgServiceStartProgress: "⏳ Запускаю VPN-демон...",
+		msgServiceStartFailed:   "❌ Не удалось запустить сервис",
+		msgServiceStarted:       "✅ **VPN-СЕРВИС ЗАПУЩЕН**\n🟢 Демон работает и готов\n⚙️ Сервис инициализирован",
+		msgServiceStopping:      "🔴 Останавливаю сервис...",
+		msgServiceStopProgress:  "⏳ Останавливаю VPN-демон...",
+		msgServiceStopFailed:    "❌ Не удалось остановить сервис",
+		msgServiceStopped:       "✅ **VPN-СЕРВИС ОСТАНОВЛЕН**\n🔴 Демон выключен\n⚙️ Сервис завершён",
+		msgServiceChecking:      "🔋 Проверяю сервис...",
+		msgServiceProgress:      "🔋 Проверяю состояние VPN-демона...",
+		msgServiceFailed:        "❌ Не удалось проверить состояние сервиса",
+		msgServiceRunning:       "🟢 **VPN-СЕРВИС РАБОТАЕТ**\n↳ Демон активен и готов\n🔋 Проверено в %s",
+		msgServiceNotRunning:    "🔴 **VPN-СЕРВИС ОСТАНОВЛЕН**\n↳ Демон не запущен\n🔋 Проверено в %s",
+		msgServiceUnknown:       "🟡 **СОСТОЯНИЕ VPN-СЕРВИСА НЕИЗВЕСТНО** • %s",
+
+		msgLangCurrent:     "🌐 Язык: %s (%s)\nКоманды: /lang en, /lang ru или /lang auto, чтобы следовать настройкам Telegram.",
+		msgLangAuto:        "из Telegram",
+		msgLangOverride:    "выбран через /lang",
+		msgLangSet:         "🌐 Язык переключён на русский.",
+		msgLangReset:       "🌐 Язык снова берётся из настроек Telegram.",
+		msgLangUnsupported: "❌ Язык %q не поддерживается. Доступны: %s",
+		msgLangSaveFailed:  "❌ Не удалось сохранить язык",
+
+		msgButtonStatus:        "🔍 Статус",
+		msgButtonServiceStatus: "🔋 Состояние сервиса",
+		msgButtonEnableVPN:     "🔐 Через VPN",
+		msgButtonDisableVPN:    "🔓 Напрямую",
+		msgButtonStartVPN:      "🟢 Запустить VPN",
+		msgButtonStopVPN:       "🔴 Остановить VPN",
+		msgButtonCancel:        "❌ Отмена",
+		msgButtonConfirm:       "✅ Подтвердить",
+		msgButtonKeepRouting:   "⏹ Оставить маршрут",
+		msgButtonRefresh:       "🔄 Обновить",
+		msgPanelOutdated:       "⌛ Эти кнопки устарели. Используйте последнюю панель управления.",
+		msgUnauthorizedAlert:   "🚫 Доступ запрещён. Сначала авторизуйтесь.",
+
+		msgActionEnableVPN:      "Маршрут через VPN",
+		msgActionDisableVPN:     "Маршрут напрямую",
+		msgActionStartService:   "Запуск VPN",
+		msgActionStopService:    "Остановка VPN",
+		msgActionRestartService: "Перезапуск VPN",
+		msgActionFailover:       "Автоматическое переключение на резерв",
+		msgActionFailback:       "Автоматический возврат с резерва",
+		msgActionSelectOutbound: "Смена outbound",
+		msgActionRestoreBackup:  "Восстановление резервной копии конфигурации",
+		msgOutcomeDone:          "✅ Выполнено",
+		msgOutcomeFailed:        "❌ Ошибка",
+		msgDurationDays:         "%dд %dч %dм",
+		msgDurationHours:        "%dч %dм",
+		msgDurationMinutes:      "%dм",
+		msgLayoutDate:           "02.01 15:04",
+		msgLayoutWeekday:        "02.01 15:04",
+		msgLayoutHistory:        "02.01 15:04",
+		msgLayoutNextRun:        "02.01.2006 15:04",
+
+		msgConfirmToast:        "⚠️ Подтвердите действие",
+		msgConfirmPrompt:       "⚠️ **Подтвердите: %s**\n↳ %s\n⏳ Автоотмена через %d с",
+		msgConfirmTimedOut:     "❌ **%s: отменено**\n↳ Не подтверждено за %s",
+		msgConfirmNothing:      "⌛ Подтверждать нечего.",
+		msgConfirmNotRequester: "🚫 Подтвердить может только тот, кто запросил действие.",
+		msgConfirmed:           "✅ Подтверждено",
+		msgCancelNothing:       "❓ Отменять нечего.",
+		msgCancelNotRequester:  "🚫 Отменить может только тот, кто запросил действие.",
+		msgCancelled:           "❌ Отменено",
+		msgActionCancelled:     "❌ **%s: отменено**\n↳ Ничего не изменено",
+		msgRoleForbidsAction:   "🚫 Ваша роль (%s) не позволяет: %s",
+		msgWarnEnableVPN:       "Весь трафик пойдёт через VPN-туннель",
+		msgWarnDisableVPN:      "Весь трафик пойдёт в обход VPN-туннеля",
+		msgWarnStartService:    "VPN-демон будет запущен",
+		msgWarnStopService:     "VPN-демон остановится, и все устройства потеряют туннель",
+		msgWarnRestartService:  "VPN-демон перезапустится, устройства ненадолго потеряют туннель",
+		msgWarnSelectOutbound:  "Весь трафик пойдёт через самый быстрый outbound",
+		msgWarnChangeConfig:    "Это изменит конфигурацию роутера",
+
+		msgTOTPNotEnabled:    "❓ Двухфакторная аутентификация не включена.",
+		msgTOTPRequiredToast: "🔑 Нужна двухфакторная аутентификация",
+		msgTOTPEnrollFirst:   "🔑 **Нужна двухфакторная аутентификация**\n↳ %s — защищённое действие\n📲 Сначала подключите её: %s enroll",
+		msgTOTPCodeToast:     "🔑 Нужно подтверждение",
+		msgTOTPCodeRequired:  "🔑 **Нужно подтверждение**\n↳ %s — защищённое действие\n📲 Отправьте %s КОД из приложения-аутентификатора в течение %d мин.",
+		msgOTPUsage:          "❌ Укажите код: %s КОД",
+		msgOTPInvalid:        "❌ Неверный или уже использованный код. Попробуйте следующий.",
+		msgOTPNotEnrolled:    "❌ Двухфакторная аутентификация не подключена. Используйте %s enroll",
+		msgOTPLocked:         "⏳ Слишком много неверных кодов. Попробуйте снова через %s",
+		msgOTPAccepted:       "✅ Код принят. Защищённые действия ненадолго разблокированы.",
+		msgTOTPConfirmFailed: "❌ Не удалось завершить подключение. Попробуйте ещё раз.",
+		msgTOTPActivated:     "✅ Двухфакторная аутентификация включена.",
+		msgTOTPDisableFailed: "❌ Не удалось отключить двухфакторную аутентификацию. Попробуйте ещё раз.",
+		msgTOTPDeactivated:   "🔓 Двухфакторная аутентификация отключена.",
+		msgTOTPStateActive:   "включена",
+		msgTOTPStateNone:     "не подключена",
+		msgTOTPHelp:          "🔑 **Двухфакторная аутентификация:** %s\n\n%s enroll - подключить приложение-аутентификатор\n%s confirm КОД - завершить подключение\n%s disable КОД - отключить\n%s КОД - подтвердить защищённое действие",
+		msgTOTPEnrollFailed:  "❌ Не удалось начать подключение. Попробуйте ещё раз.",
+		msgTOTPAlreadyOn:     "ℹ️ Двухфакторная аутентификация уже подключена. Чтобы начать заново, отключите её: %s disable CODE",
+		msgTOTPQRFailed:      "❌ Не удалось создать QR-код",
+		msgTOTPQRCaption:     "📲 Отсканируйте код приложением-аутентификатором\n🔑 Или введите секрет вручную: `%s`\n\nЗатем отправьте %s confirm КОД",
+
+		msgInvitesNotEnabled:  "❌ Ссылки-приглашения не включены.",
+		msgInviteInvalid:      "❌ Эта ссылка-приглашение недействительна.",
+		msgInviteExpired:      "⌛ Срок действия ссылки истёк. Попросите у администратора новую.",
+		msgInviteUsed:         "❌ Эта ссылка-приглашение уже использована.",
+		msgInviteRevoked:      "❌ Эта ссылка-приглашение отозвана.",
+		msgInviteUsage:        "❌ Неизвестная роль %q. Формат: %s [admin|operator|viewer] [срок]",
+		msgInviteTTLInvalid:   "❌ Неверный срок. Укажите длительность вроде 30m или 48h (не больше %s)",
+		msgInviteCreateFailed: "❌ Не удалось создать приглашение",
+		msgInviteCreated:      "🎟️ Приглашение создано\n👤 Роль: %s\n⌛ Действует до: %s\n🆔 ID: %s\n\nСсылка срабатывает один раз:\n%s\n\nОтозвать: %s %s",
+		msgInvitesEmpty:       "🎟️ Приглашений пока нет.",
+		msgInvitesRecent:      "🎟️ Последние приглашения:\n%s",
+		msgInviteLine:         "%s • %s • %s • создал %d",
+		msgInviteStateActive:  "действует",
+		msgInviteStateUsed:    "использовано",
+		msgInviteStateRevoked: "отозвано",
+		msgInviteStateExpired: "истекло",
+		msgRevokeUsage:        "❌ Укажите ID приглашения: %s ID",
+		msgRevokeUnknown:      "❌ Приглашения с ID %s нет.",
+		msgRevokeInactive:     "ℹ️ Приглашение %s уже %s.",
+		msgRevokeFailed:       "❌ Не удалось отозвать приглашение. Попробуйте ещё раз.",
+		msgRevokeDone:         "🗑️ Приглашение %s отозвано.",
+		msgGrantRevokeFailed:  "❌ Не удалось отозвать доступ. Попробуйте ещё раз.",
+		msgGrantRevoked:       "🗑️ Доступ по приглашению %s отозван у пользователя %d.",
+		msgGrantReplaced:      "ℹ️ Приглашение %s больше не даёт роль пользователю %d; более новый доступ сохранён.",
+		msgInvitesAdminOnly:   "🚫 Управлять приглашениями могут только администраторы.",
+
+		msgSessionHintAuth:  "↳ Авторизуйтесь снова, чтобы вернуть доступ",
+		msgSessionHintStart: "↳ Отправьте %s, чтобы войти снова",
+		msgLoggedOut:        "👋 **Вы вышли**\n%s",
+		msgAccessRevoked:    "🚫 **Доступ отозван**\n↳ Администратор отозвал ваше приглашение",
+		msgSessionIdle:      "⌛ **Сессия истекла из-за бездействия**\n%s",
+		msgSessionExpired:   "⌛ **Сессия истекла**\n%s",
+
+		msgNotificationsNotEnabled: "❓ Уведомления не включены.",
+		msgSubscribeFailed:         "❌ Не удалось подписаться",
+		msgSubscribed:              "🔔 Вы подписаны на уведомления роутера. Отписаться: %s",
+		msgUnsubscribeFailed:       "❌ Не удалось отписаться",
+		msgUnsubscribed:            "🔕 Вы отписались от уведомлений роутера.",
+		msgDriftTitle:              "⚠️ **Состояние роутера изменено в обход бота**",
+		msgDriftRouting:            "🔀 Маршрут: `%s` → `%s`",
+		msgDriftService:            "🔋 Сервис: `%s` → `%s`",
+		msgDriftDetected:           "🕒 Обнаружено в %s",
+		msgAPIAction:               "🤖 **Действие через API**\n↳ %s, клиент `%s`\n%s",
+		msgFailoverFailed:          "❌ **%s: ошибка**\n↳ Не удалось переключить `%s` → `%s`; попробую ещё раз",
+		msgFailoverDown:            "🚨 **VPN-туннель недоступен**\n↳ %d проверок подряд не прошли: `%s`\n🔀 Переключено `%s` → `%s` до восстановления",
+		msgFailoverRecovered:       "✅ **VPN-туннель восстановлен**\n🔀 Переключено обратно `%s` → `%s`",
+		msgFailoverStatus:          "🚨 Резервный маршрут с %s, ждём восстановления VPN-туннеля",
+		msgShutdownInterruptedYou:  "⚠️ Бот останавливается, а «%s» ещё выполняется (%s). Роутер может быть в процессе изменения; проверьте «%s», когда бот вернётся.",
+		msgShutdownInterrupted:     "⚠️ **Остановка бота прервала изменение роутера**\n↳ «%s» (`%s`) ещё выполнялось спустя %s",
+
+		msgHistoryUsage:       "❌ Формат: %s [N]",
+		msgHistoryUnavailable: "❌ История недоступна",
+		msgHistoryEmpty:       "📜 Действий пока не записано.",
+		msgHistoryTitle:       "📜 Последние действия (%d):\n%s",
+
+		msgScheduleNotEnabled:   "❓ Расписание не включено.",
+		msgScheduleAdminOnly:    "🚫 Управлять расписанием могут только администраторы.",
+		msgScheduleRemoveUsage:  "❌ Формат: %s remove ID",
+		msgScheduleNotFound:     "❌ Правила с ID %s нет.",
+		msgScheduleRemoveFailed: "❌ Не удалось удалить правило. Попробуйте ещё раз.",
+		msgScheduleRemoved:      "🗑️ Удалено: %s",
+		msgScheduleSaveFailed:   "❌ Не удалось сохранить правило",
+		msgScheduleAdded:        "🗓️ Запланировано: %s\n⏭️ Следующий запуск: %s",
+		msgScheduleEmpty:        "🗓️ Запланированных действий нет.\n\n%s",
+		msgScheduleList:         "🗓️ Действия по расписанию (%s):",
+		msgScheduleListLine:     "%s • следующий запуск %s",
+		msgScheduledAction:      "🗓️ **Действие по расписанию**\n↳ %s (правило %s)\n%s",
+		msgScheduleUsage: `Формат:
+%s - список правил
+%s add ДНИ ЧЧ:ММ ДЕЙСТВИЕ - добавить правило
+%s remove ID - удалить правило
+
+ДНИ: daily, weekdays, weekends или дни вроде mon,wed,fri или mon-fri
+ДЕЙСТВИЕ: vpn, direct, start или stop
+
+Пример: %s add weekdays 09:00 direct`,
+		msgScheduleBadDays:   "❌ Неверные дни %q\n\n%s",
+		msgScheduleBadTime:   "❌ Неверное время %q (формат ЧЧ:ММ)\n\n%s",
+		msgScheduleBadAction: "❌ Неизвестное действие %q (vpn, direct, start или stop)\n\n%s",
+
+		msgPingUsage:          "❌ Формат: %s [fastest]",
+		msgPingProgress:       "📡 Проверяю outbound'ы с роутера...",
+		msgPingFailed:         "❌ Не удалось проверить outbound'ы",
+		msgPingNoneReachable:  "❌ Ни один outbound не доступен",
+		msgPingAlreadyFastest: "⚡ `%s` уже самый быстрый",
+		msgPingTitle:          "📡 **Задержка outbound'ов с роутера**",
+		msgPingOutbound:       "Outbound",
+		msgPingProbeFailed:    "ошибка",
+		msgPingActive:         "\\* активный outbound",
+		msgOutboundSwitching:  "⚡ Переключаю outbound...",
+		msgOutboundProgress:   "⏳ Переключаю трафик на `%s`...",
+		msgOutboundFailed:     "❌ Не удалось переключиться на `%s`",
+		msgOutboundDone:       "✅ **Переключено на самый быстрый outbound**\n🔀 Основное правило теперь использует `%s`",
+
+		msgTimedNotEnabled:    "❓ Временная маршрутизация не включена.",
+		msgTimedUsage:         "❌ Формат: %s ДЛИТЕЛЬНОСТЬ, например 30m или 2h (от %s до %s)",
+		msgTimedReadFailed:    "❌ Не удалось прочитать текущий маршрут, ничего не изменено",
+		msgTimedRevertFailed:  "⚠️ Маршрут переключён, но автоматический возврат запланировать не удалось",
+		msgTimedSwitched:      "✅ **Маршрут переключён на %s**\n%s",
+		msgRevertNone:         "⌛ Запланированного возврата нет.",
+		msgRevertCancelToast:  "⏹ Возврат отменён",
+		msgRevertCancelled:    "⏹ **Автоматический возврат отменён**\n↳ Маршрут не вернётся к %s; текущий маршрут сохраняется",
+		msgRevertBadExtension: "❓ Неизвестное продление",
+		msgRevertTooFar:       "⚠️ Возврат нельзя отложить больше чем на %s.",
+		msgRevertExtendToast:  "➕ Продлено на %s",
+		msgRevertPostponed:    "➕ **Возврат отложен**\n%s",
+		msgRoleForbidsRouting: "🚫 Ваша роль (%s) не позволяет менять маршрут",
+		msgRevertStatus:       "⏳ Возврат к %s через %s (в %s)",
+		msgRevertTargetVPN:    "VPN",
+		msgRevertTargetDirect: "прямому маршруту",
+		msgRevertFailed:       "❌ **Автоматический возврат не удался**\n↳ Не удалось вернуться к %s, повтор каждые %s",
+		msgRevertDone:         "⏰ **Временный маршрут завершён**\n↳ Автоматически возвращено к %s",
+
+		msgDashboardNotEnabled: "❓ Панели мониторинга не включены.",
+		msgDashboardRemoved:    "📊 Панель мониторинга удалена. Отправьте %s, чтобы создать новую.",
+		msgDashboardOutdated:   "⌛ Эта панель устарела. Используйте закреплённую.",
+		msgDashboardRefreshing: "🔄 Обновляю...",
+		msgDashboardTitle:      "📊 **Панель VPN Commander**",
+		msgDashRoutingUnknown:  "❓ Маршрут: **неизвестен**",
+		msgDashRoutingVPN:      "🔐 Маршрут: **VPN-туннель**",
+		msgDashRoutingDirect:   "🔓 Маршрут: **напрямую**",
+		msgDashOutboundUnknown: "🔀 Активный outbound: неизвестен",
+		msgDashOutbound:        "🔀 Активный outbound: `%s`",
+		msgDashServiceUnknown:  "🟡 Сервис: **неизвестно**",
+		msgDashServiceRunning:  "🟢 Сервис: **работает**",
+		msgDashServiceStopped:  "🔴 Сервис: **остановлен**",
+		msgDashUptimeUnknown:   "⏱️ Аптайм роутера: неизвестен",
+		msgDashUptime:          "⏱️ Аптайм роутера: %s",
+		msgDashNoChange:        "📝 Последнее изменение: нет записей",
+		msgDashChange:          "📝 Последнее изменение: %s • %s",
+		msgDashUpdated:         "🕒 Обновлено в %s",
+		msgChangeBy:            "%s, %s",
+		msgChangeFailed:        "%s (ошибка)",
+		msgChangeExternal:      "%s: изменено в обход бота",
+		msgChangeFieldRouting:  "маршрут",
+		msgChangeFieldService:  "сервис",
+		msgChangeFieldsJoin:    " и ",
+	},
+}
+
+// translate returns the message for key in language, formatted with args
+// Missing translations fall back to English, and unknown keys to the key itself so a gap never blanks a reply
+func translate(language Language, key messageKey, args ...any) string {
+	return translateFrom(catalog, language, key, args...)
+}
+
+// translateFrom is translate looking messages up in messages instead of the catalog
+func translateFrom(messages map[Language]map[messageKey]string, language Language, key messageKey, args ...any) string {
+	text, ok := messages[language][key]
+	if !ok {
+		if text, ok = messages[defaultLanguage][key]; !ok {
+			text = string(key)
+		}
+	}
+	if len(args) == 0 {
+		return text
+	}
+	return fmt.Sprintf(text, args...)
+}
+
+// LanguageStore persists the languages users chose with /lang and remembers the ones Telegram reports
+type LanguageStore struct {
+	path      string             // Empty keeps choices in memory only
+	overrides map[int64]Language // userID -> language chosen with /lang
+	detected  map[int64]Language // userID -> language from the user's Telegram settings
+	mutex     sync.Mutex
+}
+
+// NewLanguageStore loads language choices from path
+func NewLanguageStore(path string) (*LanguageStore, error) {
+	store := newLanguageStore(path)
+	if err := loadJSONFile(path, &store.overrides); err != nil {
+		return nil, fmt.Errorf("failed to load languages: %w", err)
+	}
+	return store, nil
+}
+
+// newLanguageStore returns an empty store saving to path; an empty path keeps choices in memory
+func newLanguageStore(path string) *LanguageStore {
+	return &LanguageStore{
+		path:      path,
+		overrides: make(map[int64]Language),
+		detected:  make(map[int64]Language),
+	}
+}
+
+// Resolve returns the language to answer userID in, remembering the language code Telegram sent
+// A /lang choice wins over the Telegram settings, and unsupported languages get English
+func (s *LanguageStore) Resolve(userID int64, languageCode string) Language {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if language, ok := parseLanguage(languageCode); ok {
+		s.detected[userID] = language
+	} else if languageCode != "" {
+		delete(s.detected, userID)
+	}
+	return s.languageLocked(userID)
+}
+
+// Lookup is Resolve without remembering anything, for senders who are not signed in
+func (s *LanguageStore) Lookup(userID int64, languageCode string) Language {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if language, ok := s.overrides[userID]; ok {
+		return language
+	}
+	if language, ok := parseLanguage(languageCode); ok {
+		return language
+	}
+	return defaultLanguage
+}
+
+// Language returns the language to answer userID in without a fresh language code
+func (s *LanguageStore) Language(userID int64) Language {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.languageLocked(userID)
+}
+
+// languageLocked picks the override, then the detected language; caller must hold s.mutex
+func (s *LanguageStore) languageLocked(userID int64) Language {
+	if language, ok := s.overrides[userID]; ok {
+		return language
+	}
+	if language, ok := s.detected[userID]; ok {
+		return language
+	}
+	return defaultLanguage
+}
+
+// Override reports the language userID chose with /lang, if any
+func (s *LanguageStore) Override(userID int64) (Language, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	language, ok := s.overrides[userID]
+	return language, ok
+}
+
+// SetOverride makes userID get language regardless of their Telegram settings
+func (s *LanguageStore) SetOverride(userID int64, language Language) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	overrides := s.copyOverrides()
+	overrides[userID] = language
+	if err := s.save(overrides); err != nil {
+		return err
+	}
+	s.overrides = overrides
+	return nil
+}
+
+// ClearOverride makes userID follow their Telegram settings again
+func (s *LanguageStore) ClearOverride(userID int64) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	overrides := s.copyOverrides()
+	delete(overrides, userID)
+	if err := s.save(overrides); err != nil {
+		return err
+	}
+	s.overrides = overrides
+	return nil
+}
+
+// copyOverrides returns a copy of the overrides to change, so a failed save leaves them untouched
+// Caller must hold s.mutex
+func (s *LanguageStore) copyOverrides() map[int64]Language {
+	overrides := make(map[int64]Language, len(s.overrides)+1)
+	for userID, language := range s.overrides {
+		overrides[userID] = language
+	}
+	return overrides
+}
+
+// save persists overrides to disk
+// Caller must hold s.mutex
+func (s *LanguageStore) save(overrides map[int64]Language) error {
+	if s.path == "" {
+		return nil
+	}
+	if err := saveJSONFile(s.path, overrides); err != nil {
+		return fmt.Errorf("failed to save languages: %w", err)
+	}
+	return nil
+}
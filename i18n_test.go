@@ -0,0 +1,258 @@
+package main
+
+import (
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// formatVerbs matches the fmt verbs of a message, ignoring escaped percent signs
+var formatVerbs = regexp.MustCompile(`%[-+# 0-9.]*[a-zA-Z]`)
+
+func TestCatalogTranslationsMatchEnglish(t *testing.T) {
+	english := catalog[defaultLanguage]
+	for language, messages := range catalog {
+		if _, ok := languageNames[language]; !ok {
+			t.Errorf("Catalog has messages for unsupported language %s", language)
+		}
+		for key, text := range messages {
+			source, ok := english[key]
+			if !ok {
+				t.Errorf("%s message %s has no English original", language, key)
+				continue
+			}
+			want := formatVerbs.FindAllString(strings.ReplaceAll(source, "%%", ""), -1)
+			got := formatVerbs.FindAllString(strings.ReplaceAll(text, "%%", ""), -1)
+			if strings.Join(got, " ") != strings.Join(want, " ") {
+				t.Errorf("%s message %s uses verbs %v, English uses %v", language, key, got, want)
+			}
+		}
+		if language != defaultLanguage && len(messages) != len(english) {
+			t.Errorf("%s translates %d of %d messages", language, len(messages), len(english))
+		}
+	}
+}
+
+func TestTranslateFallsBack(t *testing.T) {
+	messages := map[Language]map[messageKey]string{
+		LanguageEnglish: {"greeting": "Hello %s", "english_only": "Only in English"},
+		LanguageRussian: {"greeting": "Привет %s"},
+	}
+
+	if got := translateFrom(messages, LanguageRussian, "english_only"); got != "Only in English" {
+		t.Errorf("Expected a missing translation to fall back to English, got %q", got)
+	}
+	if got := translateFrom(messages, Language("de"), "greeting", "Bob"); got != "Hello Bob" {
+		t.Errorf("Expected an unsupported language to get English, got %q", got)
+	}
+	if got := translateFrom(messages, LanguageRussian, "no_such_message"); got != "no_such_message" {
+		t.Errorf("Expected an unknown key to show the key, got %q", got)
+	}
+	if got := translateFrom(messages, LanguageRussian, "greeting", "Боб"); got != "Привет Боб" {
+		t.Errorf("Expected arguments to be formatted, got %q", got)
+	}
+}
+
+func TestWelcomeNamesPanelButtons(t *testing.T) {
+	for language := range catalog {
+		welcome := translate(language, msgWelcome)
+		for action, key := range panelButtons {
+			if action == panelActionCancel {
+				continue
+			}
+			if label := translate(language, key); !strings.Contains(welcome, label) {
+				t.Errorf("%s welcome does not name the %q button", language, label)
+			}
+		}
+	}
+}
+
+func TestTypedPanelActionAcceptsEveryLanguage(t *testing.T) {
+	for language := range catalog {
+		for action, key := range panelButtons {
+			if got, ok := typedPanelAction(translate(language, key)); !ok || got != action {
+				t.Errorf("Typed %s label of %s gave %q %v", language, action, got, ok)
+			}
+		}
+	}
+	if _, ok := typedPanelAction("hello"); ok {
+		t.Error("Expected free text not to match a button")
+	}
+}
+
+func TestBroadcastUsesRecipientLanguage(t *testing.T) {
+	fake := newFakeTelegram(t)
+	tb := newTestTelegramBot(t, fake)
+	subscriptions, err := NewSubscriptionStore(filepath.Join(t.TempDir(), "subscriptions.json"))
+	if err != nil {
+		t.Fatalf("NewSubscriptionStore failed: %v", err)
+	}
+	tb.SetSubscriptions(subscriptions)
+	subscriptions.Subscribe(testChatID)
+	if err := tb.languages.SetOverride(testUserID, LanguageRussian); err != nil {
+		t.Fatalf("SetOverride failed: %v", err)
+	}
+
+	tb.NotifyAPIAction(ActionEnableVPN, "ci", nil)
+	call := fake.WaitFor(t, "sendMessage", "Действие через API")
+	if !strings.Contains(call.Params["text"], "Маршрут через VPN") {
+		t.Errorf("Expected the action to be named in Russian, got %q", call.Params["text"])
+	}
+}
+
+func TestErrorRepliesAreTranslated(t *testing.T) {
+	fake := newFakeTelegram(t)
+	tb := newTestTelegramBot(t, fake)
+	tb.authorizeUser(testUserID, testChatID, RoleAdmin, VPNStatusUnknown)
+	vm := newOfflineVPNManager(t)
+	scheduler, err := NewScheduler(filepath.Join(t.TempDir(), "schedule.json"), vm, time.UTC, vm.logger)
+	if err != nil {
+		t.Fatalf("NewScheduler failed: %v", err)
+	}
+	tb.SetScheduler(scheduler)
+
+	russian := func(id int, text string) tgbotapi.Update {
+		update := messageUpdate(id, text)
+		update.Message.From.LanguageCode = "ru"
+		return update
+	}
+
+	// Go error strings stay in the log; the reply names the problem in the user's language
+	tests := []struct {
+		text string
+		want string
+	}{
+		{CommandSchedule + " add daily 25:00 stop", `Неверное время "25:00"`},
+		{CommandSchedule + " add daily 09:00 reboot", `Неизвестное действие "reboot"`},
+		{CommandSchedule + " add someday 09:00 stop", `Неверные дни "someday"`},
+		{CommandSchedule + " remove abc123", "Правила с ID abc123 нет"},
+	}
+	for i, tt := range tests {
+		tb.handleUpdate(russian(i+1, tt.text))
+		call := fake.WaitFor(t, "sendMessage", tt.want)
+		for _, english := range []string{"invalid time", "unknown action", "unknown day", "not found"} {
+			if strings.Contains(call.Params["text"], english) {
+				t.Errorf("Reply to %q contains the Go error %q: %s", tt.text, english, call.Params["text"])
+			}
+		}
+	}
+}
+
+func TestParseLanguage(t *testing.T) {
+	tests := []struct {
+		code string
+		want Language
+		ok   bool
+	}{
+		{code: "ru", want: LanguageRussian, ok: true},
+		{code: "ru-RU", want: LanguageRussian, ok: true},
+		{code: "EN-us", want: LanguageEnglish, ok: true},
+		{code: "de", ok: false},
+		{code: "", ok: false},
+	}
+
+	for _, tt := range tests {
+		language, ok := parseLanguage(tt.code)
+		if ok != tt.ok || (ok && language != tt.want) {
+			t.Errorf("parseLanguage(%q) = %s %v, want %s %v", tt.code, language, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestLanguageStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "languages.json")
+	store, err := NewLanguageStore(path)
+	if err != nil {
+		t.Fatalf("NewLanguageStore failed: %v", err)
+	}
+
+	if language := store.Resolve(1, "ru-RU"); language != LanguageRussian {
+		t.Errorf("Expected the Telegram language, got %s", language)
+	}
+	if language := store.Language(1); language != LanguageRussian {
+		t.Errorf("Expected the Telegram language to be remembered, got %s", language)
+	}
+	if language := store.Resolve(2, "de"); language != defaultLanguage {
+		t.Errorf("Expected an unsupported language to get %s, got %s", defaultLanguage, language)
+	}
+
+	if err := store.SetOverride(1, LanguageEnglish); err != nil {
+		t.Fatalf("SetOverride failed: %v", err)
+	}
+	if language := store.Resolve(1, "ru"); language != LanguageEnglish {
+		t.Errorf("Expected /lang to win over Telegram, got %s", language)
+	}
+
+	// Overrides survive a restart, detected languages do not need to
+	reloaded, err := NewLanguageStore(path)
+	if err != nil {
+		t.Fatalf("Reloading failed: %v", err)
+	}
+	if language, ok := reloaded.Override(1); !ok || language != LanguageEnglish {
+		t.Errorf("Expected the override to be persisted, got %s %v", language, ok)
+	}
+
+	if err := reloaded.ClearOverride(1); err != nil {
+		t.Fatalf("ClearOverride failed: %v", err)
+	}
+	if language := reloaded.Resolve(1, "ru"); language != LanguageRussian {
+		t.Errorf("Expected the Telegram language after /lang auto, got %s", language)
+	}
+
+	// Strangers are answered in their language without being remembered
+	if language := reloaded.Lookup(3, "ru"); language != LanguageRussian {
+		t.Errorf("Expected Lookup to use the Telegram language, got %s", language)
+	}
+	if language := reloaded.Language(3); language != defaultLanguage {
+		t.Errorf("Expected Lookup not to remember the language, got %s", language)
+	}
+}
+
+func TestLanguageStoreKeepsOverridesWhenSaveFails(t *testing.T) {
+	// Saving over a directory fails
+	store := newLanguageStore(t.TempDir())
+
+	if err := store.SetOverride(1, LanguageRussian); err == nil {
+		t.Fatal("Expected SetOverride to fail")
+	}
+	if language, ok := store.Override(1); ok {
+		t.Errorf("Expected a failed save to leave no override, got %s", language)
+	}
+}
+
+func TestE2ELanguage(t *testing.T) {
+	fake, tb := startE2EBot(t)
+	russian := tgbotapi.User{ID: testUserID, UserName: "tester", LanguageCode: "ru"}
+
+	fake.InjectMessage(testChatID, russian, CommandStatus)
+	fake.WaitFor(t, "sendMessage", "Доступ запрещён")
+
+	// /lang needs a session, and strangers leave nothing behind in the store
+	fake.InjectMessage(testChatID, russian, CommandLang+" en")
+	waitForCalls(t, fake, "sendMessage", "Доступ запрещён", 2)
+	if language, ok := tb.languages.Override(testUserID); ok {
+		t.Errorf("Expected /lang to be refused before authentication, got %s", language)
+	}
+	if language := tb.languages.Language(testUserID); language != defaultLanguage {
+		t.Errorf("Expected the language of a stranger not to be remembered, got %s", language)
+	}
+
+	fake.InjectMessage(testChatID, russian, CommandAuth+" "+e2eAuthCode)
+	panel := fake.WaitFor(t, "sendMessage", "Авторизация успешна")
+	buttonData(t, panel, "🔍 Статус")
+
+	// /lang wins over the Telegram settings
+	fake.InjectMessage(testChatID, russian, CommandLang+" de")
+	fake.WaitFor(t, "sendMessage", "не поддерживается")
+	fake.InjectMessage(testChatID, russian, CommandLang+" en")
+	fake.WaitFor(t, "sendMessage", "Language set to English")
+
+	fake.InjectMessage(testChatID, russian, CommandLang+" auto")
+	fake.WaitFor(t, "sendMessage", "Язык снова берётся из настроек Telegram")
+	fake.InjectMessage(testChatID, russian, CommandPanel)
+	fake.WaitFor(t, "sendMessage", "Выберите действие ниже")
+}
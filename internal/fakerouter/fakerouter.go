@@ -0,0 +1,352 @@
+// Package fakerouter is an in-memory stand-in for an xkeen router in tests
+//
+// It keeps the Xray config directory as a map of files, makes timestamped backups on every
+// write like the SSH client does, tracks whether the service is running and lets tests
+// inject failures per operation.
+package fakerouter
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Paths of the seeded Xray config directory
+const (
+	ConfigDir     = "/opt/etc/xray/configs"
+	RoutingPath   = ConfigDir + "/05_routing.json"
+	OutboundsPath = ConfigDir + "/04_outbounds.json"
+)
+
+// Outputs of xkeen -status, which xkeen prints in Russian
+const (
+	StatusRunning = "Прокси-клиент запущен"
+	StatusStopped = "Прокси-клиент не запущен"
+)
+
+// backupTimeLayout matches the date +%Y%m%d-%H%M%S suffix of backups made by the SSH client
+const backupTimeLayout = "20060102-150405"
+
+// Op names an operation failures can be injected into
+type Op string
+
+const (
+	OpReadFile  Op = "read"
+	OpWriteFile Op = "write"
+	OpRestart   Op = "restart"
+	OpStart     Op = "start"
+	OpStop      Op = "stop"
+	OpStatus    Op = "status"
+	OpExec      Op = "exec"
+	OpUptime    Op = "uptime"
+)
+
+// Router is an in-memory router; the zero value is not usable, call New
+type Router struct {
+	Now func() time.Time // Clock used for backup names, time.Now by default
+
+	mutex    sync.Mutex
+	host     string
+	files    map[string]string
+	running  bool
+	uptime   time.Duration
+	failures map[Op]error
+	calls    []Op
+	restarts int
+	commands func(command string) (string, error)
+}
+
+// New returns a running router whose config directory holds a routing config sending the
+// default rule to outbound, next to an outbounds file with vless-reality, direct and block
+func New(outbound string) *Router {
+	return &Router{
+		Now:     time.Now,
+		host:    "fake-router",
+		running: true,
+		uptime:  time.Hour,
+		files: map[string]string{
+			RoutingPath:   RoutingConfig(outbound),
+			OutboundsPath: OutboundsConfig,
+		},
+		failures: make(map[Op]error),
+	}
+}
+
+// RoutingConfig returns a routing config with a domain rule and a default rule sending traffic to outbound
+func RoutingConfig(outbound string) string {
+	return fmt.Sprintf(`{
+  "routing": {
+    "domainStrategy": "IPIfNonMatch",
+    "rules": [
+      {
+        "type": "field",
+        "domain": ["geosite:ru"],
+        "outboundTag": "direct"
+      },
+      {
+        "type": "field",
+        "inboundTag": ["redirect", "tproxy"],
+        "outboundTag": %q,
+        "network": "tcp,udp"
+      }
+    ]
+  }
+}`, outbound)
+}
+
+// OutboundsConfig is the seeded outbounds file with vless-reality, direct and block
+const OutboundsConfig = `{
+  "outbounds": [
+    {
+      "tag": "vless-reality",
+      "protocol": "vless",
+      "settings": {"vnext": [{"address": "vpn.example.com", "port": 443, "users": [{"id": "00000000-0000-0000-0000-000000000000"}]}]}
+    },
+    {"tag": "direct", "protocol": "freedom"},
+    {"tag": "block", "protocol": "blackhole"}
+  ]
+}`
+
+// SetHost changes the address the router reports
+func (r *Router) SetHost(host string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.host = host
+}
+
+// SetFile creates or replaces a file without making a backup
+func (r *Router) SetFile(filePath, content string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.files[filePath] = content
+}
+
+// RemoveFile deletes a file
+func (r *Router) RemoveFile(filePath string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	delete(r.files, filePath)
+}
+
+// File returns the content of a file and whether it exists
+func (r *Router) File(filePath string) (string, bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	content, ok := r.files[filePath]
+	return content, ok
+}
+
+// Backups returns the backup files of filePath, oldest first
+func (r *Router) Backups(filePath string) []string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.backupsLocked(filePath)
+}
+
+func (r *Router) backupsLocked(filePath string) []string {
+	var backups []string
+	for name := range r.files {
+		if strings.HasPrefix(name, filePath+".backup.") {
+			backups = append(backups, name)
+		}
+	}
+	sort.Strings(backups)
+	return backups
+}
+
+// SetRunning starts or stops the service without going through xkeen
+func (r *Router) SetRunning(running bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.running = running
+}
+
+// Running reports whether the service is running
+func (r *Router) Running() bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.running
+}
+
+// Restarts returns how often the service was restarted
+func (r *Router) Restarts() int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.restarts
+}
+
+// SetUptime changes the uptime the router reports
+func (r *Router) SetUptime(uptime time.Duration) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.uptime = uptime
+}
+
+// Fail makes every following op fail with err; a nil err clears the failure
+func (r *Router) Fail(op Op, err error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if err == nil {
+		delete(r.failures, op)
+		return
+	}
+	r.failures[op] = err
+}
+
+// HandleCommands answers ExecuteCommand calls the router does not emulate itself
+func (r *Router) HandleCommands(handler func(command string) (string, error)) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.commands = handler
+}
+
+// Calls returns the operations performed so far, in order
+func (r *Router) Calls() []Op {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return append([]Op(nil), r.calls...)
+}
+
+// begin records op and returns its injected failure; the caller holds the mutex
+func (r *Router) begin(op Op) error {
+	r.calls = append(r.calls, op)
+	return r.failures[op]
+}
+
+// ReadFile returns the content of a file; for a missing one it returns cat's complaint and
+// the exit status error, as SSHClient does
+func (r *Router) ReadFile(filePath string) (string, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if err := r.begin(OpReadFile); err != nil {
+		return "", err
+	}
+	content, ok := r.files[filePath]
+	if !ok {
+		return fmt.Sprintf("cat: can't open '%s': No such file or directory\n", filePath), errors.New("command execution failed: Process exited with status 1")
+	}
+	return content, nil
+}
+
+// WriteFile backs up the current content and replaces it, ending it with a newline like the heredoc write does
+func (r *Router) WriteFile(filePath, content string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if err := r.begin(OpWriteFile); err != nil {
+		return fmt.Errorf("failed to write file %s: %w", filePath, err)
+	}
+	if old, ok := r.files[filePath]; ok {
+		r.files[filePath+".backup."+r.Now().Format(backupTimeLayout)] = old
+	}
+	r.files[filePath] = content + "\n"
+	return nil
+}
+
+// RestartService starts the service, or restarts it when running
+func (r *Router) RestartService() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if err := r.begin(OpRestart); err != nil {
+		return fmt.Errorf("failed to restart Xray service: %w", err)
+	}
+	r.running = true
+	r.restarts++
+	return nil
+}
+
+// StartService starts the service
+func (r *Router) StartService() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if err := r.begin(OpStart); err != nil {
+		return fmt.Errorf("failed to start Xray service: %w", err)
+	}
+	r.running = true
+	return nil
+}
+
+// StopService stops the service
+func (r *Router) StopService() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if err := r.begin(OpStop); err != nil {
+		return fmt.Errorf("failed to stop Xray service: %w", err)
+	}
+	r.running = false
+	return nil
+}
+
+// GetServiceStatus returns what xkeen -status prints for the current state
+func (r *Router) GetServiceStatus() (string, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if err := r.begin(OpStatus); err != nil {
+		return "", fmt.Errorf("failed to get Xray service status: %w", err)
+	}
+	if r.running {
+		return StatusRunning, nil
+	}
+	return StatusStopped, nil
+}
+
+// ExecuteCommand emulates the connection test, backup listing and uptime commands, passing
+// anything else to the handler set by HandleCommands
+func (r *Router) ExecuteCommand(command string) (string, error) {
+	r.mutex.Lock()
+	if err := r.begin(OpExec); err != nil {
+		r.mutex.Unlock()
+		return "", err
+	}
+
+	switch {
+	case command == "echo 'connection_test'":
+		r.mutex.Unlock()
+		return "connection_test\n", nil
+	case command == "cat /proc/uptime":
+		uptime := r.uptime
+		r.mutex.Unlock()
+		return fmt.Sprintf("%.2f %.2f\n", uptime.Seconds(), uptime.Seconds()), nil
+	case strings.HasPrefix(command, "ls -1 ") && strings.HasSuffix(command, ".backup.* 2>/dev/null || true"):
+		filePath := strings.TrimSuffix(strings.TrimPrefix(command, "ls -1 "), ".backup.* 2>/dev/null || true")
+		backups := r.backupsLocked(filePath)
+		r.mutex.Unlock()
+		if len(backups) == 0 {
+			return "", nil
+		}
+		return strings.Join(backups, "\n") + "\n", nil
+	}
+
+	handler := r.commands
+	r.mutex.Unlock()
+	if handler == nil {
+		return "", errors.New("command execution failed: unsupported command: " + command)
+	}
+	return handler(command)
+}
+
+// GetUptime returns the configured uptime
+func (r *Router) GetUptime() (time.Duration, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if err := r.begin(OpUptime); err != nil {
+		return 0, fmt.Errorf("failed to read uptime: %w", err)
+	}
+	return r.uptime, nil
+}
+
+// Host returns the router address
+func (r *Router) Host() string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.host
+}
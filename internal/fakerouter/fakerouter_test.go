@@ -0,0 +1,60 @@
+package fakerouter
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRouterBacksUpWrites(t *testing.T) {
+	router := New("direct")
+	router.Now = func() time.Time { return time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC) }
+
+	if err := router.WriteFile(RoutingPath, "{}"); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	if content, _ := router.File(RoutingPath); content != "{}\n" {
+		t.Errorf("Expected the new content, got %q", content)
+	}
+
+	listing, err := router.ExecuteCommand("ls -1 " + RoutingPath + ".backup.* 2>/dev/null || true")
+	if err != nil {
+		t.Fatalf("Listing backups failed: %v", err)
+	}
+	if listing != RoutingPath+".backup.20240501-120000\n" {
+		t.Errorf("Unexpected backup listing %q", listing)
+	}
+	if backup, _ := router.File(RoutingPath + ".backup.20240501-120000"); backup != RoutingConfig("direct") {
+		t.Errorf("Expected the backup to hold the seeded config, got %q", backup)
+	}
+
+	if output, err := router.ReadFile(ConfigDir + "/missing.json"); err == nil || !strings.Contains(output, "No such file") {
+		t.Errorf("Expected reading a missing file to fail like cat, got %q (%v)", output, err)
+	}
+}
+
+func TestRouterServiceState(t *testing.T) {
+	router := New("direct")
+
+	if err := router.StopService(); err != nil {
+		t.Fatalf("StopService failed: %v", err)
+	}
+	if status, _ := router.GetServiceStatus(); status != StatusStopped {
+		t.Errorf("Expected %q, got %q", StatusStopped, status)
+	}
+
+	router.Fail(OpRestart, errors.New("xkeen not found"))
+	if err := router.RestartService(); err == nil || router.Running() {
+		t.Errorf("Expected a failed restart to leave the service stopped, got %v", err)
+	}
+	router.Fail(OpRestart, nil)
+	if err := router.RestartService(); err != nil || !router.Running() || router.Restarts() != 1 {
+		t.Errorf("Expected one successful restart, got %v", err)
+	}
+
+	calls := router.Calls()
+	if len(calls) != 4 || calls[0] != OpStop || calls[3] != OpRestart {
+		t.Errorf("Unexpected calls %v", calls)
+	}
+}
@@ -0,0 +1,173 @@
+package sshfake
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+)
+
+// shell runs the steps of one command line, keeping the working directory between them
+type shell struct {
+	server *Server
+	cwd    string
+}
+
+// runOr runs `step || fallback`, where the fallback only runs when step fails
+func (sh *shell) runOr(step string) Result {
+	alternatives := strings.Split(step, " || ")
+	var result Result
+	for _, alternative := range alternatives {
+		result = sh.run(alternative)
+		if result.Status == 0 {
+			break
+		}
+	}
+	return result
+}
+
+// run executes a single simple command
+func (sh *shell) run(step string) Result {
+	args := splitWords(step)
+	discardStderr := false
+	words := args[:0]
+	for _, arg := range args {
+		if arg == "2>/dev/null" {
+			discardStderr = true
+			continue
+		}
+		words = append(words, arg)
+	}
+	if len(words) == 0 {
+		return Result{}
+	}
+
+	result := sh.builtin(words[0], words[1:])
+	if discardStderr {
+		result.Stderr = ""
+	}
+	return result
+}
+
+func (sh *shell) builtin(name string, args []string) Result {
+	switch name {
+	case "true", "export":
+		return Result{}
+	case "echo":
+		return Result{Stdout: strings.Join(args, " ") + "\n"}
+	case "cd":
+		return sh.cd(args)
+	case "cat":
+		return sh.cat(args)
+	case "cp":
+		return sh.cp(args)
+	case "ls":
+		return sh.ls(args)
+	case "xkeen":
+		return sh.server.xkeen(args)
+	}
+
+	sh.server.mutex.Lock()
+	handler := sh.server.handler
+	sh.server.mutex.Unlock()
+	if handler != nil {
+		output, status := handler(strings.Join(append([]string{name}, args...), " "))
+		return Result{Stdout: output, Status: status}
+	}
+	return Result{Stderr: fmt.Sprintf("sh: %s: not found\n", name), Status: 127}
+}
+
+// resolve turns a possibly relative router path into an absolute one
+func (sh *shell) resolve(p string) string {
+	if path.IsAbs(p) {
+		return path.Clean(p)
+	}
+	return path.Join(sh.cwd, p)
+}
+
+func (sh *shell) cd(args []string) Result {
+	if len(args) != 1 {
+		return Result{Stderr: "sh: cd: bad usage\n", Status: 2}
+	}
+	dir := sh.resolve(args[0])
+	if info, err := os.Stat(sh.server.Path(dir)); err != nil || !info.IsDir() {
+		return Result{Stderr: fmt.Sprintf("sh: cd: can't cd to %s: No such file or directory\n", args[0]), Status: 2}
+	}
+	sh.cwd = dir
+	return Result{}
+}
+
+func (sh *shell) cat(args []string) Result {
+	var result Result
+	for _, arg := range args {
+		content, err := os.ReadFile(sh.server.Path(sh.resolve(arg)))
+		if err != nil {
+			result.Stderr += fmt.Sprintf("cat: can't open '%s': No such file or directory\n", arg)
+			result.Status = 1
+			continue
+		}
+		result.Stdout += string(content)
+	}
+	return result
+}
+
+func (sh *shell) cp(args []string) Result {
+	if len(args) != 2 {
+		return Result{Stderr: "BusyBox cp: bad usage\n", Status: 1}
+	}
+	content, err := os.ReadFile(sh.server.Path(sh.resolve(args[0])))
+	if err != nil {
+		return Result{Stderr: fmt.Sprintf("cp: can't stat '%s': No such file or directory\n", args[0]), Status: 1}
+	}
+	if err := os.WriteFile(sh.server.Path(sh.resolve(args[1])), content, 0o644); err != nil {
+		return Result{Stderr: fmt.Sprintf("cp: can't create '%s': No such file or directory\n", args[1]), Status: 1}
+	}
+	return Result{}
+}
+
+// ls supports the -1 listing of globs used to find backups
+func (sh *shell) ls(args []string) Result {
+	var result Result
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "-") {
+			continue
+		}
+		matches, err := sh.server.glob(sh.resolve(arg))
+		if err != nil || len(matches) == 0 {
+			result.Stderr += fmt.Sprintf("ls: %s: No such file or directory\n", arg)
+			result.Status = 1
+			continue
+		}
+		for _, match := range matches {
+			result.Stdout += match + "\n"
+		}
+	}
+	return result
+}
+
+// splitWords splits a command on spaces, keeping single-quoted words together without their quotes
+func splitWords(command string) []string {
+	var words []string
+	var word strings.Builder
+	inWord, quoted := false, false
+	for _, r := range command {
+		switch {
+		case r == '\'':
+			quoted = !quoted
+			inWord = true
+		case (r == ' ' || r == '\t') && !quoted:
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words
+}
@@ -0,0 +1,402 @@
+// Package sshfake is an in-process SSH server emulating an xkeen router for tests
+//
+// The router filesystem lives in a temporary directory. The server understands the commands
+// SSHClient sends: cat, cp with a $(date) suffix, heredoc writes, ls globs, echo and xkeen with
+// its Russian output and the "ps: applet not found" noise busybox adds, chained with && and ||.
+package sshfake
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+
+	"vpn-commander/internal/fakerouter"
+)
+
+// Credentials the server accepts
+const (
+	Username = "root"
+	Password = "keenetic"
+)
+
+// Outputs of xkeen, which prints in Russian and colours the state
+const (
+	StatusRunning = "Прокси-клиент \033[32mзапущен\033[0m"
+	StatusStopped = "Прокси-клиент \033[31mне запущен\033[0m"
+	appletNoise   = "ps: applet not found"
+)
+
+// dateSubstitution is the backup suffix SSHClient.WriteFile asks the shell to expand
+const dateSubstitution = "$(date +%Y%m%d-%H%M%S)"
+
+// heredocDelimiter ends the heredoc SSHClient.WriteFile sends
+const heredocDelimiter = "\nEOF"
+
+// Handler answers a command the server does not emulate, returning its output and exit status
+type Handler func(command string) (output string, status int)
+
+// Server is a fake router reachable over SSH
+type Server struct {
+	Now func() time.Time // Clock used for $(date), time.Now by default
+
+	listener net.Listener
+	config   *ssh.ServerConfig
+	root     string
+
+	mutex    sync.Mutex
+	running  bool
+	restarts int
+	commands []string
+	failures map[string]string // Command substring -> output of the failing command
+	handler  Handler
+	conns    map[*ssh.ServerConn]struct{}
+	wg       sync.WaitGroup
+}
+
+// NewServer starts a server whose filesystem holds the xkeen config directory, with the default
+// rule routed to outbound, and /proc/uptime; the service is running. Call Close when done.
+// Like httptest.NewServer it panics when the server cannot start.
+func NewServer(outbound string) *Server {
+	root, err := os.MkdirTemp("", "sshfake-")
+	if err != nil {
+		panic(fmt.Sprintf("sshfake: creating root: %v", err))
+	}
+	s := &Server{
+		Now:      time.Now,
+		root:     root,
+		running:  true,
+		failures: make(map[string]string),
+		conns:    make(map[*ssh.ServerConn]struct{}),
+	}
+	s.WriteFile(fakerouter.RoutingPath, fakerouter.RoutingConfig(outbound))
+	s.WriteFile(fakerouter.OutboundsPath, fakerouter.OutboundsConfig)
+	s.WriteFile("/proc/uptime", "3600.00 7200.00\n")
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		panic(fmt.Sprintf("sshfake: generating host key: %v", err))
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		panic(fmt.Sprintf("sshfake: loading host key: %v", err))
+	}
+	s.config = &ssh.ServerConfig{
+		PasswordCallback: func(conn ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if conn.User() == Username && string(password) == Password {
+				return nil, nil
+			}
+			return nil, errors.New("permission denied")
+		},
+	}
+	s.config.AddHostKey(signer)
+
+	if s.listener, err = net.Listen("tcp", "127.0.0.1:0"); err != nil {
+		panic(fmt.Sprintf("sshfake: listening: %v", err))
+	}
+	s.wg.Add(1)
+	go s.accept()
+	return s
+}
+
+// Close stops the server, drops its connections and removes the filesystem
+func (s *Server) Close() {
+	s.listener.Close()
+	s.DropConnections()
+	s.wg.Wait()
+	os.RemoveAll(s.root)
+}
+
+// Addr returns the host:port to dial
+func (s *Server) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// DropConnections closes every open connection, as a router reboot or network blip would
+func (s *Server) DropConnections() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+}
+
+// Path returns where a router path lives on the local filesystem
+func (s *Server) Path(routerPath string) string {
+	return filepath.Join(s.root, filepath.FromSlash(path.Clean("/"+routerPath)))
+}
+
+// WriteFile creates or replaces a router file, creating its directory
+func (s *Server) WriteFile(routerPath, content string) {
+	local := s.Path(routerPath)
+	if err := os.MkdirAll(filepath.Dir(local), 0o755); err != nil {
+		panic(fmt.Sprintf("sshfake: creating %s: %v", routerPath, err))
+	}
+	if err := os.WriteFile(local, []byte(content), 0o644); err != nil {
+		panic(fmt.Sprintf("sshfake: writing %s: %v", routerPath, err))
+	}
+}
+
+// ReadFile returns the content of a router file and whether it exists
+func (s *Server) ReadFile(routerPath string) (string, bool) {
+	content, err := os.ReadFile(s.Path(routerPath))
+	return string(content), err == nil
+}
+
+// Backups returns the router paths of the backups of routerPath, oldest first
+func (s *Server) Backups(routerPath string) []string {
+	matches, _ := s.glob(routerPath + ".backup.*")
+	return matches
+}
+
+// SetRunning starts or stops the service without going through xkeen
+func (s *Server) SetRunning(running bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.running = running
+}
+
+// Running reports whether the service is running
+func (s *Server) Running() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.running
+}
+
+// Restarts returns how often xkeen -restart ran
+func (s *Server) Restarts() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.restarts
+}
+
+// Commands returns the commands received so far, in order
+func (s *Server) Commands() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]string(nil), s.commands...)
+}
+
+// Fail makes every command containing substring print output and exit with status 1
+func (s *Server) Fail(substring, output string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.failures[substring] = output
+}
+
+// ClearFailures undoes every Fail
+func (s *Server) ClearFailures() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.failures = make(map[string]string)
+}
+
+// Handle answers commands the server does not emulate, such as the curl probes
+func (s *Server) Handle(handler Handler) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.handler = handler
+}
+
+func (s *Server) accept() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.wg.Add(1)
+		go s.serveConn(conn)
+	}
+}
+
+func (s *Server) serveConn(netConn net.Conn) {
+	defer s.wg.Done()
+
+	conn, channels, requests, err := ssh.NewServerConn(netConn, s.config)
+	if err != nil {
+		netConn.Close()
+		return
+	}
+	s.mutex.Lock()
+	s.conns[conn] = struct{}{}
+	s.mutex.Unlock()
+	defer func() {
+		s.mutex.Lock()
+		delete(s.conns, conn)
+		s.mutex.Unlock()
+		conn.Close()
+	}()
+
+	go ssh.DiscardRequests(requests)
+	for newChannel := range channels {
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "only sessions are supported")
+			continue
+		}
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			continue
+		}
+		s.wg.Add(1)
+		go s.serveSession(channel, requests)
+	}
+}
+
+// serveSession runs the session's exec request and reports its exit status
+func (s *Server) serveSession(channel ssh.Channel, requests <-chan *ssh.Request) {
+	defer s.wg.Done()
+	defer channel.Close()
+
+	for request := range requests {
+		if request.Type != "exec" {
+			if request.WantReply {
+				request.Reply(false, nil)
+			}
+			continue
+		}
+
+		var exec struct{ Command string }
+		if err := ssh.Unmarshal(request.Payload, &exec); err != nil {
+			request.Reply(false, nil)
+			continue
+		}
+		request.Reply(true, nil)
+
+		result := s.Run(exec.Command)
+		channel.Write([]byte(result.Stdout))
+		channel.Stderr().Write([]byte(result.Stderr))
+		channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{uint32(result.Status)}))
+		return
+	}
+}
+
+// Result is the outcome of a command
+type Result struct {
+	Stdout string
+	Stderr string
+	Status int
+}
+
+// Run interprets command the way the router's shell would
+func (s *Server) Run(command string) Result {
+	s.mutex.Lock()
+	s.commands = append(s.commands, command)
+	for substring, output := range s.failures {
+		if strings.Contains(command, substring) {
+			s.mutex.Unlock()
+			return Result{Stderr: output, Status: 1}
+		}
+	}
+	s.mutex.Unlock()
+
+	// A heredoc swallows the rest of the command, so it is recognised before splitting on &&
+	if target, content, ok := parseHeredoc(command); ok {
+		return s.writeHeredoc(target, content)
+	}
+
+	command = strings.ReplaceAll(command, dateSubstitution, s.Now().Format("20060102-150405"))
+	shell := &shell{server: s, cwd: "/"}
+	var combined Result
+	for _, step := range strings.Split(command, " && ") {
+		result := shell.runOr(step)
+		combined.Stdout += result.Stdout
+		combined.Stderr += result.Stderr
+		combined.Status = result.Status
+		if result.Status != 0 {
+			break
+		}
+	}
+	return combined
+}
+
+// parseHeredoc splits `cat > PATH << 'EOF'\nCONTENT\nEOF` into its target and content
+func parseHeredoc(command string) (target, content string, ok bool) {
+	header, body, found := strings.Cut(command, "\n")
+	if !found || !strings.HasSuffix(header, " << 'EOF'") || !strings.HasPrefix(header, "cat > ") {
+		return "", "", false
+	}
+	target = strings.TrimSuffix(strings.TrimPrefix(header, "cat > "), " << 'EOF'")
+	body, found = strings.CutSuffix("\n"+body, heredocDelimiter)
+	if !found {
+		return "", "", false
+	}
+	return target, strings.TrimPrefix(body, "\n"), true
+}
+
+func (s *Server) writeHeredoc(target, content string) Result {
+	local := s.Path(target)
+	if info, err := os.Stat(filepath.Dir(local)); err != nil || !info.IsDir() {
+		return Result{Stderr: fmt.Sprintf("sh: can't create %s: nonexistent directory\n", target), Status: 1}
+	}
+	// The line break before the delimiter belongs to the heredoc, so the file ends with one
+	if err := os.WriteFile(local, []byte(content+"\n"), 0o644); err != nil {
+		return Result{Stderr: fmt.Sprintf("sh: can't create %s: %v\n", target, err), Status: 1}
+	}
+	return Result{}
+}
+
+// glob expands a router path pattern into router paths, sorted
+func (s *Server) glob(pattern string) ([]string, error) {
+	matches, err := filepath.Glob(s.Path(pattern))
+	if err != nil {
+		return nil, err
+	}
+	paths := make([]string, 0, len(matches))
+	for _, match := range matches {
+		relative, err := filepath.Rel(s.root, match)
+		if err != nil {
+			continue
+		}
+		paths = append(paths, "/"+filepath.ToSlash(relative))
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// xkeen emulates the xkeen control script, which runs ps for every action
+func (s *Server) xkeen(args []string) Result {
+	if len(args) != 1 {
+		return Result{Stdout: "Использование: xkeen -start | -stop | -restart | -status\n", Status: 1}
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	noise := appletNoise + "\n"
+	switch args[0] {
+	case "-status":
+		if s.running {
+			return Result{Stdout: "  " + StatusRunning + "\n", Stderr: noise}
+		}
+		return Result{Stdout: "  " + StatusStopped + "\n", Stderr: noise}
+	case "-start":
+		if s.running {
+			return Result{Stdout: "  Прокси-клиент уже \033[32mзапущен\033[0m\n", Stderr: noise}
+		}
+		s.running = true
+		return Result{Stdout: "  Прокси-клиент \033[32mзапущен\033[0m\n", Stderr: noise + noise}
+	case "-stop":
+		if !s.running {
+			return Result{Stdout: "  Прокси-клиент \033[31mне запущен\033[0m\n", Stderr: noise}
+		}
+		s.running = false
+		return Result{Stdout: "  Прокси-клиент \033[31mостановлен\033[0m\n", Stderr: noise}
+	case "-restart":
+		s.running = true
+		s.restarts++
+		return Result{Stdout: "  Прокси-клиент \033[32mперезапущен\033[0m\n", Stderr: noise + noise}
+	default:
+		return Result{Stdout: fmt.Sprintf("  Неизвестный аргумент: %s\n", args[0]), Status: 1}
+	}
+}
@@ -0,0 +1,70 @@
+package sshfake
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"vpn-commander/internal/fakerouter"
+)
+
+func TestServerRunsRouterCommands(t *testing.T) {
+	server := NewServer("direct")
+	defer server.Close()
+	server.Now = func() time.Time { return time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC) }
+
+	tests := []struct {
+		name    string
+		command string
+		stdout  string
+		stderr  string
+		status  int
+	}{
+		{name: "echo", command: "echo 'connection_test'", stdout: "connection_test\n"},
+		{name: "cat", command: "cat /proc/uptime", stdout: "3600.00 7200.00\n"},
+		{name: "cat missing", command: "cat /etc/missing", stderr: "cat: can't open '/etc/missing': No such file or directory\n", status: 1},
+		{name: "ls without match", command: "ls -1 /tmp/*.json", stderr: "ls: /tmp/*.json: No such file or directory\n", status: 1},
+		{name: "ls silenced", command: "ls -1 " + fakerouter.RoutingPath + ".backup.* 2>/dev/null || true"},
+		{name: "backup", command: "cp " + fakerouter.RoutingPath + " " + fakerouter.RoutingPath + ".backup.$(date +%Y%m%d-%H%M%S)"},
+		{name: "ls backups", command: "ls -1 " + fakerouter.RoutingPath + ".backup.*", stdout: fakerouter.RoutingPath + ".backup.20240501-120000\n"},
+		{name: "cd missing", command: "cd /opt/missing && xkeen -stop", stderr: "sh: cd: can't cd to /opt/missing: No such file or directory\n", status: 2},
+		{name: "unknown", command: "curl -s https://example.com", stderr: "sh: curl: not found\n", status: 127},
+		{
+			name:    "status",
+			command: "export PATH=/opt/sbin:/opt/bin && cd " + fakerouter.ConfigDir + " && xkeen -status",
+			stdout:  "  " + StatusRunning + "\n",
+			stderr:  appletNoise + "\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := server.Run(tt.command)
+			if result.Stdout != tt.stdout || result.Stderr != tt.stderr || result.Status != tt.status {
+				t.Errorf("Expected %q %q %d, got %q %q %d", tt.stdout, tt.stderr, tt.status, result.Stdout, result.Stderr, result.Status)
+			}
+		})
+	}
+
+	if !server.Running() {
+		t.Error("A failed cd must keep xkeen -stop from running")
+	}
+}
+
+func TestServerWritesHeredoc(t *testing.T) {
+	server := NewServer("direct")
+	defer server.Close()
+
+	content := "{\n  \"a\": \"x && y || z\"\n}"
+	if result := server.Run("cat > /opt/etc/test.json << 'EOF'\n" + content + "\nEOF"); result.Status != 0 {
+		t.Fatalf("Heredoc write failed: %+v", result)
+	}
+	if written, _ := server.ReadFile("/opt/etc/test.json"); written != content+"\n" {
+		t.Errorf("Expected %q, got %q", content+"\n", written)
+	}
+
+	result := server.Run("cat > /missing/dir/test.json << 'EOF'\n{}\nEOF")
+	if result.Status != 1 || !strings.Contains(result.Stderr, "can't create") {
+		t.Errorf("Expected writing into a missing directory to fail, got %+v", result)
+	}
+}
@@ -0,0 +1,386 @@
+// Package tgfake is an in-process fake of the Telegram Bot API for tests
+//
+// It records every request, keeps the messages visible in each chat up to date as the bot
+// sends, edits and deletes them, and serves updates injected by the test through getUpdates.
+package tgfake
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Bot is the account getMe reports
+var Bot = tgbotapi.User{ID: 1, IsBot: true, FirstName: "Test", UserName: "test_bot"}
+
+// longPollLimit caps how long getUpdates waits for an injected update
+const longPollLimit = time.Second
+
+// Call is a single Bot API request received by the server
+type Call struct {
+	Method    string
+	Params    map[string]string
+	MessageID int // ID of the message sent, edited or deleted
+}
+
+// Message is a message currently visible in a chat
+type Message struct {
+	ID          int
+	FromBot     bool
+	Text        string // Text, or the caption of a photo
+	ReplyMarkup string // JSON inline keyboard, empty without one
+}
+
+// Server is a fake Bot API server
+type Server struct {
+	server        *httptest.Server
+	mutex         sync.Mutex
+	calls         []Call
+	nextMessageID int
+	chats         map[int64]map[int]*Message
+	pinned        map[int64]int
+	webhookURL    string
+	updates       []tgbotapi.Update
+	nextUpdateID  int
+	injected      chan struct{} // Closed and replaced whenever an update is injected
+	closed        chan struct{}
+}
+
+// NewServer starts a fake Bot API server; call Close when done
+func NewServer() *Server {
+	s := &Server{
+		nextMessageID: 100,
+		nextUpdateID:  1,
+		chats:         make(map[int64]map[int]*Message),
+		pinned:        make(map[int64]int),
+		injected:      make(chan struct{}),
+		closed:        make(chan struct{}),
+	}
+	s.server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+// Close stops the server, releasing pending long polls
+func (s *Server) Close() {
+	close(s.closed)
+	s.server.Close()
+}
+
+// NewBotAPI returns a Bot API client talking to the server
+func (s *Server) NewBotAPI(token string) (*tgbotapi.BotAPI, error) {
+	return tgbotapi.NewBotAPIWithClient(token, s.server.URL+"/bot%s/%s", s.server.Client())
+}
+
+// URL returns the base URL of the server
+func (s *Server) URL() string {
+	return s.server.URL
+}
+
+// SetWebhookURL pretends a webhook is registered, as getWebhookInfo reports it
+func (s *Server) SetWebhookURL(url string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.webhookURL = url
+}
+
+// Inject queues an update for getUpdates, assigning its update ID
+// A message in the update becomes visible in its chat
+func (s *Server) Inject(update tgbotapi.Update) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	update.UpdateID = s.nextUpdateID
+	s.nextUpdateID++
+	if message := update.Message; message != nil && message.Chat != nil {
+		s.chat(message.Chat.ID)[message.MessageID] = &Message{ID: message.MessageID, Text: message.Text}
+	}
+	s.updates = append(s.updates, update)
+
+	close(s.injected)
+	s.injected = make(chan struct{})
+}
+
+// InjectMessage queues a text message from user in chatID and returns its message ID
+func (s *Server) InjectMessage(chatID int64, user tgbotapi.User, text string) int {
+	s.mutex.Lock()
+	s.nextMessageID++
+	messageID := s.nextMessageID
+	s.mutex.Unlock()
+
+	s.Inject(tgbotapi.Update{Message: &tgbotapi.Message{
+		MessageID: messageID,
+		From:      &user,
+		Chat:      &tgbotapi.Chat{ID: chatID, Type: "private"},
+		Date:      int(time.Now().Unix()),
+		Text:      text,
+	}})
+	return messageID
+}
+
+// InjectCallback queues a press by user on a button of messageID carrying data and returns the query ID
+func (s *Server) InjectCallback(chatID int64, user tgbotapi.User, messageID int, data string) string {
+	s.mutex.Lock()
+	queryID := fmt.Sprintf("query-%d", s.nextUpdateID)
+	s.mutex.Unlock()
+
+	s.Inject(tgbotapi.Update{CallbackQuery: &tgbotapi.CallbackQuery{
+		ID:   queryID,
+		From: &user,
+		Message: &tgbotapi.Message{
+			MessageID: messageID,
+			Chat:      &tgbotapi.Chat{ID: chatID, Type: "private"},
+		},
+		Data: data,
+	}})
+	return queryID
+}
+
+// Calls returns every request received so far except getUpdates polls
+func (s *Server) Calls() []Call {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]Call(nil), s.calls...)
+}
+
+// Find returns the most recent call of method whose text contains substring
+func (s *Server) Find(method, substring string) (Call, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for i := len(s.calls) - 1; i >= 0; i-- {
+		call := s.calls[i]
+		if call.Method == method && strings.Contains(call.Params["text"], substring) {
+			return call, true
+		}
+	}
+	return Call{}, false
+}
+
+// TestingT is the part of testing.TB the wait helpers use
+type TestingT interface {
+	Helper()
+	Fatalf(format string, args ...any)
+}
+
+// WaitFor polls until a call of method containing substring arrives, failing t after five seconds
+func (s *Server) WaitFor(t TestingT, method, substring string) Call {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if call, ok := s.Find(method, substring); ok {
+			return call
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("Timed out waiting for %s containing %q", method, substring)
+	return Call{}
+}
+
+// Chat returns the messages visible in a chat, oldest first
+func (s *Server) Chat(chatID int64) []Message {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	messages := make([]Message, 0, len(s.chats[chatID]))
+	for _, message := range s.chats[chatID] {
+		messages = append(messages, *message)
+	}
+	sort.Slice(messages, func(i, j int) bool { return messages[i].ID < messages[j].ID })
+	return messages
+}
+
+// WaitForChat polls until the messages visible in a chat satisfy cond, failing t after five seconds
+func (s *Server) WaitForChat(t TestingT, chatID int64, cond func([]Message) bool) []Message {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		messages := s.Chat(chatID)
+		if cond(messages) {
+			return messages
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for chat %d, it shows %+v", chatID, messages)
+			return nil
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// Delete removes a message from a chat, as if the user deleted it
+func (s *Server) Delete(chatID int64, messageID int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.chat(chatID), messageID)
+}
+
+// Pinned returns the pinned message of a chat, or zero
+func (s *Server) Pinned(chatID int64) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.pinned[chatID]
+}
+
+// chat returns the visible messages of chatID; the caller holds the mutex
+func (s *Server) chat(chatID int64) map[int]*Message {
+	messages, ok := s.chats[chatID]
+	if !ok {
+		messages = make(map[int]*Message)
+		s.chats[chatID] = messages
+	}
+	return messages
+}
+
+// errBadRequest is a Bot API error with a description like Telegram's
+type errBadRequest string
+
+func (e errBadRequest) Error() string {
+	return "Bad Request: " + string(e)
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseMultipartForm(1 << 20); err != nil && !errors.Is(err, http.ErrNotMultipart) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	io.Copy(io.Discard, r.Body)
+
+	call := Call{Method: path.Base(r.URL.Path), Params: make(map[string]string)}
+	for key := range r.PostForm {
+		call.Params[key] = r.PostForm.Get(key)
+	}
+	if r.MultipartForm != nil {
+		// Uploaded files are recorded by their field name
+		for key, files := range r.MultipartForm.File {
+			call.Params[key] = files[0].Filename
+		}
+	}
+
+	var result any
+	var err error
+	if call.Method == "getUpdates" {
+		result = s.getUpdates(r, call)
+	} else {
+		s.mutex.Lock()
+		result, err = s.handle(&call)
+		s.calls = append(s.calls, call)
+		s.mutex.Unlock()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err != nil {
+		json.NewEncoder(w).Encode(map[string]any{"ok": false, "error_code": http.StatusBadRequest, "description": err.Error()})
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]any{"ok": true, "result": result})
+}
+
+// handle applies a request to the fake's state; the caller holds the mutex
+func (s *Server) handle(call *Call) (any, error) {
+	chatID, _ := strconv.ParseInt(call.Params["chat_id"], 10, 64)
+	messageID, _ := strconv.Atoi(call.Params["message_id"])
+
+	switch call.Method {
+	case "getMe":
+		return Bot, nil
+	case "getWebhookInfo":
+		return map[string]any{"url": s.webhookURL, "pending_update_count": len(s.updates)}, nil
+	case "setWebhook":
+		s.webhookURL = call.Params["url"]
+	case "deleteWebhook":
+		s.webhookURL = ""
+	case "sendMessage", "sendPhoto":
+		s.nextMessageID++
+		call.MessageID = s.nextMessageID
+		message := &Message{ID: call.MessageID, FromBot: true, Text: call.Params["text"], ReplyMarkup: call.Params["reply_markup"]}
+		if call.Method == "sendPhoto" {
+			message.Text = call.Params["caption"]
+		}
+		s.chat(chatID)[call.MessageID] = message
+		return messageResult(chatID, message), nil
+	case "editMessageText", "editMessageReplyMarkup":
+		call.MessageID = messageID
+		message, ok := s.chat(chatID)[messageID]
+		if !ok {
+			return nil, errBadRequest("message to edit not found")
+		}
+		if call.Method == "editMessageText" {
+			if message.Text == call.Params["text"] && message.ReplyMarkup == call.Params["reply_markup"] {
+				return nil, errBadRequest("message is not modified")
+			}
+			message.Text = call.Params["text"]
+		}
+		message.ReplyMarkup = call.Params["reply_markup"]
+		return messageResult(chatID, message), nil
+	case "deleteMessage":
+		call.MessageID = messageID
+		if _, ok := s.chat(chatID)[messageID]; !ok {
+			return nil, errBadRequest("message to delete not found")
+		}
+		delete(s.chat(chatID), messageID)
+	case "pinChatMessage":
+		call.MessageID = messageID
+		s.pinned[chatID] = messageID
+	case "unpinChatMessage":
+		delete(s.pinned, chatID)
+	}
+	return true, nil
+}
+
+// getUpdates returns the injected updates from the requested offset, waiting briefly for one
+func (s *Server) getUpdates(r *http.Request, call Call) []tgbotapi.Update {
+	offset, _ := strconv.Atoi(call.Params["offset"])
+	timeout := time.NewTimer(longPollLimit)
+	defer timeout.Stop()
+
+	for {
+		s.mutex.Lock()
+		var pending []tgbotapi.Update
+		for _, update := range s.updates {
+			if update.UpdateID >= offset {
+				pending = append(pending, update)
+			}
+		}
+		injected := s.injected
+		s.mutex.Unlock()
+
+		if len(pending) > 0 {
+			return pending
+		}
+		select {
+		case <-injected:
+		case <-timeout.C:
+			return []tgbotapi.Update{}
+		case <-r.Context().Done():
+			return []tgbotapi.Update{}
+		case <-s.closed:
+			return []tgbotapi.Update{}
+		}
+	}
+}
+
+// messageResult is the Message object Telegram returns for a sent or edited message
+func messageResult(chatID int64, message *Message) map[string]any {
+	result := map[string]any{
+		"message_id": message.ID,
+		"date":       time.Now().Unix(),
+		"chat":       map[string]any{"id": chatID, "type": "private"},
+		"text":       message.Text,
+	}
+	if message.ReplyMarkup != "" {
+		result["reply_markup"] = json.RawMessage(message.ReplyMarkup)
+	}
+	return result
+}
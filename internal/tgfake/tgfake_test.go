@@ -0,0 +1,79 @@
+package tgfake
+
+import (
+	"strings"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func TestServerTracksChat(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+
+	api, err := server.NewBotAPI("token")
+	if err != nil {
+		t.Fatalf("NewBotAPI failed: %v", err)
+	}
+	if api.Self.UserName != Bot.UserName {
+		t.Errorf("Expected getMe to report %q, got %q", Bot.UserName, api.Self.UserName)
+	}
+
+	sent, err := api.Send(tgbotapi.NewMessage(1, "hello"))
+	if err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	if _, err := api.Send(tgbotapi.NewEditMessageText(1, sent.MessageID, "edited")); err != nil {
+		t.Fatalf("Edit failed: %v", err)
+	}
+	if _, err := api.Send(tgbotapi.NewEditMessageText(1, sent.MessageID, "edited")); err == nil || !strings.Contains(err.Error(), "not modified") {
+		t.Errorf("Expected an unchanged edit to be refused, got %v", err)
+	}
+	if messages := server.Chat(1); len(messages) != 1 || messages[0].Text != "edited" || !messages[0].FromBot {
+		t.Errorf("Unexpected chat %+v", messages)
+	}
+
+	if _, err := api.Request(tgbotapi.NewDeleteMessage(1, sent.MessageID)); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if _, err := api.Request(tgbotapi.NewDeleteMessage(1, sent.MessageID)); err == nil {
+		t.Error("Expected deleting a missing message to fail")
+	}
+	if _, err := api.Send(tgbotapi.NewEditMessageText(1, sent.MessageID, "again")); err == nil {
+		t.Error("Expected editing a deleted message to fail")
+	}
+	if messages := server.Chat(1); len(messages) != 0 {
+		t.Errorf("Expected an empty chat, got %+v", messages)
+	}
+}
+
+func TestServerServesInjectedUpdates(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+
+	api, err := server.NewBotAPI("token")
+	if err != nil {
+		t.Fatalf("NewBotAPI failed: %v", err)
+	}
+
+	user := tgbotapi.User{ID: 7, UserName: "tester"}
+	messageID := server.InjectMessage(42, user, "/start")
+	server.InjectCallback(42, user, messageID, "status")
+
+	updates, err := api.GetUpdates(tgbotapi.NewUpdate(0))
+	if err != nil {
+		t.Fatalf("GetUpdates failed: %v", err)
+	}
+	if len(updates) != 2 || updates[0].Message.Text != "/start" || updates[1].CallbackQuery.Data != "status" {
+		t.Fatalf("Unexpected updates %+v", updates)
+	}
+	if messages := server.Chat(42); len(messages) != 1 || messages[0].ID != messageID || messages[0].FromBot {
+		t.Errorf("Expected the user's message in the chat, got %+v", messages)
+	}
+
+	// Confirmed updates are not served again
+	updates, err = api.GetUpdates(tgbotapi.NewUpdate(updates[1].UpdateID + 1))
+	if err != nil || len(updates) != 0 {
+		t.Errorf("Expected no further updates, got %+v (%v)", updates, err)
+	}
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Role determines which bot controls an authorized user may use
+type Role string
+
+const (
+	RoleAdmin    Role = "admin"    // Full control plus user management
+	RoleOperator Role = "operator" // Routing and service control
+	RoleViewer   Role = "viewer"   // Read-only status checks
+)
+
+// parseRole validates a role name
+func parseRole(name string) (Role, error) {
+	switch role := Role(name); role {
+	case RoleAdmin, RoleOperator, RoleViewer:
+		return role, nil
+	default:
+		return "", fmt.Errorf("unknown role %q", name)
+	}
+}
+
+// CanControl reports whether the role may change routing or the VPN service
+func (r Role) CanControl() bool {
+	return r == RoleAdmin || r == RoleOperator
+}
+
+// CanAdminister reports whether the role may manage other users
+func (r Role) CanAdminister() bool {
+	return r == RoleAdmin
+}
+
+var (
+	errInviteInvalid  = errors.New("invite link is invalid")
+	errInviteExpired  = errors.New("invite link has expired")
+	errInviteUsed     = errors.New("invite link has already been used")
+	errInviteRevoked  = errors.New("invite link has been revoked")
+	errInviteInactive = errors.New("invite is no longer active")
+)
+
+// Invite is a single-use authorization token; only the token hash is stored
+type Invite struct {
+	ID        string    `json:"id"`
+	TokenHash string    `json:"token_hash"`
+	Role      Role      `json:"role"`
+	CreatedBy int64     `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+	UsedBy    int64     `json:"used_by,omitempty"`
+	UsedAt    time.Time `json:"used_at,omitempty"`
+	RevokedBy int64     `json:"revoked_by,omitempty"`
+	RevokedAt time.Time `json:"revoked_at,omitempty"`
+}
+
+// State returns a short description of the invite lifecycle state at now
+func (i *Invite) State(now time.Time) string {
+	switch {
+	case !i.UsedAt.IsZero():
+		return "used"
+	case !i.RevokedAt.IsZero():
+		return "revoked"
+	case now.After(i.ExpiresAt):
+		return "expired"
+	default:
+		return "active"
+	}
+}
+
+// InviteManager issues, redeems and revokes invite tokens, persisting them as an audit record
+type InviteManager struct {
+	path    string
+	logger  *logrus.Logger
+	invites map[string]*Invite // ID -> invite
+	mutex   sync.Mutex
+	now     func() time.Time
+}
+
+// NewInviteManager creates an invite manager persisting invites to path
+func NewInviteManager(path string, logger *logrus.Logger) (*InviteManager, error) {
+	im := &InviteManager{
+		path:    path,
+		logger:  logger,
+		invites: make(map[string]*Invite),
+		now:     time.Now,
+	}
+
+	if err := loadJSONFile(path, &im.invites); err != nil {
+		return nil, fmt.Errorf("failed to load invites: %w", err)
+	}
+
+	return im, nil
+}
+
+// Create issues a new invite for role valid for ttl and returns it with its secret token
+func (im *InviteManager) Create(role Role, ttl time.Duration, createdBy int64) (*Invite, string, error) {
+	tokenBytes := make([]byte, 24)
+	if _, err := rand.Read(tokenBytes); err != nil {
+		return nil, "", fmt.Errorf("failed to generate invite token: %w", err)
+	}
+	idBytes := make([]byte, 4)
+	if _, err := rand.Read(idBytes); err != nil {
+		return nil, "", fmt.Errorf("failed to generate invite ID: %w", err)
+	}
+
+	// Base64url keeps the token within the characters Telegram allows in start parameters
+	token := base64.RawURLEncoding.EncodeToString(tokenBytes)
+	now := im.now()
+	invite := &Invite{
+		ID:        hex.EncodeToString(idBytes),
+		TokenHash: hashInviteToken(token),
+		Role:      role,
+		CreatedBy: createdBy,
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+	}
+
+	im.mutex.Lock()
+	defer im.mutex.Unlock()
+
+	im.invites[invite.ID] = invite
+	if err := im.save(); err != nil {
+		delete(im.invites, invite.ID)
+		return nil, "", err
+	}
+
+	im.logger.WithFields(logrus.Fields{
+		"invite_id":  invite.ID,
+		"role":       role,
+		"created_by": createdBy,
+		"expires_at": invite.ExpiresAt,
+	}).Info("Invite created")
+
+	copied := *invite
+	return &copied, token, nil
+}
+
+// Redeem consumes a token on behalf of userID and returns the invite it belonged to
+func (im *InviteManager) Redeem(token string, userID int64) (*Invite, error) {
+	hash := hashInviteToken(token)
+
+	im.mutex.Lock()
+	defer im.mutex.Unlock()
+
+	var invite *Invite
+	for _, candidate := range im.invites {
+		if candidate.TokenHash == hash {
+			invite = candidate
+			break
+		}
+	}
+
+	if invite == nil {
+		im.logger.WithField("user_id", userID).Warn("Invite redemption failed - unknown token")
+		return nil, errInviteInvalid
+	}
+
+	now := im.now()
+	var err error
+	switch invite.State(now) {
+	case "used":
+		err = errInviteUsed
+	case "revoked":
+		err = errInviteRevoked
+	case "expired":
+		err = errInviteExpired
+	}
+	if err != nil {
+		im.logger.WithFields(logrus.Fields{
+			"invite_id": invite.ID,
+			"user_id":   userID,
+			"error":     err,
+		}).Warn("Invite redemption failed")
+		return nil, err
+	}
+
+	invite.UsedBy = userID
+	invite.UsedAt = now
+	if err := im.save(); err != nil {
+		invite.UsedBy = 0
+		invite.UsedAt = time.Time{}
+		return nil, err
+	}
+
+	im.logger.WithFields(logrus.Fields{
+		"invite_id": invite.ID,
+		"role":      invite.Role,
+		"user_id":   userID,
+	}).Info("Invite redeemed")
+
+	copied := *invite
+	return &copied, nil
+}
+
+// Revoke invalidates an unused invite by ID
+func (im *InviteManager) Revoke(id string, revokedBy int64) error {
+	im.mutex.Lock()
+	defer im.mutex.Unlock()
+
+	invite, exists := im.invites[id]
+	if !exists {
+		return errInviteInvalid
+	}
+	if state := invite.State(im.now()); state != "active" {
+		return fmt.Errorf("%w: already %s", errInviteInactive, state)
+	}
+
+	invite.RevokedBy = revokedBy
+	invite.RevokedAt = im.now()
+	if err := im.save(); err != nil {
+		invite.RevokedBy = 0
+		invite.RevokedAt = time.Time{}
+		return err
+	}
+
+	im.logger.WithFields(logrus.Fields{
+		"invite_id":  id,
+		"revoked_by": revokedBy,
+	}).Info("Invite revoked")
+	return nil
+}
+
+// Get returns a copy of the invite with ID id
+func (im *InviteManager) Get(id string) (Invite, bool) {
+	im.mutex.Lock()
+	defer im.mutex.Unlock()
+
+	invite, exists := im.invites[id]
+	if !exists {
+		return Invite{}, false
+	}
+	return *invite, true
+}
+
+// List returns copies of the most recent invites, newest first
+func (im *InviteManager) List(limit int) []Invite {
+	im.mutex.Lock()
+	defer im.mutex.Unlock()
+
+	invites := make([]Invite, 0, len(im.invites))
+	for _, invite := range im.invites {
+		invites = append(invites, *invite)
+	}
+	sort.Slice(invites, func(i, j int) bool {
+		return invites[i].CreatedAt.After(invites[j].CreatedAt)
+	})
+
+	if limit > 0 && len(invites) > limit {
+		invites = invites[:limit]
+	}
+	return invites
+}
+
+// save persists invites to disk
+// Caller must hold im.mutex
+func (im *InviteManager) save() error {
+	if err := saveJSONFile(im.path, im.invites); err != nil {
+		return fmt.Errorf("failed to save invites: %w", err)
+	}
+	return nil
+}
+
+// hashInviteToken returns the hex SHA-256 of a token
+func hashInviteToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+func newTestInviteManager(t *testing.T) *InviteManager {
+	t.Helper()
+
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+
+	manager, err := NewInviteManager(filepath.Join(t.TempDir(), "invites.json"), logger)
+	if err != nil {
+		t.Fatalf("NewInviteManager failed: %v", err)
+	}
+	return manager
+}
+
+func TestInviteRedeemOnce(t *testing.T) {
+	manager := newTestInviteManager(t)
+
+	invite, token, err := manager.Create(RoleViewer, time.Hour, 1)
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if invite.TokenHash == token {
+		t.Error("Token must not be stored in plain text")
+	}
+
+	redeemed, err := manager.Redeem(token, 2)
+	if err != nil {
+		t.Fatalf("Redeem failed: %v", err)
+	}
+	if redeemed.Role != RoleViewer || redeemed.UsedBy != 2 {
+		t.Errorf("Unexpected redeemed invite: %+v", redeemed)
+	}
+
+	if _, err := manager.Redeem(token, 3); err != errInviteUsed {
+		t.Errorf("Expected errInviteUsed, got %v", err)
+	}
+	if _, err := manager.Redeem("bogus", 3); err != errInviteInvalid {
+		t.Errorf("Expected errInviteInvalid, got %v", err)
+	}
+}
+
+func TestInviteExpiryAndRevocation(t *testing.T) {
+	manager := newTestInviteManager(t)
+
+	now := time.Now()
+	manager.now = func() time.Time { return now }
+
+	_, expiredToken, _ := manager.Create(RoleOperator, time.Minute, 1)
+	revoked, revokedToken, _ := manager.Create(RoleOperator, time.Hour, 1)
+
+	if err := manager.Revoke(revoked.ID, 1); err != nil {
+		t.Fatalf("Revoke failed: %v", err)
+	}
+	if err := manager.Revoke(revoked.ID, 1); err == nil {
+		t.Error("Expected second revoke to fail")
+	}
+
+	now = now.Add(2 * time.Minute)
+	if _, err := manager.Redeem(expiredToken, 2); err != errInviteExpired {
+		t.Errorf("Expected errInviteExpired, got %v", err)
+	}
+	if _, err := manager.Redeem(revokedToken, 2); err != errInviteRevoked {
+		t.Errorf("Expected errInviteRevoked, got %v", err)
+	}
+
+	// Records are kept for auditing and survive a restart
+	reloaded, err := NewInviteManager(manager.path, manager.logger)
+	if err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	if got := len(reloaded.List(0)); got != 2 {
+		t.Errorf("Expected 2 persisted invites, got %d", got)
+	}
+}
+
+func TestParseRole(t *testing.T) {
+	if _, err := parseRole("operator"); err != nil {
+		t.Errorf("Expected operator to be valid: %v", err)
+	}
+	if _, err := parseRole("root"); err == nil {
+		t.Error("Expected unknown role to be rejected")
+	}
+	if RoleViewer.CanControl() {
+		t.Error("Viewers must not control the router")
+	}
+}
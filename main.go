@@ -3,10 +3,15 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"flag"
+	"fmt"
+	"io"
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strings"
 	"syscall"
 	"time"
 
@@ -15,15 +20,71 @@ import (
 )
 
 func main() {
-	// Parse command line flags
-	var healthCheck = flag.Bool("health-check", false, "Run health check and exit")
-	flag.Parse()
+	os.Exit(dispatch(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// dispatch runs the subcommand named by the first argument and returns the exit code
+// Without a subcommand the bot runs, so existing flag-only invocations keep working
+func dispatch(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return runServe(args, stderr)
+	}
+
+	switch args[0] {
+	case "serve":
+		return runServe(args[1:], stderr)
+	case "help":
+		fmt.Fprint(stdout, cliUsage)
+		return cliExitOK
+	}
+	if _, ok := cliCommands[args[0]]; !ok {
+		fmt.Fprintf(stderr, "Unknown command %q\n\n%s", args[0], cliUsage)
+		return cliExitUsage
+	}
+	return runCLI(args[0], args[1:], stdout, stderr)
+}
+
+// runServe parses the bot's flags, then runs the health check or the bot
+func runServe(args []string, stderr io.Writer) int {
+	flags := flag.NewFlagSet("serve", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	healthCheck := flags.Bool("health-check", false, "Run health check and exit")
+	healthPort := flags.String("health-port", getEnv("HEALTH_PORT", "8080"), "Port of the health check server")
+	healthCheckSSH := flags.Bool("health-check-ssh", false, "Also test the SSH connection to the router during -health-check")
+	flags.Usage = func() {
+		fmt.Fprint(stderr, cliUsage+"\nFlags for serve:\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return cliExitOK
+		}
+		return cliExitUsage
+	}
+	if flags.NArg() > 0 {
+		fmt.Fprintf(stderr, "Unexpected argument %q\n", flags.Arg(0))
+		return cliExitUsage
+	}
 
 	// Handle health check
 	if *healthCheck {
-		os.Exit(runHealthCheck())
+		return runHealthCheck(*healthPort, *healthCheckSSH)
 	}
 
+	return runServer(*healthPort)
+}
+
+// defaultShutdownTimeout bounds how long shutdown waits for updates and router changes in progress
+const defaultShutdownTimeout = 30 * time.Second
+
+// Exit codes of the bot after a shutdown signal
+const (
+	serveExitOK        = 0
+	serveExitAbandoned = 3 // Shutdown timed out with updates or router changes unfinished
+)
+
+// runServer runs the bot until it receives a shutdown signal and returns the exit code
+func runServer(healthPort string) int {
 	// Initialize logger
 	logger := logrus.New()
 	
@@ -50,7 +111,6 @@ func main() {
 	// Validate required environment variables
 	requiredEnvVars := []string{
 		"TELEGRAM_BOT_TOKEN",
-		"AUTH_CODE",
 		"ROUTER_HOST",
 		"ROUTER_USERNAME",
 		"ROUTER_PASSWORD",
@@ -62,6 +122,20 @@ func main() {
 		}
 	}
 
+	// Someone has to be able to get in: either via the shared code or as a configured admin
+	adminUsers, err := parseUserIDs(getEnvList("ADMIN_USER_IDS", ""))
+	if err != nil {
+		logger.WithError(err).Fatal("Invalid ADMIN_USER_IDS")
+	}
+	if os.Getenv("AUTH_CODE") == "" && len(adminUsers) == 0 {
+		logger.Fatal("Either AUTH_CODE or ADMIN_USER_IDS must be set")
+	}
+
+	authCodeRole, err := parseRole(getEnv("AUTH_CODE_ROLE", string(RoleAdmin)))
+	if err != nil {
+		logger.WithError(err).Fatal("Invalid AUTH_CODE_ROLE")
+	}
+
 	// Create context with cancellation
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -77,8 +151,18 @@ func main() {
 		logger.WithError(err).Fatal("Failed to initialize SSH client")
 	}
 
+	metrics := NewMetrics()
+	sshClient.SetMetrics(metrics)
+
 	// Initialize VPN manager
 	vpnManager := NewVPNManager(sshClient, logger)
+	vpnManager.SetMetrics(metrics)
+	if path := os.Getenv("XRAY_CONFIG_PATH"); path != "" {
+		vpnManager.SetConfigPath(path)
+	}
+	if path := os.Getenv("XRAY_OUTBOUNDS_PATH"); path != "" {
+		vpnManager.SetOutboundsPath(path)
+	}
 
 	// Initialize Telegram bot
 	bot, err := NewTelegramBot(
@@ -90,28 +174,231 @@ func main() {
 	if err != nil {
 		logger.WithError(err).Fatal("Failed to initialize Telegram bot")
 	}
+	bot.SetMetrics(metrics)
+
+	bot.SetAdminUsers(adminUsers)
+	bot.SetAuthCodeRole(authCodeRole)
+	bot.SetSessionPolicy(
+		getEnvDuration("SESSION_LIFETIME", 7*24*time.Hour, logger),
+		getEnvDuration("SESSION_IDLE_TIMEOUT", 0, logger),
+	)
+
+	dataDir := getEnv("DATA_DIR", "data")
+
+	inviteManager, err := NewInviteManager(filepath.Join(dataDir, "invites.json"), logger)
+	if err != nil {
+		logger.WithError(err).Fatal("Failed to initialize invite manager")
+	}
+	bot.SetInviteManager(inviteManager)
+
+	grants, err := NewGrantStore(filepath.Join(dataDir, "grants.json"))
+	if err != nil {
+		logger.WithError(err).Fatal("Failed to load role grants")
+	}
+	bot.SetGrantStore(grants)
+
+	// Audit log of every router-changing action
+	var auditSinks []AuditSink
+	for _, sinkName := range getEnvList("AUDIT_SINKS", "file") {
+		switch sinkName {
+		case "file":
+			fileSink, err := NewFileAuditSink(getEnv("AUDIT_LOG_PATH", filepath.Join(dataDir, "audit.jsonl")))
+			if err != nil {
+				logger.WithError(err).Fatal("Failed to open audit log")
+			}
+			auditSinks = append(auditSinks, fileSink)
+		case "log":
+			auditSinks = append(auditSinks, NewLogAuditSink(logger))
+		default:
+			logger.WithField("sink", sinkName).Fatal("Unknown audit sink")
+		}
+	}
+	auditLog := NewAuditLog(logger, auditSinks...)
+	defer auditLog.Close()
+	vpnManager.SetAuditLog(auditLog)
+	bot.SetAuditLog(auditLog)
+
+	subscriptions, err := NewSubscriptionStore(filepath.Join(dataDir, "subscriptions.json"))
+	if err != nil {
+		logger.WithError(err).Fatal("Failed to load notification subscriptions")
+	}
+	bot.SetSubscriptions(subscriptions)
+
+	languages, err := NewLanguageStore(filepath.Join(dataDir, "languages.json"))
+	if err != nil {
+		logger.WithError(err).Fatal("Failed to load user languages")
+	}
+	bot.SetLanguageStore(languages)
+
+	reverts, err := NewRevertManager(filepath.Join(dataDir, "reverts.json"), vpnManager, logger)
+	if err != nil {
+		logger.WithError(err).Fatal("Failed to load pending routing revert")
+	}
+	bot.SetRevertManager(reverts)
+	reverts.Start()
+	defer reverts.Stop()
+
+	// Cron-style scheduled routing and service changes
+	scheduleLocation, err := time.LoadLocation(getEnv("SCHEDULE_TIMEZONE", "Local"))
+	if err != nil {
+		logger.WithError(err).Fatal("Invalid SCHEDULE_TIMEZONE")
+	}
+	scheduler, err := NewScheduler(filepath.Join(dataDir, "schedule.json"), vpnManager, scheduleLocation, logger)
+	if err != nil {
+		logger.WithError(err).Fatal("Failed to load schedule")
+	}
+	bot.SetScheduler(scheduler)
+	go scheduler.Run(ctx)
+
+	if err := bot.SetDashboard(filepath.Join(dataDir, "dashboards.json"), getEnvDuration("DASHBOARD_REFRESH_INTERVAL", 5*time.Minute, logger)); err != nil {
+		logger.WithError(err).Fatal("Failed to initialize dashboards")
+	}
+
+	// Confirmation prompts for disruptive actions
+	var confirmActions []Action
+	for _, action := range getEnvList("CONFIRM_ACTIONS", "enable_vpn,disable_vpn,select_outbound,stop_service") {
+		if action != "none" {
+			confirmActions = append(confirmActions, Action(action))
+		}
+	}
+	bot.SetConfirmation(confirmActions, getEnvDuration("CONFIRM_TIMEOUT", defaultConfirmTimeout, logger))
+
+	// Concurrent update handling, in order within each chat
+	bot.SetUpdateProcessing(
+		getEnvInt("UPDATE_WORKERS", defaultUpdateWorkers, logger),
+		getEnvInt("UPDATE_QUEUE_SIZE", defaultUpdateQueueSize, logger),
+		getEnvDuration("UPDATE_DRAIN_TIMEOUT", defaultUpdateDrainTimeout, logger),
+	)
+	shutdownTimeout := getEnvDuration("SHUTDOWN_TIMEOUT", defaultShutdownTimeout, logger)
+
+	// Optional TOTP second factor for protected actions
+	if getEnvBool("TOTP_ENABLED", false, logger) {
+		var protectedActions []Action
+		for _, action := range getEnvList("TOTP_PROTECTED_ACTIONS", "stop_service,restore_backup") {
+			protectedActions = append(protectedActions, Action(action))
+		}
+
+		totpManager, err := NewTOTPManager(filepath.Join(dataDir, "totp.json"), TOTPConfig{
+			Issuer:           getEnv("TOTP_ISSUER", "VPN Commander"),
+			GracePeriod:      getEnvDuration("TOTP_GRACE_PERIOD", 5*time.Minute, logger),
+			Skew:             getEnvInt("TOTP_SKEW", 1, logger),
+			Required:         getEnvBool("TOTP_REQUIRED", false, logger),
+			ProtectedActions: protectedActions,
+		}, logger)
+		if err != nil {
+			logger.WithError(err).Fatal("Failed to initialize TOTP manager")
+		}
+		bot.SetTOTPManager(totpManager)
+	}
+
+	// Receive updates by webhook, typically behind an ingress, instead of long polling
+	switch mode := getEnv("TELEGRAM_MODE", TelegramModePolling); mode {
+	case TelegramModePolling:
+	case TelegramModeWebhook:
+		err := bot.SetWebhook(WebhookConfig{
+			URL:             os.Getenv("TELEGRAM_WEBHOOK_URL"),
+			SecretToken:     os.Getenv("TELEGRAM_WEBHOOK_SECRET"),
+			CertificatePath: os.Getenv("TELEGRAM_WEBHOOK_CERT"),
+			MaxConnections:  getEnvInt("TELEGRAM_WEBHOOK_MAX_CONNECTIONS", 0, logger),
+		})
+		if err != nil {
+			logger.WithError(err).Fatal("Invalid Telegram webhook configuration")
+		}
+	default:
+		logger.WithField("mode", mode).Fatal("Unknown TELEGRAM_MODE (use polling or webhook)")
+	}
+
+	// REST API: bearer tokens on the health server, or a separate TLS listener when a certificate is configured
+	apiTokens, err := parseAPITokens(getEnvList("API_TOKENS", ""))
+	if err != nil {
+		logger.WithError(err).Fatal("Invalid API_TOKENS")
+	}
+	var apiHandler http.Handler
+	var apiServer *http.Server
+	apiCert := os.Getenv("API_TLS_CERT")
+	if len(apiTokens) > 0 || apiCert != "" {
+		api := NewAPIServer(vpnManager, apiTokens, logger)
+		api.SetNotifier(bot.NotifyAPIAction)
+
+		if apiCert == "" {
+			apiHandler = api.Handler()
+		} else {
+			tlsConfig, err := newAPITLSConfig(apiCert, os.Getenv("API_TLS_KEY"), os.Getenv("API_CLIENT_CA"))
+			if err != nil {
+				logger.WithError(err).Fatal("Failed to configure API TLS")
+			}
+			apiServer = &http.Server{
+				Addr:      getEnv("API_ADDR", ":8443"),
+				Handler:   api.Handler(),
+				TLSConfig: tlsConfig,
+			}
+			go func() {
+				logger.Info("Starting API server on " + apiServer.Addr)
+				if err := apiServer.ListenAndServeTLS("", ""); err != nil && err != http.ErrServerClosed {
+					logger.WithError(err).Error("API server failed")
+				}
+			}()
+		}
+	}
 
 	// Start health check server
+	readiness := NewReadinessChecker(vpnManager, bot,
+		getEnvDuration("READY_CACHE_TTL", defaultReadyCacheTTL, logger),
+		getEnvDuration("READY_TIMEOUT", defaultReadyTimeout, logger),
+		logger,
+	)
+	auditToken := os.Getenv("AUDIT_EXPORT_TOKEN")
+	if auditToken == "" {
+		logger.Info("Audit export disabled, set AUDIT_EXPORT_TOKEN to serve /audit")
+	}
+	healthAddr := ":" + healthPort
 	healthServer := &http.Server{
-		Addr:    ":8080",
-		Handler: createHealthCheckHandler(bot, vpnManager, logger),
+		Addr:    healthAddr,
+		Handler: createHealthCheckHandler(bot, vpnManager, auditLog, metrics, readiness, apiHandler, auditToken, logger),
 	}
 	
 	go func() {
-		logger.Info("Starting health check server on :8080")
+		logger.Info("Starting health check server on " + healthAddr)
 		if err := healthServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 			logger.WithError(err).Error("Health check server failed")
 		}
 	}()
 
 	// Start the bot
+	botDone := make(chan struct{})
 	go func() {
+		defer close(botDone)
 		if err := bot.Start(ctx); err != nil {
 			logger.WithError(err).Error("Bot stopped with error")
 			cancel()
 		}
 	}()
 
+	// Watch for router changes made outside the bot
+	if watchInterval := getEnvDuration("WATCH_INTERVAL", time.Minute, logger); watchInterval > 0 {
+		watcher := NewStateWatcher(vpnManager, watchInterval, logger)
+		watcher.SetNotifier(bot.NotifyStateDrift)
+		go watcher.Run(ctx)
+	}
+
+	// Fail over to another outbound while the VPN tunnel is down
+	if getEnvBool("FAILOVER_ENABLED", false, logger) {
+		prober, err := NewHealthProber(filepath.Join(dataDir, "failover.json"), FailoverConfig{
+			Interval:          getEnvDuration("FAILOVER_INTERVAL", time.Minute, logger),
+			FailureThreshold:  getEnvInt("FAILOVER_FAILURE_THRESHOLD", 3, logger),
+			RecoveryThreshold: getEnvInt("FAILOVER_RECOVERY_THRESHOLD", 3, logger),
+			FallbackOutbound:  getEnv("FAILOVER_OUTBOUND", "direct"),
+			SocksAddress:      getEnv("FAILOVER_SOCKS_ADDRESS", "127.0.0.1:10808"),
+			ProbeURL:          getEnv("FAILOVER_PROBE_URL", "https://www.gstatic.com/generate_204"),
+			ProbeTimeout:      getEnvDuration("FAILOVER_PROBE_TIMEOUT", 10*time.Second, logger),
+		}, sshClient, vpnManager, logger)
+		if err != nil {
+			logger.WithError(err).Fatal("Failed to initialize health prober")
+		}
+		bot.SetHealthProber(prober)
+		go prober.Run(ctx)
+	}
+
 	logger.Info("VPN Commander bot started successfully")
 
 	// Wait for interrupt signal
@@ -125,51 +412,147 @@ func main() {
 		logger.Info("Context cancelled")
 	}
 
-	// Graceful shutdown
-	logger.Info("Shutting down gracefully...")
+	// Graceful shutdown: stop taking work, finish what is running, then disconnect
+	logger.WithField("timeout", shutdownTimeout).Info("Shutting down gracefully...")
 	cancel()
 
-	// Shutdown health server
-	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), shutdownTimeout)
 	defer shutdownCancel()
-	
-	if err := healthServer.Shutdown(shutdownCtx); err != nil {
+
+	if apiServer != nil {
+		if err := apiServer.Shutdown(shutdownCtx); err != nil {
+			logger.WithError(err).Error("Failed to shutdown API server")
+		}
+	}
+
+	// Wait for the bot to finish the updates it already received
+	select {
+	case <-botDone:
+	case <-shutdownCtx.Done():
+		logger.Warn("Timed out waiting for the bot to stop")
+	}
+
+	// Wait for router changes still running, e.g. from a schedule or a revert
+	abandoned := vpnManager.Shutdown(shutdownCtx)
+	for _, operation := range abandoned {
+		logger.WithFields(logrus.Fields{
+			"action":  operation.Action,
+			"source":  operation.Actor.Source,
+			"user_id": operation.Actor.UserID,
+			"running": time.Since(operation.StartedAt).Round(time.Second).String(),
+		}).Error("Abandoned router operation")
+	}
+	bot.NotifyShutdown(abandoned)
+
+	// The health server goes last so probes and the webhook answer while work finishes
+	healthCtx, healthCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer healthCancel()
+	if err := healthServer.Shutdown(healthCtx); err != nil {
 		logger.WithError(err).Error("Failed to shutdown health server")
 	}
 
-	// Give components time to shut down
-	time.Sleep(2 * time.Second)
+	if err := sshClient.Disconnect(); err != nil {
+		logger.WithError(err).Warn("Failed to close SSH connection")
+	}
+
+	if len(abandoned) > 0 || bot.AbandonedUpdates() > 0 {
+		logger.WithFields(logrus.Fields{
+			"operations": len(abandoned),
+			"updates":    bot.AbandonedUpdates(),
+		}).Warn("Shutdown complete with abandoned work")
+		return serveExitAbandoned
+	}
 	logger.Info("Shutdown complete")
+	return serveExitOK
 }
 
-// runHealthCheck performs a simple health check
-func runHealthCheck() int {
-	// Simple health check - just verify the process can start
+// Health check exit codes, one per failure class; Docker reserves 2, so it is skipped
+const (
+	healthExitOK         = 0
+	healthExitConfig     = 1 // Required configuration is missing
+	healthExitNotRunning = 3 // The health server did not answer /health
+	healthExitNotReady   = 4 // /ready reported a failing dependency
+	healthExitSSH        = 5 // The direct SSH test failed
+)
+
+// runHealthCheck queries /health and /ready of the running process on port and,
+// with checkSSH, tests the router connection directly
+func runHealthCheck(port string, checkSSH bool) int {
 	logger := logrus.New()
 	logger.SetLevel(logrus.ErrorLevel)
-	
+
+	// Best effort: the running process may have taken its settings from .env
+	godotenv.Load()
+
 	// Check if required env vars are set
 	requiredVars := []string{
 		"TELEGRAM_BOT_TOKEN",
-		"AUTH_CODE", 
 		"ROUTER_HOST",
 		"ROUTER_USERNAME",
 		"ROUTER_PASSWORD",
 	}
-	
+
 	for _, envVar := range requiredVars {
 		if os.Getenv(envVar) == "" {
 			logger.Errorf("Health check failed: %s not set", envVar)
-			return 1
+			return healthExitConfig
 		}
 	}
-	
-	logger.Info("Health check passed")
-	return 0
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	baseURL := "http://127.0.0.1:" + port
+
+	resp, err := client.Get(baseURL + "/health")
+	if err != nil {
+		logger.WithError(err).Error("Health check failed: health server is not responding")
+		return healthExitNotRunning
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		logger.WithField("status", resp.StatusCode).Error("Health check failed: /health returned an error")
+		return healthExitNotRunning
+	}
+
+	resp, err = client.Get(baseURL + "/ready")
+	if err != nil {
+		logger.WithError(err).Error("Health check failed: health server is not responding")
+		return healthExitNotRunning
+	}
+	var report ReadinessReport
+	decodeErr := json.NewDecoder(resp.Body).Decode(&report)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		fields := logrus.Fields{"status": resp.StatusCode}
+		if decodeErr == nil {
+			for name, result := range report.Checks {
+				if !result.OK {
+					fields[name] = result.Error
+				}
+			}
+		}
+		logger.WithFields(fields).Error("Health check failed: not ready")
+		return healthExitNotReady
+	}
+
+	if checkSSH {
+		sshClient, err := NewSSHClient(os.Getenv("ROUTER_HOST"), os.Getenv("ROUTER_USERNAME"), os.Getenv("ROUTER_PASSWORD"), logger)
+		if err == nil {
+			_, err = sshClient.ExecuteCommand("echo 'connection_test'")
+			sshClient.Disconnect()
+		}
+		if err != nil {
+			logger.WithError(err).Error("Health check failed: SSH connection to the router failed")
+			return healthExitSSH
+		}
+	}
+
+	// Errors are the only log level shown, so success is reported on stdout
+	fmt.Println("Health check passed")
+	return healthExitOK
 }
 
 // createHealthCheckHandler creates HTTP handlers for health checks
-func createHealthCheckHandler(bot *TelegramBot, vpnManager *VPNManager, logger *logrus.Logger) http.Handler {
+func createHealthCheckHandler(bot *TelegramBot, vpnManager *VPNManager, auditLog *AuditLog, metrics *Metrics, readiness *ReadinessChecker, apiHandler http.Handler, auditToken string, logger *logrus.Logger) http.Handler {
 	mux := http.NewServeMux()
 	
 	// Liveness probe
@@ -179,22 +562,7 @@ func createHealthCheckHandler(bot *TelegramBot, vpnManager *VPNManager, logger *
 	})
 	
 	// Readiness probe
-	mux.HandleFunc("/ready", func(w http.ResponseWriter, r *http.Request) {
-		// Check if bot is ready
-		if bot == nil {
-			http.Error(w, "Bot not initialized", http.StatusServiceUnavailable)
-			return
-		}
-		
-		// Check if VPN manager is ready
-		if vpnManager == nil {
-			http.Error(w, "VPN manager not initialized", http.StatusServiceUnavailable)
-			return
-		}
-		
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte("Ready"))
-	})
+	mux.Handle("/ready", newReadinessHandler(readiness))
 	
 	// Status endpoint
 	mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
@@ -209,6 +577,24 @@ func createHealthCheckHandler(bot *TelegramBot, vpnManager *VPNManager, logger *
 		w.WriteHeader(http.StatusOK)
 		json.NewEncoder(w).Encode(statusData)
 	})
+
+	// Audit export endpoint, only with a token: the health port is usually reachable without one
+	if auditToken != "" {
+		mux.Handle("/audit", newAuditExportHandler(auditLog, auditToken, logger))
+	}
+
+	// Prometheus metrics
+	mux.Handle("/metrics", newMetricsHandler(metrics))
+
+	// REST API, when served without TLS
+	if apiHandler != nil {
+		mux.Handle("/api/", apiHandler)
+	}
+
+	// Telegram webhook, when updates are not received by long polling
+	if bot != nil && bot.WebhookPath() != "" {
+		mux.Handle(bot.WebhookPath(), bot.WebhookHandler())
+	}
 	
 	return mux
 }
\ No newline at end of file
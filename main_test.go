@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+// startHealthServer serves /health and a /ready report, returning the port it listens on
+func startHealthServer(t *testing.T, report ReadinessReport) string {
+	t.Helper()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	})
+	mux.HandleFunc("/ready", func(w http.ResponseWriter, r *http.Request) {
+		if !report.Ready {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(report)
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	parsed, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatalf("Invalid server URL: %v", err)
+	}
+	return parsed.Port()
+}
+
+func setHealthCheckEnv(t *testing.T) {
+	t.Setenv("TELEGRAM_BOT_TOKEN", "token")
+	t.Setenv("ROUTER_HOST", "127.0.0.1:1")
+	t.Setenv("ROUTER_USERNAME", "user")
+	t.Setenv("ROUTER_PASSWORD", "password")
+}
+
+// The exit codes are documented for Docker HEALTHCHECK users, so they are checked literally
+func TestRunHealthCheck(t *testing.T) {
+	ready := ReadinessReport{Ready: true, Checks: map[string]ReadinessResult{"ssh": {OK: true}}}
+	notReady := ReadinessReport{Checks: map[string]ReadinessResult{"ssh": {Error: "connection refused"}}}
+
+	t.Run("missing configuration", func(t *testing.T) {
+		setHealthCheckEnv(t)
+		t.Setenv("ROUTER_PASSWORD", "")
+		if code := runHealthCheck(startHealthServer(t, ready), false); code != 1 {
+			t.Errorf("Expected exit code 1, got %d", code)
+		}
+	})
+
+	t.Run("ready", func(t *testing.T) {
+		setHealthCheckEnv(t)
+		if code := runHealthCheck(startHealthServer(t, ready), false); code != 0 {
+			t.Errorf("Expected exit code 0, got %d", code)
+		}
+	})
+
+	t.Run("not running", func(t *testing.T) {
+		setHealthCheckEnv(t)
+		if code := runHealthCheck("1", false); code != 3 {
+			t.Errorf("Expected exit code 3, got %d", code)
+		}
+	})
+
+	t.Run("not ready", func(t *testing.T) {
+		setHealthCheckEnv(t)
+		if code := runHealthCheck(startHealthServer(t, notReady), false); code != 4 {
+			t.Errorf("Expected exit code 4, got %d", code)
+		}
+	})
+
+	t.Run("ssh unreachable", func(t *testing.T) {
+		setHealthCheckEnv(t)
+		if code := runHealthCheck(startHealthServer(t, ready), true); code != 5 {
+			t.Errorf("Expected exit code 5, got %d", code)
+		}
+	})
+}
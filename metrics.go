@@ -0,0 +1,341 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// sshDurationBuckets are the upper bounds, in seconds, of the SSH command latency histogram
+var sshDurationBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// histogram is a cumulative Prometheus histogram with fixed buckets
+type histogram struct {
+	counts []uint64 // Per bucket in sshDurationBuckets, not cumulative
+	count  uint64
+	sum    float64
+}
+
+// observe records one value in seconds
+func (h *histogram) observe(seconds float64) {
+	for i, bound := range sshDurationBuckets {
+		if seconds <= bound {
+			h.counts[i]++
+			break
+		}
+	}
+	h.count++
+	h.sum += seconds
+}
+
+// sshCommandKey labels an SSH command counter
+type sshCommandKey struct {
+	kind   string
+	result string
+}
+
+// Metrics collects counters and gauges exposed at /metrics in the Prometheus text format
+// A nil *Metrics records nothing, so components work without metrics wired in
+type Metrics struct {
+	mutex           sync.Mutex
+	sshCommands     map[sshCommandKey]uint64
+	sshDurations    map[string]*histogram // kind -> latency
+	sshReconnects   uint64
+	telegramUpdates map[string]uint64       // command -> updates
+	authFailures    map[string]uint64       // reason -> failures
+	configApplies   map[string]uint64       // result -> applies
+	routing         map[string]string       // router -> active outbound
+	services        map[string]ServiceState // router -> service state
+}
+
+// NewMetrics creates an empty metrics registry
+func NewMetrics() *Metrics {
+	return &Metrics{
+		sshCommands:     make(map[sshCommandKey]uint64),
+		sshDurations:    make(map[string]*histogram),
+		telegramUpdates: make(map[string]uint64),
+		authFailures:    make(map[string]uint64),
+		configApplies:   make(map[string]uint64),
+		routing:         make(map[string]string),
+		services:        make(map[string]ServiceState),
+	}
+}
+
+// ObserveSSHCommand records an SSH command of kind that took duration and failed when err is set
+func (m *Metrics) ObserveSSHCommand(kind string, duration time.Duration, err error) {
+	if m == nil {
+		return
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.sshCommands[sshCommandKey{kind: kind, result: resultLabel(err)}]++
+	h := m.sshDurations[kind]
+	if h == nil {
+		h = &histogram{counts: make([]uint64, len(sshDurationBuckets))}
+		m.sshDurations[kind] = h
+	}
+	h.observe(duration.Seconds())
+}
+
+// IncSSHReconnects records a connection to the router made after the first one
+func (m *Metrics) IncSSHReconnects() {
+	if m == nil {
+		return
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.sshReconnects++
+}
+
+// IncTelegramUpdate records an incoming update for command
+func (m *Metrics) IncTelegramUpdate(command string) {
+	if m == nil {
+		return
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.telegramUpdates[command]++
+}
+
+// IncAuthFailure records a rejected authentication or access attempt
+func (m *Metrics) IncAuthFailure(reason string) {
+	if m == nil {
+		return
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.authFailures[reason]++
+}
+
+// ObserveConfigApply records an attempt to write the routing configuration
+func (m *Metrics) ObserveConfigApply(err error) {
+	if m == nil {
+		return
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.configApplies[resultLabel(err)]++
+}
+
+// SetRouting records the outbound the router's default rule currently uses
+func (m *Metrics) SetRouting(router, outbound string) {
+	if m == nil {
+		return
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.routing[router] = outbound
+}
+
+// SetServiceState records the router's current VPN service state
+func (m *Metrics) SetServiceState(router string, state ServiceState) {
+	if m == nil {
+		return
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.services[router] = state
+}
+
+// WriteTo renders all metrics in the Prometheus text exposition format
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	var b strings.Builder
+
+	writeHeader(&b, "vpn_commander_ssh_commands_total", "counter", "SSH commands run on the router by kind and result.")
+	keys := make([]sshCommandKey, 0, len(m.sshCommands))
+	for key := range m.sshCommands {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].kind != keys[j].kind {
+			return keys[i].kind < keys[j].kind
+		}
+		return keys[i].result < keys[j].result
+	})
+	for _, key := range keys {
+		writeSample(&b, "vpn_commander_ssh_commands_total", m.sshCommands[key], "kind", key.kind, "result", key.result)
+	}
+
+	writeHeader(&b, "vpn_commander_ssh_command_duration_seconds", "histogram", "Latency of SSH commands run on the router by kind.")
+	for _, kind := range sortedKeys(m.sshDurations) {
+		h := m.sshDurations[kind]
+		var cumulative uint64
+		for i, bound := range sshDurationBuckets {
+			cumulative += h.counts[i]
+			writeSample(&b, "vpn_commander_ssh_command_duration_seconds_bucket", cumulative, "kind", kind, "le", formatFloat(bound))
+		}
+		writeSample(&b, "vpn_commander_ssh_command_duration_seconds_bucket", h.count, "kind", kind, "le", "+Inf")
+		writeSample(&b, "vpn_commander_ssh_command_duration_seconds_sum", h.sum, "kind", kind)
+		writeSample(&b, "vpn_commander_ssh_command_duration_seconds_count", h.count, "kind", kind)
+	}
+
+	writeHeader(&b, "vpn_commander_ssh_reconnects_total", "counter", "Connections to the router made after the first one.")
+	writeSample(&b, "vpn_commander_ssh_reconnects_total", m.sshReconnects)
+
+	writeHeader(&b, "vpn_commander_telegram_updates_total", "counter", "Telegram updates received by command.")
+	for _, command := range sortedKeys(m.telegramUpdates) {
+		writeSample(&b, "vpn_commander_telegram_updates_total", m.telegramUpdates[command], "command", command)
+	}
+
+	writeHeader(&b, "vpn_commander_auth_failures_total", "counter", "Rejected authentication and access attempts by reason.")
+	for _, reason := range sortedKeys(m.authFailures) {
+		writeSample(&b, "vpn_commander_auth_failures_total", m.authFailures[reason], "reason", reason)
+	}
+
+	writeHeader(&b, "vpn_commander_config_applies_total", "counter", "Routing configuration writes by result.")
+	for _, result := range []string{"success", "failure"} {
+		writeSample(&b, "vpn_commander_config_applies_total", m.configApplies[result], "result", result)
+	}
+
+	writeHeader(&b, "vpn_commander_routing_mode", "gauge", "Routing mode of the router's default rule (1 for the current mode).")
+	for _, router := range sortedKeys(m.routing) {
+		current := routingModeLabel(m.routing[router])
+		for _, mode := range []string{"vpn", "direct", "other"} {
+			writeSample(&b, "vpn_commander_routing_mode", boolGauge(mode == current), "router", router, "mode", mode)
+		}
+	}
+
+	writeHeader(&b, "vpn_commander_routing_outbound", "gauge", "Outbound the router's default rule uses (always 1).")
+	for _, router := range sortedKeys(m.routing) {
+		writeSample(&b, "vpn_commander_routing_outbound", 1, "router", router, "outbound", m.routing[router])
+	}
+
+	writeHeader(&b, "vpn_commander_service_state", "gauge", "State of the router's VPN service (1 for the current state).")
+	for _, router := range sortedKeys(m.services) {
+		for _, state := range []ServiceState{ServiceStateRunning, ServiceStateStopped, ServiceStateUnknown} {
+			writeSample(&b, "vpn_commander_service_state", boolGauge(m.services[router] == state), "router", router, "state", string(state))
+		}
+	}
+
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+// newMetricsHandler serves metrics to Prometheus scrapers
+func newMetricsHandler(metrics *Metrics) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		metrics.WriteTo(w)
+	})
+}
+
+// sshCommandKind classifies an SSH command so latencies can be labelled without unbounded cardinality
+func sshCommandKind(command string) string {
+	switch {
+	case strings.Contains(command, "xkeen -restart"):
+		return "restart"
+	case strings.Contains(command, "xkeen -start"):
+		return "start"
+	case strings.Contains(command, "xkeen -stop"):
+		return "stop"
+	case strings.Contains(command, "xkeen -status"):
+		return "status"
+	case strings.HasPrefix(command, "cat > "):
+		return "write"
+	case strings.HasPrefix(command, "cp "):
+		return "backup"
+	case strings.HasPrefix(command, "ls "):
+		return "list"
+	case command == "cat /proc/uptime":
+		return "uptime"
+	case strings.HasPrefix(command, "cat "):
+		return "read"
+	case strings.Contains(command, "curl "):
+		return "probe"
+	case strings.HasPrefix(command, "echo "):
+		return "check"
+	default:
+		return "other"
+	}
+}
+
+// routingModeLabel maps an outbound tag to the routing_mode label
+func routingModeLabel(outbound string) string {
+	switch statusForOutbound(outbound) {
+	case VPNStatusEnabled:
+		return "vpn"
+	case VPNStatusDisabled:
+		return "direct"
+	default:
+		return "other"
+	}
+}
+
+// resultLabel maps an error to the result label
+func resultLabel(err error) string {
+	if err != nil {
+		return "failure"
+	}
+	return "success"
+}
+
+// boolGauge renders a condition as a 0/1 gauge value
+func boolGauge(condition bool) int {
+	if condition {
+		return 1
+	}
+	return 0
+}
+
+// writeHeader writes the HELP and TYPE lines of a metric family
+func writeHeader(b *strings.Builder, name, kind, help string) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// writeSample writes one sample; labels are name/value pairs
+func writeSample(b *strings.Builder, name string, value interface{}, labels ...string) {
+	b.WriteString(name)
+	if len(labels) > 0 {
+		b.WriteByte('{')
+		for i := 0; i+1 < len(labels); i += 2 {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			fmt.Fprintf(b, "%s=\"%s\"", labels[i], escapeLabelValue(labels[i+1]))
+		}
+		b.WriteByte('}')
+	}
+
+	switch v := value.(type) {
+	case float64:
+		fmt.Fprintf(b, " %s\n", formatFloat(v))
+	default:
+		fmt.Fprintf(b, " %v\n", v)
+	}
+}
+
+// escapeLabelValue escapes a label value as the text format requires
+func escapeLabelValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+// formatFloat renders a float the way Prometheus clients do
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+// sortedKeys returns the keys of a string-keyed map in order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
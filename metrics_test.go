@@ -0,0 +1,132 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func TestMetricsExposition(t *testing.T) {
+	m := NewMetrics()
+	m.ObserveSSHCommand("read", 30*time.Millisecond, nil)
+	m.ObserveSSHCommand("read", 700*time.Millisecond, nil)
+	m.ObserveSSHCommand("restart", 3*time.Second, errors.New("exit status 1"))
+	m.IncSSHReconnects()
+	m.IncTelegramUpdate("start")
+	m.IncTelegramUpdate("callback")
+	m.IncTelegramUpdate("callback")
+	m.IncAuthFailure("auth_code")
+	m.ObserveConfigApply(nil)
+	m.SetRouting("192.168.1.1", "direct")
+	m.SetServiceState("192.168.1.1", ServiceStateRunning)
+
+	var b strings.Builder
+	if _, err := m.WriteTo(&b); err != nil {
+		t.Fatalf("WriteTo failed: %v", err)
+	}
+	text := b.String()
+
+	for _, want := range []string{
+		"# TYPE vpn_commander_ssh_commands_total counter",
+		`vpn_commander_ssh_commands_total{kind="read",result="success"} 2`,
+		`vpn_commander_ssh_commands_total{kind="restart",result="failure"} 1`,
+		"# TYPE vpn_commander_ssh_command_duration_seconds histogram",
+		`vpn_commander_ssh_command_duration_seconds_bucket{kind="read",le="0.05"} 1`,
+		`vpn_commander_ssh_command_duration_seconds_bucket{kind="read",le="1"} 2`,
+		`vpn_commander_ssh_command_duration_seconds_bucket{kind="restart",le="2.5"} 0`,
+		`vpn_commander_ssh_command_duration_seconds_bucket{kind="restart",le="+Inf"} 1`,
+		`vpn_commander_ssh_command_duration_seconds_count{kind="read"} 2`,
+		"vpn_commander_ssh_reconnects_total 1",
+		`vpn_commander_telegram_updates_total{command="callback"} 2`,
+		`vpn_commander_auth_failures_total{reason="auth_code"} 1`,
+		`vpn_commander_config_applies_total{result="success"} 1`,
+		`vpn_commander_config_applies_total{result="failure"} 0`,
+		`vpn_commander_routing_mode{router="192.168.1.1",mode="direct"} 1`,
+		`vpn_commander_routing_mode{router="192.168.1.1",mode="vpn"} 0`,
+		`vpn_commander_routing_outbound{router="192.168.1.1",outbound="direct"} 1`,
+		`vpn_commander_service_state{router="192.168.1.1",state="running"} 1`,
+		`vpn_commander_service_state{router="192.168.1.1",state="stopped"} 0`,
+	} {
+		if !strings.Contains(text, want+"\n") {
+			t.Errorf("Missing %q in:\n%s", want, text)
+		}
+	}
+}
+
+func TestMetricsNilSafe(t *testing.T) {
+	var m *Metrics
+	m.ObserveSSHCommand("read", time.Second, nil)
+	m.IncSSHReconnects()
+	m.IncTelegramUpdate("start")
+	m.IncAuthFailure("totp")
+	m.ObserveConfigApply(nil)
+	m.SetRouting("router", "direct")
+	m.SetServiceState("router", ServiceStateRunning)
+}
+
+func TestMetricsEndpoint(t *testing.T) {
+	m := NewMetrics()
+	m.IncAuthFailure(`odd"reason`)
+
+	handler := createHealthCheckHandler(nil, nil, nil, m, nil, nil, "", nil)
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", recorder.Code)
+	}
+	if contentType := recorder.Header().Get("Content-Type"); !strings.HasPrefix(contentType, "text/plain; version=0.0.4") {
+		t.Errorf("Unexpected content type %q", contentType)
+	}
+	if !strings.Contains(recorder.Body.String(), `reason="odd\"reason"`) {
+		t.Errorf("Expected escaped label value in:\n%s", recorder.Body.String())
+	}
+}
+
+func TestSSHCommandKind(t *testing.T) {
+	tests := map[string]string{
+		"cat /opt/etc/xray/configs/05_routing.json":                          "read",
+		"cat > /opt/etc/xray/configs/05_routing.json << 'EOF'\n{}\nEOF":      "write",
+		"cp /a /a.backup.$(date +%Y%m%d-%H%M%S)":                             "backup",
+		"xkeen -restart":                                                     "restart",
+		"export PATH=/opt/sbin && cd /opt/etc/xray/configs && xkeen -start":  "start",
+		"export PATH=/opt/sbin && cd /opt/etc/xray/configs && xkeen -status": "status",
+		"cat /proc/uptime":                         "uptime",
+		"curl -s -o /dev/null https://example.com": "probe",
+		"echo 'connection_test'":                   "check",
+		"uname -a":                                 "other",
+	}
+	for command, want := range tests {
+		if got := sshCommandKind(command); got != want {
+			t.Errorf("sshCommandKind(%q) = %q, want %q", command, got, want)
+		}
+	}
+}
+
+func TestUpdateCommandLabel(t *testing.T) {
+	message := func(text string) tgbotapi.Update {
+		return tgbotapi.Update{Message: &tgbotapi.Message{Text: text}}
+	}
+
+	tests := []struct {
+		update tgbotapi.Update
+		want   string
+	}{
+		{message("/auth 1234"), "auth"},
+		{message("/ping@vpn_commander_bot fastest"), "ping"},
+		{message("/rm -rf"), "unknown"},
+		{message("hello"), "text"},
+		{tgbotapi.Update{CallbackQuery: &tgbotapi.CallbackQuery{}}, "callback"},
+		{tgbotapi.Update{}, "other"},
+	}
+	for _, tt := range tests {
+		if got := updateCommandLabel(tt.update); got != tt.want {
+			t.Errorf("updateCommandLabel() = %q, want %q", got, tt.want)
+		}
+	}
+}
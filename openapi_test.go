@@ -0,0 +1,295 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// openAPIDocument is the part of the OpenAPI document the tests check against
+type openAPIDocument struct {
+	Paths      map[string]map[string]openAPIOperation `json:"paths"`
+	Components struct {
+		Responses map[string]openAPIResponse `json:"responses"`
+		Schemas   map[string]*openAPISchema  `json:"schemas"`
+	} `json:"components"`
+}
+
+type openAPIOperation struct {
+	Responses map[string]openAPIResponse `json:"responses"`
+}
+
+type openAPIResponse struct {
+	Ref     string `json:"$ref"`
+	Content map[string]struct {
+		Schema *openAPISchema `json:"schema"`
+	} `json:"content"`
+}
+
+// openAPISchema supports the JSON Schema keywords openapi.json uses
+type openAPISchema struct {
+	Ref                  string                    `json:"$ref"`
+	Type                 string                    `json:"type"`
+	Enum                 []interface{}             `json:"enum"`
+	Required             []string                  `json:"required"`
+	Properties           map[string]*openAPISchema `json:"properties"`
+	AdditionalProperties *bool                     `json:"additionalProperties"`
+	Items                *openAPISchema            `json:"items"`
+}
+
+func loadOpenAPIDocument(t *testing.T) *openAPIDocument {
+	t.Helper()
+	var doc openAPIDocument
+	if err := json.Unmarshal(openAPISpec, &doc); err != nil {
+		t.Fatalf("openapi.json is invalid: %v", err)
+	}
+	return &doc
+}
+
+// responseSchema returns the JSON schema of a documented response, failing if the status is undocumented
+func (doc *openAPIDocument) responseSchema(t *testing.T, path, method string, status int) *openAPISchema {
+	t.Helper()
+	operation, ok := doc.Paths[path][strings.ToLower(method)]
+	if !ok {
+		t.Fatalf("%s %s is not documented", method, path)
+	}
+	response, ok := operation.Responses[strconv.Itoa(status)]
+	if !ok {
+		t.Fatalf("%s %s: status %d is not documented", method, path, status)
+	}
+	if name, found := strings.CutPrefix(response.Ref, "#/components/responses/"); found {
+		response = doc.Components.Responses[name]
+	}
+	media, ok := response.Content["application/json"]
+	if !ok || media.Schema == nil {
+		t.Fatalf("%s %s: status %d has no JSON schema", method, path, status)
+	}
+	return media.Schema
+}
+
+// validate checks a decoded JSON value against schema
+func (doc *openAPIDocument) validate(schema *openAPISchema, value interface{}, at string) error {
+	if name, found := strings.CutPrefix(schema.Ref, "#/components/schemas/"); found {
+		resolved, ok := doc.Components.Schemas[name]
+		if !ok {
+			return fmt.Errorf("%s: unknown schema %q", at, name)
+		}
+		return doc.validate(resolved, value, at)
+	}
+
+	if len(schema.Enum) > 0 {
+		allowed := false
+		for _, option := range schema.Enum {
+			allowed = allowed || option == value
+		}
+		if !allowed {
+			return fmt.Errorf("%s: %v is not one of %v", at, value, schema.Enum)
+		}
+	}
+
+	switch schema.Type {
+	case "":
+		return nil
+	case "string":
+		if _, ok := value.(string); !ok {
+			return fmt.Errorf("%s: expected a string, got %T", at, value)
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("%s: expected a boolean, got %T", at, value)
+		}
+	case "integer":
+		number, ok := value.(float64)
+		if !ok || number != float64(int64(number)) {
+			return fmt.Errorf("%s: expected an integer, got %v", at, value)
+		}
+	case "array":
+		items, ok := value.([]interface{})
+		if !ok {
+			return fmt.Errorf("%s: expected an array, got %T", at, value)
+		}
+		for i, item := range items {
+			if err := doc.validate(schema.Items, item, fmt.Sprintf("%s[%d]", at, i)); err != nil {
+				return err
+			}
+		}
+	case "object":
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%s: expected an object, got %T", at, value)
+		}
+		for _, name := range schema.Required {
+			if _, ok := object[name]; !ok {
+				return fmt.Errorf("%s: missing required property %q", at, name)
+			}
+		}
+		for name, property := range object {
+			propertySchema, ok := schema.Properties[name]
+			if !ok {
+				if schema.AdditionalProperties != nil && !*schema.AdditionalProperties {
+					return fmt.Errorf("%s: undocumented property %q", at, name)
+				}
+				continue
+			}
+			if err := doc.validate(propertySchema, property, at+"."+name); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("%s: unsupported schema type %q", at, schema.Type)
+	}
+	return nil
+}
+
+// validateJSON decodes data and checks it against schema
+func (doc *openAPIDocument) validateJSON(schema *openAPISchema, data []byte) error {
+	var decoded interface{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return fmt.Errorf("response is not JSON: %w", err)
+	}
+	return doc.validate(schema, decoded, "$")
+}
+
+func TestOpenAPIServed(t *testing.T) {
+	handler := newTestAPIServer(t).Handler()
+
+	// The document is public so clients can discover the API before they have a token
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/openapi.json", nil))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", recorder.Code)
+	}
+	if recorder.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("Unexpected content type %q", recorder.Header().Get("Content-Type"))
+	}
+	if recorder.Body.String() != string(openAPISpec) {
+		t.Error("Served document differs from openapi.json")
+	}
+}
+
+func TestOpenAPIDocumentsEveryRoute(t *testing.T) {
+	doc := loadOpenAPIDocument(t)
+	handler := newTestAPIServer(t).Handler()
+
+	var paths []string
+	for path := range doc.Paths {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		for method := range doc.Paths[path] {
+			// Undocumented routes hit the catch-all 404 and wrong methods get 405
+			target := strings.Replace(path, "{action}", "restart", 1)
+			request := httptest.NewRequest(strings.ToUpper(method), target, strings.NewReader(`{"mode":"vpn"}`))
+			request.Header.Set("Authorization", "Bearer secret")
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, request)
+
+			if recorder.Code == http.StatusNotFound || recorder.Code == http.StatusMethodNotAllowed {
+				t.Errorf("%s %s is documented but not routed (%d)", method, path, recorder.Code)
+			}
+		}
+	}
+}
+
+func TestOpenAPIErrorResponses(t *testing.T) {
+	doc := loadOpenAPIDocument(t)
+	handler := newTestAPIServer(t).Handler()
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		path   string // Documented path
+		token  string
+		body   string
+		status int
+	}{
+		{"missing token", http.MethodGet, "/api/v1/routing", "/api/v1/routing", "", "", http.StatusUnauthorized},
+		{"offline router", http.MethodGet, "/api/v1/routing", "/api/v1/routing", "secret", "", http.StatusBadGateway},
+		{"invalid body", http.MethodPut, "/api/v1/routing", "/api/v1/routing", "secret", `{"mode":`, http.StatusBadRequest},
+		{"unknown field", http.MethodPut, "/api/v1/routing", "/api/v1/routing", "secret", `{"tag":"x"}`, http.StatusBadRequest},
+		{"invalid mode", http.MethodPut, "/api/v1/routing", "/api/v1/routing", "secret", `{"mode":"tor"}`, http.StatusBadRequest},
+		{"switch on offline router", http.MethodPut, "/api/v1/routing", "/api/v1/routing", "secret", `{"mode":"direct"}`, http.StatusBadGateway},
+		{"unknown service action", http.MethodPost, "/api/v1/service/reboot", "/api/v1/service/{action}", "secret", "", http.StatusNotFound},
+		{"service on offline router", http.MethodPost, "/api/v1/service/stop", "/api/v1/service/{action}", "secret", "", http.StatusBadGateway},
+		{"rules unauthorized", http.MethodGet, "/api/v1/rules", "/api/v1/rules", "wrong", "", http.StatusUnauthorized},
+		{"status on offline router", http.MethodGet, "/api/v1/status", "/api/v1/status", "secret", "", http.StatusBadGateway},
+		{"rules on offline router", http.MethodGet, "/api/v1/rules", "/api/v1/rules", "secret", "", http.StatusBadGateway},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+			if tt.token != "" {
+				request.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, request)
+
+			if recorder.Code != tt.status {
+				t.Fatalf("Expected %d, got %d: %s", tt.status, recorder.Code, recorder.Body.String())
+			}
+			schema := doc.responseSchema(t, tt.path, tt.method, recorder.Code)
+			if err := doc.validateJSON(schema, recorder.Body.Bytes()); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestOpenAPISuccessSchemas(t *testing.T) {
+	doc := loadOpenAPIDocument(t)
+
+	// The offline router cannot produce success responses, so check the bodies the handlers encode
+	tests := []struct {
+		path   string
+		method string
+		value  interface{}
+	}{
+		{"/api/v1/routing", http.MethodGet, RoutingState{Outbound: "vless-reality", Mode: routingModeLabel("vless-reality")}},
+		{"/api/v1/routing", http.MethodPut, RoutingState{Outbound: "direct", Mode: routingModeLabel("direct")}},
+		{"/api/v1/routing", http.MethodGet, RoutingState{Outbound: "warp", Mode: routingModeLabel("warp")}},
+		{"/api/v1/status", http.MethodGet, StatusResponse{RoutingState: RoutingState{Outbound: "direct", Mode: "direct"}, Service: ServiceStateStopped}},
+		{"/api/v1/service/{action}", http.MethodPost, ServiceResponse{Action: "restart", State: ServiceStateRunning}},
+		{"/api/v1/service/{action}", http.MethodPost, ServiceResponse{Action: "stop", State: ServiceStateUnknown}},
+		{"/api/v1/rules", http.MethodGet, RulesResponse{Rules: []RoutingRule{}}},
+		{"/api/v1/rules", http.MethodGet, RulesResponse{Rules: []RoutingRule{
+			{Index: 0, Rule: Rule{Type: "field", Domain: []string{"geosite:ru"}, OutboundTag: "direct"}},
+			{Index: 1, Rule: Rule{Type: "field", IP: "10.0.0.0/8", Port: "443", Protocol: []string{"tls"}, Network: "tcp", OutboundTag: "direct"}},
+			{Index: 2, Default: true, Rule: Rule{Type: "field", InboundTag: []string{"redirect", "tproxy"}, OutboundTag: "vless-reality"}},
+		}}},
+	}
+
+	for _, tt := range tests {
+		data, err := json.Marshal(tt.value)
+		if err != nil {
+			t.Fatalf("Failed to marshal %T: %v", tt.value, err)
+		}
+		schema := doc.responseSchema(t, tt.path, tt.method, http.StatusOK)
+		if err := doc.validateJSON(schema, data); err != nil {
+			t.Errorf("%s %s: %v", tt.method, tt.path, err)
+		}
+	}
+
+	// Every key in serviceActions is documented, and the validator rejects what the spec forbids
+	schema := doc.responseSchema(t, "/api/v1/service/{action}", http.MethodPost, http.StatusOK)
+	for name := range serviceActions {
+		data, _ := json.Marshal(ServiceResponse{Action: name, State: ServiceStateStopped})
+		if err := doc.validateJSON(schema, data); err != nil {
+			t.Errorf("Service action %q: %v", name, err)
+		}
+	}
+	if err := doc.validateJSON(schema, []byte(`{"action":"reboot","state":"running"}`)); err == nil {
+		t.Error("Expected an undocumented action to fail validation")
+	}
+	if err := doc.validateJSON(schema, []byte(`{"action":"start","state":"running","extra":1}`)); err == nil {
+		t.Error("Expected an undocumented property to fail validation")
+	}
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var errUnknownOutbound = errors.New("unknown outbound")
+
+// defaultOutboundsPath is where xkeen keeps the Xray outbounds
+const defaultOutboundsPath = "/opt/etc/xray/configs/04_outbounds.json"
+
+// OutboundsConfig represents the structure of the Xray outbounds configuration
+type OutboundsConfig struct {
+	Outbounds []Outbound `json:"outbounds"`
+}
+
+// Outbound represents an Xray outbound; only the fields needed to reach its server are parsed
+type Outbound struct {
+	Tag      string `json:"tag"`
+	Protocol string `json:"protocol"`
+	Settings struct {
+		Vnext   []OutboundServer `json:"vnext,omitempty"`   // vless, vmess
+		Servers []OutboundServer `json:"servers,omitempty"` // trojan, shadowsocks, socks, http
+	} `json:"settings"`
+	StreamSettings struct {
+		Security    string `json:"security,omitempty"`
+		TLSSettings *struct {
+			ServerName string `json:"serverName,omitempty"`
+		} `json:"tlsSettings,omitempty"`
+		RealitySettings *struct {
+			ServerName string `json:"serverName,omitempty"`
+		} `json:"realitySettings,omitempty"`
+	} `json:"streamSettings"`
+}
+
+// OutboundServer is a remote server an outbound connects to
+type OutboundServer struct {
+	Address string `json:"address"`
+	Port    int    `json:"port"`
+}
+
+// OutboundTarget is an outbound server endpoint that can be probed
+type OutboundTarget struct {
+	Tag        string
+	Address    string
+	Port       int
+	Security   string // "tls", "reality" or "" for plain TCP
+	ServerName string // SNI sent during the handshake
+}
+
+// OutboundLatency is the result of probing one outbound from the router
+type OutboundLatency struct {
+	OutboundTarget
+	Connect   time.Duration // TCP connect time
+	Handshake time.Duration // TLS/Reality handshake time, zero for plain TCP
+	Err       error
+}
+
+// Total returns the time until the connection was usable
+func (l OutboundLatency) Total() time.Duration {
+	if l.Handshake > 0 {
+		return l.Handshake
+	}
+	return l.Connect
+}
+
+// GetOutboundTargets lists the servers of every outbound that connects to one
+func (vm *VPNManager) GetOutboundTargets() ([]OutboundTarget, error) {
+	content, err := vm.router.ReadFile(vm.outboundsPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read outbounds file: %w", err)
+	}
+	return parseOutboundTargets(content)
+}
+
+// checkOutbound returns errUnknownOutbound unless tag names an outbound that connects to a server
+func (vm *VPNManager) checkOutbound(tag string) error {
+	targets, err := vm.GetOutboundTargets()
+	if err != nil {
+		return err
+	}
+	for _, target := range targets {
+		if target.Tag == tag {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %q", errUnknownOutbound, tag)
+}
+
+// parseOutboundTargets extracts probe targets from an outbounds file, skipping freedom, blackhole and the like
+func parseOutboundTargets(content string) ([]OutboundTarget, error) {
+	var config OutboundsConfig
+	if err := json.Unmarshal([]byte(content), &config); err != nil {
+		return nil, fmt.Errorf("failed to parse outbounds JSON: %w", err)
+	}
+
+	var targets []OutboundTarget
+	for _, outbound := range config.Outbounds {
+		servers := append(append([]OutboundServer{}, outbound.Settings.Vnext...), outbound.Settings.Servers...)
+		if len(servers) == 0 || outbound.Tag == "" {
+			continue
+		}
+
+		// Outbounds with several servers are measured on the first one, which Xray tries first
+		target := OutboundTarget{
+			Tag:      outbound.Tag,
+			Address:  servers[0].Address,
+			Port:     servers[0].Port,
+			Security: outbound.StreamSettings.Security,
+		}
+		switch target.Security {
+		case "reality":
+			if outbound.StreamSettings.RealitySettings != nil {
+				target.ServerName = outbound.StreamSettings.RealitySettings.ServerName
+			}
+		case "tls":
+			if outbound.StreamSettings.TLSSettings != nil {
+				target.ServerName = outbound.StreamSettings.TLSSettings.ServerName
+			}
+		default:
+			target.Security = ""
+		}
+		if target.ServerName == "" {
+			target.ServerName = target.Address
+		}
+		targets = append(targets, target)
+	}
+	return targets, nil
+}
+
+// PingOutbounds measures connect and handshake latency from the router to every outbound server,
+// returning the results fastest first with unreachable outbounds last
+func (vm *VPNManager) PingOutbounds(ctx context.Context, timeout time.Duration) ([]OutboundLatency, error) {
+	targets, err := vm.GetOutboundTargets()
+	if err != nil {
+		return nil, err
+	}
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("no outbound servers configured in %s", vm.outboundsPath)
+	}
+
+	// One SSH round trip for all outbounds keeps the router's session limit out of the picture
+	output, err := vm.router.ExecuteCommand(buildPingScript(targets, timeout))
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	if err != nil && strings.TrimSpace(output) == "" {
+		return nil, fmt.Errorf("failed to probe outbounds: %w", err)
+	}
+
+	results := parsePingOutput(targets, output)
+	sortLatencies(results)
+	return results, nil
+}
+
+// buildPingScript returns a shell script printing "INDEX CONNECT HANDSHAKE EXIT" for every target
+// A Reality server forwards the handshake to its camouflage site, so a TLS handshake with the
+// outbound's SNI measures the same path the tunnel uses
+func buildPingScript(targets []OutboundTarget, timeout time.Duration) string {
+	seconds := int(timeout.Seconds())
+	if seconds < 1 {
+		seconds = 1
+	}
+
+	var script strings.Builder
+	for i, target := range targets {
+		host := shellQuoteHost(target.Address)
+		if strings.Contains(host, ":") {
+			host = "[" + host + "]" // IPv6 literal
+		}
+
+		var probe string
+		if target.Security == "" {
+			probe = fmt.Sprintf("curl -s -o /dev/null -m %d -w '%%{time_connect} %%{time_appconnect}' 'telnet://%s:%d' </dev/null",
+				seconds, host, target.Port)
+		} else {
+			probe = fmt.Sprintf("curl -k -s -o /dev/null -m %d -w '%%{time_connect} %%{time_appconnect}' --connect-to '%s:443:%s:%d' 'https://%s/'",
+				seconds, shellQuoteHost(target.ServerName), host, target.Port, shellQuoteHost(target.ServerName))
+		}
+		fmt.Fprintf(&script, "printf '%d '; %s; echo \" $?\"\n", i, probe)
+	}
+	return script.String()
+}
+
+// shellQuoteHost drops characters that could break out of the single-quoted curl arguments
+func shellQuoteHost(host string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '\'' || r == '\\' || r == ' ' {
+			return -1
+		}
+		return r
+	}, host)
+}
+
+// parsePingOutput matches script output lines back to their targets
+func parsePingOutput(targets []OutboundTarget, output string) []OutboundLatency {
+	results := make([]OutboundLatency, len(targets))
+	for i, target := range targets {
+		results[i] = OutboundLatency{OutboundTarget: target, Err: fmt.Errorf("no probe result")}
+	}
+
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 4 {
+			continue
+		}
+		index, err := strconv.Atoi(fields[0])
+		if err != nil || index < 0 || index >= len(targets) {
+			continue
+		}
+
+		result := &results[index]
+		result.Err = nil
+		result.Connect = parseCurlSeconds(fields[1])
+		if result.Security != "" {
+			result.Handshake = parseCurlSeconds(fields[2])
+		}
+
+		exitCode := fields[3]
+		switch {
+		case result.Connect == 0:
+			result.Err = fmt.Errorf("connection failed (curl exit %s)", exitCode)
+		case result.Security != "" && result.Handshake == 0:
+			result.Err = fmt.Errorf("handshake failed (curl exit %s)", exitCode)
+		}
+	}
+	return results
+}
+
+// parseCurlSeconds converts a curl timing in seconds to a duration, returning zero for garbage
+func parseCurlSeconds(value string) time.Duration {
+	seconds, err := strconv.ParseFloat(value, 64)
+	if err != nil || seconds <= 0 {
+		return 0
+	}
+	return time.Duration(seconds * float64(time.Second))
+}
+
+// sortLatencies orders results fastest first, with failed probes last
+func sortLatencies(results []OutboundLatency) {
+	sort.SliceStable(results, func(i, j int) bool {
+		if (results[i].Err == nil) != (results[j].Err == nil) {
+			return results[i].Err == nil
+		}
+		return results[i].Total() < results[j].Total()
+	})
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testOutbounds = `{
+  "outbounds": [
+    {
+      "tag": "vless-reality",
+      "protocol": "vless",
+      "settings": {"vnext": [{"address": "203.0.113.10", "port": 443, "users": [{"id": "uuid"}]}]},
+      "streamSettings": {"network": "tcp", "security": "reality", "realitySettings": {"serverName": "www.example.com"}}
+    },
+    {
+      "tag": "trojan-tls",
+      "protocol": "trojan",
+      "settings": {"servers": [{"address": "backup.example.net", "port": 8443}]},
+      "streamSettings": {"security": "tls", "tlsSettings": {}}
+    },
+    {
+      "tag": "ss-plain",
+      "protocol": "shadowsocks",
+      "settings": {"servers": [{"address": "198.51.100.7", "port": 8388}]}
+    },
+    {"tag": "direct", "protocol": "freedom"},
+    {"tag": "block", "protocol": "blackhole"}
+  ]
+}`
+
+func TestParseOutboundTargets(t *testing.T) {
+	targets, err := parseOutboundTargets(testOutbounds)
+	if err != nil {
+		t.Fatalf("parseOutboundTargets failed: %v", err)
+	}
+
+	want := []OutboundTarget{
+		{Tag: "vless-reality", Address: "203.0.113.10", Port: 443, Security: "reality", ServerName: "www.example.com"},
+		{Tag: "trojan-tls", Address: "backup.example.net", Port: 8443, Security: "tls", ServerName: "backup.example.net"},
+		{Tag: "ss-plain", Address: "198.51.100.7", Port: 8388, ServerName: "198.51.100.7"},
+	}
+	if len(targets) != len(want) {
+		t.Fatalf("Expected %d targets, got %+v", len(want), targets)
+	}
+	for i := range want {
+		if targets[i] != want[i] {
+			t.Errorf("Target %d = %+v, want %+v", i, targets[i], want[i])
+		}
+	}
+
+	if _, err := parseOutboundTargets("not json"); err == nil {
+		t.Error("Expected an error for invalid JSON")
+	}
+}
+
+func TestBuildPingScript(t *testing.T) {
+	targets, _ := parseOutboundTargets(testOutbounds)
+	script := buildPingScript(targets, 5*time.Second)
+
+	lines := strings.Split(strings.TrimSpace(script), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("Expected one line per target, got %q", script)
+	}
+	if !strings.Contains(lines[0], "--connect-to 'www.example.com:443:203.0.113.10:443' 'https://www.example.com/'") {
+		t.Errorf("Reality probe should handshake with the SNI through the server: %s", lines[0])
+	}
+	if !strings.Contains(lines[2], "'telnet://198.51.100.7:8388'") {
+		t.Errorf("Plain outbound should only be connected to: %s", lines[2])
+	}
+}
+
+func TestParsePingOutput(t *testing.T) {
+	targets, _ := parseOutboundTargets(testOutbounds)
+	output := "0 0.041200 0.120500 0\n" +
+		"1 0.000000 0.000000 28\n" +
+		"2 0.030000 0.000000 0\n"
+
+	results := parsePingOutput(targets, output)
+	sortLatencies(results)
+
+	if results[0].Tag != "ss-plain" || results[0].Connect != 30*time.Millisecond || results[0].Err != nil {
+		t.Errorf("Expected the plain outbound first, got %+v", results[0])
+	}
+	if results[1].Tag != "vless-reality" || results[1].Handshake != 120500*time.Microsecond {
+		t.Errorf("Expected the Reality outbound second, got %+v", results[1])
+	}
+	if results[2].Tag != "trojan-tls" || results[2].Err == nil {
+		t.Errorf("Expected the unreachable outbound last, got %+v", results[2])
+	}
+}
+
+func TestParsePingOutputMissingAndFailedHandshake(t *testing.T) {
+	targets, _ := parseOutboundTargets(testOutbounds)
+	results := parsePingOutput(targets, "ps: applet not found\n0 0.040000 0.000000 35\n")
+
+	if results[0].Err == nil || !strings.Contains(results[0].Err.Error(), "handshake") {
+		t.Errorf("Expected a handshake failure, got %v", results[0].Err)
+	}
+	if results[1].Err == nil || results[2].Err == nil {
+		t.Error("Expected targets without output to be reported as failed")
+	}
+}
+
+func TestFormatPingResults(t *testing.T) {
+	results := []OutboundLatency{
+		{OutboundTarget: OutboundTarget{Tag: "vless-reality", Security: "reality"}, Connect: 41 * time.Millisecond, Handshake: 120 * time.Millisecond},
+		{OutboundTarget: OutboundTarget{Tag: "trojan-tls", Security: "tls"}, Err: errors.New("connection failed")},
+	}
+
+	text := formatPingResults(LanguageEnglish, results, "vless-reality")
+	if !strings.Contains(text, "* vless-reality") || !strings.Contains(text, "120ms") {
+		t.Errorf("Expected the active outbound marked with its latency:\n%s", text)
+	}
+	if !strings.Contains(text, "failed") {
+		t.Errorf("Expected the failed outbound to be shown:\n%s", text)
+	}
+}
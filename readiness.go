@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Readiness check defaults
+const (
+	defaultReadyCacheTTL = 30 * time.Second
+	defaultReadyTimeout  = 5 * time.Second
+)
+
+// ReadinessResult is the outcome of one readiness check
+type ReadinessResult struct {
+	OK         bool      `json:"ok"`
+	Error      string    `json:"error,omitempty"`
+	DurationMS int64     `json:"duration_ms"`
+	CheckedAt  time.Time `json:"checked_at"`
+}
+
+// ReadinessReport is the /ready response body
+type ReadinessReport struct {
+	Ready  bool                       `json:"ready"`
+	Checks map[string]ReadinessResult `json:"checks"`
+}
+
+// readinessCheck is a named dependency check
+type readinessCheck struct {
+	name string
+	run  func() error
+}
+
+// ReadinessChecker runs dependency checks for /ready, caching results so frequent probes
+// do not hammer the router or the Telegram API
+type ReadinessChecker struct {
+	checks  []readinessCheck
+	ttl     time.Duration
+	timeout time.Duration
+	logger  *logrus.Logger
+	results map[string]ReadinessResult
+	running map[string]chan struct{} // Closed when the check finishes
+	mutex   sync.Mutex
+	now     func() time.Time
+}
+
+// NewReadinessChecker creates a checker for SSH, the routing config and the Telegram API
+// Results are reused for ttl, and a request waits at most timeout for checks to finish
+func NewReadinessChecker(vpnManager *VPNManager, bot *TelegramBot, ttl, timeout time.Duration, logger *logrus.Logger) *ReadinessChecker {
+	rc := newReadinessChecker(ttl, timeout, logger)
+	rc.add("ssh", vpnManager.CheckRouter)
+	rc.add("routing_config", vpnManager.ValidateConfiguration)
+	rc.add("telegram", bot.CheckAPI)
+	return rc
+}
+
+// newReadinessChecker creates a checker without any checks
+func newReadinessChecker(ttl, timeout time.Duration, logger *logrus.Logger) *ReadinessChecker {
+	if ttl <= 0 {
+		ttl = defaultReadyCacheTTL
+	}
+	if timeout <= 0 {
+		timeout = defaultReadyTimeout
+	}
+	return &ReadinessChecker{
+		ttl:     ttl,
+		timeout: timeout,
+		logger:  logger,
+		results: make(map[string]ReadinessResult),
+		running: make(map[string]chan struct{}),
+		now:     time.Now,
+	}
+}
+
+// add registers a check
+func (rc *ReadinessChecker) add(name string, run func() error) {
+	rc.checks = append(rc.checks, readinessCheck{name: name, run: run})
+}
+
+// Check reports every check, rerunning those whose cached result is older than the TTL
+// A check still running when ctx ends is reported as failed and keeps running in the background
+func (rc *ReadinessChecker) Check(ctx context.Context) ReadinessReport {
+	ctx, cancel := context.WithTimeout(ctx, rc.timeout)
+	defer cancel()
+
+	var waiting []chan struct{}
+	rc.mutex.Lock()
+	for _, check := range rc.checks {
+		if result, ok := rc.results[check.name]; ok && rc.now().Sub(result.CheckedAt) < rc.ttl {
+			continue
+		}
+		done, running := rc.running[check.name]
+		if !running {
+			done = make(chan struct{})
+			rc.running[check.name] = done
+			go rc.run(check, done)
+		}
+		waiting = append(waiting, done)
+	}
+	rc.mutex.Unlock()
+
+	for _, done := range waiting {
+		select {
+		case <-done:
+		case <-ctx.Done():
+		}
+	}
+
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+
+	report := ReadinessReport{Ready: true, Checks: make(map[string]ReadinessResult)}
+	for _, check := range rc.checks {
+		result, ok := rc.results[check.name]
+		if _, running := rc.running[check.name]; running && (!ok || rc.now().Sub(result.CheckedAt) >= rc.ttl) {
+			result = ReadinessResult{Error: "check timed out", CheckedAt: rc.now()}
+		}
+		report.Checks[check.name] = result
+		report.Ready = report.Ready && result.OK
+	}
+	return report
+}
+
+// run executes a check and stores its result
+func (rc *ReadinessChecker) run(check readinessCheck, done chan struct{}) {
+	start := rc.now()
+	err := check.run()
+	result := ReadinessResult{
+		OK:         err == nil,
+		DurationMS: time.Since(start).Milliseconds(),
+		CheckedAt:  rc.now(),
+	}
+	if err != nil {
+		result.Error = err.Error()
+		rc.logger.WithError(err).WithField("check", check.name).Warn("Readiness check failed")
+	}
+
+	rc.mutex.Lock()
+	rc.results[check.name] = result
+	delete(rc.running, check.name)
+	rc.mutex.Unlock()
+	close(done)
+}
+
+// newReadinessHandler serves the readiness report, with 503 while any check fails
+func newReadinessHandler(checker *ReadinessChecker) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		report := checker.Check(r.Context())
+
+		w.Header().Set("Content-Type", "application/json")
+		if report.Ready {
+			w.WriteHeader(http.StatusOK)
+		} else {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(report)
+	})
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+func newTestReadinessChecker(ttl, timeout time.Duration) *ReadinessChecker {
+	logger := logrus.New()
+	logger.SetLevel(logrus.FatalLevel)
+	return newReadinessChecker(ttl, timeout, logger)
+}
+
+func TestReadinessCheckerCachesResults(t *testing.T) {
+	rc := newTestReadinessChecker(time.Minute, time.Second)
+	var calls atomic.Int32
+	rc.add("ssh", func() error {
+		calls.Add(1)
+		return nil
+	})
+
+	for i := 0; i < 3; i++ {
+		if report := rc.Check(context.Background()); !report.Ready || !report.Checks["ssh"].OK {
+			t.Fatalf("Expected ready, got %+v", report)
+		}
+	}
+	if calls.Load() != 1 {
+		t.Errorf("Expected the check to run once within the TTL, ran %d times", calls.Load())
+	}
+
+	// Once the cached result expires the check runs again
+	rc.now = func() time.Time { return time.Now().Add(2 * time.Minute) }
+	rc.Check(context.Background())
+	if calls.Load() != 2 {
+		t.Errorf("Expected the check to rerun after the TTL, ran %d times", calls.Load())
+	}
+}
+
+func TestReadinessCheckerReportsFailures(t *testing.T) {
+	rc := newTestReadinessChecker(time.Minute, time.Second)
+	rc.add("ssh", func() error { return nil })
+	rc.add("routing_config", func() error { return errors.New("target routing rule not found") })
+
+	report := rc.Check(context.Background())
+	if report.Ready {
+		t.Fatal("Expected not ready when a check fails")
+	}
+	if !report.Checks["ssh"].OK {
+		t.Error("Expected the passing check to be reported as OK")
+	}
+	if got := report.Checks["routing_config"].Error; got != "target routing rule not found" {
+		t.Errorf("Unexpected error %q", got)
+	}
+}
+
+func TestReadinessCheckerTimesOut(t *testing.T) {
+	rc := newTestReadinessChecker(time.Minute, 20*time.Millisecond)
+	release := make(chan struct{})
+	rc.add("telegram", func() error {
+		<-release
+		return nil
+	})
+
+	report := rc.Check(context.Background())
+	if report.Ready || report.Checks["telegram"].Error != "check timed out" {
+		t.Fatalf("Expected a timed out check, got %+v", report)
+	}
+
+	// The slow check finishes in the background and its result is used afterwards
+	close(release)
+	deadline := time.Now().Add(5 * time.Second)
+	for !rc.Check(context.Background()).Ready {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the finished check to make the service ready")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestReadinessHandler(t *testing.T) {
+	rc := newTestReadinessChecker(time.Minute, time.Second)
+	rc.add("ssh", func() error { return errors.New("connection refused") })
+
+	recorder := httptest.NewRecorder()
+	newReadinessHandler(rc).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/ready", nil))
+
+	if recorder.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503, got %d", recorder.Code)
+	}
+	var report ReadinessReport
+	if err := json.NewDecoder(recorder.Body).Decode(&report); err != nil {
+		t.Fatalf("Invalid JSON: %v", err)
+	}
+	if report.Ready || report.Checks["ssh"].Error != "connection refused" {
+		t.Errorf("Unexpected report %+v", report)
+	}
+}
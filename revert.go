@@ -0,0 +1,296 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+var errNoPendingRevert = errors.New("no routing revert is pending")
+
+// revertRetryDelay is how long a revert that failed on the router waits before it is tried again
+const revertRetryDelay = time.Minute
+
+// PendingRevert is a scheduled switch back to the routing in effect before a timed change
+type PendingRevert struct {
+	Action    Action    `json:"action"`             // Audit action of the switch back, see revertAction
+	Outbound  string    `json:"outbound,omitempty"` // Outbound restored; empty in reverts saved before it was recorded
+	At        time.Time `json:"at"`
+	UserID    int64     `json:"user_id"`
+	Username  string    `json:"username,omitempty"`
+	ChatID    int64     `json:"chat_id"`
+	CreatedAt time.Time `json:"created_at"`
+
+	failures int // Failed attempts since the revert came due
+}
+
+// revertAction returns the audit action of switching back to outbound
+func revertAction(outbound string) Action {
+	switch statusForOutbound(outbound) {
+	case VPNStatusEnabled:
+		return ActionEnableVPN
+	case VPNStatusDisabled:
+		return ActionDisableVPN
+	default:
+		return ActionSelectOutbound
+	}
+}
+
+// RevertManager runs at most one pending routing revert, persisting it across restarts
+type RevertManager struct {
+	path       string
+	vpnManager *VPNManager
+	logger     *logrus.Logger
+	pending    *PendingRevert
+	timer      *time.Timer
+	notify     func(revert PendingRevert, err error)
+	mutex      sync.Mutex
+	now        func() time.Time
+}
+
+// NewRevertManager creates a revert manager persisting the pending revert to path
+func NewRevertManager(path string, vpnManager *VPNManager, logger *logrus.Logger) (*RevertManager, error) {
+	rm := &RevertManager{
+		path:       path,
+		vpnManager: vpnManager,
+		logger:     logger,
+		now:        time.Now,
+	}
+
+	if err := loadJSONFile(path, &rm.pending); err != nil {
+		return nil, fmt.Errorf("failed to load pending revert: %w", err)
+	}
+
+	return rm, nil
+}
+
+// SetNotifier registers a callback invoked after a revert has run
+func (rm *RevertManager) SetNotifier(notify func(revert PendingRevert, err error)) {
+	rm.mutex.Lock()
+	defer rm.mutex.Unlock()
+	rm.notify = notify
+}
+
+// Start arms the timer for a revert loaded from disk; one that came due while
+// the bot was down runs immediately
+func (rm *RevertManager) Start() {
+	rm.mutex.Lock()
+	defer rm.mutex.Unlock()
+
+	if rm.pending != nil {
+		rm.logger.WithFields(logrus.Fields{
+			"action": rm.pending.Action,
+			"at":     rm.pending.At,
+		}).Info("Resuming pending routing revert")
+		rm.arm()
+	}
+}
+
+// Schedule replaces any pending revert with revert
+func (rm *RevertManager) Schedule(revert PendingRevert) error {
+	switch {
+	case revert.Outbound != "" && revert.Action != revertAction(revert.Outbound):
+		return fmt.Errorf("cannot revert to %q with action %q", revert.Outbound, revert.Action)
+	case revert.Outbound == "" && revert.Action != ActionEnableVPN && revert.Action != ActionDisableVPN:
+		return fmt.Errorf("cannot revert with action %q", revert.Action)
+	}
+	if revert.CreatedAt.IsZero() {
+		revert.CreatedAt = rm.now()
+	}
+
+	rm.mutex.Lock()
+	defer rm.mutex.Unlock()
+
+	previous := rm.pending
+	rm.pending = &revert
+	if err := rm.save(); err != nil {
+		rm.pending = previous
+		return err
+	}
+	rm.arm()
+
+	rm.logger.WithFields(logrus.Fields{
+		"action":  revert.Action,
+		"at":      revert.At,
+		"user_id": revert.UserID,
+	}).Info("Routing revert scheduled")
+	return nil
+}
+
+// Pending returns the pending revert, if any
+func (rm *RevertManager) Pending() (PendingRevert, bool) {
+	if rm == nil {
+		return PendingRevert{}, false
+	}
+
+	rm.mutex.Lock()
+	defer rm.mutex.Unlock()
+	if rm.pending == nil {
+		return PendingRevert{}, false
+	}
+	return *rm.pending, true
+}
+
+// Extend postpones the pending revert by d
+func (rm *RevertManager) Extend(d time.Duration) (PendingRevert, error) {
+	rm.mutex.Lock()
+	defer rm.mutex.Unlock()
+
+	if rm.pending == nil {
+		return PendingRevert{}, errNoPendingRevert
+	}
+
+	previous := rm.pending.At
+	rm.pending.At = rm.pending.At.Add(d)
+	if err := rm.save(); err != nil {
+		rm.pending.At = previous
+		return PendingRevert{}, err
+	}
+	rm.arm()
+
+	rm.logger.WithField("at", rm.pending.At).Info("Routing revert extended")
+	return *rm.pending, nil
+}
+
+// Cancel drops the pending revert, keeping the current routing
+func (rm *RevertManager) Cancel() (PendingRevert, error) {
+	rm.mutex.Lock()
+	defer rm.mutex.Unlock()
+
+	if rm.pending == nil {
+		return PendingRevert{}, errNoPendingRevert
+	}
+
+	cancelled := *rm.pending
+	rm.pending = nil
+	if err := rm.save(); err != nil {
+		rm.pending = &cancelled
+		return PendingRevert{}, err
+	}
+	rm.disarm()
+
+	rm.logger.WithField("action", cancelled.Action).Info("Routing revert cancelled")
+	return cancelled, nil
+}
+
+// CancelIfAction drops the pending revert when it would perform action, which
+// has just been done by hand and made the revert pointless
+func (rm *RevertManager) CancelIfAction(action Action) {
+	if rm == nil {
+		return
+	}
+	if pending, ok := rm.Pending(); ok && pending.Action == action {
+		if _, err := rm.Cancel(); err != nil && !errors.Is(err, errNoPendingRevert) {
+			rm.logger.WithError(err).Error("Failed to cancel obsolete routing revert")
+		}
+	}
+}
+
+// Stop disarms the timer without touching the persisted revert
+func (rm *RevertManager) Stop() {
+	rm.mutex.Lock()
+	defer rm.mutex.Unlock()
+	rm.disarm()
+}
+
+// arm (re)starts the timer for the pending revert
+// Caller must hold rm.mutex
+func (rm *RevertManager) arm() {
+	rm.armAfter(rm.pending.At.Sub(rm.now()))
+}
+
+// armAfter (re)starts the timer for the pending revert to fire after d
+// Caller must hold rm.mutex
+func (rm *RevertManager) armAfter(d time.Duration) {
+	rm.disarm()
+
+	revert := rm.pending
+	rm.timer = time.AfterFunc(d, func() { rm.fire(revert) })
+}
+
+// disarm stops the timer, if any
+// Caller must hold rm.mutex
+func (rm *RevertManager) disarm() {
+	if rm.timer != nil {
+		rm.timer.Stop()
+		rm.timer = nil
+	}
+}
+
+// fire runs revert unless it has been cancelled, extended or replaced meanwhile
+// The revert stays pending, on disk too, until the switch back has succeeded
+func (rm *RevertManager) fire(revert *PendingRevert) {
+	rm.mutex.Lock()
+	if rm.pending != revert {
+		rm.mutex.Unlock()
+		return
+	}
+	// Timers can fire a little early; wait for the rest instead of dropping the revert
+	if remaining := revert.At.Sub(rm.now()); remaining > 0 {
+		rm.armAfter(remaining)
+		rm.mutex.Unlock()
+		return
+	}
+	rm.timer = nil
+	notify := rm.notify
+	rm.mutex.Unlock()
+
+	ctx := withActor(context.Background(), Actor{
+		UserID:   revert.UserID,
+		Username: revert.Username,
+		Source:   "revert",
+	})
+
+	var err error
+	if revert.Outbound != "" {
+		err = rm.vpnManager.SwitchOutbound(ctx, revert.Action, revert.Outbound)
+	} else {
+		err = rm.vpnManager.Perform(ctx, revert.Action)
+	}
+
+	rm.mutex.Lock()
+	current := rm.pending == revert
+	switch {
+	case err == nil:
+		rm.logger.WithField("action", revert.Action).Info("Routing reverted")
+		if current {
+			rm.pending = nil
+			if err := rm.save(); err != nil {
+				rm.logger.WithError(err).Error("Failed to clear pending revert")
+			}
+		}
+	case errors.Is(err, ErrShuttingDown):
+		// Kept on disk, the revert runs when the bot starts again
+		rm.logger.WithField("action", revert.Action).Info("Routing revert postponed by shutdown")
+		rm.mutex.Unlock()
+		return
+	default:
+		rm.logger.WithError(err).WithField("action", revert.Action).Error("Routing revert failed")
+		revert.failures++
+		if current {
+			rm.armAfter(revertRetryDelay)
+		}
+	}
+	// Retries of a failing revert are not announced again, but its eventual success is
+	announce := err == nil || revert.failures <= 1
+	// Extend may move At once the lock is released
+	notified := *revert
+	rm.mutex.Unlock()
+
+	if notify != nil && announce {
+		notify(notified, err)
+	}
+}
+
+// save persists the pending revert, writing null when there is none
+// Caller must hold rm.mutex
+func (rm *RevertManager) save() error {
+	if err := saveJSONFile(rm.path, rm.pending); err != nil {
+		return fmt.Errorf("failed to save pending revert: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// newOfflineVPNManager returns a VPN manager whose router is unreachable, so
+// router actions are attempted but fail fast
+func newOfflineVPNManager(t *testing.T) *VPNManager {
+	t.Helper()
+
+	logger := logrus.New()
+	logger.SetLevel(logrus.FatalLevel)
+
+	sshClient, err := NewSSHClient("127.0.0.1:1", "user", "password", logger)
+	if err != nil {
+		t.Fatalf("NewSSHClient failed: %v", err)
+	}
+	return NewVPNManager(sshClient, logger)
+}
+
+func newTestRevertManager(t *testing.T, path string) *RevertManager {
+	t.Helper()
+
+	vm := newOfflineVPNManager(t)
+	rm, err := NewRevertManager(path, vm, vm.logger)
+	if err != nil {
+		t.Fatalf("NewRevertManager failed: %v", err)
+	}
+	t.Cleanup(rm.Stop)
+	return rm
+}
+
+func TestRevertManagerFires(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "reverts.json")
+	vm, _ := newFakeRouterManager(t, "direct")
+	rm, err := NewRevertManager(path, vm, vm.logger)
+	if err != nil {
+		t.Fatalf("NewRevertManager failed: %v", err)
+	}
+	t.Cleanup(rm.Stop)
+
+	fired := make(chan PendingRevert, 1)
+	rm.SetNotifier(func(revert PendingRevert, err error) {
+		if err != nil {
+			t.Errorf("Revert failed: %v", err)
+		}
+		fired <- revert
+	})
+
+	// The outbound in effect before the timed switch is restored, whatever it was
+	revert := PendingRevert{Action: ActionSelectOutbound, Outbound: "block", At: time.Now().Add(20 * time.Millisecond), ChatID: 7}
+	if err := rm.Schedule(revert); err != nil {
+		t.Fatalf("Schedule failed: %v", err)
+	}
+
+	select {
+	case revert := <-fired:
+		if revert.Outbound != "block" || revert.ChatID != 7 {
+			t.Errorf("Unexpected revert fired: %+v", revert)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Revert did not fire")
+	}
+
+	if outbound, err := vm.GetActiveOutbound(); err != nil || outbound != "block" {
+		t.Errorf("Expected the routing to be switched back to block, got %q (%v)", outbound, err)
+	}
+	if _, ok := rm.Pending(); ok {
+		t.Error("Expected no pending revert after it fired")
+	}
+	if _, ok := newTestRevertManager(t, path).Pending(); ok {
+		t.Error("Expected the fired revert to be removed from disk")
+	}
+}
+
+func TestRevertManagerKeepsFailedRevert(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "reverts.json")
+	rm := newTestRevertManager(t, path)
+
+	fired := make(chan error, 1)
+	rm.SetNotifier(func(revert PendingRevert, err error) { fired <- err })
+	if err := rm.Schedule(PendingRevert{Action: ActionEnableVPN, Outbound: "vless-reality", At: time.Now().Add(20 * time.Millisecond)}); err != nil {
+		t.Fatalf("Schedule failed: %v", err)
+	}
+
+	select {
+	case err := <-fired:
+		if err == nil {
+			t.Fatal("Expected the revert to fail against an offline router")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Revert did not fire")
+	}
+
+	// A failed revert is retried, and survives a restart until it succeeds
+	if _, ok := rm.Pending(); !ok {
+		t.Error("Expected the failed revert to stay pending")
+	}
+	rm.Stop()
+	if pending, ok := newTestRevertManager(t, path).Pending(); !ok || pending.Outbound != "vless-reality" {
+		t.Errorf("Expected the failed revert to stay on disk, got %+v %v", pending, ok)
+	}
+}
+
+func TestRevertManagerAnnouncesSuccessAfterFailures(t *testing.T) {
+	vm, _ := newFakeRouterManager(t, "direct")
+	rm, err := NewRevertManager(filepath.Join(t.TempDir(), "reverts.json"), vm, vm.logger)
+	if err != nil {
+		t.Fatalf("NewRevertManager failed: %v", err)
+	}
+	t.Cleanup(rm.Stop)
+
+	fired := make(chan error, 1)
+	rm.SetNotifier(func(revert PendingRevert, err error) { fired <- err })
+	at := time.Now().Add(time.Hour)
+	if err := rm.Schedule(PendingRevert{Action: ActionSelectOutbound, Outbound: "block", At: at}); err != nil {
+		t.Fatalf("Schedule failed: %v", err)
+	}
+
+	// Earlier attempts failed and were announced once; the retry that works is announced too
+	rm.mutex.Lock()
+	revert := rm.pending
+	revert.failures = 2
+	rm.now = func() time.Time { return at.Add(time.Minute) }
+	rm.mutex.Unlock()
+	rm.fire(revert)
+
+	select {
+	case err := <-fired:
+		if err != nil {
+			t.Errorf("Expected the revert to succeed, got %v", err)
+		}
+	default:
+		t.Fatal("Expected the successful revert to be announced")
+	}
+}
+
+func TestRevertManagerWaitsForEarlyTimer(t *testing.T) {
+	vm, _ := newFakeRouterManager(t, "vless-reality")
+	rm, err := NewRevertManager(filepath.Join(t.TempDir(), "reverts.json"), vm, vm.logger)
+	if err != nil {
+		t.Fatalf("NewRevertManager failed: %v", err)
+	}
+	t.Cleanup(rm.Stop)
+
+	fired := make(chan struct{})
+	rm.SetNotifier(func(PendingRevert, error) { close(fired) })
+
+	// The timer is armed 20ms ahead, then fires while the clock still reads 10ms before the deadline
+	at := time.Now().Add(time.Hour)
+	var calls atomic.Int32
+	rm.now = func() time.Time {
+		switch calls.Add(1) {
+		case 1:
+			return at.Add(-20 * time.Millisecond)
+		case 2:
+			return at.Add(-10 * time.Millisecond)
+		default:
+			return at
+		}
+	}
+	if err := rm.Schedule(PendingRevert{Action: ActionDisableVPN, Outbound: "direct", At: at, CreatedAt: time.Now()}); err != nil {
+		t.Fatalf("Schedule failed: %v", err)
+	}
+
+	select {
+	case <-fired:
+	case <-time.After(5 * time.Second):
+		t.Fatal("An early timer dropped the revert instead of waiting for the deadline")
+	}
+	if outbound, _ := vm.GetActiveOutbound(); outbound != "direct" {
+		t.Errorf("Expected direct routing, got %q", outbound)
+	}
+	if n := calls.Load(); n < 3 {
+		t.Errorf("Expected the early timer to be re-armed, clock read %d times", n)
+	}
+}
+
+func TestRevertManagerPersistsAndResumes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "reverts.json")
+	rm := newTestRevertManager(t, path)
+
+	at := time.Now().Add(time.Hour)
+	if err := rm.Schedule(PendingRevert{Action: ActionDisableVPN, At: at, UserID: 42}); err != nil {
+		t.Fatalf("Schedule failed: %v", err)
+	}
+	extended, err := rm.Extend(30 * time.Minute)
+	if err != nil {
+		t.Fatalf("Extend failed: %v", err)
+	}
+	if !extended.At.Equal(at.Add(30 * time.Minute)) {
+		t.Errorf("Expected revert at %v, got %v", at.Add(30*time.Minute), extended.At)
+	}
+	rm.Stop()
+
+	// After a restart the revert is still pending with its extended deadline
+	restarted := newTestRevertManager(t, path)
+	pending, ok := restarted.Pending()
+	if !ok || pending.Action != ActionDisableVPN || pending.UserID != 42 || !pending.At.Equal(extended.At) {
+		t.Fatalf("Expected resumed revert %+v, got %+v (ok=%v)", extended, pending, ok)
+	}
+
+	if _, err := restarted.Cancel(); err != nil {
+		t.Fatalf("Cancel failed: %v", err)
+	}
+	if _, err := restarted.Cancel(); !errors.Is(err, errNoPendingRevert) {
+		t.Errorf("Expected errNoPendingRevert, got %v", err)
+	}
+}
+
+func TestRevertManagerRunsOverdueRevertOnStart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "reverts.json")
+	if err := saveJSONFile(path, PendingRevert{Action: ActionEnableVPN, At: time.Now().Add(-time.Minute)}); err != nil {
+		t.Fatalf("saveJSONFile failed: %v", err)
+	}
+
+	rm := newTestRevertManager(t, path)
+	fired := make(chan struct{})
+	rm.SetNotifier(func(PendingRevert, error) { close(fired) })
+	rm.Start()
+
+	select {
+	case <-fired:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Overdue revert did not run on start")
+	}
+}
+
+func TestRevertManagerRejectsServiceActions(t *testing.T) {
+	rm := newTestRevertManager(t, filepath.Join(t.TempDir(), "reverts.json"))
+	if err := rm.Schedule(PendingRevert{Action: ActionStopService, At: time.Now().Add(time.Hour)}); err == nil {
+		t.Error("Expected scheduling a service action to fail")
+	}
+	if err := rm.Schedule(PendingRevert{Action: ActionEnableVPN, Outbound: "direct", At: time.Now().Add(time.Hour)}); err == nil {
+		t.Error("Expected an action not matching the outbound to fail")
+	}
+}
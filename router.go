@@ -0,0 +1,24 @@
+package main
+
+import "time"
+
+// RouterClient runs commands and manages the Xray service on the router
+// *SSHClient implements it over SSH; tests use an in-memory fake
+type RouterClient interface {
+	// ReadFile returns the content of a file
+	ReadFile(filePath string) (string, error)
+	// WriteFile replaces a file, keeping a timestamped .backup copy of the old content
+	WriteFile(filePath, content string) error
+	// RestartService, StartService and StopService run xkeen -restart, -start and -stop
+	RestartService() error
+	StartService() error
+	StopService() error
+	// GetServiceStatus returns the output of xkeen -status without shell noise
+	GetServiceStatus() (string, error)
+	// ExecuteCommand runs a shell command and returns its combined output
+	ExecuteCommand(command string) (string, error)
+	// GetUptime returns how long the router has been running
+	GetUptime() (time.Duration, error)
+	// Host returns the router address, used to label audit entries and metrics
+	Host() string
+}
@@ -0,0 +1,363 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	errScheduleNotFound      = errors.New("schedule rule not found")
+	errUnknownScheduleAction = errors.New("unknown action")
+	errUnknownScheduleDay    = errors.New("unknown day")
+	errInvalidScheduleTime   = errors.New("invalid time")
+)
+
+// scheduleCatchUp bounds how far back the scheduler replays minutes it missed while an action
+// overran, so a clock jump or a suspended router does not fire a day's worth of rules at once
+const scheduleCatchUp = 15 * time.Minute
+
+// scheduleActions maps the action words accepted by /schedule to router actions
+var scheduleActions = map[string]Action{
+	"vpn":    ActionEnableVPN,
+	"direct": ActionDisableVPN,
+	"start":  ActionStartService,
+	"stop":   ActionStopService,
+}
+
+// weekdayNames maps day abbreviations to weekdays
+var weekdayNames = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// ScheduleRule runs an action at a time of day on selected weekdays
+type ScheduleRule struct {
+	ID        string    `json:"id"`
+	Days      string    `json:"days"` // e.g. "daily", "weekdays", "mon,wed,fri" or "mon-fri"
+	Time      string    `json:"time"` // HH:MM in the scheduler's time zone
+	Action    Action    `json:"action"`
+	CreatedBy int64     `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+	LastRun   time.Time `json:"last_run,omitempty"`
+
+	weekdays [7]bool
+	hour     int
+	minute   int
+}
+
+// parseScheduleRule validates a day spec, a HH:MM time and an action word into a rule
+func parseScheduleRule(days, clock, action string) (*ScheduleRule, error) {
+	mappedAction, ok := scheduleActions[strings.ToLower(action)]
+	if !ok {
+		return nil, fmt.Errorf("%w %q (use vpn, direct, start or stop)", errUnknownScheduleAction, action)
+	}
+
+	rule := &ScheduleRule{Days: strings.ToLower(days), Time: clock, Action: mappedAction}
+	if err := rule.compile(); err != nil {
+		return nil, err
+	}
+	return rule, nil
+}
+
+// compile parses Days and Time into the matching fields
+func (r *ScheduleRule) compile() error {
+	weekdays, err := parseWeekdays(r.Days)
+	if err != nil {
+		return err
+	}
+
+	parsed, err := time.Parse("15:04", r.Time)
+	if err != nil {
+		return fmt.Errorf("%w %q (use HH:MM)", errInvalidScheduleTime, r.Time)
+	}
+
+	r.weekdays = weekdays
+	r.hour = parsed.Hour()
+	r.minute = parsed.Minute()
+	r.Time = parsed.Format("15:04") // Normalize 9:00 to 09:00 so rules sort by time
+	return nil
+}
+
+// parseWeekdays parses "daily", "weekdays", "weekends" or a comma-separated list of days and day ranges
+func parseWeekdays(spec string) ([7]bool, error) {
+	var weekdays [7]bool
+	switch spec {
+	case "daily", "everyday":
+		for day := range weekdays {
+			weekdays[day] = true
+		}
+		return weekdays, nil
+	case "weekdays":
+		spec = "mon-fri"
+	case "weekends":
+		spec = "sat,sun"
+	}
+
+	for _, part := range strings.Split(spec, ",") {
+		from, to, isRange := strings.Cut(part, "-")
+		first, ok := weekdayNames[from]
+		if !ok {
+			return weekdays, fmt.Errorf("%w %q", errUnknownScheduleDay, from)
+		}
+		last := first
+		if isRange {
+			if last, ok = weekdayNames[to]; !ok {
+				return weekdays, fmt.Errorf("%w %q", errUnknownScheduleDay, to)
+			}
+		}
+
+		// Ranges may wrap around the week, e.g. fri-mon
+		for day := first; ; day = (day + 1) % 7 {
+			weekdays[day] = true
+			if day == last {
+				break
+			}
+		}
+	}
+	return weekdays, nil
+}
+
+// Matches reports whether the rule is due in the minute containing t
+func (r *ScheduleRule) Matches(t time.Time) bool {
+	return r.weekdays[t.Weekday()] && t.Hour() == r.hour && t.Minute() == r.minute
+}
+
+// NextRun returns the first time after from at which the rule is due
+func (r *ScheduleRule) NextRun(from time.Time) time.Time {
+	for offset := 0; offset <= 7; offset++ {
+		day := from.AddDate(0, 0, offset)
+		candidate := time.Date(day.Year(), day.Month(), day.Day(), r.hour, r.minute, 0, 0, from.Location())
+		if candidate.After(from) && r.weekdays[candidate.Weekday()] {
+			return candidate
+		}
+	}
+	return time.Time{}
+}
+
+// Scheduler runs schedule rules through VPNManager, persisting them to disk
+type Scheduler struct {
+	path       string
+	vpnManager *VPNManager
+	location   *time.Location
+	logger     *logrus.Logger
+	rules      map[string]*ScheduleRule // ID -> rule
+	notify     func(rule ScheduleRule, err error)
+	mutex      sync.Mutex
+	now        func() time.Time
+}
+
+// NewScheduler creates a scheduler evaluating rules in location and persisting them to path
+func NewScheduler(path string, vpnManager *VPNManager, location *time.Location, logger *logrus.Logger) (*Scheduler, error) {
+	s := &Scheduler{
+		path:       path,
+		vpnManager: vpnManager,
+		location:   location,
+		logger:     logger,
+		rules:      make(map[string]*ScheduleRule),
+		now:        time.Now,
+	}
+
+	if err := loadJSONFile(path, &s.rules); err != nil {
+		return nil, fmt.Errorf("failed to load schedule: %w", err)
+	}
+	for id, rule := range s.rules {
+		if err := rule.compile(); err != nil {
+			return nil, fmt.Errorf("invalid schedule rule %s: %w", id, err)
+		}
+	}
+
+	return s, nil
+}
+
+// SetNotifier registers a callback invoked after a rule has run
+func (s *Scheduler) SetNotifier(notify func(rule ScheduleRule, err error)) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.notify = notify
+}
+
+// Location returns the time zone rules are evaluated in
+func (s *Scheduler) Location() *time.Location {
+	return s.location
+}
+
+// Add stores a new rule created by createdBy and returns it with its ID
+func (s *Scheduler) Add(rule ScheduleRule, createdBy int64) (ScheduleRule, error) {
+	idBytes := make([]byte, 3)
+	if _, err := rand.Read(idBytes); err != nil {
+		return ScheduleRule{}, fmt.Errorf("failed to generate schedule ID: %w", err)
+	}
+	rule.ID = hex.EncodeToString(idBytes)
+	rule.CreatedBy = createdBy
+	rule.CreatedAt = s.now()
+	rule.LastRun = time.Time{}
+	if err := rule.compile(); err != nil {
+		return ScheduleRule{}, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.rules[rule.ID] = &rule
+	if err := s.save(); err != nil {
+		delete(s.rules, rule.ID)
+		return ScheduleRule{}, err
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"schedule_id": rule.ID,
+		"days":        rule.Days,
+		"time":        rule.Time,
+		"action":      rule.Action,
+		"created_by":  createdBy,
+	}).Info("Schedule rule added")
+	return rule, nil
+}
+
+// Remove deletes a rule by ID
+func (s *Scheduler) Remove(id string) (ScheduleRule, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	rule, exists := s.rules[id]
+	if !exists {
+		return ScheduleRule{}, errScheduleNotFound
+	}
+	delete(s.rules, id)
+	if err := s.save(); err != nil {
+		s.rules[id] = rule
+		return ScheduleRule{}, err
+	}
+
+	s.logger.WithField("schedule_id", id).Info("Schedule rule removed")
+	return *rule, nil
+}
+
+// List returns copies of all rules ordered by time of day
+func (s *Scheduler) List() []ScheduleRule {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	rules := make([]ScheduleRule, 0, len(s.rules))
+	for _, rule := range s.rules {
+		rules = append(rules, *rule)
+	}
+	sort.Slice(rules, func(i, j int) bool {
+		if rules[i].Time != rules[j].Time {
+			return rules[i].Time < rules[j].Time
+		}
+		return rules[i].ID < rules[j].ID
+	})
+	return rules
+}
+
+// Run evaluates rules at the start of every minute until ctx is cancelled
+// Rules that came due while the bot was down are skipped rather than replayed late
+func (s *Scheduler) Run(ctx context.Context) {
+	s.logger.WithField("time_zone", s.location.String()).Info("Scheduler started")
+
+	last := s.now().Truncate(time.Minute)
+	for {
+		now := s.now()
+		next := now.Truncate(time.Minute).Add(time.Minute)
+		timer := time.NewTimer(next.Sub(now))
+
+		select {
+		case <-timer.C:
+			last = s.runSince(last, s.now())
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		}
+	}
+}
+
+// runSince runs the rules due in every minute after last up to the one containing now, so rules
+// of minutes spent waiting on a slow action still run, and returns the last minute evaluated
+func (s *Scheduler) runSince(last, now time.Time) time.Time {
+	current := now.Truncate(time.Minute)
+	if earliest := current.Add(-scheduleCatchUp); last.Before(earliest) {
+		last = earliest
+	}
+	for minute := last.Add(time.Minute); !minute.After(current); minute = minute.Add(time.Minute) {
+		s.RunDue(minute)
+	}
+	if current.After(last) {
+		return current
+	}
+	return last
+}
+
+// RunDue runs every rule due in the minute containing now that has not run in it yet
+func (s *Scheduler) RunDue(now time.Time) {
+	local := now.In(s.location)
+	minute := local.Truncate(time.Minute)
+
+	s.mutex.Lock()
+	var due []ScheduleRule
+	for _, rule := range s.rules {
+		if rule.Matches(local) && rule.LastRun.Before(minute) {
+			rule.LastRun = local
+			due = append(due, *rule)
+		}
+	}
+	if len(due) > 0 {
+		if err := s.save(); err != nil {
+			s.logger.WithError(err).Error("Failed to record schedule runs")
+		}
+	}
+	notify := s.notify
+	s.mutex.Unlock()
+
+	// Run in a stable order so "stop then start" pairs in the same minute stay predictable
+	sort.Slice(due, func(i, j int) bool { return due[i].ID < due[j].ID })
+	for _, rule := range due {
+		err := s.execute(rule)
+		if notify != nil {
+			notify(rule, err)
+		}
+	}
+}
+
+// execute performs a rule's action on behalf of its creator
+func (s *Scheduler) execute(rule ScheduleRule) error {
+	ctx := withActor(context.Background(), Actor{
+		UserID: rule.CreatedBy,
+		Source: "schedule:" + rule.ID,
+	})
+
+	err := s.vpnManager.Perform(ctx, rule.Action)
+	fields := logrus.Fields{
+		"schedule_id": rule.ID,
+		"action":      rule.Action,
+	}
+	if err != nil {
+		s.logger.WithError(err).WithFields(fields).Error("Scheduled action failed")
+	} else {
+		s.logger.WithFields(fields).Info("Scheduled action completed")
+	}
+	return err
+}
+
+// save persists the rules
+// Caller must hold s.mutex
+func (s *Scheduler) save() error {
+	if err := saveJSONFile(s.path, s.rules); err != nil {
+		return fmt.Errorf("failed to save schedule: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseWeekdays(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    []time.Weekday
+		wantErr bool
+	}{
+		{"daily", []time.Weekday{time.Sunday, time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday, time.Saturday}, false},
+		{"weekdays", []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday}, false},
+		{"weekends", []time.Weekday{time.Saturday, time.Sunday}, false},
+		{"mon,wed,fri", []time.Weekday{time.Monday, time.Wednesday, time.Friday}, false},
+		{"fri-mon", []time.Weekday{time.Friday, time.Saturday, time.Sunday, time.Monday}, false},
+		{"tue,thu-fri", []time.Weekday{time.Tuesday, time.Thursday, time.Friday}, false},
+		{"monday", nil, true},
+		{"mon-xyz", nil, true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseWeekdays(tt.spec)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseWeekdays(%q) error = %v, wantErr %v", tt.spec, err, tt.wantErr)
+			continue
+		}
+		if tt.wantErr {
+			continue
+		}
+
+		var want [7]bool
+		for _, day := range tt.want {
+			want[day] = true
+		}
+		if got != want {
+			t.Errorf("parseWeekdays(%q) = %v, want %v", tt.spec, got, want)
+		}
+	}
+}
+
+func TestParseScheduleRule(t *testing.T) {
+	if _, err := parseScheduleRule("weekdays", "25:00", "direct"); err == nil {
+		t.Error("Expected invalid time to be rejected")
+	}
+	if _, err := parseScheduleRule("weekdays", "09:00", "reboot"); err == nil {
+		t.Error("Expected unknown action to be rejected")
+	}
+
+	rule, err := parseScheduleRule("Weekdays", "9:00", "DIRECT")
+	if err != nil {
+		t.Fatalf("parseScheduleRule failed: %v", err)
+	}
+	if rule.Action != ActionDisableVPN || rule.Days != "weekdays" || rule.Time != "09:00" {
+		t.Errorf("Unexpected rule %+v", rule)
+	}
+
+	// 2024-01-05 is a Friday
+	friday := time.Date(2024, 1, 5, 9, 0, 30, 0, time.UTC)
+	if !rule.Matches(friday) {
+		t.Error("Expected rule to match Friday 09:00")
+	}
+	if rule.Matches(friday.Add(time.Minute)) {
+		t.Error("Expected rule not to match 09:01")
+	}
+	if rule.Matches(friday.AddDate(0, 0, 1)) {
+		t.Error("Expected rule not to match Saturday")
+	}
+
+	next := rule.NextRun(friday)
+	if want := time.Date(2024, 1, 8, 9, 0, 0, 0, time.UTC); !next.Equal(want) {
+		t.Errorf("NextRun = %v, want %v", next, want)
+	}
+}
+
+func TestSchedulerRunDue(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "schedule.json")
+	vm := newOfflineVPNManager(t)
+	scheduler, err := NewScheduler(path, vm, time.UTC, vm.logger)
+	if err != nil {
+		t.Fatalf("NewScheduler failed: %v", err)
+	}
+
+	var ran []ScheduleRule
+	scheduler.SetNotifier(func(rule ScheduleRule, err error) {
+		if err == nil {
+			t.Error("Expected the action to fail against an offline router")
+		}
+		ran = append(ran, rule)
+	})
+
+	stop, _ := parseScheduleRule("daily", "03:00", "stop")
+	start, _ := parseScheduleRule("daily", "03:05", "start")
+	stopRule, err := scheduler.Add(*stop, 1)
+	if err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	if _, err := scheduler.Add(*start, 1); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+
+	at := time.Date(2024, 1, 5, 3, 0, 10, 0, time.UTC)
+	scheduler.RunDue(at)
+	scheduler.RunDue(at.Add(30 * time.Second)) // Same minute: must not run twice
+	if len(ran) != 1 || ran[0].ID != stopRule.ID {
+		t.Fatalf("Expected only the stop rule to run once, ran %+v", ran)
+	}
+
+	// Rules and their last run survive a restart
+	reloaded, err := NewScheduler(path, vm, time.UTC, vm.logger)
+	if err != nil {
+		t.Fatalf("NewScheduler reload failed: %v", err)
+	}
+	if rules := reloaded.List(); len(rules) != 2 || rules[0].ID != stopRule.ID || rules[0].LastRun.IsZero() {
+		t.Errorf("Unexpected reloaded rules %+v", rules)
+	}
+	reloaded.SetNotifier(func(rule ScheduleRule, err error) { ran = append(ran, rule) })
+	reloaded.RunDue(at.Add(40 * time.Second))
+	if len(ran) != 1 {
+		t.Error("Reloaded scheduler ran a rule again within the same minute")
+	}
+
+	if _, err := reloaded.Remove(stopRule.ID); err != nil {
+		t.Fatalf("Remove failed: %v", err)
+	}
+	if _, err := reloaded.Remove(stopRule.ID); err != errScheduleNotFound {
+		t.Errorf("Expected errScheduleNotFound, got %v", err)
+	}
+}
+
+func TestSchedulerCatchesUpOverrunMinutes(t *testing.T) {
+	vm := newOfflineVPNManager(t)
+	scheduler, err := NewScheduler(filepath.Join(t.TempDir(), "schedule.json"), vm, time.UTC, vm.logger)
+	if err != nil {
+		t.Fatalf("NewScheduler failed: %v", err)
+	}
+
+	var ran []Action
+	scheduler.SetNotifier(func(rule ScheduleRule, err error) { ran = append(ran, rule.Action) })
+	stop, _ := parseScheduleRule("daily", "03:00", "stop")
+	start, _ := parseScheduleRule("daily", "03:01", "start")
+	for _, rule := range []*ScheduleRule{stop, start} {
+		if _, err := scheduler.Add(*rule, 1); err != nil {
+			t.Fatalf("Add failed: %v", err)
+		}
+	}
+
+	// The 03:00 action overran into 03:02, so the 03:01 tick never happened
+	last := scheduler.runSince(time.Date(2024, 1, 5, 2, 59, 0, 0, time.UTC), time.Date(2024, 1, 5, 3, 0, 1, 0, time.UTC))
+	last = scheduler.runSince(last, time.Date(2024, 1, 5, 3, 2, 40, 0, time.UTC))
+	if len(ran) != 2 || ran[0] != ActionStopService || ran[1] != ActionStartService {
+		t.Errorf("Expected stop then start, ran %v", ran)
+	}
+	if want := time.Date(2024, 1, 5, 3, 2, 0, 0, time.UTC); !last.Equal(want) {
+		t.Errorf("Expected the last evaluated minute to be %v, got %v", want, last)
+	}
+
+	// A clock jump does not replay more than scheduleCatchUp
+	ran = nil
+	scheduler.runSince(last, last.Add(12*time.Hour))
+	if len(ran) != 0 {
+		t.Errorf("Expected no rules replayed across a 12 hour jump, ran %v", ran)
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestVPNManagerShutdownWaitsForOperations(t *testing.T) {
+	vm := newOfflineVPNManager(t)
+
+	end, err := vm.beginMutation(context.Background(), ActionRestartService)
+	if err != nil {
+		t.Fatalf("beginMutation failed: %v", err)
+	}
+	time.AfterFunc(50*time.Millisecond, end)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if abandoned := vm.Shutdown(ctx); len(abandoned) != 0 {
+		t.Errorf("Expected the operation to finish, got %+v", abandoned)
+	}
+	if _, busy := vm.MutationState(); busy {
+		t.Error("Expected no operation in flight")
+	}
+}
+
+func TestVPNManagerShutdownAbandonsOperations(t *testing.T) {
+	vm := newOfflineVPNManager(t)
+
+	actor := Actor{UserID: testUserID, Username: "tester", Source: "telegram"}
+	end, err := vm.beginMutation(withActor(context.Background(), actor), ActionStopService)
+	if err != nil {
+		t.Fatalf("beginMutation failed: %v", err)
+	}
+	defer end()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	abandoned := vm.Shutdown(ctx)
+	if len(abandoned) != 1 || abandoned[0].Action != ActionStopService || abandoned[0].Actor != actor {
+		t.Fatalf("Unexpected abandoned operations %+v", abandoned)
+	}
+
+	// Nothing new starts once shutdown began
+	if err := vm.EnableVPN(context.Background()); !errors.Is(err, ErrShuttingDown) {
+		t.Errorf("Expected ErrShuttingDown, got %v", err)
+	}
+	if err := vm.RestartVPNService(context.Background()); !errors.Is(err, ErrShuttingDown) {
+		t.Errorf("Expected ErrShuttingDown, got %v", err)
+	}
+}
+
+func TestNotifyShutdown(t *testing.T) {
+	fake := newFakeTelegram(t)
+	tb := newTestTelegramBot(t, fake)
+
+	subscriptions, err := NewSubscriptionStore(filepath.Join(t.TempDir(), "subscriptions.json"))
+	if err != nil {
+		t.Fatalf("NewSubscriptionStore failed: %v", err)
+	}
+	if err := subscriptions.Subscribe(testChatID + 1); err != nil {
+		t.Fatalf("Subscribe failed: %v", err)
+	}
+	tb.SetSubscriptions(subscriptions)
+	tb.authorizeUser(testUserID+1, testChatID+1, RoleViewer, VPNStatusUnknown)
+
+	tb.NotifyShutdown([]RouterOperation{
+		{Action: ActionStopService, Actor: Actor{UserID: testUserID, Source: "telegram"}, StartedAt: time.Now()},
+		{Action: ActionFailover, Actor: Actor{Source: "failover"}, StartedAt: time.Now()},
+	})
+
+	direct, ok := fake.Find("sendMessage", "Stop VPN was still running")
+	if !ok || direct.Params["chat_id"] != "2002" {
+		t.Errorf("Expected the user who stopped the service to be told, got %+v", direct)
+	}
+	broadcast, ok := fake.Find("sendMessage", "Shutdown interrupted a router change")
+	if !ok || broadcast.Params["chat_id"] != "2003" {
+		t.Errorf("Expected subscribers to hear about the failover, got %+v", broadcast)
+	}
+}
+
+func TestWebhookRefusesUpdatesAfterStop(t *testing.T) {
+	fake := newFakeTelegram(t)
+	tb := newTestTelegramBot(t, fake)
+	if err := tb.SetWebhook(WebhookConfig{URL: "https://bot.example.com/telegram/webhook", SecretToken: "secret"}); err != nil {
+		t.Fatalf("SetWebhook failed: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		tb.Start(ctx)
+		close(stopped)
+	}()
+	fake.WaitFor(t, "setWebhook", "")
+	cancel()
+	<-stopped
+
+	body, _ := json.Marshal(messageUpdate(1, CommandStart))
+	request := httptest.NewRequest(http.MethodPost, "/telegram/webhook", bytes.NewReader(body))
+	request.Header.Set(webhookSecretHeader, "secret")
+	recorder := httptest.NewRecorder()
+	tb.WebhookHandler().ServeHTTP(recorder, request)
+
+	// Telegram keeps the update and redelivers it to the next start
+	if recorder.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503, got %d", recorder.Code)
+	}
+	if tb.AbandonedUpdates() != 0 {
+		t.Errorf("Expected no abandoned updates, got %d", tb.AbandonedUpdates())
+	}
+}
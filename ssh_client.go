@@ -2,7 +2,9 @@ package main
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/sirupsen/logrus"
@@ -16,6 +18,9 @@ type SSHClient struct {
 	password string
 	client   *ssh.Client
 	logger   *logrus.Logger
+	metrics  *Metrics
+	dialed   bool       // Whether a connection was ever established, so later ones count as reconnects
+	mutex    sync.Mutex // Guards client and dialed; sessions themselves may run concurrently
 }
 
 // NewSSHClient creates a new SSH client instance
@@ -34,6 +39,13 @@ func NewSSHClient(host, username, password string, logger *logrus.Logger) (*SSHC
 
 // Connect establishes SSH connection to the router
 func (s *SSHClient) Connect() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.connectLocked()
+}
+
+// connectLocked dials the router; caller must hold s.mutex
+func (s *SSHClient) connectLocked() error {
 	config := &ssh.ClientConfig{
 		User: s.username,
 		Auth: []ssh.AuthMethod{
@@ -55,12 +67,29 @@ func (s *SSHClient) Connect() error {
 	}
 
 	s.client = client
+	if s.dialed {
+		s.metrics.IncSSHReconnects()
+	}
+	s.dialed = true
 	s.logger.WithField("host", s.host).Info("SSH connection established")
 	return nil
 }
 
+// SetMetrics enables recording of command latencies and reconnects
+func (s *SSHClient) SetMetrics(metrics *Metrics) {
+	s.metrics = metrics
+}
+
+// Host returns the address of the router
+func (s *SSHClient) Host() string {
+	return s.host
+}
+
 // Disconnect closes the SSH connection
 func (s *SSHClient) Disconnect() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
 	if s.client != nil {
 		err := s.client.Close()
 		s.client = nil
@@ -70,17 +99,61 @@ func (s *SSHClient) Disconnect() error {
 	return nil
 }
 
-// ExecuteCommand executes a command on the remote server
-func (s *SSHClient) ExecuteCommand(command string) (string, error) {
+// getClient returns the current connection, dialing the router if necessary
+func (s *SSHClient) getClient() (*ssh.Client, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
 	if s.client == nil {
-		if err := s.Connect(); err != nil {
-			return "", fmt.Errorf("failed to establish SSH connection: %w", err)
+		if err := s.connectLocked(); err != nil {
+			return nil, fmt.Errorf("failed to establish SSH connection: %w", err)
 		}
 	}
+	return s.client, nil
+}
+
+// dropClient discards a broken connection so the next command reconnects
+func (s *SSHClient) dropClient(client *ssh.Client) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
 
-	session, err := s.client.NewSession()
+	if s.client == client {
+		s.client.Close()
+		s.client = nil
+		s.logger.WithField("host", s.host).Warn("SSH connection lost, will reconnect")
+	}
+}
+
+// newSession opens a session, reconnecting once if the connection has gone stale
+func (s *SSHClient) newSession() (*ssh.Session, error) {
+	client, err := s.getClient()
 	if err != nil {
-		return "", fmt.Errorf("failed to create SSH session: %w", err)
+		return nil, err
+	}
+
+	session, err := client.NewSession()
+	if err == nil {
+		return session, nil
+	}
+
+	s.dropClient(client)
+	if client, err = s.getClient(); err != nil {
+		return nil, err
+	}
+	if session, err = client.NewSession(); err != nil {
+		return nil, fmt.Errorf("failed to create SSH session: %w", err)
+	}
+	return session, nil
+}
+
+// ExecuteCommand executes a command on the remote server
+func (s *SSHClient) ExecuteCommand(command string) (_ string, err error) {
+	start := time.Now()
+	defer func() { s.metrics.ObserveSSHCommand(sshCommandKind(command), time.Since(start), err) }()
+
+	session, err := s.newSession()
+	if err != nil {
+		return "", err
 	}
 	defer session.Close()
 
@@ -166,13 +239,14 @@ func (s *SSHClient) StopService() error {
 }
 
 // GetServiceStatus gets Xray service status using xkeen command
+// It logs at debug level only since the state watcher calls it every WATCH_INTERVAL
 func (s *SSHClient) GetServiceStatus() (string, error) {
 	command := "export PATH=/opt/sbin:/opt/bin:/opt/usr/sbin:/opt/usr/bin:/usr/sbin:/usr/bin:/sbin:/bin && cd /opt/etc/xray/configs && xkeen -status"
 	s.logger.WithFields(logrus.Fields{
 		"host":     s.host,
 		"username": s.username,
 		"command":  command,
-	}).Info("Executing xkeen status command")
+	}).Debug("Executing xkeen status command")
 	
 	output, err := s.ExecuteCommand(command)
 	if err != nil {
@@ -185,7 +259,7 @@ func (s *SSHClient) GetServiceStatus() (string, error) {
 		"raw_output": output,
 		"raw_bytes":  []byte(output),
 		"raw_length": len(output),
-	}).Info("Raw xkeen -status output")
+	}).Debug("Raw xkeen -status output")
 	
 	// Filter out the "ps: applet not found" error from xkeen output
 	// Only keep lines that contain actual status information
@@ -205,14 +279,40 @@ func (s *SSHClient) GetServiceStatus() (string, error) {
 		"clean_output": cleanOutput,
 		"clean_bytes":  []byte(cleanOutput),
 		"clean_length": len(cleanOutput),
-	}).Info("Cleaned xkeen -status output")
+	}).Debug("Cleaned xkeen -status output")
 	return cleanOutput, nil
 }
 
 
+// GetUptime returns how long the router has been running
+func (s *SSHClient) GetUptime() (time.Duration, error) {
+	output, err := s.ExecuteCommand("cat /proc/uptime")
+	if err != nil {
+		return 0, fmt.Errorf("failed to read uptime: %w", err)
+	}
+	return parseUptime(output)
+}
+
+// parseUptime parses the first field of /proc/uptime (seconds since boot)
+func parseUptime(output string) (time.Duration, error) {
+	fields := strings.Fields(output)
+	if len(fields) == 0 {
+		return 0, fmt.Errorf("empty uptime output")
+	}
+	seconds, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil || seconds < 0 {
+		return 0, fmt.Errorf("invalid uptime %q", fields[0])
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
 // CheckConnection verifies if the SSH connection is still active
 func (s *SSHClient) CheckConnection() error {
-	if s.client == nil {
+	s.mutex.Lock()
+	connected := s.client != nil
+	s.mutex.Unlock()
+
+	if !connected {
 		return fmt.Errorf("SSH client is not connected")
 	}
 
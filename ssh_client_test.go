@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"vpn-commander/internal/fakerouter"
+	"vpn-commander/internal/sshfake"
+)
+
+// newSSHRouter starts a fake router reachable over SSH and a manager driving it through a real SSHClient
+func newSSHRouter(t *testing.T, outbound string) (*sshfake.Server, *SSHClient, *VPNManager) {
+	t.Helper()
+
+	server := sshfake.NewServer(outbound)
+	t.Cleanup(server.Close)
+	server.Now = func() time.Time { return time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC) }
+
+	logger := logrus.New()
+	logger.SetLevel(logrus.FatalLevel)
+	sshClient, err := NewSSHClient(server.Addr(), sshfake.Username, sshfake.Password, logger)
+	if err != nil {
+		t.Fatalf("NewSSHClient failed: %v", err)
+	}
+	t.Cleanup(func() { sshClient.Disconnect() })
+	return server, sshClient, NewVPNManager(sshClient, logger)
+}
+
+func TestSSHClientSwitchesRouting(t *testing.T) {
+	server, _, manager := newSSHRouter(t, "direct")
+
+	if status, err := manager.GetStatus(); err != nil || status != VPNStatusDisabled {
+		t.Fatalf("Expected %s, got %s (%v)", VPNStatusDisabled, status, err)
+	}
+	before, _ := server.ReadFile(fakerouter.RoutingPath)
+
+	if err := manager.EnableVPN(context.Background()); err != nil {
+		t.Fatalf("EnableVPN failed: %v", err)
+	}
+	if status, err := manager.GetStatus(); err != nil || status != VPNStatusEnabled {
+		t.Errorf("Expected %s, got %s (%v)", VPNStatusEnabled, status, err)
+	}
+	if server.Restarts() != 1 {
+		t.Errorf("Expected the service to be restarted once, got %d", server.Restarts())
+	}
+
+	// The heredoc must carry the JSON through untouched
+	written, _ := server.ReadFile(fakerouter.RoutingPath)
+	var config XrayConfig
+	if err := json.Unmarshal([]byte(written), &config); err != nil {
+		t.Fatalf("Written config is not valid JSON: %v\n%s", err, written)
+	}
+
+	backups, err := manager.ListBackups()
+	if err != nil || len(backups) != 1 || backups[0].Name != "20240501-120000" {
+		t.Fatalf("Expected one backup, got %+v (%v)", backups, err)
+	}
+	if backup, _ := server.ReadFile(backups[0].Path); backup != before {
+		t.Errorf("Expected the backup to hold the previous config, got %q", backup)
+	}
+}
+
+func TestSSHClientControlsService(t *testing.T) {
+	server, sshClient, manager := newSSHRouter(t, "direct")
+
+	output, err := sshClient.GetServiceStatus()
+	if err != nil {
+		t.Fatalf("GetServiceStatus failed: %v", err)
+	}
+	if strings.Contains(output, "applet not found") || !strings.Contains(output, "запущен") {
+		t.Errorf("Expected the xkeen noise to be filtered out, got %q", output)
+	}
+
+	if err := manager.StopVPNService(context.Background()); err != nil {
+		t.Fatalf("StopVPNService failed: %v", err)
+	}
+	if state, err := manager.GetServiceState(); err != nil || state != ServiceStateStopped {
+		t.Errorf("Expected %s, got %s (%v)", ServiceStateStopped, state, err)
+	}
+
+	if err := manager.StartVPNService(context.Background()); err != nil {
+		t.Fatalf("StartVPNService failed: %v", err)
+	}
+	if state, err := manager.GetServiceState(); err != nil || state != ServiceStateRunning {
+		t.Errorf("Expected %s, got %s (%v)", ServiceStateRunning, state, err)
+	}
+
+	server.Fail("xkeen -restart", "xkeen: another instance is running\n")
+	if err := manager.RestartVPNService(context.Background()); err == nil || !strings.Contains(err.Error(), "another instance is running") {
+		t.Errorf("Expected the xkeen output in the error, got %v", err)
+	}
+
+	if uptime, err := manager.GetRouterUptime(); err != nil || uptime != time.Hour {
+		t.Errorf("Expected an hour of uptime, got %v (%v)", uptime, err)
+	}
+}
+
+func TestSSHClientErrors(t *testing.T) {
+	server, sshClient, manager := newSSHRouter(t, "direct")
+
+	if output, err := sshClient.ReadFile("/opt/etc/missing.json"); err == nil || !strings.Contains(output, "No such file or directory") {
+		t.Errorf("Expected cat's complaint for a missing file, got %q (%v)", output, err)
+	}
+
+	// A failed write leaves the config and the service alone
+	server.Fail("cat > ", "sh: can't create: Read-only file system\n")
+	if err := manager.EnableVPN(context.Background()); err == nil || !strings.Contains(err.Error(), "failed to write updated config") {
+		t.Errorf("Expected the write to fail, got %v", err)
+	}
+	if server.Restarts() != 0 {
+		t.Error("A failed write must not restart the service")
+	}
+	server.ClearFailures()
+
+	// A dropped connection is redialled on the next command
+	if err := sshClient.Connect(); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	server.DropConnections()
+	if err := sshClient.CheckConnection(); err != nil {
+		t.Errorf("Expected the client to reconnect, got %v", err)
+	}
+
+	wrong, err := NewSSHClient(server.Addr(), sshfake.Username, "wrong", logrus.New())
+	if err != nil {
+		t.Fatalf("NewSSHClient failed: %v", err)
+	}
+	if err := wrong.Connect(); err == nil {
+		wrong.Disconnect()
+		t.Error("Expected a wrong password to be refused")
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// SubscriptionStore persists the chats that receive proactive notifications
+type SubscriptionStore struct {
+	path  string
+	chats map[int64]bool
+	mutex sync.Mutex
+}
+
+// NewSubscriptionStore loads subscriptions from path
+func NewSubscriptionStore(path string) (*SubscriptionStore, error) {
+	store := &SubscriptionStore{
+		path:  path,
+		chats: make(map[int64]bool),
+	}
+
+	if err := loadJSONFile(path, &store.chats); err != nil {
+		return nil, fmt.Errorf("failed to load subscriptions: %w", err)
+	}
+	return store, nil
+}
+
+// Subscribe adds a chat to the notification list
+func (s *SubscriptionStore) Subscribe(chatID int64) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.chats[chatID] = true
+	return s.save()
+}
+
+// Unsubscribe removes a chat from the notification list
+func (s *SubscriptionStore) Unsubscribe(chatID int64) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.chats, chatID)
+	return s.save()
+}
+
+// IsSubscribed reports whether a chat receives notifications
+func (s *SubscriptionStore) IsSubscribed(chatID int64) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.chats[chatID]
+}
+
+// ChatIDs returns all subscribed chats in a stable order
+func (s *SubscriptionStore) ChatIDs() []int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	chatIDs := make([]int64, 0, len(s.chats))
+	for chatID := range s.chats {
+		chatIDs = append(chatIDs, chatID)
+	}
+	sort.Slice(chatIDs, func(i, j int) bool { return chatIDs[i] < chatIDs[j] })
+	return chatIDs
+}
+
+// save persists subscriptions to disk
+// Caller must hold s.mutex
+func (s *SubscriptionStore) save() error {
+	if err := saveJSONFile(s.path, s.chats); err != nil {
+		return fmt.Errorf("failed to save subscriptions: %w", err)
+	}
+	return nil
+}
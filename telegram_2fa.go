@@ -0,0 +1,270 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/sirupsen/logrus"
+	"github.com/skip2/go-qrcode"
+)
+
+// pendingActionTTL is how long a protected action waits for its second factor
+const pendingActionTTL = 2 * time.Minute
+
+// pendingAction is a protected action parked until the user supplies a TOTP code
+type pendingAction struct {
+	action  Action
+	run     func()
+	expires time.Time
+}
+
+// SetTOTPManager enables the TOTP second factor for protected actions
+func (tb *TelegramBot) SetTOTPManager(manager *TOTPManager) {
+	tb.totpManager = manager
+	tb.logger.Info("Two-factor authentication enabled")
+}
+
+// runProtected runs the action if the user's role allows it, after an explicit confirmation
+// for disruptive actions and a TOTP code for protected ones
+func (tb *TelegramBot) runProtected(in *interaction, action Action, run func()) {
+	if role, _ := tb.getUserRole(in.userID); !role.CanControl() {
+		tb.alert(in, tb.text(in, msgRoleForbidsAction, role, describeAction(tb.language(in), action)))
+		return
+	}
+
+	if tb.confirmActions[action] {
+		tb.askConfirmation(in, action, func() { tb.requireSecondFactor(in, action, run) })
+		return
+	}
+	tb.requireSecondFactor(in, action, run)
+}
+
+// requireSecondFactor runs the action, first parking it until the user replies with
+// /otp CODE when it needs a fresh TOTP code
+func (tb *TelegramBot) requireSecondFactor(in *interaction, action Action, run func()) {
+	if tb.totpManager == nil {
+		run()
+		return
+	}
+
+	required, err := tb.totpManager.RequiresCode(in.userID, action)
+	if err != nil {
+		tb.acknowledge(in, tb.text(in, msgTOTPRequiredToast))
+		tb.showPanel(in, tb.text(in, msgTOTPEnrollFirst, describeAction(tb.language(in), action), CommandTOTP))
+		return
+	}
+
+	if !required {
+		run()
+		return
+	}
+
+	tb.pendingMutex.Lock()
+	tb.pendingActions[in.userID] = pendingAction{
+		action:  action,
+		run:     run,
+		expires: time.Now().Add(pendingActionTTL),
+	}
+	tb.pendingMutex.Unlock()
+
+	tb.logger.WithFields(logrus.Fields{
+		"user_id": in.userID,
+		"action":  action,
+	}).Info("Protected action awaiting TOTP code")
+
+	tb.acknowledge(in, tb.text(in, msgTOTPCodeToast))
+	tb.showPanel(in, tb.text(in, msgTOTPCodeRequired, describeAction(tb.language(in), action), CommandOTP, int(pendingActionTTL/time.Minute)))
+}
+
+// handleOTP verifies a TOTP code and runs the pending protected action, if any
+func (tb *TelegramBot) handleOTP(message *tgbotapi.Message) {
+	// The code is a secret, never leave it in the chat history
+	tb.deleteUserMessage(message.Chat.ID, message.MessageID)
+
+	if tb.totpManager == nil {
+		tb.sendMessage(tgbotapi.NewMessage(message.Chat.ID, translate(tb.userLanguage(message.From), msgTOTPNotEnabled)))
+		return
+	}
+
+	in := newMessageInteraction(message)
+	args := strings.Fields(message.Text)
+	if len(args) != 2 {
+		tb.showPanel(in, tb.text(in, msgOTPUsage, CommandOTP))
+		return
+	}
+
+	if err := tb.totpManager.Verify(message.From.ID, args[1]); err != nil {
+		text := tb.text(in, msgOTPInvalid)
+		var locked *totpLockedError
+		if errors.Is(err, errTOTPNotEnrolled) {
+			text = tb.text(in, msgOTPNotEnrolled, CommandTOTP)
+		} else if errors.As(err, &locked) {
+			text = tb.text(in, msgOTPLocked, locked.wait)
+		} else {
+			tb.metrics.IncAuthFailure("totp")
+		}
+		tb.showPanel(in, text)
+		return
+	}
+
+	tb.pendingMutex.Lock()
+	pending, exists := tb.pendingActions[message.From.ID]
+	delete(tb.pendingActions, message.From.ID)
+	tb.pendingMutex.Unlock()
+
+	if !exists || time.Now().After(pending.expires) {
+		tb.showPanel(in, tb.text(in, msgOTPAccepted))
+		return
+	}
+
+	// The role may have changed while the action was parked
+	if role, _ := tb.getUserRole(in.userID); !role.CanControl() {
+		tb.showPanel(in, tb.text(in, msgRoleForbidsAction, role, describeAction(tb.language(in), pending.action)))
+		return
+	}
+
+	tb.logger.WithFields(logrus.Fields{
+		"user_id": message.From.ID,
+		"action":  pending.action,
+	}).Info("TOTP verified, running protected action")
+	pending.run()
+	tb.refreshDashboardsAsync()
+}
+
+// handleTOTP manages the user's TOTP enrollment: /2fa [enroll|confirm CODE|disable CODE]
+func (tb *TelegramBot) handleTOTP(message *tgbotapi.Message) {
+	language := tb.userLanguage(message.From)
+	if tb.totpManager == nil {
+		tb.sendMessage(tgbotapi.NewMessage(message.Chat.ID, translate(language, msgTOTPNotEnabled)))
+		return
+	}
+
+	args := strings.Fields(message.Text)
+	subcommand := ""
+	if len(args) > 1 {
+		subcommand = strings.ToLower(args[1])
+	}
+	code := ""
+	if len(args) > 2 {
+		code = args[2]
+	}
+
+	userID := message.From.ID
+	switch subcommand {
+	case "enroll":
+		tb.handleTOTPEnroll(message)
+	case "confirm":
+		tb.deleteUserMessage(message.Chat.ID, message.MessageID)
+		if err := tb.totpManager.Confirm(userID, code); err != nil {
+			tb.sendMessage(tgbotapi.NewMessage(message.Chat.ID, tb.totpErrorText(language, err, msgTOTPConfirmFailed)))
+			return
+		}
+		tb.deleteEnrollmentMessage(message.Chat.ID, userID)
+		tb.sendMessage(tgbotapi.NewMessage(message.Chat.ID, translate(language, msgTOTPActivated)))
+	case "disable":
+		tb.deleteUserMessage(message.Chat.ID, message.MessageID)
+		if err := tb.totpManager.Disable(userID, code); err != nil {
+			tb.sendMessage(tgbotapi.NewMessage(message.Chat.ID, tb.totpErrorText(language, err, msgTOTPDisableFailed)))
+			return
+		}
+		tb.sendMessage(tgbotapi.NewMessage(message.Chat.ID, translate(language, msgTOTPDeactivated)))
+	default:
+		state := msgTOTPStateNone
+		if tb.totpManager.IsEnrolled(userID) {
+			state = msgTOTPStateActive
+		}
+		text := translate(language, msgTOTPHelp, translate(language, state), CommandTOTP, CommandTOTP, CommandTOTP, CommandOTP)
+		msg := tgbotapi.NewMessage(message.Chat.ID, text)
+		msg.ParseMode = "Markdown"
+		tb.sendMessage(msg)
+	}
+}
+
+// totpErrorText explains a failed /2fa subcommand in language; errors the user cannot act on
+// are logged and reported with the generic failed message
+func (tb *TelegramBot) totpErrorText(language Language, err error, failed messageKey) string {
+	var locked *totpLockedError
+	switch {
+	case errors.Is(err, errTOTPInvalidCode):
+		return translate(language, msgOTPInvalid)
+	case errors.Is(err, errTOTPNotEnrolled):
+		return translate(language, msgOTPNotEnrolled, CommandTOTP)
+	case errors.Is(err, errTOTPAlreadyEnrolled):
+		return translate(language, msgTOTPAlreadyOn, CommandTOTP)
+	case errors.As(err, &locked):
+		return translate(language, msgOTPLocked, locked.wait)
+	default:
+		tb.logger.WithError(err).Error("Two-factor command failed")
+		return translate(language, failed)
+	}
+}
+
+// handleTOTPEnroll starts an enrollment and sends the provisioning QR code as a photo
+func (tb *TelegramBot) handleTOTPEnroll(message *tgbotapi.Message) {
+	language := tb.userLanguage(message.From)
+	account := message.From.UserName
+	if account == "" {
+		account = fmt.Sprintf("%d", message.From.ID)
+	}
+
+	uri, secret, err := tb.totpManager.Enroll(message.From.ID, account)
+	if err != nil {
+		tb.sendMessage(tgbotapi.NewMessage(message.Chat.ID, tb.totpErrorText(language, err, msgTOTPEnrollFailed)))
+		return
+	}
+
+	image, err := qrcode.Encode(uri, qrcode.Medium, 256)
+	if err != nil {
+		tb.logger.WithError(err).Error("Failed to render TOTP QR code")
+		tb.sendMessage(tgbotapi.NewMessage(message.Chat.ID, translate(language, msgTOTPQRFailed)))
+		return
+	}
+
+	photo := tgbotapi.NewPhoto(message.Chat.ID, tgbotapi.FileBytes{Name: "2fa.png", Bytes: image})
+	photo.Caption = translate(language, msgTOTPQRCaption, secret, CommandTOTP)
+	photo.ParseMode = "Markdown"
+
+	sent, err := tb.bot.Send(photo)
+	if err != nil {
+		tb.logger.WithError(err).Error("Failed to send TOTP QR code")
+		return
+	}
+
+	tb.messageMutex.Lock()
+	tb.enrollMessages[message.From.ID] = sent.MessageID
+	tb.messageMutex.Unlock()
+}
+
+// deleteEnrollmentMessage removes the QR code photo once it is no longer needed
+func (tb *TelegramBot) deleteEnrollmentMessage(chatID, userID int64) {
+	tb.messageMutex.Lock()
+	messageID := tb.enrollMessages[userID]
+	delete(tb.enrollMessages, userID)
+	tb.messageMutex.Unlock()
+
+	tb.deleteUserMessage(chatID, messageID)
+}
+
+// actionNames maps actions to their human-readable names
+var actionNames = map[Action]messageKey{
+	ActionEnableVPN:      msgActionEnableVPN,
+	ActionDisableVPN:     msgActionDisableVPN,
+	ActionStartService:   msgActionStartService,
+	ActionStopService:    msgActionStopService,
+	ActionRestartService: msgActionRestartService,
+	ActionFailover:       msgActionFailover,
+	ActionFailback:       msgActionFailback,
+	ActionSelectOutbound: msgActionSelectOutbound,
+	ActionRestoreBackup:  msgActionRestoreBackup,
+}
+
+// describeAction returns a human-readable name for an action in language
+func describeAction(language Language, action Action) string {
+	if key, ok := actionNames[action]; ok {
+		return translate(language, key)
+	}
+	return string(action)
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestOTPRechecksRoleOfParkedAction(t *testing.T) {
+	fake := newFakeTelegram(t)
+	tb := newTestTelegramBot(t, fake)
+
+	manager, err := NewTOTPManager(filepath.Join(t.TempDir(), "totp.json"), TOTPConfig{
+		ProtectedActions: []Action{ActionStopService},
+	}, tb.logger)
+	if err != nil {
+		t.Fatalf("NewTOTPManager failed: %v", err)
+	}
+	now := time.Now()
+	manager.now = func() time.Time { return now }
+	tb.SetTOTPManager(manager)
+
+	_, secret, err := manager.Enroll(testUserID, "tester")
+	if err != nil {
+		t.Fatalf("Enroll failed: %v", err)
+	}
+	key, _ := decodeTOTPSecret(secret)
+	if err := manager.Confirm(testUserID, totpCode(key, now, totpPeriod, totpDigits, totpSHA1)); err != nil {
+		t.Fatalf("Confirm failed: %v", err)
+	}
+	now = now.Add(totpPeriod)
+
+	ran := false
+	in := &interaction{chatID: testChatID, userID: testUserID, username: "tester"}
+	tb.runProtected(in, ActionStopService, func() { ran = true })
+	fake.WaitFor(t, "sendMessage", "Confirmation required")
+
+	// Demoted while the action waits for its code
+	tb.authorizeUser(testUserID, testChatID, RoleViewer, VPNStatusUnknown)
+	tb.handleUpdate(messageUpdate(2, CommandOTP+" "+totpCode(key, now, totpPeriod, totpDigits, totpSHA1)))
+	fake.WaitFor(t, "sendMessage", "does not allow")
+	if ran {
+		t.Error("Expected the parked action not to run after the user was demoted")
+	}
+}
@@ -0,0 +1,16 @@
+package main
+
+// NotifyAPIAction tells subscribers about a router change made through the REST API
+func (tb *TelegramBot) NotifyAPIAction(action Action, client string, err error) {
+	outcome := msgOutcomeDone
+	if err != nil {
+		outcome = msgOutcomeFailed
+	} else if outbound, readErr := tb.vpnManager.GetActiveOutbound(); readErr == nil {
+		tb.updateAllCachedStatuses(statusForOutbound(outbound))
+	}
+
+	tb.broadcast(func(language Language) string {
+		return translate(language, msgAPIAction, describeAction(language, action), client, translate(language, outcome))
+	})
+	tb.refreshDashboardsAsync()
+}
@@ -5,26 +5,83 @@ import (
 	"fmt"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"github.com/sirupsen/logrus"
 )
 
+// TelegramAPI is the part of the Bot API the bot uses; *tgbotapi.BotAPI implements it
+type TelegramAPI interface {
+	Send(c tgbotapi.Chattable) (tgbotapi.Message, error)         // Sends or edits a message
+	Request(c tgbotapi.Chattable) (*tgbotapi.APIResponse, error) // Deletes messages, answers callbacks, pins
+	GetUpdatesChan(config tgbotapi.UpdateConfig) tgbotapi.UpdatesChannel
+	StopReceivingUpdates()
+	GetMe() (tgbotapi.User, error)
+}
+
 // TelegramBot represents the Telegram bot instance
 type TelegramBot struct {
-	bot             *tgbotapi.BotAPI
+	bot             TelegramAPI
+	self            tgbotapi.User // The bot's own account
 	authCode        string
 	vpnManager      *VPNManager
 	logger          *logrus.Logger
-	authorizedUsers map[int64]VPNStatus
+	authCodeRole    Role
+	adminUsers      map[int64]bool
+	authorizedUsers map[int64]*authorizedUser
 	userMutex       sync.RWMutex
-	lastMessages    map[int64]int    // userID -> last bot message ID for editing
-	lastMsgType     map[int64]string // userID -> last message type 
-	lastUserMsg     map[int64]int    // userID -> last user command message ID
+	inviteManager   *InviteManager
+	grants          *GrantStore
+	auditLog        *AuditLog
+	subscriptions   *SubscriptionStore
+	languages       *LanguageStore
+	sessionLifetime time.Duration           // Zero disables the absolute session limit
+	sessionIdle     time.Duration           // Zero disables the idle timeout
+	panels          map[int64]*controlPanel // chatID -> inline control panel message
+	panelNonce      atomic.Uint64
+	panelMutex      sync.Mutex
+	enrollMessages  map[int64]int // userID -> TOTP QR code message ID
 	messageMutex    sync.RWMutex
+	totpManager     *TOTPManager
+	pendingActions  map[int64]pendingAction // userID -> action awaiting a TOTP code
+	pendingMutex    sync.Mutex
+
+	dashboards         map[int64]int // chatID -> pinned dashboard message ID
+	dashboardPath      string
+	dashboardInterval  time.Duration
+	lastExternalChange routerChange
+	dashboardMutex     sync.Mutex
+	dashboardRefresh   sync.Mutex
+
+	confirmActions    map[Action]bool
+	confirmTimeout    time.Duration
+	confirmations     map[int64]*confirmation // chatID -> action awaiting confirmation
+	confirmationMutex sync.Mutex
+
+	reverts   *RevertManager
+	scheduler *Scheduler
+	prober    *HealthProber
+	metrics   *Metrics
+	webhook   *webhookState // Nil when updates are received by long polling
+
+	updateWorkers      int
+	updateQueueSize    int
+	updateDrainTimeout time.Duration
+	abandonedUpdates   atomic.Int64 // Queued updates dropped by the last drain
+}
+
+// authorizedUser holds the session, role and cached VPN status of an authenticated user
+type authorizedUser struct {
+	role         Role
+	status       VPNStatus
+	chatID       int64
+	authorizedAt time.Time
+	lastSeen     time.Time
 }
 
-// Command constants
+// Command constants; the button labels are the English ones, see panelButtons for every language
 const (
 	CommandStart         = "/start"
 	CommandAuth          = "/auth"
@@ -35,8 +92,31 @@ const (
 	CommandStopVPN       = "🔴 Stop VPN"
 	CommandServiceStatus = "🔋 Service Status"
 	CommandCancel        = "❌ Cancel"
+	CommandPanel         = "/panel"
+	CommandDashboard     = "/dashboard"
+	CommandDirectFor     = "/direct_for"
+	CommandVPNFor        = "/vpn_for"
+	CommandSchedule      = "/schedule"
+	CommandPing          = "/ping"
+	CommandTOTP          = "/2fa"
+	CommandOTP           = "/otp"
+	CommandInvite        = "/invite"
+	CommandInvites       = "/invites"
+	CommandRevoke        = "/revoke"
+	CommandLogout        = "/logout"
+	CommandHistory       = "/history"
+	CommandSubscribe     = "/subscribe"
+	CommandUnsubscribe   = "/unsubscribe"
+	CommandLang          = "/lang"
 )
 
+// slashCommands lists the slash commands the bot handles, used to label update metrics
+var slashCommands = []string{
+	CommandStart, CommandAuth, CommandPanel, CommandDashboard, CommandDirectFor, CommandVPNFor,
+	CommandSchedule, CommandPing, CommandTOTP, CommandOTP, CommandInvite, CommandInvites,
+	CommandRevoke, CommandLogout, CommandHistory, CommandSubscribe, CommandUnsubscribe, CommandLang,
+}
+
 // NewTelegramBot creates a new Telegram bot instance
 func NewTelegramBot(token, authCode string, vpnManager *VPNManager, logger *logrus.Logger) (*TelegramBot, error) {
 	bot, err := tgbotapi.NewBotAPI(token)
@@ -46,41 +126,113 @@ func NewTelegramBot(token, authCode string, vpnManager *VPNManager, logger *logr
 
 	bot.Debug = false
 
+	return newTelegramBot(bot, bot.Self, authCode, vpnManager, logger), nil
+}
+
+// newTelegramBot wraps an already connected Bot API client logged in as self
+func newTelegramBot(bot TelegramAPI, self tgbotapi.User, authCode string, vpnManager *VPNManager, logger *logrus.Logger) *TelegramBot {
 	return &TelegramBot{
 		bot:             bot,
+		self:            self,
 		authCode:        authCode,
+		authCodeRole:    RoleAdmin,
+		adminUsers:      make(map[int64]bool),
 		vpnManager:      vpnManager,
 		logger:          logger,
-		authorizedUsers: make(map[int64]VPNStatus),
-		lastMessages:    make(map[int64]int),
-		lastMsgType:     make(map[int64]string),
-		lastUserMsg:     make(map[int64]int),
-	}, nil
+		authorizedUsers: make(map[int64]*authorizedUser),
+		panels:          make(map[int64]*controlPanel),
+		enrollMessages:  make(map[int64]int),
+		pendingActions:  make(map[int64]pendingAction),
+		dashboards:      make(map[int64]int),
+		confirmations:   make(map[int64]*confirmation),
+		confirmTimeout:  defaultConfirmTimeout,
+		languages:       newLanguageStore(""),
+
+		updateWorkers:      defaultUpdateWorkers,
+		updateQueueSize:    defaultUpdateQueueSize,
+		updateDrainTimeout: defaultUpdateDrainTimeout,
+	}
 }
 
-// Start starts the Telegram bot
+// Start starts the Telegram bot, receiving updates by webhook when one is configured and by long polling otherwise
 func (tb *TelegramBot) Start(ctx context.Context) error {
-	tb.logger.WithField("username", tb.bot.Self.UserName).Info("Telegram bot started")
+	var updates tgbotapi.UpdatesChannel
+	if tb.webhook != nil {
+		if err := tb.registerWebhook(); err != nil {
+			return err
+		}
+		updates = tb.webhook.updates
+	} else {
+		if err := tb.removeWebhook(); err != nil {
+			return err
+		}
+		u := tgbotapi.NewUpdate(0)
+		u.Timeout = 60
+		updates = tb.bot.GetUpdatesChan(u)
+	}
 
-	u := tgbotapi.NewUpdate(0)
-	u.Timeout = 60
+	tb.logger.WithFields(logrus.Fields{
+		"username": tb.self.UserName,
+		"mode":     tb.updateMode(),
+	}).Info("Telegram bot started")
 
-	updates := tb.bot.GetUpdatesChan(u)
+	go tb.runSessionSweeper(ctx)
+	go tb.runDashboardRefresher(ctx)
 
+	dispatcher := NewUpdateDispatcher(tb.updateWorkers, tb.updateQueueSize, tb.handleUpdate, tb.logger)
+	dispatcher.SetBusyHandler(tb.replyBusy)
 	for {
 		select {
 		case update := <-updates:
-			tb.handleUpdate(update)
+			dispatcher.Submit(ctx, update)
 		case <-ctx.Done():
 			tb.logger.Info("Telegram bot shutting down")
-			tb.bot.StopReceivingUpdates()
+			// The webhook stays registered so Telegram queues updates until the next start
+			if tb.webhook == nil {
+				tb.bot.StopReceivingUpdates()
+			} else {
+				close(tb.webhook.stopped)
+			}
+			tb.drainUpdates(dispatcher)
 			return nil
 		}
 	}
 }
 
+// drainUpdates finishes the updates already received, giving up after the drain timeout
+// Chats whose updates were abandoned are told to send them again
+func (tb *TelegramBot) drainUpdates(dispatcher *UpdateDispatcher) {
+	ctx, cancel := context.WithTimeout(context.Background(), tb.updateDrainTimeout)
+	defer cancel()
+
+	start := time.Now()
+	abandoned := dispatcher.Drain(ctx)
+	if len(abandoned) == 0 {
+		tb.logger.WithField("duration", time.Since(start).Round(time.Millisecond).String()).Info("Queued updates drained")
+		return
+	}
+
+	total := 0
+	for chatID, count := range abandoned {
+		total += count
+		tb.sendMessage(tgbotapi.NewMessage(chatID, translate(tb.chatLanguage(chatID), msgShutdownAbandoned, count)))
+	}
+	tb.abandonedUpdates.Store(int64(total))
+	tb.logger.WithFields(logrus.Fields{
+		"abandoned": total,
+		"chats":     len(abandoned),
+		"timeout":   tb.updateDrainTimeout,
+	}).Warn("Gave up waiting for queued updates")
+}
+
 // handleUpdate processes incoming updates
 func (tb *TelegramBot) handleUpdate(update tgbotapi.Update) {
+	tb.metrics.IncTelegramUpdate(updateCommandLabel(update))
+
+	if update.CallbackQuery != nil {
+		tb.handleCallback(update.CallbackQuery)
+		return
+	}
 	if update.Message == nil {
 		return
 	}
@@ -102,84 +254,92 @@ func (tb *TelegramBot) handleUpdate(update tgbotapi.Update) {
 	case strings.HasPrefix(text, CommandAuth):
 		tb.handleAuth(update.Message)
 	case tb.isUserAuthorized(userID):
-		tb.handleAuthorizedCommand(update.Message)
+		if tb.touchSession(userID) {
+			tb.handleAuthorizedCommand(update.Message)
+		}
 	default:
-		tb.sendUnauthorizedMessage(update.Message.Chat.ID)
+		tb.metrics.IncAuthFailure("unauthorized")
+		tb.sendUnauthorizedMessage(update.Message.Chat.ID, tb.senderLanguage(update.Message.From))
 	}
 }
 
+// updateCommandLabel names the command an update carries without letting free text into metric labels
+func updateCommandLabel(update tgbotapi.Update) string {
+	if update.CallbackQuery != nil {
+		return "callback"
+	}
+	if update.Message == nil {
+		return "other"
+	}
 
-// handleStart handles the /start command
-func (tb *TelegramBot) handleStart(message *tgbotapi.Message) {
-	welcomeText := `🚀 **VPN Commander Bot**
+	name := commandName(update.Message.Text)
+	if name == "" {
+		return "text"
+	}
+	for _, command := range slashCommands {
+		if name == command {
+			return strings.TrimPrefix(name, "/")
+		}
+	}
+	return "unknown"
+}
 
-🎯 **What this bot controls:**
-• 🔋 **VPN Service** - Start/stop the VPN daemon
-• 🔐 **Traffic Routing** - Choose VPN tunnel or direct internet
+// handleStart handles the /start command, including invite deep links (/start TOKEN)
+func (tb *TelegramBot) handleStart(message *tgbotapi.Message) {
+	if args := strings.Fields(message.Text); len(args) == 2 {
+		tb.handleInviteRedemption(message, args[1])
+		return
+	}
 
-🔐 **Authentication required**
-Send: /auth YOUR_CODE
+	// Configured admins are authorized without any code
+	if tb.adminUsers[message.From.ID] && !tb.isUserAuthorized(message.From.ID) {
+		tb.completeAuthorization(message, RoleAdmin)
+		return
+	}
 
-📋 **Available controls after authentication:**
-🔍 Quick Status - Check current traffic routing
-🔋 Service Status - Check if VPN daemon is running
-🔐 Route via VPN - Send traffic through secure tunnel
-🔓 Route Direct - Send traffic directly to internet
-🟢 Start VPN - Power on the VPN service
-🔴 Stop VPN - Power off the VPN service
+	// Invited users sign in again with the role they were granted
+	if grant, ok := tb.roleGrant(message.From.ID); ok && !tb.isUserAuthorized(message.From.ID) {
+		tb.completeAuthorization(message, grant.Role)
+		return
+	}
 
-💡 **Pro tip:** Check status first, then choose your routing preference!`
+	// Authorized users get their control panel back
+	if tb.isUserAuthorized(message.From.ID) && tb.touchSession(message.From.ID) {
+		in := newMessageInteraction(message)
+		tb.deleteUserMessage(in.chatID, in.userMessageID)
+		tb.showPanel(in, tb.text(in, msgPanelTitle))
+		return
+	}
 
-	msg := tgbotapi.NewMessage(message.Chat.ID, welcomeText)
+	msg := tgbotapi.NewMessage(message.Chat.ID, translate(tb.senderLanguage(message.From), msgWelcome))
 	msg.ParseMode = "Markdown"
 	tb.sendMessage(msg)
 }
 
 // handleAuth handles the /auth command
 func (tb *TelegramBot) handleAuth(message *tgbotapi.Message) {
+	language := tb.senderLanguage(message.From)
+	if tb.authCode == "" {
+		msg := tgbotapi.NewMessage(message.Chat.ID, translate(language, msgAuthDisabled))
+		tb.sendMessage(msg)
+		return
+	}
+
 	args := strings.Fields(message.Text)
 	if len(args) != 2 {
-		msg := tgbotapi.NewMessage(message.Chat.ID, "❌ Please provide the authentication code: /auth YOUR_CODE")
+		msg := tgbotapi.NewMessage(message.Chat.ID, translate(language, msgAuthUsage))
 		tb.sendMessage(msg)
 		return
 	}
 
 	providedCode := args[1]
 	if providedCode == tb.authCode {
-		// Check current VPN status and authorize user with this status
-		currentStatus, err := tb.vpnManager.GetStatus()
-		if err != nil {
-			tb.logger.WithError(err).Error("Failed to get initial VPN status during auth")
-			currentStatus = VPNStatusUnknown
-		}
-		
-		tb.authorizeUser(message.From.ID, currentStatus)
-		
-		var statusText string
-		switch currentStatus {
-		case VPNStatusEnabled:
-			statusText = "🔐 Current routing: VPN TUNNEL"
-		case VPNStatusDisabled:
-			statusText = "🔓 Current routing: DIRECT"
-		default:
-			statusText = "❓ Current routing: UNKNOWN"
-		}
-		
-		responseText := fmt.Sprintf("✅ **Authentication successful!**\n\n%s\n\n🎛️ You now have access to VPN controls.", statusText)
-		msg := tgbotapi.NewMessage(message.Chat.ID, responseText)
-		msg.ParseMode = "Markdown"
-		msg.ReplyMarkup = tb.createMainKeyboard()
-		tb.sendMessage(msg)
-		
-		tb.logger.WithFields(logrus.Fields{
-			"user_id":     message.From.ID,
-			"username":    message.From.UserName,
-			"vpn_status":  currentStatus,
-		}).Info("User authenticated successfully with initial VPN status")
+		tb.completeAuthorization(message, tb.authCodeRole)
 	} else {
-		msg := tgbotapi.NewMessage(message.Chat.ID, "❌ Invalid authentication code. Access denied.")
+		msg := tgbotapi.NewMessage(message.Chat.ID, translate(language, msgAuthInvalid))
 		tb.sendMessage(msg)
-		
+		tb.metrics.IncAuthFailure("auth_code")
+
 		tb.logger.WithFields(logrus.Fields{
 			"user_id":  message.From.ID,
 			"username": message.From.UserName,
@@ -187,163 +347,259 @@ func (tb *TelegramBot) handleAuth(message *tgbotapi.Message) {
 	}
 }
 
+// completeAuthorization authorizes the sender with role and greets them with the current routing status
+func (tb *TelegramBot) completeAuthorization(message *tgbotapi.Message, role Role) {
+	// Check current VPN status and authorize user with this status
+	currentStatus, err := tb.vpnManager.GetStatus()
+	if err != nil {
+		tb.logger.WithError(err).Error("Failed to get initial VPN status during auth")
+		currentStatus = VPNStatusUnknown
+	}
+
+	tb.authorizeUser(message.From.ID, message.Chat.ID, role, currentStatus)
+
+	in := newMessageInteraction(message)
+	statusKey := msgRoutingUnknown
+	switch currentStatus {
+	case VPNStatusEnabled:
+		statusKey = msgRoutingVPN
+	case VPNStatusDisabled:
+		statusKey = msgRoutingDirect
+	}
+
+	tb.showPanel(in, tb.text(in, msgAuthSuccess, tb.text(in, statusKey), role))
+
+	tb.logger.WithFields(logrus.Fields{
+		"user_id":    message.From.ID,
+		"username":   message.From.UserName,
+		"role":       role,
+		"vpn_status": currentStatus,
+	}).Info("User authenticated successfully with initial VPN status")
+}
+
 // handleAuthorizedCommand handles commands from authorized users
 func (tb *TelegramBot) handleAuthorizedCommand(message *tgbotapi.Message) {
-	// Store user message ID for deletion
-	tb.storeUserMessageID(message.From.ID, message.MessageID)
-	
-	switch message.Text {
-	case CommandStatus:
-		tb.handleStatus(message)
-	case CommandEnableVPN:
-		tb.handleEnableVPN(message)
-	case CommandDisableVPN:
-		tb.handleDisableVPN(message)
-	case CommandStartVPN:
-		tb.handleStartVPN(message)
-	case CommandStopVPN:
-		tb.handleStopVPN(message)
-	case CommandServiceStatus:
-		tb.handleServiceStatus(message)
+	switch commandName(message.Text) {
+	case CommandTOTP:
+		tb.handleTOTP(message)
+		return
+	case CommandOTP:
+		tb.handleOTP(message)
+		return
+	case CommandInvite:
+		tb.handleInvite(message)
+		return
+	case CommandInvites:
+		tb.handleInvites(message)
+		return
+	case CommandRevoke:
+		tb.handleRevoke(message)
+		return
+	case CommandLogout:
+		tb.handleLogout(message)
+		return
+	case CommandHistory:
+		tb.handleHistory(message)
+		return
+	case CommandSubscribe:
+		tb.handleSubscribe(message)
+		return
+	case CommandUnsubscribe:
+		tb.handleUnsubscribe(message)
+		return
+	case CommandDashboard:
+		tb.handleDashboard(message)
+		return
+	case CommandDirectFor:
+		tb.handleTimedRouting(message, ActionDisableVPN)
+		return
+	case CommandVPNFor:
+		tb.handleTimedRouting(message, ActionEnableVPN)
+		return
+	case CommandSchedule:
+		tb.handleSchedule(message)
+		return
+	case CommandPing:
+		tb.handlePing(message)
+		return
+	case CommandLang:
+		tb.handleLang(message)
+		return
+	}
+
+	in := newMessageInteraction(message)
+	defer tb.deleteUserMessage(in.chatID, in.userMessageID)
+
+	if message.Text == CommandPanel {
+		tb.showPanel(in, tb.text(in, msgPanelTitle))
+		return
+	}
+	// Button labels still work when typed, in any language
+	if action, ok := typedPanelAction(message.Text); ok {
+		tb.handlePanelAction(in, action, "")
+		return
+	}
+	tb.showPanel(in, tb.text(in, msgUnknownCommand))
+}
+
+// handlePanelAction runs a control panel action for a button press or typed command
+func (tb *TelegramBot) handlePanelAction(in *interaction, action, arg string) {
+	defer tb.refreshDashboardsAsync()
+
+	switch action {
+	case panelActionStatus:
+		tb.handleStatus(in)
+	case panelActionService:
+		tb.handleServiceStatus(in)
+	case panelActionVPN:
+		tb.runProtected(in, ActionEnableVPN, func() { tb.handleEnableVPN(in) })
+	case panelActionDirect:
+		tb.runProtected(in, ActionDisableVPN, func() { tb.handleDisableVPN(in) })
+	case panelActionStart:
+		tb.runProtected(in, ActionStartService, func() { tb.handleStartVPN(in) })
+	case panelActionStop:
+		tb.runProtected(in, ActionStopService, func() { tb.handleStopVPN(in) })
+	case panelActionConfirm:
+		tb.handleConfirm(in, arg)
+	case panelActionCancel:
+		tb.handleCancel(in)
+	case panelActionRevertCancel:
+		tb.handleRevertCancel(in)
+	case panelActionRevertExtend:
+		tb.handleRevertExtend(in, arg)
 	default:
-		// Delete user command message for unknown commands too
-		tb.deleteUserMessage(message.Chat.ID, message.MessageID)
-		msg := tgbotapi.NewMessage(message.Chat.ID, "❓ Unknown command. Please use the keyboard buttons.")
-		msg.ReplyMarkup = tb.createMainKeyboard()
-		tb.sendMessage(msg)
+		tb.alert(in, tb.text(in, msgUnknownAction))
 	}
 }
 
 // handleStatus checks and displays current VPN status
-func (tb *TelegramBot) handleStatus(message *tgbotapi.Message) {
-	tb.logger.WithField("user_id", message.From.ID).Info("Status check requested")
-	
-	userID := message.From.ID
-	
-	// Send progressive message
-	msgID := tb.sendProgressiveMessage(message.Chat.ID, "🔍 Checking traffic routing status...", "vpn_status", message.MessageID)
-	
-	cachedStatus := tb.getCachedStatus(userID)
+func (tb *TelegramBot) handleStatus(in *interaction) {
+	tb.logger.WithField("user_id", in.userID).Info("Status check requested")
+
+	tb.acknowledge(in, tb.text(in, msgStatusChecking))
+	tb.showPanelProgress(in, tb.text(in, msgStatusProgress))
+
+	cachedStatus := tb.getCachedStatus(in.userID)
 	status, err := tb.vpnManager.GetStatus()
-	
+
 	if err != nil {
 		tb.logger.WithError(err).Error("Failed to get VPN status")
-		
+
 		// Use cached status if available
 		if cachedStatus != VPNStatusUnknown {
 			status = cachedStatus
 			tb.logger.WithField("cached_status", cachedStatus).Warn("Using cached status due to error")
 		} else {
-			tb.updateProgressiveMessage(message.Chat.ID, msgID, "❌ Status check failed")
+			tb.showPanel(in, tb.text(in, msgStatusFailed))
 			return
 		}
 	} else {
 		// Update cached status
-		tb.updateCachedStatus(userID, status)
+		tb.updateCachedStatus(in.userID, status)
 	}
 
+	checkedAt := time.Now().Format("15:04")
 	var responseText string
 	switch status {
 	case VPNStatusEnabled:
-		responseText = "🔐 **VPN ROUTING ACTIVE**\n↳ All traffic routes through VPN tunnel\n📊 Checked at " + message.Time().Format("15:04")
+		responseText = tb.text(in, msgStatusVPN, checkedAt)
 	case VPNStatusDisabled:
-		responseText = "🔓 **DIRECT ROUTING ACTIVE**\n↳ Traffic goes directly to internet\n📊 Checked at " + message.Time().Format("15:04")
+		responseText = tb.text(in, msgStatusDirect, checkedAt)
 	default:
-		responseText = "❓ **ROUTING STATUS UNKNOWN** • " + message.Time().Format("15:04")
+		responseText = tb.text(in, msgStatusUnknown, checkedAt)
+	}
+	if line := tb.revertStatusLine(tb.language(in)); line != "" {
+		responseText += "\n" + line
 	}
-	
-	tb.updateProgressiveMessage(message.Chat.ID, msgID, responseText)
+
+	tb.showPanel(in, responseText)
 }
 
-// handleEnableVPN enables VPN routing
-func (tb *TelegramBot) handleEnableVPN(message *tgbotapi.Message) {
-	tb.logger.WithField("user_id", message.From.ID).Info("VPN enable requested")
-	
-	// Delete user command message
-	tb.deleteUserMessage(message.Chat.ID, message.MessageID)
+// handleEnableVPN enables VPN routing and reports whether it succeeded
+func (tb *TelegramBot) handleEnableVPN(in *interaction) bool {
+	tb.logger.WithField("user_id", in.userID).Info("VPN enable requested")
 
-	if err := tb.vpnManager.EnableVPN(); err != nil {
+	tb.acknowledge(in, tb.text(in, msgEnableSwitching))
+	tb.showPanelProgress(in, tb.text(in, msgEnableProgress))
+
+	if err := tb.vpnManager.EnableVPN(tb.actionContext(in)); err != nil {
 		tb.logger.WithError(err).Error("Failed to enable VPN")
-		errorMsg := tgbotapi.NewMessage(message.Chat.ID, "❌ Failed to enable VPN")
-		errorMsg.ReplyMarkup = tb.createMainKeyboard()
-		tb.sendMessage(errorMsg)
-		return
+		tb.showPanel(in, tb.text(in, msgEnableFailed))
+		return false
 	}
 
 	// Update cached status
-	tb.updateCachedStatus(message.From.ID, VPNStatusEnabled)
+	tb.updateCachedStatus(in.userID, VPNStatusEnabled)
+	tb.reverts.CancelIfAction(ActionEnableVPN)
 
-	tb.sendOrEditMessage(message.Chat.ID, "✅ **ROUTING SWITCHED TO VPN**\n🔐 Traffic now flows through secure tunnel\n⚡ Applied instantly", tb.createMainKeyboard())
+	tb.showPanel(in, tb.text(in, msgEnableDone))
+	return true
 }
 
-// handleDisableVPN disables VPN routing
-func (tb *TelegramBot) handleDisableVPN(message *tgbotapi.Message) {
-	tb.logger.WithField("user_id", message.From.ID).Info("VPN disable requested")
-	
-	// Delete user command message
-	tb.deleteUserMessage(message.Chat.ID, message.MessageID)
+// handleDisableVPN disables VPN routing and reports whether it succeeded
+func (tb *TelegramBot) handleDisableVPN(in *interaction) bool {
+	tb.logger.WithField("user_id", in.userID).Info("VPN disable requested")
+
+	tb.acknowledge(in, tb.text(in, msgDisableSwitching))
+	tb.showPanelProgress(in, tb.text(in, msgDisableProgress))
 
-	if err := tb.vpnManager.DisableVPN(); err != nil {
+	if err := tb.vpnManager.DisableVPN(tb.actionContext(in)); err != nil {
 		tb.logger.WithError(err).Error("Failed to disable VPN")
-		errorMsg := tgbotapi.NewMessage(message.Chat.ID, "❌ Failed to disable VPN")
-		errorMsg.ReplyMarkup = tb.createMainKeyboard()
-		tb.sendMessage(errorMsg)
-		return
+		tb.showPanel(in, tb.text(in, msgDisableFailed))
+		return false
 	}
 
 	// Update cached status
-	tb.updateCachedStatus(message.From.ID, VPNStatusDisabled)
+	tb.updateCachedStatus(in.userID, VPNStatusDisabled)
+	tb.reverts.CancelIfAction(ActionDisableVPN)
 
-	tb.sendOrEditMessage(message.Chat.ID, "✅ **ROUTING SWITCHED TO DIRECT**\n🔓 Traffic now goes directly to internet\n⚡ Applied instantly", tb.createMainKeyboard())
+	tb.showPanel(in, tb.text(in, msgDisableDone))
+	return true
 }
 
 // handleStartVPN starts the VPN service using xkeen
-func (tb *TelegramBot) handleStartVPN(message *tgbotapi.Message) {
-	tb.logger.WithField("user_id", message.From.ID).Info("VPN service start requested")
-	
-	// Delete user command message
-	tb.deleteUserMessage(message.Chat.ID, message.MessageID)
+func (tb *TelegramBot) handleStartVPN(in *interaction) {
+	tb.logger.WithField("user_id", in.userID).Info("VPN service start requested")
+
+	tb.acknowledge(in, tb.text(in, msgServiceStarting))
+	tb.showPanelProgress(in, tb.text(in, msgServiceStartProgress))
 
-	if err := tb.vpnManager.StartVPNService(); err != nil {
+	if err := tb.vpnManager.StartVPNService(tb.actionContext(in)); err != nil {
 		tb.logger.WithError(err).Error("Failed to start VPN service")
-		errorMsg := tgbotapi.NewMessage(message.Chat.ID, "❌ Failed to start service")
-		errorMsg.ReplyMarkup = tb.createMainKeyboard()
-		tb.sendMessage(errorMsg)
+		tb.showPanel(in, tb.text(in, msgServiceStartFailed))
 		return
 	}
 
-	tb.sendOrEditMessage(message.Chat.ID, "✅ **VPN SERVICE STARTED**\n🟢 Daemon is now running and ready\n⚙️ Service initialized", tb.createMainKeyboard())
+	tb.showPanel(in, tb.text(in, msgServiceStarted))
 }
 
 // handleStopVPN stops the VPN service using xkeen
-func (tb *TelegramBot) handleStopVPN(message *tgbotapi.Message) {
-	tb.logger.WithField("user_id", message.From.ID).Info("VPN service stop requested")
-	
-	// Delete user command message
-	tb.deleteUserMessage(message.Chat.ID, message.MessageID)
+func (tb *TelegramBot) handleStopVPN(in *interaction) {
+	tb.logger.WithField("user_id", in.userID).Info("VPN service stop requested")
+
+	tb.acknowledge(in, tb.text(in, msgServiceStopping))
+	tb.showPanelProgress(in, tb.text(in, msgServiceStopProgress))
 
-	if err := tb.vpnManager.StopVPNService(); err != nil {
+	if err := tb.vpnManager.StopVPNService(tb.actionContext(in)); err != nil {
 		tb.logger.WithError(err).Error("Failed to stop VPN service")
-		errorMsg := tgbotapi.NewMessage(message.Chat.ID, "❌ Failed to stop service")
-		errorMsg.ReplyMarkup = tb.createMainKeyboard()
-		tb.sendMessage(errorMsg)
+		tb.showPanel(in, tb.text(in, msgServiceStopFailed))
 		return
 	}
 
-	tb.sendOrEditMessage(message.Chat.ID, "✅ **VPN SERVICE STOPPED**\n🔴 Daemon has been shut down\n⚙️ Service terminated", tb.createMainKeyboard())
+	tb.showPanel(in, tb.text(in, msgServiceStopped))
 }
 
 // handleServiceStatus checks and displays VPN service status using xkeen
-func (tb *TelegramBot) handleServiceStatus(message *tgbotapi.Message) {
-	tb.logger.WithField("user_id", message.From.ID).Info("VPN service status check requested")
+func (tb *TelegramBot) handleServiceStatus(in *interaction) {
+	tb.logger.WithField("user_id", in.userID).Info("VPN service status check requested")
 
-	// Send progressive message
-	msgID := tb.sendProgressiveMessage(message.Chat.ID, "🔋 Checking VPN daemon status...", "service_status", message.MessageID)
+	tb.acknowledge(in, tb.text(in, msgServiceChecking))
+	tb.showPanelProgress(in, tb.text(in, msgServiceProgress))
 
 	status, err := tb.vpnManager.GetVPNServiceStatus()
 	if err != nil {
 		tb.logger.WithError(err).Error("Failed to get VPN service status")
-		tb.updateProgressiveMessage(message.Chat.ID, msgID, "❌ Service status check failed")
+		tb.showPanel(in, tb.text(in, msgServiceFailed))
 		return
 	}
 
@@ -353,71 +609,46 @@ func (tb *TelegramBot) handleServiceStatus(message *tgbotapi.Message) {
 	cleanStatus = strings.ReplaceAll(cleanStatus, "[31m", "")
 	cleanStatus = strings.ReplaceAll(cleanStatus, "[0m", "")
 	cleanStatus = strings.TrimSpace(cleanStatus)
-	
+
 	// Determine status with simple logic
+	checkedAt := time.Now().Format("15:04")
 	var responseText string
 	if strings.Contains(cleanStatus, "не запущен") {
-		responseText = "🔴 **VPN SERVICE STOPPED**\n↳ Daemon is not running\n🔋 Checked at " + message.Time().Format("15:04")
+		responseText = tb.text(in, msgServiceNotRunning, checkedAt)
 		tb.logger.WithField("decision", "not running - found 'не запущен'").Info("Status decision")
 	} else if strings.Contains(cleanStatus, "запущен") || cleanStatus != "" {
-		responseText = "🟢 **VPN SERVICE RUNNING**\n↳ Daemon is active and ready\n🔋 Checked at " + message.Time().Format("15:04")
+		responseText = tb.text(in, msgServiceRunning, checkedAt)
 		tb.logger.WithField("decision", "running - found service active").Info("Status decision")
 	} else {
-		responseText = "🟡 **VPN SERVICE STATUS UNKNOWN** • " + message.Time().Format("15:04")
+		responseText = tb.text(in, msgServiceUnknown, checkedAt)
 		tb.logger.WithField("decision", "unknown - empty output after cleaning").Info("Status decision")
 	}
-	
-	tb.updateProgressiveMessage(message.Chat.ID, msgID, responseText)
-}
-
-// getCombinedStatus returns a combined status display showing both routing and service status
-func (tb *TelegramBot) getCombinedStatus() (string, error) {
-	// Get routing status
-	routingStatus, err := tb.vpnManager.GetStatus()
-	if err != nil {
-		tb.logger.WithError(err).Warn("Failed to get routing status for combined display")
-		routingStatus = VPNStatusUnknown
-	}
 
-	// Get service status
-	serviceStatusRaw, err := tb.vpnManager.GetVPNServiceStatus()
-	var serviceRunning bool
-	if err != nil {
-		tb.logger.WithError(err).Warn("Failed to get service status for combined display")
-		serviceRunning = false
-	} else {
-		// Clean and check service status
-		cleanStatus := strings.ReplaceAll(serviceStatusRaw, "\033[31m", "")
-		cleanStatus = strings.ReplaceAll(cleanStatus, "\033[0m", "")
-		cleanStatus = strings.TrimSpace(cleanStatus)
-		serviceRunning = !strings.Contains(cleanStatus, "не запущен")
-	}
-
-	// Build combined status message
-	var routingIcon, serviceIcon string
-	switch routingStatus {
-	case VPNStatusEnabled:
-		routingIcon = "🔒"
-	case VPNStatusDisabled:
-		routingIcon = "🌐"
-	default:
-		routingIcon = "❓"
-	}
-
-	if serviceRunning {
-		serviceIcon = "🟢"
-	} else {
-		serviceIcon = "🔴"
-	}
-
-	return fmt.Sprintf("%s%s Combined Status", routingIcon, serviceIcon), nil
+	tb.showPanel(in, responseText)
 }
 
-// authorizeUser adds a user to the authorized users list with initial VPN status
-func (tb *TelegramBot) authorizeUser(userID int64, initialStatus VPNStatus) {
+// authorizeUser starts a session for a user with a role and initial VPN status
+func (tb *TelegramBot) authorizeUser(userID, chatID int64, role Role, initialStatus VPNStatus) {
 	tb.userMutex.Lock()
 	defer tb.userMutex.Unlock()
-	tb.authorizedUsers[userID] = initialStatus
+	now := time.Now()
+	tb.authorizedUsers[userID] = &authorizedUser{
+		role:         role,
+		status:       initialStatus,
+		chatID:       chatID,
+		authorizedAt: now,
+		lastSeen:     now,
+	}
+}
+
+// getUserRole returns the role of an authorized user
+func (tb *TelegramBot) getUserRole(userID int64) (Role, bool) {
+	tb.userMutex.RLock()
+	defer tb.userMutex.RUnlock()
+	if user, exists := tb.authorizedUsers[userID]; exists {
+		return user.role, true
+	}
+	return "", false
 }
 
 // isUserAuthorized checks if a user is authorized
@@ -432,8 +663,8 @@ func (tb *TelegramBot) isUserAuthorized(userID int64) bool {
 func (tb *TelegramBot) getCachedStatus(userID int64) VPNStatus {
 	tb.userMutex.RLock()
 	defer tb.userMutex.RUnlock()
-	if status, exists := tb.authorizedUsers[userID]; exists {
-		return status
+	if user, exists := tb.authorizedUsers[userID]; exists {
+		return user.status
 	}
 	return VPNStatusUnknown
 }
@@ -442,218 +673,42 @@ func (tb *TelegramBot) getCachedStatus(userID int64) VPNStatus {
 func (tb *TelegramBot) updateCachedStatus(userID int64, status VPNStatus) {
 	tb.userMutex.Lock()
 	defer tb.userMutex.Unlock()
-	if _, exists := tb.authorizedUsers[userID]; exists {
-		tb.authorizedUsers[userID] = status
+	if user, exists := tb.authorizedUsers[userID]; exists {
+		user.status = status
 	}
 }
 
-// sendUnauthorizedMessage sends an unauthorized access message
-func (tb *TelegramBot) sendUnauthorizedMessage(chatID int64) {
-	text := "🚫 Unauthorized access. Please authenticate first using /auth YOUR_CODE"
-	msg := tgbotapi.NewMessage(chatID, text)
-	tb.sendMessage(msg)
-}
-
-// createMainKeyboard creates UX-optimized keyboard with logical information-action flow
-func (tb *TelegramBot) createMainKeyboard() tgbotapi.ReplyKeyboardMarkup {
-	return tgbotapi.NewReplyKeyboard(
-		// Information Layer - Check status before making decisions
-		tgbotapi.NewKeyboardButtonRow(
-			tgbotapi.NewKeyboardButton(CommandStatus),
-			tgbotapi.NewKeyboardButton(CommandServiceStatus),
-		),
-		// Traffic Control Layer - Core routing decisions
-		tgbotapi.NewKeyboardButtonRow(
-			tgbotapi.NewKeyboardButton(CommandEnableVPN),
-			tgbotapi.NewKeyboardButton(CommandDisableVPN),
-		),
-		// Service Control Layer - Power management
-		tgbotapi.NewKeyboardButtonRow(
-			tgbotapi.NewKeyboardButton(CommandStartVPN),
-			tgbotapi.NewKeyboardButton(CommandStopVPN),
-		),
-	)
-}
-
-// sendProgressiveMessage sends a progressive message that can be edited through process stages
-func (tb *TelegramBot) sendProgressiveMessage(chatID int64, initialText string, msgType string, userMsgID int) int {
-	tb.messageMutex.Lock()
-	defer tb.messageMutex.Unlock()
-	
-	userID := chatID
-	lastMessageID, exists := tb.lastMessages[userID]
-	lastType, typeExists := tb.lastMsgType[userID]
-	
-	// Delete previous bot message if it was the same type
-	if exists && lastMessageID > 0 && typeExists && lastType == msgType {
-		deleteMsg := tgbotapi.NewDeleteMessage(chatID, lastMessageID)
-		tb.bot.Send(deleteMsg) // Don't care about errors here
-	}
-	
-	// Delete user command message
-	if userMsgID > 0 {
-		deleteUserMsg := tgbotapi.NewDeleteMessage(chatID, userMsgID)
-		tb.bot.Send(deleteUserMsg) // Don't care about errors here
-	}
-	
-	// Send new message
-	msg := tgbotapi.NewMessage(chatID, initialText)
-	// Don't add keyboard to processing message
-	
-	if sentMsg, err := tb.bot.Send(msg); err != nil {
-		tb.logger.WithError(err).Error("Failed to send progressive message")
-		return 0
-	} else {
-		// Store new message ID and type
-		tb.lastMessages[chatID] = sentMsg.MessageID
-		tb.lastMsgType[chatID] = msgType
-		return sentMsg.MessageID
-	}
-}
-
-// updateProgressiveMessage edits an existing message text only (ReplyKeyboard can't be edited)
-func (tb *TelegramBot) updateProgressiveMessage(chatID int64, messageID int, finalText string) {
-	if messageID == 0 {
-		return
-	}
-	
-	// Edit message text only with markdown support
-	editMsg := tgbotapi.NewEditMessageText(chatID, messageID, finalText)
-	editMsg.ParseMode = "Markdown"
-	if _, err := tb.bot.Send(editMsg); err != nil {
-		tb.logger.WithError(err).Debug("Failed to edit message text")
-		// If edit fails, send new message as fallback
-		tb.sendStatusMessageWithMarkdown(chatID, finalText, "fallback")
-	}
-}
-
-
-// sendStatusMessage sends a status message and deletes previous status message (fallback)
-func (tb *TelegramBot) sendStatusMessage(chatID int64, text string, msgType string) {
-	tb.messageMutex.Lock()
-	defer tb.messageMutex.Unlock()
-	
-	userID := chatID
-	lastMessageID, exists := tb.lastMessages[userID]
-	lastType, typeExists := tb.lastMsgType[userID]
-	
-	// Send new message
-	msg := tgbotapi.NewMessage(chatID, text)
-	msg.ReplyMarkup = tb.createMainKeyboard()
-	
-	if sentMsg, err := tb.bot.Send(msg); err != nil {
-		tb.logger.WithError(err).Error("Failed to send status message")
-		return
-	} else {
-		// Store new message ID and type
-		tb.lastMessages[chatID] = sentMsg.MessageID
-		tb.lastMsgType[chatID] = msgType
-		
-		// Delete previous bot message if it was the same type
-		if exists && lastMessageID > 0 && typeExists && lastType == msgType {
-			deleteMsg := tgbotapi.NewDeleteMessage(chatID, lastMessageID)
-			if _, err := tb.bot.Send(deleteMsg); err != nil {
-				tb.logger.WithError(err).Debug("Failed to delete previous bot message")
-			}
-		}
-	}
-}
-
-// sendStatusMessageWithMarkdown sends a status message with markdown support
-func (tb *TelegramBot) sendStatusMessageWithMarkdown(chatID int64, text string, msgType string) {
-	tb.messageMutex.Lock()
-	defer tb.messageMutex.Unlock()
-	
-	userID := chatID
-	lastMessageID, exists := tb.lastMessages[userID]
-	lastType, typeExists := tb.lastMsgType[userID]
-	
-	// Send new message
-	msg := tgbotapi.NewMessage(chatID, text)
-	msg.ParseMode = "Markdown"
-	msg.ReplyMarkup = tb.createMainKeyboard()
-	
-	if sentMsg, err := tb.bot.Send(msg); err != nil {
-		tb.logger.WithError(err).Error("Failed to send status message with markdown")
-		return
-	} else {
-		// Store new message ID and type
-		tb.lastMessages[chatID] = sentMsg.MessageID
-		tb.lastMsgType[chatID] = msgType
-		
-		// Delete previous bot message if it was the same type
-		if exists && lastMessageID > 0 && typeExists && lastType == msgType {
-			deleteMsg := tgbotapi.NewDeleteMessage(chatID, lastMessageID)
-			if _, err := tb.bot.Send(deleteMsg); err != nil {
-				tb.logger.WithError(err).Debug("Failed to delete previous bot message")
-			}
-		}
-	}
-}
-
-// sendOrEditMessage sends a new message and deletes the previous one (legacy)
-func (tb *TelegramBot) sendOrEditMessage(chatID int64, text string, keyboard tgbotapi.ReplyKeyboardMarkup) {
-	tb.sendStatusMessageWithMarkdown(chatID, text, "status")
-}
-
-// sendNewMessage sends a new message and stores its ID
-func (tb *TelegramBot) sendNewMessage(chatID int64, text string, keyboard tgbotapi.ReplyKeyboardMarkup) {
-	msg := tgbotapi.NewMessage(chatID, text)
-	msg.ReplyMarkup = keyboard
-	
-	maxRetries := 3
-	for attempt := 1; attempt <= maxRetries; attempt++ {
-		if sentMsg, err := tb.bot.Send(msg); err != nil {
-			tb.logger.WithFields(logrus.Fields{
-				"chat_id": chatID,
-				"text":    text,
-				"error":   err,
-				"attempt": attempt,
-			}).Warn("Failed to send message")
-			
-			if attempt < maxRetries {
-				continue
-			}
-		} else {
-			// Store message ID for future editing
-			tb.lastMessages[chatID] = sentMsg.MessageID
-			return
-		}
+// sendUnauthorizedMessage sends an unauthorized access message in language
+func (tb *TelegramBot) sendUnauthorizedMessage(chatID int64, language Language) {
+	key := msgUnauthorizedCode
+	if tb.authCode == "" {
+		key = msgUnauthorizedInvite
 	}
+	msg := tgbotapi.NewMessage(chatID, translate(language, key))
+	tb.sendMessage(msg)
 }
 
 // sendMessage sends a message and logs any errors with retry logic (legacy function)
 func (tb *TelegramBot) sendMessage(msg tgbotapi.MessageConfig) {
 	maxRetries := 3
 	for attempt := 1; attempt <= maxRetries; attempt++ {
-		if sentMsg, err := tb.bot.Send(msg); err != nil {
+		if _, err := tb.bot.Send(msg); err != nil {
 			tb.logger.WithFields(logrus.Fields{
 				"chat_id": msg.ChatID,
 				"text":    msg.Text,
 				"error":   err,
 				"attempt": attempt,
 			}).Warn("Failed to send message")
-			
+
 			if attempt < maxRetries {
 				continue
 			}
 		} else {
-			// Store message ID for editing if it's a status-type message
-			tb.messageMutex.Lock()
-			tb.lastMessages[msg.ChatID] = sentMsg.MessageID
-			tb.messageMutex.Unlock()
 			return
 		}
 	}
 }
 
-// storeUserMessageID stores the user's message ID for later deletion
-func (tb *TelegramBot) storeUserMessageID(userID int64, messageID int) {
-	tb.messageMutex.Lock()
-	defer tb.messageMutex.Unlock()
-	tb.lastUserMsg[userID] = messageID
-}
-
 // deleteUserMessage deletes a user's message
 func (tb *TelegramBot) deleteUserMessage(chatID int64, messageID int) {
 	if messageID > 0 {
@@ -664,7 +719,41 @@ func (tb *TelegramBot) deleteUserMessage(chatID int64, messageID int) {
 	}
 }
 
+// actionContext returns a context identifying the sender as the actor of a router change
+func (tb *TelegramBot) actionContext(in *interaction) context.Context {
+	return withActor(context.Background(), Actor{
+		UserID:   in.userID,
+		Username: in.username,
+		Source:   "telegram",
+	})
+}
+
+// commandName extracts the leading slash command from text, dropping any @botname suffix
+func commandName(text string) string {
+	fields := strings.Fields(text)
+	if len(fields) == 0 || !strings.HasPrefix(fields[0], "/") {
+		return ""
+	}
+
+	name := fields[0]
+	if i := strings.Index(name, "@"); i >= 0 {
+		name = name[:i]
+	}
+	return name
+}
+
+// SetMetrics enables recording of update and auth failure metrics
+func (tb *TelegramBot) SetMetrics(metrics *Metrics) {
+	tb.metrics = metrics
+}
+
+// CheckAPI verifies that the Telegram Bot API is reachable and accepts the token
+func (tb *TelegramBot) CheckAPI() error {
+	_, err := tb.bot.GetMe()
+	return err
+}
+
 // GetBotInfo returns information about the bot
 func (tb *TelegramBot) GetBotInfo() *tgbotapi.User {
-	return &tb.bot.Self
-}
\ No newline at end of file
+	return &tb.self
+}
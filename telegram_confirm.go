@@ -0,0 +1,240 @@
+package main
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/sirupsen/logrus"
+)
+
+// Confirmation prompt timing
+const (
+	defaultConfirmTimeout = 15 * time.Second
+	confirmCountdownStep  = 5 * time.Second // How often the remaining time is updated
+)
+
+// confirmation is a disruptive action waiting for the user to press Confirm
+type confirmation struct {
+	action    Action
+	userID    int64 // Only the user who asked may answer the prompt
+	run       func()
+	nonce     string // Panel nonce the Confirm and Cancel buttons are bound to
+	expires   time.Time
+	stop      chan struct{} // Closed when the prompt is answered or replaced
+	rendering sync.Mutex    // Held while the prompt is drawn, so nothing is drawn over a later result
+}
+
+// SetConfirmation requires an explicit confirmation for actions, cancelling unanswered prompts after timeout
+func (tb *TelegramBot) SetConfirmation(actions []Action, timeout time.Duration) {
+	tb.confirmActions = make(map[Action]bool)
+	for _, action := range actions {
+		tb.confirmActions[action] = true
+	}
+	if timeout > 0 {
+		tb.confirmTimeout = timeout
+	}
+
+	tb.logger.WithFields(logrus.Fields{
+		"actions": actions,
+		"timeout": tb.confirmTimeout,
+	}).Info("Confirmation prompts enabled")
+}
+
+// askConfirmation replaces the panel with a confirm/cancel prompt and starts its countdown
+func (tb *TelegramBot) askConfirmation(in *interaction, action Action, run func()) {
+	c := &confirmation{
+		action:  action,
+		userID:  in.userID,
+		run:     run,
+		nonce:   tb.nextPanelNonce(),
+		expires: time.Now().Add(tb.confirmTimeout),
+		stop:    make(chan struct{}),
+	}
+
+	tb.acknowledge(in, tb.text(in, msgConfirmToast))
+
+	c.rendering.Lock()
+	tb.confirmationMutex.Lock()
+	previous := tb.confirmations[in.chatID]
+	if previous != nil {
+		close(previous.stop)
+	}
+	tb.confirmations[in.chatID] = c
+	tb.confirmationMutex.Unlock()
+
+	// Let a countdown tick of the replaced prompt finish before drawing over it
+	if previous != nil {
+		previous.rendering.Lock()
+		previous.rendering.Unlock()
+	}
+	tb.renderConfirmation(in, c, tb.confirmTimeout)
+	c.rendering.Unlock()
+
+	tb.logger.WithFields(logrus.Fields{
+		"user_id": in.userID,
+		"action":  action,
+	}).Info("Action awaiting confirmation")
+
+	go tb.runConfirmationCountdown(in, c)
+}
+
+// runConfirmationCountdown updates the remaining time of a prompt and cancels it once it runs out
+func (tb *TelegramBot) runConfirmationCountdown(in *interaction, c *confirmation) {
+	for {
+		// Tick on whole multiples of the step so the countdown reads 15, 10, 5
+		wait := time.Until(c.expires) % confirmCountdownStep
+		if wait <= 0 {
+			wait = confirmCountdownStep
+		}
+		if remaining := time.Until(c.expires); remaining < wait {
+			wait = remaining
+		}
+
+		select {
+		case <-c.stop:
+			return
+		case <-time.After(wait):
+		}
+
+		// Holding c.rendering keeps a late tick from overwriting the result of Confirm or Cancel,
+		// which wait for it after taking the prompt
+		c.rendering.Lock()
+		tb.confirmationMutex.Lock()
+		current := tb.confirmations[in.chatID] == c
+		remaining := time.Until(c.expires)
+		expired := current && remaining < time.Second
+		if expired {
+			delete(tb.confirmations, in.chatID)
+		}
+		tb.confirmationMutex.Unlock()
+
+		if !current {
+			c.rendering.Unlock()
+			return
+		}
+		if !expired {
+			tb.renderConfirmation(in, c, remaining)
+			c.rendering.Unlock()
+			continue
+		}
+
+		tb.logger.WithFields(logrus.Fields{
+			"user_id": in.userID,
+			"action":  c.action,
+		}).Info("Confirmation timed out")
+		tb.showPanel(in, tb.text(in, msgConfirmTimedOut, describeAction(tb.language(in), c.action), tb.confirmTimeout))
+		c.rendering.Unlock()
+		return
+	}
+}
+
+// renderConfirmation shows the prompt with the time left to answer it
+// Caller must hold c.rendering
+func (tb *TelegramBot) renderConfirmation(in *interaction, c *confirmation, remaining time.Duration) {
+	language := tb.language(in)
+	text := translate(language, msgConfirmPrompt,
+		describeAction(language, c.action), confirmationWarning(language, c.action), int(math.Ceil(remaining.Seconds())))
+
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(translate(language, msgButtonConfirm), encodeCallbackData(panelActionConfirm, c.nonce, string(c.action))),
+			tgbotapi.NewInlineKeyboardButtonData(translate(language, msgButtonCancel), encodeCallbackData(panelActionCancel, c.nonce)),
+		),
+	)
+	tb.renderPanel(in, text, c.nonce, &keyboard)
+}
+
+// handleConfirm runs the action awaiting confirmation in the chat, if the presser asked for it
+// and their role still allows it
+func (tb *TelegramBot) handleConfirm(in *interaction, action string) {
+	c, ok := tb.takeConfirmation(in.chatID, in.userID)
+	if c == nil {
+		tb.alert(in, tb.text(in, msgConfirmNothing))
+		return
+	}
+	if ok && action != "" && Action(action) != c.action {
+		// A stale button dropped the pending prompt, so replace its dead buttons with the panel
+		tb.alert(in, tb.text(in, msgConfirmNothing))
+		tb.showPanel(in, tb.text(in, msgActionCancelled, describeAction(tb.language(in), c.action)))
+		return
+	}
+	if !ok {
+		tb.alert(in, tb.text(in, msgConfirmNotRequester))
+		return
+	}
+
+	if role, _ := tb.getUserRole(in.userID); !role.CanControl() {
+		tb.alert(in, tb.text(in, msgRoleForbidsAction, role, describeAction(tb.language(in), c.action)))
+		tb.showPanel(in, tb.text(in, msgActionCancelled, describeAction(tb.language(in), c.action)))
+		return
+	}
+
+	tb.logger.WithFields(logrus.Fields{
+		"user_id": in.userID,
+		"action":  c.action,
+	}).Info("Action confirmed")
+
+	tb.acknowledge(in, tb.text(in, msgConfirmed))
+	c.run()
+}
+
+// handleCancel drops the action awaiting confirmation in the chat, if the presser asked for it
+func (tb *TelegramBot) handleCancel(in *interaction) {
+	c, ok := tb.takeConfirmation(in.chatID, in.userID)
+	if c == nil {
+		tb.acknowledge(in, "")
+		tb.showPanel(in, tb.text(in, msgCancelNothing))
+		return
+	}
+	if !ok {
+		tb.alert(in, tb.text(in, msgCancelNotRequester))
+		return
+	}
+
+	tb.logger.WithFields(logrus.Fields{
+		"user_id": in.userID,
+		"action":  c.action,
+	}).Info("Action cancelled")
+
+	tb.acknowledge(in, tb.text(in, msgCancelled))
+	tb.showPanel(in, tb.text(in, msgActionCancelled, describeAction(tb.language(in), c.action)))
+}
+
+// takeConfirmation removes and returns the chat's pending confirmation if userID asked for it,
+// stopping its countdown; another user's prompt is returned with false and left in place
+func (tb *TelegramBot) takeConfirmation(chatID, userID int64) (*confirmation, bool) {
+	tb.confirmationMutex.Lock()
+	c := tb.confirmations[chatID]
+	if c == nil || c.userID != userID {
+		tb.confirmationMutex.Unlock()
+		return c, false
+	}
+	delete(tb.confirmations, chatID)
+	close(c.stop)
+	tb.confirmationMutex.Unlock()
+
+	// Wait for a countdown tick drawing the prompt so the caller's result is not overwritten
+	c.rendering.Lock()
+	c.rendering.Unlock()
+	return c, true
+}
+
+// confirmationWarnings explain what the disruptive actions will do
+var confirmationWarnings = map[Action]messageKey{
+	ActionEnableVPN:      msgWarnEnableVPN,
+	ActionDisableVPN:     msgWarnDisableVPN,
+	ActionStartService:   msgWarnStartService,
+	ActionStopService:    msgWarnStopService,
+	ActionRestartService: msgWarnRestartService,
+	ActionSelectOutbound: msgWarnSelectOutbound,
+}
+
+// confirmationWarning explains what a disruptive action will do, in language
+func confirmationWarning(language Language, action Action) string {
+	if key, ok := confirmationWarnings[action]; ok {
+		return translate(language, key)
+	}
+	return translate(language, msgWarnChangeConfig)
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/sirupsen/logrus"
+
+	"vpn-commander/internal/tgfake"
+)
+
+const (
+	testUserID = 1001
+	testChatID = 2002
+)
+
+// newFakeTelegram starts a fake Bot API server for the test
+func newFakeTelegram(t *testing.T) *tgfake.Server {
+	t.Helper()
+
+	fake := tgfake.NewServer()
+	t.Cleanup(fake.Close)
+	return fake
+}
+
+// buttonData returns the callback data of the button labelled label in a call's inline keyboard
+func buttonData(t *testing.T, call tgfake.Call, label string) string {
+	t.Helper()
+
+	var markup tgbotapi.InlineKeyboardMarkup
+	if err := json.Unmarshal([]byte(call.Params["reply_markup"]), &markup); err != nil {
+		t.Fatalf("Failed to parse reply markup %q: %v", call.Params["reply_markup"], err)
+	}
+	for _, row := range markup.InlineKeyboard {
+		for _, button := range row {
+			if button.Text == label && button.CallbackData != nil {
+				return *button.CallbackData
+			}
+		}
+	}
+	t.Fatalf("Button %q not found in %s", label, call.Params["reply_markup"])
+	return ""
+}
+
+// waitForPanel waits until the chat's stored panel is (or, with current false, is no longer) the one
+// holding the Confirm button of call; the fake records a request before the bot stores the panel it rendered
+func waitForPanel(t *testing.T, tb *TelegramBot, call tgfake.Call, current bool) {
+	t.Helper()
+
+	_, nonce, _ := parseCallbackData(buttonData(t, call, "✅ Confirm"))
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if tb.isCurrentPanel(testChatID, call.MessageID, nonce) == current {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("Timed out waiting for the panel to change (current %v)", current)
+}
+
+// newTestTelegramBot creates a bot talking to fake with an authorized operator and an offline router
+func newTestTelegramBot(t *testing.T, fake *tgfake.Server) *TelegramBot {
+	t.Helper()
+
+	logger := logrus.New()
+	logger.SetLevel(logrus.FatalLevel)
+
+	api, err := fake.NewBotAPI("test-token")
+	if err != nil {
+		t.Fatalf("NewBotAPIWithClient failed: %v", err)
+	}
+
+	tb := newTelegramBot(api, api.Self, "", newOfflineVPNManager(t), logger)
+	tb.authorizeUser(testUserID, testChatID, RoleOperator, VPNStatusUnknown)
+	return tb
+}
+
+func messageUpdate(messageID int, text string) tgbotapi.Update {
+	return tgbotapi.Update{Message: &tgbotapi.Message{
+		MessageID: messageID,
+		From:      &tgbotapi.User{ID: testUserID, UserName: "tester"},
+		Chat:      &tgbotapi.Chat{ID: testChatID, Type: "private"},
+		Text:      text,
+	}}
+}
+
+func callbackUpdate(id string, messageID int, data string) tgbotapi.Update {
+	return tgbotapi.Update{CallbackQuery: &tgbotapi.CallbackQuery{
+		ID:   id,
+		From: &tgbotapi.User{ID: testUserID, UserName: "tester"},
+		Message: &tgbotapi.Message{
+			MessageID: messageID,
+			Chat:      &tgbotapi.Chat{ID: testChatID, Type: "private"},
+		},
+		Data: data,
+	}}
+}
+
+// promptForStop asks the bot to stop the service and returns the confirmation prompt
+func promptForStop(t *testing.T, fake *tgfake.Server, tb *TelegramBot) tgfake.Call {
+	t.Helper()
+
+	tb.handleUpdate(messageUpdate(1, CommandStopVPN))
+	prompt := fake.WaitFor(t, "sendMessage", "Confirm: Stop VPN")
+	waitForPanel(t, tb, prompt, true)
+	if _, ok := fake.Find("sendMessage", "Stopping VPN daemon"); ok {
+		t.Fatal("Service stop started before confirmation")
+	}
+	return prompt
+}
+
+func TestConfirmationConfirmRunsAction(t *testing.T) {
+	fake := newFakeTelegram(t)
+	tb := newTestTelegramBot(t, fake)
+	tb.SetConfirmation([]Action{ActionStopService}, time.Minute)
+
+	prompt := promptForStop(t, fake, tb)
+	tb.handleUpdate(callbackUpdate("cb-1", prompt.MessageID, buttonData(t, prompt, "✅ Confirm")))
+
+	fake.WaitFor(t, "answerCallbackQuery", "Confirmed")
+	fake.WaitFor(t, "editMessageText", "Stopping VPN daemon")
+	fake.WaitFor(t, "editMessageText", "Failed to stop service")
+}
+
+func TestConfirmationCancelSkipsAction(t *testing.T) {
+	fake := newFakeTelegram(t)
+	tb := newTestTelegramBot(t, fake)
+	tb.SetConfirmation([]Action{ActionStopService}, time.Minute)
+
+	prompt := promptForStop(t, fake, tb)
+	tb.handleUpdate(callbackUpdate("cb-1", prompt.MessageID, buttonData(t, prompt, CommandCancel)))
+
+	fake.WaitFor(t, "answerCallbackQuery", "Cancelled")
+	fake.WaitFor(t, "editMessageText", "Stop VPN cancelled")
+	waitForPanel(t, tb, prompt, false)
+	if _, ok := fake.Find("editMessageText", "Stopping VPN daemon"); ok {
+		t.Error("Service stop ran despite cancellation")
+	}
+
+	// The old Confirm button must not resurrect the cancelled action
+	tb.handleUpdate(callbackUpdate("cb-2", prompt.MessageID, buttonData(t, prompt, "✅ Confirm")))
+	fake.WaitFor(t, "answerCallbackQuery", "outdated")
+	if _, ok := fake.Find("editMessageText", "Stopping VPN daemon"); ok {
+		t.Error("Outdated Confirm button ran the action")
+	}
+}
+
+func TestConfirmationTimesOut(t *testing.T) {
+	fake := newFakeTelegram(t)
+	tb := newTestTelegramBot(t, fake)
+	tb.SetConfirmation([]Action{ActionStopService}, 100*time.Millisecond)
+
+	prompt := promptForStop(t, fake, tb)
+	fake.WaitFor(t, "editMessageText", fmt.Sprintf("Not confirmed within %s", 100*time.Millisecond))
+	waitForPanel(t, tb, prompt, false)
+
+	tb.handleUpdate(callbackUpdate("cb-1", prompt.MessageID, buttonData(t, prompt, "✅ Confirm")))
+	fake.WaitFor(t, "answerCallbackQuery", "outdated")
+	if _, ok := fake.Find("editMessageText", "Stopping VPN daemon"); ok {
+		t.Error("Service stop ran after the prompt timed out")
+	}
+}
+
+func TestUnconfirmedActionRunsImmediately(t *testing.T) {
+	fake := newFakeTelegram(t)
+	tb := newTestTelegramBot(t, fake)
+	tb.SetConfirmation([]Action{ActionStopService}, time.Minute)
+
+	tb.handleUpdate(messageUpdate(1, CommandStartVPN))
+	fake.WaitFor(t, "editMessageText", "Failed to start service")
+	if _, ok := fake.Find("sendMessage", "Confirm:"); ok {
+		t.Error("Start VPN asked for confirmation although it is not configured to")
+	}
+}
+
+func TestConfirmationOnlyByRequester(t *testing.T) {
+	fake := newFakeTelegram(t)
+	tb := newTestTelegramBot(t, fake)
+	tb.SetConfirmation([]Action{ActionStopService}, time.Minute)
+	const otherUserID = testUserID + 1
+	tb.authorizeUser(otherUserID, testChatID, RoleAdmin, VPNStatusUnknown)
+
+	prompt := promptForStop(t, fake, tb)
+	press := callbackUpdate("cb-1", prompt.MessageID, buttonData(t, prompt, "✅ Confirm"))
+	press.CallbackQuery.From = &tgbotapi.User{ID: otherUserID, UserName: "other"}
+	tb.handleUpdate(press)
+
+	fake.WaitFor(t, "answerCallbackQuery", "Only the user who asked can confirm this")
+	if _, ok := fake.Find("editMessageText", "Stopping VPN daemon"); ok {
+		t.Fatal("Another user's press ran the action")
+	}
+
+	// The prompt stays for the requester, whose role is checked again when they confirm
+	tb.authorizeUser(testUserID, testChatID, RoleViewer, VPNStatusUnknown)
+	tb.handleUpdate(callbackUpdate("cb-2", prompt.MessageID, buttonData(t, prompt, "✅ Confirm")))
+	fake.WaitFor(t, "answerCallbackQuery", "does not allow: Stop VPN")
+	fake.WaitFor(t, "editMessageText", "Stop VPN cancelled")
+	if _, ok := fake.Find("editMessageText", "Stopping VPN daemon"); ok {
+		t.Error("A demoted user's confirmation ran the action")
+	}
+}
+
+func TestConfirmationMismatchRedrawsPanel(t *testing.T) {
+	fake := newFakeTelegram(t)
+	tb := newTestTelegramBot(t, fake)
+	tb.SetConfirmation([]Action{ActionStopService}, time.Minute)
+
+	prompt := promptForStop(t, fake, tb)
+	_, nonce, _ := parseCallbackData(buttonData(t, prompt, "✅ Confirm"))
+	tb.handleUpdate(callbackUpdate("cb-1", prompt.MessageID,
+		encodeCallbackData(panelActionConfirm, nonce, string(ActionStartService))))
+
+	fake.WaitFor(t, "answerCallbackQuery", "nothing to confirm")
+	fake.WaitFor(t, "editMessageText", "Stop VPN cancelled")
+	waitForPanel(t, tb, prompt, false)
+	if _, ok := fake.Find("editMessageText", "Stopping VPN daemon"); ok {
+		t.Error("Service stop ran after a mismatched confirmation")
+	}
+}
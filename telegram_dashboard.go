@@ -0,0 +1,377 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/sirupsen/logrus"
+)
+
+// dashboardActionRefresh is the callback action of the dashboard refresh button
+const dashboardActionRefresh = "dash"
+
+// routerChange describes the most recent change of router state
+type routerChange struct {
+	at       time.Time
+	describe func(Language) string
+}
+
+// dashboardState is the router state shown on dashboards, read once and rendered per chat language
+type dashboardState struct {
+	outbound string // Empty if it could not be read
+	service  ServiceState
+	uptime   time.Duration
+	uptimeOK bool
+	change   routerChange
+	at       time.Time
+}
+
+// SetDashboard enables pinned dashboards, persisting their message IDs to path
+// A zero interval refreshes dashboards only after actions and on request
+func (tb *TelegramBot) SetDashboard(path string, interval time.Duration) error {
+	dashboards := make(map[int64]int)
+	if err := loadJSONFile(path, &dashboards); err != nil {
+		return fmt.Errorf("failed to load dashboards: %w", err)
+	}
+
+	tb.dashboardMutex.Lock()
+	tb.dashboards = dashboards
+	tb.dashboardPath = path
+	tb.dashboardInterval = interval
+	tb.dashboardMutex.Unlock()
+
+	tb.logger.WithFields(logrus.Fields{
+		"dashboards": len(dashboards),
+		"interval":   interval,
+	}).Info("Dashboards enabled")
+	return nil
+}
+
+// handleDashboard creates and pins the chat's dashboard, or removes it: /dashboard [off]
+func (tb *TelegramBot) handleDashboard(message *tgbotapi.Message) {
+	tb.deleteUserMessage(message.Chat.ID, message.MessageID)
+
+	if tb.dashboardPath == "" {
+		tb.sendMessage(tgbotapi.NewMessage(message.Chat.ID, translate(tb.userLanguage(message.From), msgDashboardNotEnabled)))
+		return
+	}
+
+	chatID := message.Chat.ID
+	language := tb.userLanguage(message.From)
+	tb.dashboardMutex.Lock()
+	oldMessageID, exists := tb.dashboards[chatID]
+	tb.dashboardMutex.Unlock()
+
+	if exists {
+		tb.unpinDashboard(chatID, oldMessageID)
+		if err := tb.setDashboard(chatID, 0); err != nil {
+			tb.logger.WithError(err).Error("Failed to remove dashboard")
+		}
+	}
+
+	if args := strings.Fields(message.Text); len(args) > 1 && strings.EqualFold(args[1], "off") {
+		tb.sendMessage(tgbotapi.NewMessage(chatID, translate(language, msgDashboardRemoved, CommandDashboard)))
+		return
+	}
+
+	state, err := tb.readDashboardState()
+	if err != nil {
+		tb.logger.WithError(err).Warn("Dashboard created with partial status")
+	}
+
+	msg := tgbotapi.NewMessage(chatID, tb.renderDashboard(language, state))
+	msg.ParseMode = "Markdown"
+	msg.ReplyMarkup = createDashboardKeyboard(language)
+	sent, err := tb.bot.Send(msg)
+	if err != nil {
+		tb.logger.WithError(err).Error("Failed to send dashboard")
+		return
+	}
+
+	pin := tgbotapi.PinChatMessageConfig{ChatID: chatID, MessageID: sent.MessageID, DisableNotification: true}
+	if _, err := tb.bot.Request(pin); err != nil {
+		tb.logger.WithError(err).Warn("Failed to pin dashboard")
+	}
+
+	if err := tb.setDashboard(chatID, sent.MessageID); err != nil {
+		tb.logger.WithError(err).Error("Failed to save dashboard")
+	}
+}
+
+// handleDashboardRefresh refreshes the dashboard a refresh button belongs to
+func (tb *TelegramBot) handleDashboardRefresh(in *interaction, messageID int) {
+	tb.dashboardMutex.Lock()
+	current, exists := tb.dashboards[in.chatID]
+	tb.dashboardMutex.Unlock()
+
+	if !exists || current != messageID {
+		tb.alert(in, tb.text(in, msgDashboardOutdated))
+		tb.removeInlineKeyboard(in.chatID, messageID)
+		return
+	}
+
+	tb.acknowledge(in, tb.text(in, msgDashboardRefreshing))
+	tb.refreshDashboards()
+}
+
+// runDashboardRefresher refreshes every dashboard on the configured interval
+func (tb *TelegramBot) runDashboardRefresher(ctx context.Context) {
+	if tb.dashboardPath == "" || tb.dashboardInterval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(tb.dashboardInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			tb.refreshDashboards()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// refreshDashboardsAsync refreshes dashboards without delaying the caller
+func (tb *TelegramBot) refreshDashboardsAsync() {
+	if tb.dashboardPath == "" {
+		return
+	}
+	go tb.refreshDashboards()
+}
+
+// refreshDashboards re-renders every dashboard from a single read of router state
+func (tb *TelegramBot) refreshDashboards() {
+	// Serialize refreshes so a slow router is not queried by several at once
+	tb.dashboardRefresh.Lock()
+	defer tb.dashboardRefresh.Unlock()
+
+	tb.dashboardMutex.Lock()
+	dashboards := make(map[int64]int, len(tb.dashboards))
+	for chatID, messageID := range tb.dashboards {
+		dashboards[chatID] = messageID
+	}
+	tb.dashboardMutex.Unlock()
+
+	// Dashboards of chats that lost access stay frozen until someone signs in again
+	for chatID := range dashboards {
+		if !tb.chatAuthorized(chatID) {
+			delete(dashboards, chatID)
+		}
+	}
+
+	if len(dashboards) == 0 {
+		return
+	}
+
+	state, err := tb.readDashboardState()
+	if err != nil {
+		tb.logger.WithError(err).Debug("Refreshing dashboards with partial status")
+	}
+
+	for chatID, messageID := range dashboards {
+		language := tb.chatLanguage(chatID)
+		edit := tgbotapi.NewEditMessageTextAndMarkup(chatID, messageID, tb.renderDashboard(language, state), createDashboardKeyboard(language))
+		edit.ParseMode = "Markdown"
+		_, err := tb.bot.Send(edit)
+		switch {
+		case err == nil || isMessageNotModified(err):
+		case strings.Contains(err.Error(), "message to edit not found"):
+			// The user deleted the dashboard; stop refreshing it
+			if err := tb.setDashboard(chatID, 0); err != nil {
+				tb.logger.WithError(err).Error("Failed to forget deleted dashboard")
+			}
+		default:
+			tb.logger.WithError(err).WithField("chat_id", chatID).Warn("Failed to refresh dashboard")
+		}
+	}
+}
+
+// setDashboard stores the dashboard message of a chat; zero removes it
+func (tb *TelegramBot) setDashboard(chatID int64, messageID int) error {
+	tb.dashboardMutex.Lock()
+	defer tb.dashboardMutex.Unlock()
+
+	if messageID == 0 {
+		delete(tb.dashboards, chatID)
+	} else {
+		tb.dashboards[chatID] = messageID
+	}
+	return saveJSONFile(tb.dashboardPath, tb.dashboards)
+}
+
+// unpinDashboard unpins and deletes a dashboard message
+func (tb *TelegramBot) unpinDashboard(chatID int64, messageID int) {
+	unpin := tgbotapi.UnpinChatMessageConfig{ChatID: chatID, MessageID: messageID}
+	if _, err := tb.bot.Request(unpin); err != nil {
+		tb.logger.WithError(err).Debug("Failed to unpin dashboard")
+	}
+	tb.deleteUserMessage(chatID, messageID)
+}
+
+// createDashboardKeyboard builds the dashboard's refresh button, labelled in language
+func createDashboardKeyboard(language Language) tgbotapi.InlineKeyboardMarkup {
+	return tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(translate(language, msgButtonRefresh), encodeCallbackData(dashboardActionRefresh, "")),
+		),
+	)
+}
+
+// recordExternalChange remembers which fields changed outside the bot for the dashboard
+func (tb *TelegramBot) recordExternalChange(at time.Time, fields []string) {
+	describe := func(language Language) string {
+		names := make([]string, 0, len(fields))
+		for _, field := range fields {
+			switch field {
+			case "routing":
+				names = append(names, translate(language, msgChangeFieldRouting))
+			case "service":
+				names = append(names, translate(language, msgChangeFieldService))
+			default:
+				names = append(names, field)
+			}
+		}
+		return translate(language, msgChangeExternal, strings.Join(names, translate(language, msgChangeFieldsJoin)))
+	}
+
+	tb.dashboardMutex.Lock()
+	defer tb.dashboardMutex.Unlock()
+	tb.lastExternalChange = routerChange{at: at, describe: describe}
+}
+
+// lastRouterChange returns the newest of the last audited action and the last external change
+func (tb *TelegramBot) lastRouterChange() (routerChange, bool) {
+	tb.dashboardMutex.Lock()
+	change := tb.lastExternalChange
+	tb.dashboardMutex.Unlock()
+
+	if entry, ok := tb.auditLog.Last(); ok && entry.Time.After(change.at) {
+		who := entry.Source
+		if entry.Username != "" {
+			who = "`@" + entry.Username + "`" // Usernames may contain underscores
+		} else if entry.UserID != 0 {
+			who = fmt.Sprintf("%d", entry.UserID)
+		}
+		describe := func(language Language) string {
+			description := translate(language, msgChangeBy, describeAction(language, entry.Action), who)
+			if entry.Outcome == AuditOutcomeFailure {
+				description = translate(language, msgChangeFailed, description)
+			}
+			return description
+		}
+		change = routerChange{at: entry.Time, describe: describe}
+	}
+
+	return change, !change.at.IsZero()
+}
+
+// readDashboardState reads the router state the dashboards show
+// The state is always usable; err reports the first router query that failed
+func (tb *TelegramBot) readDashboardState() (dashboardState, error) {
+	var firstErr error
+	state := dashboardState{service: ServiceStateUnknown, at: time.Now()}
+
+	outbound, err := tb.vpnManager.GetActiveOutbound()
+	if err != nil {
+		tb.logger.WithError(err).Warn("Failed to get routing status for combined display")
+		firstErr = err
+	} else {
+		state.outbound = outbound
+	}
+
+	serviceState, err := tb.vpnManager.GetServiceState()
+	if err != nil {
+		tb.logger.WithError(err).Warn("Failed to get service status for combined display")
+		if firstErr == nil {
+			firstErr = err
+		}
+	} else {
+		state.service = serviceState
+	}
+
+	uptime, err := tb.vpnManager.GetRouterUptime()
+	if err != nil {
+		tb.logger.WithError(err).Debug("Failed to get router uptime for combined display")
+		if firstErr == nil {
+			firstErr = err
+		}
+	} else {
+		state.uptime, state.uptimeOK = uptime, true
+	}
+
+	state.change, _ = tb.lastRouterChange()
+	return state, firstErr
+}
+
+// renderDashboard renders the dashboard showing routing, service, outbound, uptime and last change in language
+func (tb *TelegramBot) renderDashboard(language Language, state dashboardState) string {
+	routingLine := translate(language, msgDashRoutingUnknown)
+	outboundLine := translate(language, msgDashOutboundUnknown)
+	if state.outbound != "" {
+		switch statusForOutbound(state.outbound) {
+		case VPNStatusEnabled:
+			routingLine = translate(language, msgDashRoutingVPN)
+		case VPNStatusDisabled:
+			routingLine = translate(language, msgDashRoutingDirect)
+		}
+		// Code spans keep Markdown from interpreting underscores in tags
+		outboundLine = translate(language, msgDashOutbound, state.outbound)
+	}
+
+	serviceLine := translate(language, msgDashServiceUnknown)
+	switch state.service {
+	case ServiceStateRunning:
+		serviceLine = translate(language, msgDashServiceRunning)
+	case ServiceStateStopped:
+		serviceLine = translate(language, msgDashServiceStopped)
+	}
+
+	uptimeLine := translate(language, msgDashUptimeUnknown)
+	if state.uptimeOK {
+		uptimeLine = translate(language, msgDashUptime, formatDuration(language, state.uptime))
+	}
+
+	changeLine := translate(language, msgDashNoChange)
+	if !state.change.at.IsZero() {
+		changeLine = translate(language, msgDashChange, state.change.describe(language), state.change.at.Local().Format(translate(language, msgLayoutDate)))
+	}
+
+	lines := []string{
+		translate(language, msgDashboardTitle),
+		"",
+		routingLine,
+		serviceLine,
+		outboundLine,
+		uptimeLine,
+		changeLine,
+	}
+	if revertLine := tb.revertStatusLine(language); revertLine != "" {
+		lines = append(lines, revertLine)
+	}
+	if failoverLine := tb.failoverStatusLine(language); failoverLine != "" {
+		lines = append(lines, failoverLine)
+	}
+	lines = append(lines, "", translate(language, msgDashUpdated, state.at.Format("15:04:05")))
+	return strings.Join(lines, "\n")
+}
+
+// formatDuration renders a duration as days, hours and minutes in language
+func formatDuration(language Language, d time.Duration) string {
+	days := int(d / (24 * time.Hour))
+	hours := int(d % (24 * time.Hour) / time.Hour)
+	minutes := int(d % time.Hour / time.Minute)
+
+	switch {
+	case days > 0:
+		return translate(language, msgDurationDays, days, hours, minutes)
+	case hours > 0:
+		return translate(language, msgDurationHours, hours, minutes)
+	default:
+		return translate(language, msgDurationMinutes, minutes)
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseUptime(t *testing.T) {
+	tests := []struct {
+		output  string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"350735.47 234388.90\n", 350735*time.Second + 470*time.Millisecond, false},
+		{"12.00 3.00", 12 * time.Second, false},
+		{"", 0, true},
+		{"abc 1.0", 0, true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseUptime(tt.output)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseUptime(%q) error = %v, wantErr %v", tt.output, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && got.Round(time.Millisecond) != tt.want {
+			t.Errorf("parseUptime(%q) = %v, want %v", tt.output, got, tt.want)
+		}
+	}
+}
+
+func TestFormatDuration(t *testing.T) {
+	tests := []struct {
+		uptime time.Duration
+		want   string
+	}{
+		{42 * time.Second, "0m"},
+		{5*time.Hour + 7*time.Minute, "5h 7m"},
+		{3*24*time.Hour + 4*time.Hour + 12*time.Minute, "3d 4h 12m"},
+	}
+
+	for _, tt := range tests {
+		if got := formatDuration(LanguageEnglish, tt.uptime); got != tt.want {
+			t.Errorf("formatDuration(%v) = %q, want %q", tt.uptime, got, tt.want)
+		}
+	}
+}
+
+func TestDashboardRefreshNeedsSession(t *testing.T) {
+	fake := newFakeTelegram(t)
+	tb := newTestTelegramBot(t, fake)
+	if err := tb.SetDashboard(filepath.Join(t.TempDir(), "dashboards.json"), 0); err != nil {
+		t.Fatalf("SetDashboard failed: %v", err)
+	}
+
+	tb.handleUpdate(messageUpdate(1, CommandDashboard))
+	dashboard := fake.WaitFor(t, "sendMessage", "VPN Commander Dashboard")
+
+	tb.refreshDashboards()
+	if calls := countCalls(fake, "editMessageText", "VPN Commander Dashboard"); calls != 1 {
+		t.Fatalf("Expected the dashboard to be refreshed once, got %d", calls)
+	}
+
+	// Signed out chats keep their dashboard, but it is not refreshed any more
+	tb.handleUpdate(messageUpdate(2, CommandLogout))
+	tb.refreshDashboards()
+	if calls := countCalls(fake, "editMessageText", "VPN Commander Dashboard"); calls != 1 {
+		t.Errorf("Expected no refresh without a session, got %d refreshes", calls)
+	}
+	tb.dashboardMutex.Lock()
+	messageID := tb.dashboards[testChatID]
+	tb.dashboardMutex.Unlock()
+	if messageID != dashboard.MessageID {
+		t.Errorf("Expected the dashboard to be kept, got message %d", messageID)
+	}
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/sirupsen/logrus"
+
+	"vpn-commander/internal/tgfake"
+)
+
+const e2eAuthCode = "letmein"
+
+var e2eUser = tgbotapi.User{ID: testUserID, UserName: "tester", LanguageCode: "en"}
+
+// startE2EBot runs a bot polling a fake Telegram, with an offline router and no users authorized yet
+func startE2EBot(t *testing.T) (*tgfake.Server, *TelegramBot) {
+	t.Helper()
+	return startE2EBotWith(t, nil)
+}
+
+// startE2EBotWith is startE2EBot with setup applied to the bot before it starts
+func startE2EBotWith(t *testing.T, setup func(tb *TelegramBot)) (*tgfake.Server, *TelegramBot) {
+	t.Helper()
+
+	fake := newFakeTelegram(t)
+	api, err := fake.NewBotAPI("test-token")
+	if err != nil {
+		t.Fatalf("NewBotAPI failed: %v", err)
+	}
+	logger := logrus.New()
+	logger.SetLevel(logrus.FatalLevel)
+	tb := newTelegramBot(api, api.Self, e2eAuthCode, newOfflineVPNManager(t), logger)
+	if setup != nil {
+		setup(tb)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		if err := tb.Start(ctx); err != nil {
+			t.Errorf("Start failed: %v", err)
+		}
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-stopped
+	})
+	return fake, tb
+}
+
+// botMessages returns the bot's messages among messages
+func botMessages(messages []tgfake.Message) []tgfake.Message {
+	var fromBot []tgfake.Message
+	for _, message := range messages {
+		if message.FromBot {
+			fromBot = append(fromBot, message)
+		}
+	}
+	return fromBot
+}
+
+// showsOnly reports whether the chat shows a single message, from the bot, containing text
+func showsOnly(text string) func([]tgfake.Message) bool {
+	return func(messages []tgfake.Message) bool {
+		return len(messages) == 1 && messages[0].FromBot && strings.Contains(messages[0].Text, text)
+	}
+}
+
+// pressButton taps the button labelled label on a panel message
+func pressButton(t *testing.T, fake *tgfake.Server, panel tgfake.Message, label string) {
+	t.Helper()
+	data := buttonData(t, tgfake.Call{Params: map[string]string{"reply_markup": panel.ReplyMarkup}}, label)
+	fake.InjectCallback(testChatID, e2eUser, panel.ID, data)
+}
+
+func TestE2EAuth(t *testing.T) {
+	fake, tb := startE2EBot(t)
+
+	fake.InjectMessage(testChatID, e2eUser, CommandStatus)
+	fake.WaitFor(t, "sendMessage", "Unauthorized access")
+
+	fake.InjectMessage(testChatID, e2eUser, CommandAuth+" wrong")
+	fake.WaitFor(t, "sendMessage", "Invalid authentication code")
+	if tb.isUserAuthorized(testUserID) {
+		t.Fatal("A wrong code authorized the user")
+	}
+
+	fake.InjectMessage(testChatID, e2eUser, CommandAuth+" "+e2eAuthCode)
+	messages := fake.WaitForChat(t, testChatID, func(messages []tgfake.Message) bool {
+		bot := botMessages(messages)
+		return len(bot) > 0 && strings.Contains(bot[len(bot)-1].Text, "Authentication successful")
+	})
+	panel := botMessages(messages)
+	if text := panel[len(panel)-1].Text; !strings.Contains(text, "Current routing: UNKNOWN") || !strings.Contains(text, "Role: admin") {
+		t.Errorf("Unexpected greeting %q", text)
+	}
+	if panel[len(panel)-1].ReplyMarkup == "" {
+		t.Error("Expected the greeting to carry the control panel")
+	}
+	if role, ok := tb.getUserRole(testUserID); !ok || role != RoleAdmin {
+		t.Errorf("Expected the user to be an admin, got %v %v", role, ok)
+	}
+}
+
+func TestE2EStatus(t *testing.T) {
+	t.Run("router offline", func(t *testing.T) {
+		fake, tb := startE2EBot(t)
+		tb.authorizeUser(testUserID, testChatID, RoleOperator, VPNStatusUnknown)
+
+		fake.InjectMessage(testChatID, e2eUser, CommandStatus)
+		fake.WaitForChat(t, testChatID, showsOnly("Status check failed"))
+	})
+
+	t.Run("cached status", func(t *testing.T) {
+		fake, tb := startE2EBot(t)
+		tb.authorizeUser(testUserID, testChatID, RoleOperator, VPNStatusEnabled)
+
+		fake.InjectMessage(testChatID, e2eUser, CommandStatus)
+		fake.WaitForChat(t, testChatID, showsOnly("VPN ROUTING ACTIVE"))
+		fake.WaitFor(t, "sendMessage", "Checking traffic routing status")
+	})
+}
+
+func TestE2EEnableVPN(t *testing.T) {
+	fake, tb := startE2EBot(t)
+	tb.authorizeUser(testUserID, testChatID, RoleOperator, VPNStatusDisabled)
+
+	fake.InjectMessage(testChatID, e2eUser, CommandPanel)
+	panel := fake.WaitForChat(t, testChatID, showsOnly("VPN Commander"))[0]
+
+	pressButton(t, fake, panel, CommandEnableVPN)
+	result := fake.WaitForChat(t, testChatID, showsOnly("Failed to enable VPN"))[0]
+	if result.ID != panel.ID {
+		t.Errorf("Expected the panel to be edited in place, got message %d instead of %d", result.ID, panel.ID)
+	}
+	fake.WaitFor(t, "answerCallbackQuery", "Switching to VPN")
+	fake.WaitFor(t, "editMessageText", "Switching traffic to VPN")
+	if status := tb.getCachedStatus(testUserID); status != VPNStatusDisabled {
+		t.Errorf("A failed switch must keep the cached status, got %s", status)
+	}
+
+	// Viewers may look but not switch
+	tb.authorizeUser(testUserID, testChatID, RoleViewer, VPNStatusDisabled)
+	pressButton(t, fake, result, CommandEnableVPN)
+	fake.WaitFor(t, "answerCallbackQuery", "does not allow: Route via VPN")
+	if calls := countCalls(fake, "editMessageText", "Switching traffic to VPN"); calls != 1 {
+		t.Errorf("Expected a viewer's press to be refused, got %d switch attempts", calls)
+	}
+}
+
+func TestE2EMessageReplacement(t *testing.T) {
+	fake, tb := startE2EBot(t)
+	tb.authorizeUser(testUserID, testChatID, RoleOperator, VPNStatusEnabled)
+
+	// The typed command is cleaned up and answered with a panel
+	fake.InjectMessage(testChatID, e2eUser, CommandPanel)
+	first := fake.WaitForChat(t, testChatID, showsOnly("VPN Commander"))[0]
+
+	// Typing again moves the panel to the bottom instead of stacking a second one
+	fake.InjectMessage(testChatID, e2eUser, CommandStatus)
+	second := fake.WaitForChat(t, testChatID, showsOnly("VPN ROUTING ACTIVE"))[0]
+	if second.ID <= first.ID {
+		t.Errorf("Expected a new panel below the old one, got %d after %d", second.ID, first.ID)
+	}
+
+	// Buttons edit the panel in place
+	pressButton(t, fake, second, CommandServiceStatus)
+	third := fake.WaitForChat(t, testChatID, func(messages []tgfake.Message) bool {
+		return len(messages) == 1 && !strings.Contains(messages[0].Text, "VPN ROUTING ACTIVE") && messages[0].ReplyMarkup != ""
+	})[0]
+	if third.ID != second.ID {
+		t.Errorf("Expected the panel to be edited in place, got message %d instead of %d", third.ID, second.ID)
+	}
+
+	// A panel that can no longer be edited is replaced by a new one
+	fake.Delete(testChatID, third.ID)
+	pressButton(t, fake, third, CommandStatus)
+	fourth := fake.WaitForChat(t, testChatID, showsOnly("VPN ROUTING ACTIVE"))[0]
+	if fourth.ID == third.ID {
+		t.Error("Expected a new panel after the old one was deleted")
+	}
+}
+
+func TestE2EInviteGrant(t *testing.T) {
+	fake, tb := startE2EBotWith(t, func(tb *TelegramBot) {
+		tb.SetInviteManager(newTestInviteManager(t))
+		grants, err := NewGrantStore(filepath.Join(t.TempDir(), "grants.json"))
+		if err != nil {
+			t.Fatalf("NewGrantStore failed: %v", err)
+		}
+		tb.SetGrantStore(grants)
+	})
+	tb.authorizeUser(testUserID, testChatID, RoleAdmin, VPNStatusUnknown)
+	invitee := tgbotapi.User{ID: 3003, UserName: "invitee", LanguageCode: "en"}
+
+	invite, token, err := tb.inviteManager.Create(RoleViewer, time.Hour, testUserID)
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	fake.InjectMessage(invitee.ID, invitee, CommandStart+" "+token)
+	fake.WaitFor(t, "sendMessage", "Role: viewer")
+	if grant, ok := tb.grants.Get(invitee.ID); !ok || grant.Role != RoleViewer || grant.GrantedBy != testUserID {
+		t.Fatalf("Expected the viewer grant to be persisted, got %+v %v", grant, ok)
+	}
+
+	// After a restart the invitee signs in again with plain /start
+	tb.userMutex.Lock()
+	delete(tb.authorizedUsers, invitee.ID)
+	tb.userMutex.Unlock()
+	fake.InjectMessage(invitee.ID, invitee, CommandStart)
+	waitForCalls(t, fake, "sendMessage", "Role: viewer", 2)
+
+	// A newer invite replaces the grant; revoking the old one leaves it alone
+	newer, token, err := tb.inviteManager.Create(RoleOperator, time.Hour, testUserID)
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	fake.InjectMessage(invitee.ID, invitee, CommandStart+" "+token)
+	fake.WaitFor(t, "sendMessage", "Role: operator")
+	fake.InjectMessage(testChatID, e2eUser, CommandRevoke+" "+invite.ID)
+	fake.WaitFor(t, "sendMessage", "the newer grant was kept")
+	if grant, ok := tb.grants.Get(invitee.ID); !ok || grant.InviteID != newer.ID {
+		t.Fatalf("Expected the newer grant to be kept, got %+v %v", grant, ok)
+	}
+	if !tb.isUserAuthorized(invitee.ID) {
+		t.Fatal("Expected the invitee to stay signed in")
+	}
+
+	// Revoking the used invite withdraws the grant and ends the session
+	fake.InjectMessage(testChatID, e2eUser, CommandRevoke+" "+newer.ID)
+	fake.WaitFor(t, "sendMessage", "revoked for user 3003")
+	fake.WaitFor(t, "sendMessage", "Access revoked")
+	if tb.isUserAuthorized(invitee.ID) {
+		t.Error("Expected the invitee's session to end")
+	}
+	if _, ok := tb.grants.Get(invitee.ID); ok {
+		t.Error("Expected the grant to be deleted")
+	}
+	fake.InjectMessage(invitee.ID, invitee, CommandStart)
+	fake.WaitFor(t, "sendMessage", "VPN Commander Bot")
+	if tb.isUserAuthorized(invitee.ID) {
+		t.Error("A revoked user must not sign in with /start")
+	}
+}
+
+// waitForCalls polls until n calls of method contain substring
+func waitForCalls(t *testing.T, fake *tgfake.Server, method, substring string, n int) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for countCalls(fake, method, substring) < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %d %s calls containing %q", n, method, substring)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// countCalls counts the calls of method whose text contains substring
+func countCalls(fake *tgfake.Server, method, substring string) int {
+	count := 0
+	for _, call := range fake.Calls() {
+		if call.Method == method && strings.Contains(call.Params["text"], substring) {
+			count++
+		}
+	}
+	return count
+}
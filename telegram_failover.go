@@ -0,0 +1,42 @@
+package main
+
+import "strings"
+
+// SetHealthProber enables failover notifications and the dashboard failover line
+func (tb *TelegramBot) SetHealthProber(prober *HealthProber) {
+	tb.prober = prober
+	prober.SetNotifier(tb.NotifyFailover)
+}
+
+// NotifyFailover tells subscribers that the prober switched routing, or failed to
+func (tb *TelegramBot) NotifyFailover(event FailoverEvent) {
+	if event.Err == nil {
+		tb.updateAllCachedStatuses(statusForOutbound(event.To))
+	}
+	tb.broadcast(func(language Language) string {
+		switch {
+		case event.Err != nil:
+			return translate(language, msgFailoverFailed, describeAction(language, event.Action), event.From, event.To)
+		case event.Action == ActionFailover:
+			return translate(language, msgFailoverDown, event.Failures, codeSpan(event.LastErr), event.From, event.To)
+		default:
+			return translate(language, msgFailoverRecovered, event.From, event.To)
+		}
+	})
+	tb.refreshDashboardsAsync()
+}
+
+// codeSpan makes text safe to show between backticks in a Markdown message; probe errors quote
+// arbitrary output, and a stray backtick would make Telegram reject the whole notification
+func codeSpan(text string) string {
+	return strings.ReplaceAll(text, "`", "'")
+}
+
+// failoverStatusLine describes an active failover in language, or "" if routing is not failed over
+func (tb *TelegramBot) failoverStatusLine(language Language) string {
+	state := tb.prober.Status()
+	if !state.Active {
+		return ""
+	}
+	return translate(language, msgFailoverStatus, state.Since.Local().Format("15:04"))
+}
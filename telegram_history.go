@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// History listing limits
+const (
+	defaultHistoryLimit = 10
+	maxHistoryLimit     = 50
+)
+
+// SetAuditLog enables the /history command
+func (tb *TelegramBot) SetAuditLog(auditLog *AuditLog) {
+	tb.auditLog = auditLog
+}
+
+// handleHistory shows the last N router-changing actions: /history [N]
+func (tb *TelegramBot) handleHistory(message *tgbotapi.Message) {
+	tb.deleteUserMessage(message.Chat.ID, message.MessageID)
+
+	language := tb.userLanguage(message.From)
+	limit := defaultHistoryLimit
+	if args := strings.Fields(message.Text); len(args) > 1 {
+		parsed, err := strconv.Atoi(args[1])
+		if err != nil || parsed <= 0 {
+			tb.sendMessage(tgbotapi.NewMessage(message.Chat.ID, translate(language, msgHistoryUsage, CommandHistory)))
+			return
+		}
+		limit = parsed
+	}
+	if limit > maxHistoryLimit {
+		limit = maxHistoryLimit
+	}
+
+	entries, err := tb.auditLog.Recent(limit)
+	if err != nil {
+		tb.logger.WithError(err).Error("Failed to read audit history")
+		tb.sendMessage(tgbotapi.NewMessage(message.Chat.ID, translate(language, msgHistoryUnavailable)))
+		return
+	}
+	if len(entries) == 0 {
+		tb.sendMessage(tgbotapi.NewMessage(message.Chat.ID, translate(language, msgHistoryEmpty)))
+		return
+	}
+
+	var lines []string
+	for _, entry := range entries {
+		lines = append(lines, formatAuditEntry(language, entry))
+	}
+
+	// Plain text on purpose: usernames and errors may contain Markdown control characters
+	tb.sendMessage(tgbotapi.NewMessage(message.Chat.ID, translate(language, msgHistoryTitle, len(entries), strings.Join(lines, "\n"))))
+}
+
+// formatAuditEntry renders an audit entry as a single chat line in language
+func formatAuditEntry(language Language, entry AuditEntry) string {
+	icon := "✅"
+	if entry.Outcome != AuditOutcomeSuccess {
+		icon = "❌"
+	}
+
+	who := entry.Source
+	switch {
+	case entry.Username != "":
+		who = "@" + entry.Username
+	case entry.UserID != 0:
+		who = strconv.FormatInt(entry.UserID, 10)
+	}
+
+	line := fmt.Sprintf("%s %s • %s • %s", icon, entry.Time.Local().Format(translate(language, msgLayoutHistory)), who, describeAction(language, entry.Action))
+	if entry.Before != "" || entry.After != "" {
+		line += fmt.Sprintf(" • %s → %s", entry.Before, entry.After)
+	}
+	return line
+}
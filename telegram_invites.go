@@ -0,0 +1,245 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/sirupsen/logrus"
+)
+
+// Invite limits
+const (
+	defaultInviteTTL = 24 * time.Hour
+	maxInviteTTL     = 30 * 24 * time.Hour
+	inviteListLimit  = 10
+)
+
+// SetInviteManager enables one-time invite links
+func (tb *TelegramBot) SetInviteManager(manager *InviteManager) {
+	tb.inviteManager = manager
+	tb.logger.Info("Invite links enabled")
+}
+
+// SetGrantStore persists the roles granted by invites across logouts and restarts
+func (tb *TelegramBot) SetGrantStore(store *GrantStore) {
+	tb.grants = store
+}
+
+// roleGrant returns the persisted role grant of a user
+func (tb *TelegramBot) roleGrant(userID int64) (RoleGrant, bool) {
+	if tb.grants == nil {
+		return RoleGrant{}, false
+	}
+	return tb.grants.Get(userID)
+}
+
+// SetAdminUsers configures Telegram user IDs that are authorized as admins on /start
+func (tb *TelegramBot) SetAdminUsers(userIDs []int64) {
+	for _, userID := range userIDs {
+		tb.adminUsers[userID] = true
+	}
+}
+
+// SetAuthCodeRole sets the role granted to users authenticating with the shared auth code
+func (tb *TelegramBot) SetAuthCodeRole(role Role) {
+	tb.authCodeRole = role
+}
+
+// handleInviteRedemption authorizes the sender using an invite token from a deep link
+func (tb *TelegramBot) handleInviteRedemption(message *tgbotapi.Message, token string) {
+	if tb.inviteManager == nil {
+		tb.sendMessage(tgbotapi.NewMessage(message.Chat.ID, translate(tb.senderLanguage(message.From), msgInvitesNotEnabled)))
+		return
+	}
+
+	invite, err := tb.inviteManager.Redeem(token, message.From.ID)
+	if err != nil {
+		key := msgInviteInvalid
+		switch {
+		case errors.Is(err, errInviteExpired):
+			key = msgInviteExpired
+		case errors.Is(err, errInviteUsed):
+			key = msgInviteUsed
+		case errors.Is(err, errInviteRevoked):
+			key = msgInviteRevoked
+		}
+		tb.sendMessage(tgbotapi.NewMessage(message.Chat.ID, translate(tb.senderLanguage(message.From), key)))
+		tb.metrics.IncAuthFailure("invite")
+		return
+	}
+
+	if tb.grants != nil {
+		if err := tb.grants.Grant(message.From.ID, invite.Role, invite.CreatedBy, invite.ID); err != nil {
+			// The session still works, the user just has to be invited again after it ends
+			tb.logger.WithError(err).WithField("user_id", message.From.ID).Error("Failed to persist role grant")
+		}
+	}
+	tb.completeAuthorization(message, invite.Role)
+}
+
+// handleInvite creates a single-use invite link: /invite [role] [ttl]
+func (tb *TelegramBot) handleInvite(message *tgbotapi.Message) {
+	if !tb.requireAdmin(message) {
+		return
+	}
+
+	language := tb.userLanguage(message.From)
+	args := strings.Fields(message.Text)
+	role := RoleOperator
+	if len(args) > 1 {
+		parsed, err := parseRole(strings.ToLower(args[1]))
+		if err != nil {
+			tb.sendMessage(tgbotapi.NewMessage(message.Chat.ID, translate(language, msgInviteUsage, args[1], CommandInvite)))
+			return
+		}
+		role = parsed
+	}
+
+	ttl := defaultInviteTTL
+	if len(args) > 2 {
+		parsed, err := time.ParseDuration(args[2])
+		if err != nil || parsed <= 0 || parsed > maxInviteTTL {
+			tb.sendMessage(tgbotapi.NewMessage(message.Chat.ID, translate(language, msgInviteTTLInvalid, maxInviteTTL)))
+			return
+		}
+		ttl = parsed
+	}
+
+	invite, token, err := tb.inviteManager.Create(role, ttl, message.From.ID)
+	if err != nil {
+		tb.logger.WithError(err).Error("Failed to create invite")
+		tb.sendMessage(tgbotapi.NewMessage(message.Chat.ID, translate(language, msgInviteCreateFailed)))
+		return
+	}
+
+	link := fmt.Sprintf("https://t.me/%s?start=%s", tb.self.UserName, token)
+	text := translate(language, msgInviteCreated,
+		invite.Role, invite.ExpiresAt.Format("2006-01-02 15:04"), invite.ID, link, CommandRevoke, invite.ID)
+
+	// Plain text on purpose: tokens may contain Markdown control characters
+	tb.sendMessage(tgbotapi.NewMessage(message.Chat.ID, text))
+}
+
+// inviteStates names the states Invite.State reports
+var inviteStates = map[string]messageKey{
+	"active":  msgInviteStateActive,
+	"used":    msgInviteStateUsed,
+	"revoked": msgInviteStateRevoked,
+	"expired": msgInviteStateExpired,
+}
+
+// handleInvites lists recent invites and their state
+func (tb *TelegramBot) handleInvites(message *tgbotapi.Message) {
+	if !tb.requireAdmin(message) {
+		return
+	}
+
+	language := tb.userLanguage(message.From)
+	invites := tb.inviteManager.List(inviteListLimit)
+	if len(invites) == 0 {
+		tb.sendMessage(tgbotapi.NewMessage(message.Chat.ID, translate(language, msgInvitesEmpty)))
+		return
+	}
+
+	now := time.Now()
+	var lines []string
+	for _, invite := range invites {
+		line := translate(language, msgInviteLine, invite.ID, invite.Role, translate(language, inviteStates[invite.State(now)]), invite.CreatedBy)
+		if invite.UsedBy != 0 {
+			line += fmt.Sprintf(" → %d", invite.UsedBy)
+		}
+		lines = append(lines, line)
+	}
+
+	tb.sendMessage(tgbotapi.NewMessage(message.Chat.ID, translate(language, msgInvitesRecent, strings.Join(lines, "\n"))))
+}
+
+// handleRevoke revokes an invite: /revoke ID
+// An unused invite can no longer be redeemed; for a used one the role it granted is withdrawn
+func (tb *TelegramBot) handleRevoke(message *tgbotapi.Message) {
+	if !tb.requireAdmin(message) {
+		return
+	}
+
+	language := tb.userLanguage(message.From)
+	args := strings.Fields(message.Text)
+	if len(args) != 2 {
+		tb.sendMessage(tgbotapi.NewMessage(message.Chat.ID, translate(language, msgRevokeUsage, CommandRevoke)))
+		return
+	}
+
+	if invite, ok := tb.inviteManager.Get(args[1]); ok && invite.UsedBy != 0 {
+		tb.revokeGrant(message, invite)
+		return
+	}
+
+	if err := tb.inviteManager.Revoke(args[1], message.From.ID); err != nil {
+		text := translate(language, msgRevokeFailed)
+		switch {
+		case errors.Is(err, errInviteInvalid):
+			text = translate(language, msgRevokeUnknown, args[1])
+		case errors.Is(err, errInviteInactive):
+			invite, _ := tb.inviteManager.Get(args[1])
+			text = translate(language, msgRevokeInactive, args[1], translate(language, inviteStates[invite.State(time.Now())]))
+		default:
+			tb.logger.WithError(err).Error("Failed to revoke invite")
+		}
+		tb.sendMessage(tgbotapi.NewMessage(message.Chat.ID, text))
+		return
+	}
+
+	tb.sendMessage(tgbotapi.NewMessage(message.Chat.ID, translate(language, msgRevokeDone, args[1])))
+}
+
+// revokeGrant withdraws the role a used invite granted and ends the user's session
+func (tb *TelegramBot) revokeGrant(message *tgbotapi.Message, invite Invite) {
+	if tb.grants != nil {
+		err := tb.grants.RevokeInvite(invite.UsedBy, invite.ID)
+		if errors.Is(err, errGrantReplaced) {
+			// A newer invite or grant gave the user their current role; leave it and the session alone
+			tb.sendMessage(tgbotapi.NewMessage(message.Chat.ID, translate(tb.userLanguage(message.From), msgGrantReplaced, invite.ID, invite.UsedBy)))
+			return
+		}
+		if err != nil && !errors.Is(err, errGrantNotFound) {
+			tb.logger.WithError(err).Error("Failed to revoke role grant")
+			tb.sendMessage(tgbotapi.NewMessage(message.Chat.ID, translate(tb.userLanguage(message.From), msgGrantRevokeFailed)))
+			return
+		}
+	}
+
+	tb.userMutex.Lock()
+	user, exists := tb.authorizedUsers[invite.UsedBy]
+	delete(tb.authorizedUsers, invite.UsedBy)
+	tb.userMutex.Unlock()
+	if exists {
+		tb.notifySessionEnded(invite.UsedBy, user.chatID, "revoked")
+	}
+
+	tb.logger.WithFields(logrus.Fields{
+		"invite_id":  invite.ID,
+		"user_id":    invite.UsedBy,
+		"revoked_by": message.From.ID,
+	}).Info("Role grant revoked")
+	tb.sendMessage(tgbotapi.NewMessage(message.Chat.ID, translate(tb.userLanguage(message.From), msgGrantRevoked, invite.ID, invite.UsedBy)))
+}
+
+// requireAdmin checks that invites are enabled and the sender is an admin
+func (tb *TelegramBot) requireAdmin(message *tgbotapi.Message) bool {
+	if tb.inviteManager == nil {
+		tb.sendMessage(tgbotapi.NewMessage(message.Chat.ID, translate(tb.userLanguage(message.From), msgInvitesNotEnabled)))
+		return false
+	}
+
+	if role, _ := tb.getUserRole(message.From.ID); !role.CanAdminister() {
+		tb.logger.WithFields(logrus.Fields{
+			"user_id": message.From.ID,
+			"role":    role,
+		}).Warn("Non-admin attempted invite management")
+		tb.sendMessage(tgbotapi.NewMessage(message.Chat.ID, translate(tb.userLanguage(message.From), msgInvitesAdminOnly)))
+		return false
+	}
+	return true
+}
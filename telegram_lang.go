@@ -0,0 +1,107 @@
+package main
+
+import (
+	"sort"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// SetLanguageStore persists the languages users choose with /lang
+func (tb *TelegramBot) SetLanguageStore(store *LanguageStore) {
+	tb.languages = store
+}
+
+// userLanguage returns the language to answer a user in, given the language code of their latest update
+func (tb *TelegramBot) userLanguage(user *tgbotapi.User) Language {
+	if user == nil {
+		return defaultLanguage
+	}
+	return tb.languages.Resolve(user.ID, user.LanguageCode)
+}
+
+// senderLanguage returns the language to answer a user who is not signed in, without remembering it
+// so that strangers cannot grow the language store
+func (tb *TelegramBot) senderLanguage(user *tgbotapi.User) Language {
+	if user == nil {
+		return defaultLanguage
+	}
+	return tb.languages.Lookup(user.ID, user.LanguageCode)
+}
+
+// chatLanguage returns the language of a chat when no update is at hand: that of a user signed in
+// to it, or else that of the private chat's user, whose ID is the chat's
+func (tb *TelegramBot) chatLanguage(chatID int64) Language {
+	userID := chatID
+	tb.userMutex.RLock()
+	for id, user := range tb.authorizedUsers {
+		if user.chatID == chatID {
+			userID = id
+			break
+		}
+	}
+	tb.userMutex.RUnlock()
+	return tb.languages.Language(userID)
+}
+
+// language returns the language of the interaction's user
+func (tb *TelegramBot) language(in *interaction) Language {
+	return tb.languages.Resolve(in.userID, in.languageCode)
+}
+
+// text returns the message for key in the language of the interaction's user
+func (tb *TelegramBot) text(in *interaction, key messageKey, args ...any) string {
+	return translate(tb.language(in), key, args...)
+}
+
+// handleLang shows or changes the sender's language: /lang, /lang en|ru, /lang auto
+func (tb *TelegramBot) handleLang(message *tgbotapi.Message) {
+	userID := message.From.ID
+	args := strings.Fields(message.Text)
+	reply := func(text string) {
+		tb.sendMessage(tgbotapi.NewMessage(message.Chat.ID, text))
+	}
+
+	if len(args) < 2 {
+		language := tb.userLanguage(message.From)
+		source := msgLangAuto
+		if _, ok := tb.languages.Override(userID); ok {
+			source = msgLangOverride
+		}
+		reply(translate(language, msgLangCurrent, languageNames[language], translate(language, source)))
+		return
+	}
+
+	if strings.EqualFold(args[1], "auto") {
+		if err := tb.languages.ClearOverride(userID); err != nil {
+			tb.logger.WithError(err).Error("Failed to reset language")
+			reply(translate(tb.userLanguage(message.From), msgLangSaveFailed))
+			return
+		}
+		reply(translate(tb.userLanguage(message.From), msgLangReset))
+		return
+	}
+
+	language, ok := parseLanguage(args[1])
+	if !ok {
+		reply(translate(tb.userLanguage(message.From), msgLangUnsupported, args[1], supportedLanguages()))
+		return
+	}
+	if err := tb.languages.SetOverride(userID, language); err != nil {
+		tb.logger.WithError(err).Error("Failed to save language")
+		reply(translate(tb.userLanguage(message.From), msgLangSaveFailed))
+		return
+	}
+	tb.logger.WithField("user_id", userID).WithField("language", language).Info("Language changed")
+	reply(translate(language, msgLangSet))
+}
+
+// supportedLanguages lists the codes /lang accepts
+func supportedLanguages() string {
+	codes := make([]string, 0, len(languageNames))
+	for language := range languageNames {
+		codes = append(codes, string(language))
+	}
+	sort.Strings(codes)
+	return strings.Join(codes, ", ")
+}
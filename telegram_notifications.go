@@ -0,0 +1,146 @@
+package main
+
+import (
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// SetSubscriptions enables /subscribe and proactive notifications
+func (tb *TelegramBot) SetSubscriptions(store *SubscriptionStore) {
+	tb.subscriptions = store
+}
+
+// handleSubscribe subscribes the chat to proactive notifications
+func (tb *TelegramBot) handleSubscribe(message *tgbotapi.Message) {
+	tb.deleteUserMessage(message.Chat.ID, message.MessageID)
+
+	if tb.subscriptions == nil {
+		tb.sendMessage(tgbotapi.NewMessage(message.Chat.ID, translate(tb.userLanguage(message.From), msgNotificationsNotEnabled)))
+		return
+	}
+
+	if err := tb.subscriptions.Subscribe(message.Chat.ID); err != nil {
+		tb.logger.WithError(err).Error("Failed to subscribe chat")
+		tb.sendMessage(tgbotapi.NewMessage(message.Chat.ID, translate(tb.userLanguage(message.From), msgSubscribeFailed)))
+		return
+	}
+	tb.sendMessage(tgbotapi.NewMessage(message.Chat.ID, translate(tb.userLanguage(message.From), msgSubscribed, CommandUnsubscribe)))
+}
+
+// handleUnsubscribe removes the chat from proactive notifications
+func (tb *TelegramBot) handleUnsubscribe(message *tgbotapi.Message) {
+	tb.deleteUserMessage(message.Chat.ID, message.MessageID)
+
+	if tb.subscriptions == nil {
+		tb.sendMessage(tgbotapi.NewMessage(message.Chat.ID, translate(tb.userLanguage(message.From), msgNotificationsNotEnabled)))
+		return
+	}
+
+	if err := tb.subscriptions.Unsubscribe(message.Chat.ID); err != nil {
+		tb.logger.WithError(err).Error("Failed to unsubscribe chat")
+		tb.sendMessage(tgbotapi.NewMessage(message.Chat.ID, translate(tb.userLanguage(message.From), msgUnsubscribeFailed)))
+		return
+	}
+	tb.sendMessage(tgbotapi.NewMessage(message.Chat.ID, translate(tb.userLanguage(message.From), msgUnsubscribed)))
+}
+
+// broadcast sends a Markdown notification to every subscribed chat, rendered in the chat's language
+func (tb *TelegramBot) broadcast(render func(Language) string) {
+	tb.broadcastExcept(0, render)
+}
+
+// broadcastExcept is broadcast skipping exceptChatID, which has been told already
+func (tb *TelegramBot) broadcastExcept(exceptChatID int64, render func(Language) string) {
+	if tb.subscriptions == nil {
+		return
+	}
+
+	for _, chatID := range tb.subscribedChats() {
+		if chatID == exceptChatID {
+			continue
+		}
+		msg := tgbotapi.NewMessage(chatID, render(tb.chatLanguage(chatID)))
+		msg.ParseMode = "Markdown"
+		tb.sendMessage(msg)
+	}
+}
+
+// subscribedChats returns the subscribed chats that are still authorized, so a chat stops
+// receiving notifications once its users lose access
+// The subscription itself is kept and resumes when a user signs in again
+func (tb *TelegramBot) subscribedChats() []int64 {
+	if tb.subscriptions == nil {
+		return nil
+	}
+
+	var chatIDs []int64
+	for _, chatID := range tb.subscriptions.ChatIDs() {
+		if tb.chatAuthorized(chatID) {
+			chatIDs = append(chatIDs, chatID)
+		}
+	}
+	return chatIDs
+}
+
+// chatAuthorized reports whether chatID may receive notifications and dashboard updates: someone
+// is signed in to it, or it is the private chat of a user whose authorization is persisted
+// (a configured admin or a role grant), so notifications keep flowing after a restart
+func (tb *TelegramBot) chatAuthorized(chatID int64) bool {
+	if tb.chatHasSession(chatID) || tb.adminUsers[chatID] {
+		return true
+	}
+	_, granted := tb.roleGrant(chatID)
+	return granted
+}
+
+// chatHasSession reports whether an authorized user with an unexpired session uses chatID
+func (tb *TelegramBot) chatHasSession(chatID int64) bool {
+	now := time.Now()
+	tb.userMutex.RLock()
+	defer tb.userMutex.RUnlock()
+	for _, user := range tb.authorizedUsers {
+		if user.chatID == chatID && tb.sessionExpiryReason(user, now) == "" {
+			return true
+		}
+	}
+	return false
+}
+
+// NotifyStateDrift refreshes cached statuses and tells subscribers about changes made outside the bot
+func (tb *TelegramBot) NotifyStateDrift(changes []StateChange, current RouterState) {
+	if current.Outbound != "" {
+		tb.updateAllCachedStatuses(statusForOutbound(current.Outbound))
+	}
+
+	var fields []string
+	for _, change := range changes {
+		fields = append(fields, change.Field)
+	}
+	tb.recordExternalChange(current.At, fields)
+	tb.refreshDashboardsAsync()
+
+	tb.broadcast(func(language Language) string {
+		lines := []string{translate(language, msgDriftTitle)}
+		for _, change := range changes {
+			switch change.Field {
+			case "routing":
+				lines = append(lines, translate(language, msgDriftRouting, change.Before, change.After))
+			case "service":
+				lines = append(lines, translate(language, msgDriftService, change.Before, change.After))
+			}
+		}
+		lines = append(lines, translate(language, msgDriftDetected, current.At.Format("15:04")))
+		return strings.Join(lines, "\n")
+	})
+}
+
+// updateAllCachedStatuses replaces the cached routing status of every authorized user
+func (tb *TelegramBot) updateAllCachedStatuses(status VPNStatus) {
+	tb.userMutex.Lock()
+	defer tb.userMutex.Unlock()
+	for _, user := range tb.authorizedUsers {
+		user.status = status
+	}
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDriftNotificationQuotesOutboundTags(t *testing.T) {
+	fake := newFakeTelegram(t)
+	tb := newTestTelegramBot(t, fake)
+	subscriptions, err := NewSubscriptionStore(filepath.Join(t.TempDir(), "subscriptions.json"))
+	if err != nil {
+		t.Fatalf("NewSubscriptionStore failed: %v", err)
+	}
+	tb.SetSubscriptions(subscriptions)
+	subscriptions.Subscribe(testChatID)
+
+	// An underscore outside a code span starts Markdown italics and Telegram rejects the message
+	tb.NotifyStateDrift([]StateChange{{Field: "routing", Before: "vless-reality", After: "direct_ru"}},
+		RouterState{Outbound: "direct_ru", At: time.Now()})
+	call := fake.WaitFor(t, "sendMessage", "Routing")
+	if !strings.Contains(call.Params["text"], "`vless-reality` → `direct_ru`") {
+		t.Errorf("Expected outbound tags in code spans, got %q", call.Params["text"])
+	}
+}
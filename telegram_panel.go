@@ -0,0 +1,294 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/sirupsen/logrus"
+)
+
+// Control panel button actions carried in callback data
+const (
+	panelActionStatus  = "status"
+	panelActionService = "service"
+	panelActionVPN     = "vpn"
+	panelActionDirect  = "direct"
+	panelActionStart   = "start"
+	panelActionStop    = "stop"
+	panelActionConfirm = "ok"
+	panelActionCancel  = "cancel"
+)
+
+// controlPanel is the single inline-keyboard message the bot keeps per chat
+type controlPanel struct {
+	messageID int
+	nonce     string // Changes on every render so presses on outdated buttons can be detected
+}
+
+// interaction describes a request arriving either as a typed message or as a button press
+type interaction struct {
+	chatID        int64
+	userID        int64
+	username      string
+	languageCode  string // Language of the user's Telegram app, see TelegramBot.text
+	userMessageID int    // Typed message to clean up, zero for button presses
+	callbackID    string // Callback query to answer, empty for typed messages
+	answered      bool
+	panelMoved    bool // Typed commands move the panel to the bottom of the chat once
+}
+
+// newMessageInteraction wraps a typed message
+func newMessageInteraction(message *tgbotapi.Message) *interaction {
+	return &interaction{
+		chatID:        message.Chat.ID,
+		userID:        message.From.ID,
+		username:      message.From.UserName,
+		languageCode:  message.From.LanguageCode,
+		userMessageID: message.MessageID,
+	}
+}
+
+// newCallbackInteraction wraps a button press on a panel message
+func newCallbackInteraction(query *tgbotapi.CallbackQuery) *interaction {
+	return &interaction{
+		chatID:       query.Message.Chat.ID,
+		userID:       query.From.ID,
+		username:     query.From.UserName,
+		languageCode: query.From.LanguageCode,
+		callbackID:   query.ID,
+	}
+}
+
+// encodeCallbackData packs a panel action, the panel nonce and optional arguments
+// Telegram limits callback data to 64 bytes, so keep actions and arguments short
+func encodeCallbackData(action, nonce string, args ...string) string {
+	return strings.Join(append([]string{action, nonce}, args...), ":")
+}
+
+// parseCallbackData splits callback data into action, nonce and the remaining argument
+func parseCallbackData(data string) (action, nonce, arg string) {
+	parts := strings.SplitN(data, ":", 3)
+	action = parts[0]
+	if len(parts) > 1 {
+		nonce = parts[1]
+	}
+	if len(parts) > 2 {
+		arg = parts[2]
+	}
+	return action, nonce, arg
+}
+
+// panelButtons maps the panel actions that can also be typed to the labels of their buttons
+var panelButtons = map[string]messageKey{
+	panelActionStatus:  msgButtonStatus,
+	panelActionService: msgButtonServiceStatus,
+	panelActionVPN:     msgButtonEnableVPN,
+	panelActionDirect:  msgButtonDisableVPN,
+	panelActionStart:   msgButtonStartVPN,
+	panelActionStop:    msgButtonStopVPN,
+	panelActionCancel:  msgButtonCancel,
+}
+
+// typedPanelAction returns the panel action whose button label, in any language, was typed
+func typedPanelAction(text string) (string, bool) {
+	for action, key := range panelButtons {
+		for language := range catalog {
+			if text == translate(language, key) {
+				return action, true
+			}
+		}
+	}
+	return "", false
+}
+
+// createPanelKeyboard builds the control buttons bound to a panel nonce, labelled in language
+func (tb *TelegramBot) createPanelKeyboard(language Language, nonce string) tgbotapi.InlineKeyboardMarkup {
+	button := func(action string) tgbotapi.InlineKeyboardButton {
+		return tgbotapi.NewInlineKeyboardButtonData(translate(language, panelButtons[action]), encodeCallbackData(action, nonce))
+	}
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(
+		// Information Layer - Check status before making decisions
+		tgbotapi.NewInlineKeyboardRow(button(panelActionStatus), button(panelActionService)),
+		// Traffic Control Layer - Core routing decisions
+		tgbotapi.NewInlineKeyboardRow(button(panelActionVPN), button(panelActionDirect)),
+		// Service Control Layer - Power management
+		tgbotapi.NewInlineKeyboardRow(button(panelActionStart), button(panelActionStop)),
+	)
+
+	// Timed Routing Layer - Keep or postpone a pending revert
+	if row := tb.revertKeyboardRow(language, nonce); row != nil {
+		keyboard.InlineKeyboard = append(keyboard.InlineKeyboard, row)
+	}
+	return keyboard
+}
+
+// showPanel renders text in the chat's control panel together with the control buttons
+func (tb *TelegramBot) showPanel(in *interaction, text string) {
+	nonce := tb.nextPanelNonce()
+	keyboard := tb.createPanelKeyboard(tb.language(in), nonce)
+	tb.renderPanel(in, text, nonce, &keyboard)
+}
+
+// showPanelProgress renders text without buttons while an action is running
+func (tb *TelegramBot) showPanelProgress(in *interaction, text string) {
+	tb.renderPanel(in, text, tb.nextPanelNonce(), nil)
+}
+
+// renderPanel edits the chat's panel in place, sending a new one when there is none yet,
+// when a typed command should bring it to the bottom of the chat, or when editing fails
+// Buttons in markup must be bound to nonce
+func (tb *TelegramBot) renderPanel(in *interaction, text, nonce string, markup *tgbotapi.InlineKeyboardMarkup) {
+	tb.panelMutex.Lock()
+	panel, exists := tb.panels[in.chatID]
+	tb.panelMutex.Unlock()
+
+	if exists && in.callbackID == "" && !in.panelMoved {
+		tb.deleteUserMessage(in.chatID, panel.messageID)
+		exists = false
+	}
+	in.panelMoved = true
+
+	if exists {
+		edit := tgbotapi.NewEditMessageText(in.chatID, panel.messageID, text)
+		edit.ParseMode = "Markdown"
+		edit.ReplyMarkup = markup
+		_, err := tb.bot.Send(edit)
+		if err == nil || isMessageNotModified(err) {
+			tb.storePanel(in.chatID, panel.messageID, nonce)
+			return
+		}
+		tb.logger.WithError(err).Debug("Failed to edit control panel, sending a new one")
+	}
+
+	msg := tgbotapi.NewMessage(in.chatID, text)
+	msg.ParseMode = "Markdown"
+	if markup != nil {
+		msg.ReplyMarkup = *markup
+	}
+	sent, err := tb.bot.Send(msg)
+	if err != nil {
+		tb.logger.WithError(err).WithField("chat_id", in.chatID).Error("Failed to send control panel")
+		return
+	}
+	tb.storePanel(in.chatID, sent.MessageID, nonce)
+}
+
+// storePanel remembers the current panel message of a chat
+func (tb *TelegramBot) storePanel(chatID int64, messageID int, nonce string) {
+	tb.panelMutex.Lock()
+	defer tb.panelMutex.Unlock()
+	tb.panels[chatID] = &controlPanel{messageID: messageID, nonce: nonce}
+}
+
+// nextPanelNonce returns a short value unique for the lifetime of the process
+func (tb *TelegramBot) nextPanelNonce() string {
+	return strconv.FormatUint(tb.panelNonce.Add(1), 36)
+}
+
+// isCurrentPanel reports whether a button press came from the latest render of the chat's panel
+func (tb *TelegramBot) isCurrentPanel(chatID int64, messageID int, nonce string) bool {
+	tb.panelMutex.Lock()
+	defer tb.panelMutex.Unlock()
+	panel, exists := tb.panels[chatID]
+	return exists && panel.messageID == messageID && panel.nonce == nonce
+}
+
+// closePanel removes the buttons from a chat's panel and forgets it
+func (tb *TelegramBot) closePanel(chatID int64) {
+	tb.panelMutex.Lock()
+	panel, exists := tb.panels[chatID]
+	delete(tb.panels, chatID)
+	tb.panelMutex.Unlock()
+
+	if exists {
+		tb.removeInlineKeyboard(chatID, panel.messageID)
+	}
+}
+
+// removeInlineKeyboard strips the buttons from a message
+func (tb *TelegramBot) removeInlineKeyboard(chatID int64, messageID int) {
+	edit := tgbotapi.NewEditMessageReplyMarkup(chatID, messageID, tgbotapi.InlineKeyboardMarkup{InlineKeyboard: [][]tgbotapi.InlineKeyboardButton{}})
+	if _, err := tb.bot.Request(edit); err != nil && !isMessageNotModified(err) {
+		tb.logger.WithError(err).Debug("Failed to remove inline keyboard")
+	}
+}
+
+// handleCallback routes a button press to the matching panel action
+func (tb *TelegramBot) handleCallback(query *tgbotapi.CallbackQuery) {
+	if query.Message == nil {
+		tb.answerCallback(query.ID, "", false)
+		return
+	}
+
+	in := newCallbackInteraction(query)
+	tb.logger.WithFields(logrus.Fields{
+		"user_id":  in.userID,
+		"username": in.username,
+		"data":     query.Data,
+	}).Debug("Received callback query")
+
+	if !tb.isUserAuthorized(in.userID) {
+		tb.metrics.IncAuthFailure("unauthorized")
+		tb.alert(in, translate(tb.senderLanguage(query.From), msgUnauthorizedAlert))
+		return
+	}
+	if !tb.touchSession(in.userID) {
+		tb.acknowledge(in, "")
+		return
+	}
+
+	action, nonce, arg := parseCallbackData(query.Data)
+	if action == dashboardActionRefresh {
+		tb.handleDashboardRefresh(in, query.Message.MessageID)
+		return
+	}
+	if !tb.isCurrentPanel(in.chatID, query.Message.MessageID, nonce) {
+		tb.alert(in, tb.text(in, msgPanelOutdated))
+		tb.panelMutex.Lock()
+		panel, exists := tb.panels[in.chatID]
+		tb.panelMutex.Unlock()
+		if !exists || panel.messageID != query.Message.MessageID {
+			tb.removeInlineKeyboard(in.chatID, query.Message.MessageID)
+		}
+		return
+	}
+
+	tb.handlePanelAction(in, action, arg)
+}
+
+// acknowledge answers a button press with a short toast; typed messages need no answer
+func (tb *TelegramBot) acknowledge(in *interaction, text string) {
+	if in.callbackID == "" || in.answered {
+		return
+	}
+	in.answered = true
+	tb.answerCallback(in.callbackID, text, false)
+}
+
+// alert answers a button press with a dialog the user has to dismiss, or sends text for typed messages
+func (tb *TelegramBot) alert(in *interaction, text string) {
+	if in.callbackID == "" {
+		tb.sendMessage(tgbotapi.NewMessage(in.chatID, text))
+		return
+	}
+	if in.answered {
+		return
+	}
+	in.answered = true
+	tb.answerCallback(in.callbackID, text, true)
+}
+
+// answerCallback stops the loading indicator on a pressed button
+func (tb *TelegramBot) answerCallback(callbackID, text string, showAlert bool) {
+	callback := tgbotapi.NewCallback(callbackID, text)
+	callback.ShowAlert = showAlert
+	if _, err := tb.bot.Request(callback); err != nil {
+		tb.logger.WithError(err).Debug("Failed to answer callback query")
+	}
+}
+
+// isMessageNotModified reports whether Telegram rejected an edit because nothing changed
+func isMessageNotModified(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "message is not modified")
+}
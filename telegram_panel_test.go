@@ -0,0 +1,131 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	"vpn-commander/internal/tgfake"
+)
+
+func TestCallbackDataRoundTrip(t *testing.T) {
+	tests := []struct {
+		action, nonce string
+		args          []string
+		wantArg       string
+	}{
+		{panelActionStatus, "1a", nil, ""},
+		{panelActionVPN, "zz", []string{"extra"}, "extra"},
+		{panelActionStop, "9", []string{"a", "b"}, "a:b"},
+	}
+
+	for _, tt := range tests {
+		data := encodeCallbackData(tt.action, tt.nonce, tt.args...)
+		if len(data) > 64 {
+			t.Errorf("callback data %q exceeds Telegram's 64 byte limit", data)
+		}
+		action, nonce, arg := parseCallbackData(data)
+		if action != tt.action || nonce != tt.nonce || arg != tt.wantArg {
+			t.Errorf("parseCallbackData(%q) = %q, %q, %q", data, action, nonce, arg)
+		}
+	}
+}
+
+func TestParseCallbackDataMalformed(t *testing.T) {
+	action, nonce, arg := parseCallbackData("status")
+	if action != "status" || nonce != "" || arg != "" {
+		t.Errorf("parseCallbackData(\"status\") = %q, %q, %q", action, nonce, arg)
+	}
+}
+
+// latestPanel returns the most recent call that rendered the control panel of the test chat
+func latestPanel(t *testing.T, fake *tgfake.Server) tgfake.Call {
+	t.Helper()
+
+	calls := fake.Calls()
+	for i := len(calls) - 1; i >= 0; i-- {
+		call := calls[i]
+		if (call.Method == "sendMessage" || call.Method == "editMessageText") && strings.Contains(call.Params["reply_markup"], "inline_keyboard") {
+			return call
+		}
+	}
+	t.Fatal("No control panel was rendered")
+	return tgfake.Call{}
+}
+
+// panelNonce returns the nonce the buttons of a rendered panel are bound to
+func panelNonce(t *testing.T, call tgfake.Call) string {
+	t.Helper()
+	_, nonce, _ := parseCallbackData(buttonData(t, call, CommandStatus))
+	return nonce
+}
+
+func TestPanelEditedInPlace(t *testing.T) {
+	fake := newFakeTelegram(t)
+	tb := newTestTelegramBot(t, fake)
+
+	tb.handleUpdate(messageUpdate(1, CommandPanel))
+	panel := latestPanel(t, fake)
+	if panel.Method != "sendMessage" {
+		t.Fatalf("Expected /panel to send a panel, got %s", panel.Method)
+	}
+
+	sent := countCalls(fake, "sendMessage", "")
+	tb.handleUpdate(callbackUpdate("cb1", panel.MessageID, buttonData(t, panel, CommandServiceStatus)))
+	edited := latestPanel(t, fake)
+	if edited.Method != "editMessageText" || edited.MessageID != panel.MessageID {
+		t.Errorf("Expected the press to edit message %d, got %s of %d", panel.MessageID, edited.Method, edited.MessageID)
+	}
+	if calls := countCalls(fake, "sendMessage", ""); calls != sent {
+		t.Errorf("Expected no new messages for a button press, got %d more", calls-sent)
+	}
+	if !tb.isCurrentPanel(testChatID, panel.MessageID, panelNonce(t, edited)) {
+		t.Error("Expected the edited panel to become the current one")
+	}
+}
+
+func TestOutdatedPanelButtonsRejected(t *testing.T) {
+	fake := newFakeTelegram(t)
+	tb := newTestTelegramBot(t, fake)
+
+	tb.handleUpdate(messageUpdate(1, CommandPanel))
+	first := latestPanel(t, fake)
+	stale := buttonData(t, first, CommandStopVPN)
+	staleNonce := panelNonce(t, first)
+
+	// Re-rendering the same message binds its buttons to a new nonce
+	tb.handleUpdate(callbackUpdate("cb1", first.MessageID, buttonData(t, first, CommandServiceStatus)))
+	if tb.isCurrentPanel(testChatID, first.MessageID, staleNonce) {
+		t.Fatal("Expected the re-rendered panel to get a new nonce")
+	}
+	tb.handleUpdate(callbackUpdate("cb2", first.MessageID, stale))
+	if _, ok := fake.Find("answerCallbackQuery", "These buttons are outdated"); !ok {
+		t.Error("Expected a press of replaced buttons to be rejected")
+	}
+	if _, ok := fake.Find("sendMessage", "Confirm: Stop VPN"); ok {
+		t.Error("An outdated button must not start its action")
+	}
+	if _, ok := fake.Find("editMessageText", "Stopping VPN daemon"); ok {
+		t.Error("An outdated button must not start its action")
+	}
+
+	// A panel left behind by a typed command loses its buttons when pressed
+	tb.handleUpdate(messageUpdate(2, CommandPanel))
+	second := latestPanel(t, fake)
+	if second.MessageID == first.MessageID {
+		t.Fatal("Expected a typed command to move the panel to a new message")
+	}
+	tb.handleUpdate(callbackUpdate("cb3", first.MessageID, buttonData(t, first, CommandStatus)))
+	removed := false
+	for _, call := range fake.Calls() {
+		if call.Method == "editMessageReplyMarkup" && call.Params["message_id"] == strconv.Itoa(first.MessageID) {
+			removed = true
+		}
+	}
+	if !removed {
+		t.Error("Expected the buttons of the old panel message to be removed")
+	}
+	if !tb.isCurrentPanel(testChatID, second.MessageID, panelNonce(t, second)) {
+		t.Error("Pressing an old panel must not replace the current one")
+	}
+}
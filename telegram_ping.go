@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// pingTimeout bounds each outbound probe; the router runs them one after another
+const pingTimeout = 5 * time.Second
+
+// handlePing measures latency from the router to every outbound: /ping [fastest]
+func (tb *TelegramBot) handlePing(message *tgbotapi.Message) {
+	in := newMessageInteraction(message)
+	defer tb.deleteUserMessage(in.chatID, in.userMessageID)
+
+	args := strings.Fields(message.Text)
+	selectFastest := len(args) == 2 && strings.EqualFold(args[1], "fastest")
+	if len(args) > 1 && !selectFastest {
+		tb.showPanel(in, tb.text(in, msgPingUsage, CommandPing))
+		return
+	}
+
+	tb.showPanelProgress(in, tb.text(in, msgPingProgress))
+
+	results, err := tb.vpnManager.PingOutbounds(context.Background(), pingTimeout)
+	if err != nil {
+		tb.logger.WithError(err).Error("Failed to ping outbounds")
+		tb.showPanel(in, tb.text(in, msgPingFailed))
+		return
+	}
+
+	active, err := tb.vpnManager.GetActiveOutbound()
+	if err != nil {
+		tb.logger.WithError(err).Warn("Failed to get active outbound for ping results")
+	}
+	table := formatPingResults(tb.language(in), results, active)
+
+	if !selectFastest {
+		tb.showPanel(in, table)
+		return
+	}
+
+	fastest := results[0]
+	switch {
+	case fastest.Err != nil:
+		tb.showPanel(in, table+"\n"+tb.text(in, msgPingNoneReachable))
+		return
+	case fastest.Tag == active:
+		tb.showPanel(in, table+"\n"+tb.text(in, msgPingAlreadyFastest, fastest.Tag))
+		return
+	}
+
+	tb.showPanel(in, table)
+	tb.runProtected(in, ActionSelectOutbound, func() {
+		tb.handleSelectOutbound(in, fastest.Tag)
+	})
+}
+
+// handleSelectOutbound points the default rule at outboundTag
+func (tb *TelegramBot) handleSelectOutbound(in *interaction, outboundTag string) {
+	tb.acknowledge(in, tb.text(in, msgOutboundSwitching))
+	tb.showPanelProgress(in, tb.text(in, msgOutboundProgress, outboundTag))
+
+	if err := tb.vpnManager.SwitchOutbound(tb.actionContext(in), ActionSelectOutbound, outboundTag); err != nil {
+		tb.logger.WithError(err).Error("Failed to switch outbound")
+		tb.showPanel(in, tb.text(in, msgOutboundFailed, outboundTag))
+		return
+	}
+
+	tb.updateAllCachedStatuses(statusForOutbound(outboundTag))
+	tb.showPanel(in, tb.text(in, msgOutboundDone, outboundTag))
+	tb.refreshDashboardsAsync()
+}
+
+// formatPingResults renders probe results as a monospace table in language, marking the active outbound
+func formatPingResults(language Language, results []OutboundLatency, active string) string {
+	header := translate(language, msgPingOutbound)
+	// fmt pads by runes, so measure in runes too
+	width := utf8.RuneCountInString(header)
+	for _, result := range results {
+		if n := utf8.RuneCountInString(result.Tag); n > width {
+			width = n
+		}
+	}
+
+	lines := []string{
+		translate(language, msgPingTitle),
+		"```",
+		fmt.Sprintf("  %-*s %8s %8s", width, header, "TCP", "TLS"),
+	}
+	for _, result := range results {
+		marker := " "
+		if result.Tag == active {
+			marker = "*"
+		}
+
+		tcp, tls := "-", "-"
+		if result.Connect > 0 {
+			tcp = formatLatency(result.Connect)
+		}
+		if result.Handshake > 0 {
+			tls = formatLatency(result.Handshake)
+		}
+		if result.Err != nil {
+			tls = translate(language, msgPingProbeFailed)
+		}
+		lines = append(lines, fmt.Sprintf("%s %-*s %8s %8s", marker, width, result.Tag, tcp, tls))
+	}
+	lines = append(lines, "```")
+	if active != "" {
+		lines = append(lines, translate(language, msgPingActive))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// formatLatency renders a latency in whole milliseconds
+func formatLatency(d time.Duration) string {
+	return fmt.Sprintf("%dms", d.Round(time.Millisecond).Milliseconds())
+}
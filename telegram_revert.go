@@ -0,0 +1,215 @@
+package main
+
+import (
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Timed routing limits
+const (
+	minTimedRouting = time.Minute
+	maxTimedRouting = 7 * 24 * time.Hour
+)
+
+// Revert panel actions
+const (
+	panelActionRevertCancel = "rvc"
+	panelActionRevertExtend = "rvx"
+)
+
+// revertExtensions are the durations offered by the extend buttons
+var revertExtensions = []time.Duration{30 * time.Minute, time.Hour}
+
+// SetRevertManager enables /direct_for and /vpn_for
+func (tb *TelegramBot) SetRevertManager(manager *RevertManager) {
+	tb.reverts = manager
+	manager.SetNotifier(tb.NotifyRevert)
+}
+
+// handleTimedRouting switches routing for a limited time: /direct_for DURATION or /vpn_for DURATION
+// The outbound in effect before the switch is restored when the time is up
+func (tb *TelegramBot) handleTimedRouting(message *tgbotapi.Message, action Action) {
+	in := newMessageInteraction(message)
+	defer tb.deleteUserMessage(in.chatID, in.userMessageID)
+
+	if tb.reverts == nil {
+		tb.showPanel(in, tb.text(in, msgTimedNotEnabled))
+		return
+	}
+
+	args := strings.Fields(message.Text)
+	var duration time.Duration
+	var err error
+	if len(args) == 2 {
+		duration, err = time.ParseDuration(args[1])
+	}
+	if len(args) != 2 || err != nil || duration < minTimedRouting || duration > maxTimedRouting {
+		language := tb.language(in)
+		tb.showPanel(in, translate(language, msgTimedUsage, commandName(message.Text), formatDuration(language, minTimedRouting), formatDuration(language, maxTimedRouting)))
+		return
+	}
+
+	var switchRouting func(*interaction) bool
+	switch action {
+	case ActionEnableVPN:
+		switchRouting = tb.handleEnableVPN
+	case ActionDisableVPN:
+		switchRouting = tb.handleDisableVPN
+	}
+
+	tb.runProtected(in, action, func() {
+		previous, err := tb.vpnManager.GetActiveOutbound()
+		if err != nil {
+			tb.logger.WithError(err).Error("Failed to read routing before timed switch")
+			tb.showPanel(in, tb.text(in, msgTimedReadFailed))
+			return
+		}
+		if !switchRouting(in) {
+			return
+		}
+
+		err = tb.reverts.Schedule(PendingRevert{
+			Action:   revertAction(previous),
+			Outbound: previous,
+			At:       time.Now().Add(duration),
+			UserID:   in.userID,
+			Username: in.username,
+			ChatID:   in.chatID,
+		})
+		if err != nil {
+			tb.logger.WithError(err).Error("Failed to schedule routing revert")
+			tb.showPanel(in, tb.text(in, msgTimedRevertFailed))
+			return
+		}
+
+		language := tb.language(in)
+		tb.showPanel(in, translate(language, msgTimedSwitched, formatDuration(language, duration), tb.revertStatusLine(language)))
+		tb.refreshDashboardsAsync()
+	})
+}
+
+// handleRevertCancel keeps the current routing and drops the pending revert
+func (tb *TelegramBot) handleRevertCancel(in *interaction) {
+	if !tb.canChangeRevert(in) {
+		return
+	}
+
+	revert, err := tb.reverts.Cancel()
+	if err != nil {
+		tb.alert(in, tb.text(in, msgRevertNone))
+		return
+	}
+
+	tb.acknowledge(in, tb.text(in, msgRevertCancelToast))
+	tb.showPanel(in, tb.text(in, msgRevertCancelled, revertTarget(tb.language(in), revert)))
+}
+
+// handleRevertExtend postpones the pending revert by the duration in arg
+func (tb *TelegramBot) handleRevertExtend(in *interaction, arg string) {
+	if !tb.canChangeRevert(in) {
+		return
+	}
+
+	extension, err := time.ParseDuration(arg)
+	if err != nil || extension <= 0 {
+		tb.alert(in, tb.text(in, msgRevertBadExtension))
+		return
+	}
+
+	if pending, ok := tb.reverts.Pending(); ok && time.Until(pending.At)+extension > maxTimedRouting {
+		tb.alert(in, tb.text(in, msgRevertTooFar, formatDuration(tb.language(in), maxTimedRouting)))
+		return
+	}
+
+	if _, err := tb.reverts.Extend(extension); err != nil {
+		tb.alert(in, tb.text(in, msgRevertNone))
+		return
+	}
+
+	language := tb.language(in)
+	tb.acknowledge(in, translate(language, msgRevertExtendToast, formatDuration(language, extension)))
+	tb.showPanel(in, translate(language, msgRevertPostponed, tb.revertStatusLine(language)))
+}
+
+// canChangeRevert checks that reverts are enabled and the user may change routing
+func (tb *TelegramBot) canChangeRevert(in *interaction) bool {
+	if tb.reverts == nil {
+		tb.alert(in, tb.text(in, msgTimedNotEnabled))
+		return false
+	}
+	if role, _ := tb.getUserRole(in.userID); !role.CanControl() {
+		tb.alert(in, tb.text(in, msgRoleForbidsRouting, role))
+		return false
+	}
+	return true
+}
+
+// revertStatusLine describes the pending revert with its countdown in language, or "" if there is none
+func (tb *TelegramBot) revertStatusLine(language Language) string {
+	revert, ok := tb.reverts.Pending()
+	if !ok {
+		return ""
+	}
+
+	remaining := time.Until(revert.At)
+	if remaining < 0 {
+		remaining = 0
+	}
+	return translate(language, msgRevertStatus, revertTarget(language, revert), formatDuration(language, remaining.Round(time.Minute)), revert.At.Local().Format("15:04"))
+}
+
+// revertTarget names the routing a revert switches back to
+func revertTarget(language Language, revert PendingRevert) string {
+	switch {
+	case revert.Action == ActionEnableVPN:
+		return translate(language, msgRevertTargetVPN)
+	case revert.Action == ActionDisableVPN:
+		return translate(language, msgRevertTargetDirect)
+	default:
+		return "`" + revert.Outbound + "`"
+	}
+}
+
+// revertKeyboardRow returns the cancel and extend buttons for a pending revert, or nil if there is none
+func (tb *TelegramBot) revertKeyboardRow(language Language, nonce string) []tgbotapi.InlineKeyboardButton {
+	if _, ok := tb.reverts.Pending(); !ok {
+		return nil
+	}
+
+	row := []tgbotapi.InlineKeyboardButton{
+		tgbotapi.NewInlineKeyboardButtonData(translate(language, msgButtonKeepRouting), encodeCallbackData(panelActionRevertCancel, nonce)),
+	}
+	for _, extension := range revertExtensions {
+		row = append(row, tgbotapi.NewInlineKeyboardButtonData("➕ "+formatDuration(language, extension), encodeCallbackData(panelActionRevertExtend, nonce, extension.String())))
+	}
+	return row
+}
+
+// NotifyRevert tells the chat that scheduled the revert, and subscribers, that it has run
+func (tb *TelegramBot) NotifyRevert(revert PendingRevert, err error) {
+	render := func(language Language) string {
+		if err != nil {
+			return translate(language, msgRevertFailed, revertTarget(language, revert), formatDuration(language, revertRetryDelay))
+		}
+		return translate(language, msgRevertDone, revertTarget(language, revert))
+	}
+	if err == nil {
+		newStatus := VPNStatusEnabled
+		switch {
+		case revert.Outbound != "":
+			newStatus = statusForOutbound(revert.Outbound)
+		case revert.Action == ActionDisableVPN:
+			newStatus = VPNStatusDisabled
+		}
+		tb.updateAllCachedStatuses(newStatus)
+	}
+
+	if revert.ChatID != 0 {
+		in := &interaction{chatID: revert.ChatID, userID: revert.UserID, username: revert.Username, panelMoved: true}
+		tb.showPanel(in, render(tb.language(in)))
+	}
+	tb.broadcastExcept(revert.ChatID, render)
+	tb.refreshDashboardsAsync()
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/sirupsen/logrus"
+)
+
+// SetScheduler enables /schedule and notifications about scheduled actions
+func (tb *TelegramBot) SetScheduler(scheduler *Scheduler) {
+	tb.scheduler = scheduler
+	scheduler.SetNotifier(tb.NotifyScheduledAction)
+}
+
+// handleSchedule manages schedule rules: /schedule [add DAYS HH:MM ACTION | remove ID]
+func (tb *TelegramBot) handleSchedule(message *tgbotapi.Message) {
+	language := tb.userLanguage(message.From)
+	if tb.scheduler == nil {
+		tb.sendMessage(tgbotapi.NewMessage(message.Chat.ID, translate(language, msgScheduleNotEnabled)))
+		return
+	}
+
+	if role, _ := tb.getUserRole(message.From.ID); !role.CanAdminister() {
+		tb.logger.WithFields(logrus.Fields{
+			"user_id": message.From.ID,
+			"role":    role,
+		}).Warn("Non-admin attempted schedule management")
+		tb.sendMessage(tgbotapi.NewMessage(message.Chat.ID, translate(language, msgScheduleAdminOnly)))
+		return
+	}
+
+	args := strings.Fields(message.Text)
+	subcommand := ""
+	if len(args) > 1 {
+		subcommand = strings.ToLower(args[1])
+	}
+
+	switch subcommand {
+	case "add":
+		tb.handleScheduleAdd(message, language, args[2:])
+	case "remove", "rm", "delete":
+		if len(args) != 3 {
+			tb.sendMessage(tgbotapi.NewMessage(message.Chat.ID, translate(language, msgScheduleRemoveUsage, CommandSchedule)))
+			return
+		}
+		rule, err := tb.scheduler.Remove(args[2])
+		if errors.Is(err, errScheduleNotFound) {
+			tb.sendMessage(tgbotapi.NewMessage(message.Chat.ID, translate(language, msgScheduleNotFound, args[2])))
+			return
+		}
+		if err != nil {
+			tb.logger.WithError(err).Error("Failed to remove schedule rule")
+			tb.sendMessage(tgbotapi.NewMessage(message.Chat.ID, translate(language, msgScheduleRemoveFailed)))
+			return
+		}
+		tb.sendMessage(tgbotapi.NewMessage(message.Chat.ID, translate(language, msgScheduleRemoved, formatScheduleRule(language, rule))))
+	case "":
+		tb.handleScheduleList(message, language)
+	default:
+		tb.sendMessage(tgbotapi.NewMessage(message.Chat.ID, scheduleUsage(language)))
+	}
+}
+
+// handleScheduleAdd adds a rule from DAYS HH:MM ACTION arguments
+func (tb *TelegramBot) handleScheduleAdd(message *tgbotapi.Message, language Language, args []string) {
+	if len(args) != 3 {
+		tb.sendMessage(tgbotapi.NewMessage(message.Chat.ID, scheduleUsage(language)))
+		return
+	}
+
+	rule, err := parseScheduleRule(args[0], args[1], args[2])
+	if err != nil {
+		key, value := msgScheduleBadDays, args[0]
+		switch {
+		case errors.Is(err, errUnknownScheduleAction):
+			key, value = msgScheduleBadAction, args[2]
+		case errors.Is(err, errInvalidScheduleTime):
+			key, value = msgScheduleBadTime, args[1]
+		}
+		tb.sendMessage(tgbotapi.NewMessage(message.Chat.ID, translate(language, key, value, scheduleUsage(language))))
+		return
+	}
+
+	added, err := tb.scheduler.Add(*rule, message.From.ID)
+	if err != nil {
+		tb.logger.WithError(err).Error("Failed to add schedule rule")
+		tb.sendMessage(tgbotapi.NewMessage(message.Chat.ID, translate(language, msgScheduleSaveFailed)))
+		return
+	}
+
+	next := added.NextRun(time.Now().In(tb.scheduler.Location()))
+	tb.sendMessage(tgbotapi.NewMessage(message.Chat.ID, translate(language, msgScheduleAdded, formatScheduleRule(language, added), next.Format(translate(language, msgLayoutNextRun)))))
+}
+
+// handleScheduleList lists all rules with their next run
+func (tb *TelegramBot) handleScheduleList(message *tgbotapi.Message, language Language) {
+	rules := tb.scheduler.List()
+	if len(rules) == 0 {
+		tb.sendMessage(tgbotapi.NewMessage(message.Chat.ID, translate(language, msgScheduleEmpty, scheduleUsage(language))))
+		return
+	}
+
+	now := time.Now().In(tb.scheduler.Location())
+	lines := []string{translate(language, msgScheduleList, tb.scheduler.Location())}
+	for _, rule := range rules {
+		lines = append(lines, translate(language, msgScheduleListLine, formatScheduleRule(language, rule), rule.NextRun(now).Format(translate(language, msgLayoutWeekday))))
+	}
+	tb.sendMessage(tgbotapi.NewMessage(message.Chat.ID, strings.Join(lines, "\n")))
+}
+
+// NotifyScheduledAction tells subscribers about a rule that has run
+func (tb *TelegramBot) NotifyScheduledAction(rule ScheduleRule, err error) {
+	outcome := msgOutcomeDone
+	if err != nil {
+		outcome = msgOutcomeFailed
+	} else {
+		switch rule.Action {
+		case ActionEnableVPN:
+			tb.updateAllCachedStatuses(VPNStatusEnabled)
+		case ActionDisableVPN:
+			tb.updateAllCachedStatuses(VPNStatusDisabled)
+		}
+	}
+
+	tb.broadcast(func(language Language) string {
+		return translate(language, msgScheduledAction, describeAction(language, rule.Action), rule.ID, translate(language, outcome))
+	})
+	tb.refreshDashboardsAsync()
+}
+
+// formatScheduleRule renders a rule on a single line in language
+func formatScheduleRule(language Language, rule ScheduleRule) string {
+	return fmt.Sprintf("%s • %s %s • %s", rule.ID, rule.Days, rule.Time, describeAction(language, rule.Action))
+}
+
+// scheduleUsage explains the /schedule syntax in language
+func scheduleUsage(language Language) string {
+	return translate(language, msgScheduleUsage, CommandSchedule, CommandSchedule, CommandSchedule, CommandSchedule)
+}
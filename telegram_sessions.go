@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/sirupsen/logrus"
+)
+
+// sessionSweepInterval is how often expired sessions are looked for in the background
+const sessionSweepInterval = time.Minute
+
+// SetSessionPolicy configures the absolute session lifetime and the idle timeout
+// A zero duration disables the respective limit
+func (tb *TelegramBot) SetSessionPolicy(lifetime, idleTimeout time.Duration) {
+	tb.sessionLifetime = lifetime
+	tb.sessionIdle = idleTimeout
+	tb.logger.WithFields(logrus.Fields{
+		"lifetime":     lifetime,
+		"idle_timeout": idleTimeout,
+	}).Info("Session policy configured")
+}
+
+// sessionExpiryReason returns why a session has expired at now, or "" if it is still valid
+func (tb *TelegramBot) sessionExpiryReason(user *authorizedUser, now time.Time) string {
+	if tb.sessionLifetime > 0 && now.Sub(user.authorizedAt) >= tb.sessionLifetime {
+		return "lifetime"
+	}
+	if tb.sessionIdle > 0 && now.Sub(user.lastSeen) >= tb.sessionIdle {
+		return "idle"
+	}
+	return ""
+}
+
+// touchSession records activity for a user and reports whether their session is still valid
+// An expired session is ended and the user is told so
+func (tb *TelegramBot) touchSession(userID int64) bool {
+	now := time.Now()
+
+	tb.userMutex.Lock()
+	user, exists := tb.authorizedUsers[userID]
+	if !exists {
+		tb.userMutex.Unlock()
+		return false
+	}
+	reason := tb.sessionExpiryReason(user, now)
+	if reason == "" {
+		user.lastSeen = now
+		tb.userMutex.Unlock()
+		return true
+	}
+	delete(tb.authorizedUsers, userID)
+	tb.userMutex.Unlock()
+
+	tb.notifySessionEnded(userID, user.chatID, reason)
+	return false
+}
+
+// runSessionSweeper periodically ends expired sessions so users are told proactively
+func (tb *TelegramBot) runSessionSweeper(ctx context.Context) {
+	if tb.sessionLifetime <= 0 && tb.sessionIdle <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(sessionSweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			tb.sweepSessions(time.Now())
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// sweepSessions ends every session that has expired at now
+func (tb *TelegramBot) sweepSessions(now time.Time) {
+	type expiredSession struct {
+		userID int64
+		chatID int64
+		reason string
+	}
+
+	var expired []expiredSession
+	tb.userMutex.Lock()
+	for userID, user := range tb.authorizedUsers {
+		if reason := tb.sessionExpiryReason(user, now); reason != "" {
+			expired = append(expired, expiredSession{userID, user.chatID, reason})
+			delete(tb.authorizedUsers, userID)
+		}
+	}
+	tb.userMutex.Unlock()
+
+	for _, session := range expired {
+		tb.notifySessionEnded(session.userID, session.chatID, session.reason)
+	}
+}
+
+// handleLogout ends the sender's session on request
+func (tb *TelegramBot) handleLogout(message *tgbotapi.Message) {
+	tb.deleteUserMessage(message.Chat.ID, message.MessageID)
+
+	tb.userMutex.Lock()
+	delete(tb.authorizedUsers, message.From.ID)
+	tb.userMutex.Unlock()
+
+	tb.notifySessionEnded(message.From.ID, message.Chat.ID, "logout")
+}
+
+// notifySessionEnded clears per-session state and tells the user, disabling the control panel
+func (tb *TelegramBot) notifySessionEnded(userID, chatID int64, reason string) {
+	tb.pendingMutex.Lock()
+	delete(tb.pendingActions, userID)
+	tb.pendingMutex.Unlock()
+
+	tb.logger.WithFields(logrus.Fields{
+		"user_id": userID,
+		"reason":  reason,
+	}).Info("User session ended")
+
+	// Ending a session never touches the role grant, so invited users only need /start
+	language := tb.languages.Language(userID)
+	hint := translate(language, msgSessionHintAuth)
+	if _, granted := tb.roleGrant(userID); granted || tb.adminUsers[userID] {
+		hint = translate(language, msgSessionHintStart, CommandStart)
+	}
+
+	var text string
+	switch reason {
+	case "logout":
+		text = translate(language, msgLoggedOut, hint)
+	case "revoked":
+		text = translate(language, msgAccessRevoked)
+	case "idle":
+		text = translate(language, msgSessionIdle, hint)
+	default:
+		text = translate(language, msgSessionExpired, hint)
+	}
+
+	if chatID == 0 {
+		return
+	}
+	tb.takeConfirmation(chatID, userID)
+	tb.closePanel(chatID)
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.ParseMode = "Markdown"
+	msg.ReplyMarkup = tgbotapi.NewRemoveKeyboard(false)
+	tb.sendMessage(msg)
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSessionExpiryReason(t *testing.T) {
+	now := time.Now()
+	tb := &TelegramBot{sessionLifetime: time.Hour, sessionIdle: 10 * time.Minute}
+
+	tests := []struct {
+		name     string
+		user     authorizedUser
+		expected string
+	}{
+		{"fresh", authorizedUser{authorizedAt: now, lastSeen: now}, ""},
+		{"idle", authorizedUser{authorizedAt: now.Add(-20 * time.Minute), lastSeen: now.Add(-15 * time.Minute)}, "idle"},
+		{"lifetime", authorizedUser{authorizedAt: now.Add(-2 * time.Hour), lastSeen: now}, "lifetime"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if reason := tb.sessionExpiryReason(&tt.user, now); reason != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, reason)
+			}
+		})
+	}
+
+	unlimited := &TelegramBot{}
+	old := authorizedUser{authorizedAt: now.Add(-1000 * time.Hour), lastSeen: now.Add(-1000 * time.Hour)}
+	if reason := unlimited.sessionExpiryReason(&old, now); reason != "" {
+		t.Errorf("Expected no expiry with limits disabled, got %q", reason)
+	}
+}
+
+func TestE2ESessionEndKeepsGrant(t *testing.T) {
+	fake, tb := startE2EBotWith(t, func(tb *TelegramBot) {
+		grants, err := NewGrantStore(filepath.Join(t.TempDir(), "grants.json"))
+		if err != nil {
+			t.Fatalf("NewGrantStore failed: %v", err)
+		}
+		if err := grants.Grant(testUserID, RoleViewer, 1, "abcd1234"); err != nil {
+			t.Fatalf("Grant failed: %v", err)
+		}
+		tb.SetGrantStore(grants)
+		tb.SetSessionPolicy(time.Hour, 0)
+	})
+
+	fake.InjectMessage(testChatID, e2eUser, CommandStart)
+	waitForCalls(t, fake, "sendMessage", "Role: viewer", 1)
+
+	// An expired session ends, the grant stays and /start restores the granted role
+	tb.sweepSessions(time.Now().Add(2 * time.Hour))
+	fake.WaitFor(t, "sendMessage", "Send /start to sign in again")
+	if tb.isUserAuthorized(testUserID) {
+		t.Fatal("Expected the session to expire")
+	}
+	fake.InjectMessage(testChatID, e2eUser, CommandStart)
+	waitForCalls(t, fake, "sendMessage", "Role: viewer", 2)
+
+	fake.InjectMessage(testChatID, e2eUser, CommandLogout)
+	fake.WaitFor(t, "sendMessage", "Logged out")
+	if _, ok := tb.grants.Get(testUserID); !ok {
+		t.Error("Expected /logout to keep the role grant")
+	}
+	fake.InjectMessage(testChatID, e2eUser, CommandStart)
+	waitForCalls(t, fake, "sendMessage", "Role: viewer", 3)
+	if role, ok := tb.getUserRole(testUserID); !ok || role != RoleViewer {
+		t.Errorf("Expected the granted role after signing in again, got %v %v", role, ok)
+	}
+}
+
+func TestNotificationsNeedSession(t *testing.T) {
+	fake := newFakeTelegram(t)
+	tb := newTestTelegramBot(t, fake)
+	subscriptions, err := NewSubscriptionStore(filepath.Join(t.TempDir(), "subscriptions.json"))
+	if err != nil {
+		t.Fatalf("NewSubscriptionStore failed: %v", err)
+	}
+	tb.SetSubscriptions(subscriptions)
+	subscriptions.Subscribe(testChatID)
+	notice := func(text string) func(Language) string {
+		return func(Language) string { return text }
+	}
+
+	tb.broadcast(notice("first notice"))
+	fake.WaitFor(t, "sendMessage", "first notice")
+
+	// A logged out chat keeps its subscription but receives nothing until someone signs in again
+	tb.handleUpdate(messageUpdate(1, CommandLogout))
+	fake.WaitFor(t, "sendMessage", "Logged out")
+	tb.broadcast(notice("second notice"))
+	if !subscriptions.IsSubscribed(testChatID) {
+		t.Error("Expected the subscription to be kept")
+	}
+
+	tb.authorizeUser(testUserID, testChatID, RoleViewer, VPNStatusUnknown)
+	tb.SetSessionPolicy(time.Hour, 0)
+	tb.userMutex.Lock()
+	tb.authorizedUsers[testUserID].authorizedAt = time.Now().Add(-2 * time.Hour)
+	tb.userMutex.Unlock()
+	tb.broadcast(notice("third notice"))
+
+	tb.authorizeUser(testUserID, testChatID, RoleViewer, VPNStatusUnknown)
+	tb.broadcast(notice("fourth notice"))
+	fake.WaitFor(t, "sendMessage", "fourth notice")
+	for _, notice := range []string{"second notice", "third notice"} {
+		if _, ok := fake.Find("sendMessage", notice); ok {
+			t.Errorf("Expected %q not to reach a chat without a valid session", notice)
+		}
+	}
+}
+
+func TestNotificationsReachPersistedUsersAfterRestart(t *testing.T) {
+	fake := newFakeTelegram(t)
+	tb := newTestTelegramBot(t, fake)
+	dir := t.TempDir()
+	subscriptions, err := NewSubscriptionStore(filepath.Join(dir, "subscriptions.json"))
+	if err != nil {
+		t.Fatalf("NewSubscriptionStore failed: %v", err)
+	}
+	grants, err := NewGrantStore(filepath.Join(dir, "grants.json"))
+	if err != nil {
+		t.Fatalf("NewGrantStore failed: %v", err)
+	}
+	tb.SetSubscriptions(subscriptions)
+	tb.SetGrantStore(grants)
+	tb.SetAdminUsers([]int64{4004})
+
+	// Nobody is signed in to these private chats, as after a restart
+	grants.Grant(3003, RoleViewer, testUserID, "abcd1234")
+	for _, chatID := range []int64{3003, 4004, 5005} {
+		subscriptions.Subscribe(chatID)
+	}
+	tb.broadcast(func(Language) string { return "restart notice" })
+
+	reached := make(map[string]bool)
+	for _, call := range fake.Calls() {
+		if call.Method == "sendMessage" && call.Params["text"] == "restart notice" {
+			reached[call.Params["chat_id"]] = true
+		}
+	}
+	if !reached["3003"] || !reached["4004"] {
+		t.Errorf("Expected the invited user and the admin to be notified, got %v", reached)
+	}
+	if reached["5005"] {
+		t.Error("Expected a chat without persisted access not to be notified")
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// AbandonedUpdates returns how many received updates were dropped because shutdown ran out of time
+func (tb *TelegramBot) AbandonedUpdates() int {
+	return int(tb.abandonedUpdates.Load())
+}
+
+// NotifyShutdown warns about router changes shutdown did not wait for: the Telegram user who
+// started one hears about it directly, other sources are reported to subscribers
+func (tb *TelegramBot) NotifyShutdown(abandoned []RouterOperation) {
+	for _, operation := range abandoned {
+		running := time.Since(operation.StartedAt).Round(time.Second)
+
+		if operation.Actor.Source == "telegram" {
+			if chatID, ok := tb.chatForUser(operation.Actor.UserID); ok {
+				language := tb.languages.Language(operation.Actor.UserID)
+				tb.sendMessage(tgbotapi.NewMessage(chatID, translate(language, msgShutdownInterruptedYou,
+					describeAction(language, operation.Action), running, translate(language, msgButtonStatus))))
+				continue
+			}
+		}
+
+		tb.broadcast(func(language Language) string {
+			return translate(language, msgShutdownInterrupted, describeAction(language, operation.Action), operation.Actor.Source, running)
+		})
+	}
+}
+
+// chatForUser returns the chat of an authorized user
+func (tb *TelegramBot) chatForUser(userID int64) (int64, bool) {
+	tb.userMutex.RLock()
+	defer tb.userMutex.RUnlock()
+
+	user, ok := tb.authorizedUsers[userID]
+	if !ok || user.chatID == 0 {
+		return 0, false
+	}
+	return user.chatID, true
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/sirupsen/logrus"
+)
+
+// Update delivery modes
+const (
+	TelegramModePolling = "polling"
+	TelegramModeWebhook = "webhook"
+)
+
+// webhookSecretHeader carries the secret token Telegram echoes on every webhook request
+const webhookSecretHeader = "X-Telegram-Bot-Api-Secret-Token"
+
+// webhookMaxBodyBytes caps webhook request bodies; updates the bot handles are small
+const webhookMaxBodyBytes = 1 << 20
+
+// webhookSecretPattern is the character set Telegram accepts for secret tokens
+var webhookSecretPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,256}$`)
+
+// webhookUpdateBuffer is how many received updates may wait for the bot, like the polling channel
+const webhookUpdateBuffer = 100
+
+// webhookAllowedUpdates are the update types the bot handles
+var webhookAllowedUpdates = []string{"message", "callback_query"}
+
+// WebhookConfig configures receiving updates by webhook instead of long polling
+type WebhookConfig struct {
+	URL             string // Public HTTPS URL Telegram posts updates to, usually on an ingress in front of the health server
+	SecretToken     string // Telegram sends it in webhookSecretHeader; requests without it are rejected
+	CertificatePath string // Self-signed certificate of the URL's host to upload, if any
+	MaxConnections  int    // Zero keeps Telegram's default
+}
+
+// telegramWebhookAPI is the additional Bot API surface webhooks need; *tgbotapi.BotAPI implements it
+type telegramWebhookAPI interface {
+	MakeRequest(endpoint string, params tgbotapi.Params) (*tgbotapi.APIResponse, error)
+	UploadFiles(endpoint string, params tgbotapi.Params, files []tgbotapi.RequestFile) (*tgbotapi.APIResponse, error)
+	GetWebhookInfo() (tgbotapi.WebhookInfo, error)
+}
+
+// webhookState is the webhook the bot serves
+type webhookState struct {
+	api     telegramWebhookAPI
+	config  WebhookConfig
+	path    string
+	updates chan tgbotapi.Update
+	stopped chan struct{} // Closed when the bot stops receiving updates
+}
+
+// SetWebhook switches update delivery from long polling to a webhook served by WebhookHandler
+func (tb *TelegramBot) SetWebhook(config WebhookConfig) error {
+	link, err := url.Parse(config.URL)
+	if err != nil {
+		return fmt.Errorf("invalid webhook URL: %w", err)
+	}
+	if link.Scheme != "https" || link.Host == "" {
+		return errors.New("webhook URL must be an absolute https URL")
+	}
+	if link.Path == "" || link.Path == "/" {
+		return errors.New("webhook URL needs a path, e.g. /telegram/webhook")
+	}
+	if !webhookSecretPattern.MatchString(config.SecretToken) {
+		return errors.New("webhook secret token must be 1-256 characters of A-Z, a-z, 0-9, _ and -")
+	}
+	api, ok := tb.bot.(telegramWebhookAPI)
+	if !ok {
+		return errors.New("the Telegram client does not support webhooks")
+	}
+
+	tb.webhook = &webhookState{
+		api:     api,
+		config:  config,
+		path:    link.Path,
+		updates: make(chan tgbotapi.Update, webhookUpdateBuffer),
+		stopped: make(chan struct{}),
+	}
+	return nil
+}
+
+// updateMode names how the bot receives updates
+func (tb *TelegramBot) updateMode() string {
+	if tb.webhook != nil {
+		return TelegramModeWebhook
+	}
+	return TelegramModePolling
+}
+
+// WebhookPath returns the path WebhookHandler serves, or "" when the bot uses long polling
+func (tb *TelegramBot) WebhookPath() string {
+	if tb.webhook == nil {
+		return ""
+	}
+	return tb.webhook.path
+}
+
+// WebhookHandler accepts updates posted by Telegram, rejecting requests without the secret token
+func (tb *TelegramBot) WebhookHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", "POST")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		secret := r.Header.Get(webhookSecretHeader)
+		if subtle.ConstantTimeCompare([]byte(secret), []byte(tb.webhook.config.SecretToken)) != 1 {
+			tb.metrics.IncAuthFailure("webhook_secret")
+			tb.logger.WithField("remote_addr", r.RemoteAddr).Warn("Rejected webhook request with a wrong secret token")
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var update tgbotapi.Update
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, webhookMaxBodyBytes)).Decode(&update); err != nil {
+			tb.logger.WithError(err).Warn("Failed to decode webhook update")
+			http.Error(w, "invalid update", http.StatusBadRequest)
+			return
+		}
+
+		// Telegram redelivers updates that are not acknowledged, so wait rather than drop,
+		// and leave them to the next start once the bot is shutting down
+		select {
+		case <-tb.webhook.stopped:
+			http.Error(w, "shutting down", http.StatusServiceUnavailable)
+			return
+		default:
+		}
+		select {
+		case tb.webhook.updates <- update:
+			w.WriteHeader(http.StatusOK)
+		case <-tb.webhook.stopped:
+			http.Error(w, "shutting down", http.StatusServiceUnavailable)
+		case <-r.Context().Done():
+		}
+	})
+}
+
+// registerWebhook points Telegram at the webhook URL, uploading the self-signed certificate if configured
+func (tb *TelegramBot) registerWebhook() error {
+	config := tb.webhook.config
+
+	params := tgbotapi.Params{"url": config.URL}
+	params.AddNonEmpty("secret_token", config.SecretToken)
+	params.AddNonZero("max_connections", config.MaxConnections)
+	if err := params.AddInterface("allowed_updates", webhookAllowedUpdates); err != nil {
+		return err
+	}
+
+	var err error
+	if config.CertificatePath != "" {
+		_, err = tb.webhook.api.UploadFiles("setWebhook", params, []tgbotapi.RequestFile{{
+			Name: "certificate",
+			Data: tgbotapi.FilePath(config.CertificatePath),
+		}})
+	} else {
+		_, err = tb.webhook.api.MakeRequest("setWebhook", params)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to register webhook: %w", err)
+	}
+
+	fields := logrus.Fields{
+		"url":                config.URL,
+		"custom_certificate": config.CertificatePath != "",
+	}
+	if info, err := tb.webhook.api.GetWebhookInfo(); err == nil {
+		fields["pending_updates"] = info.PendingUpdateCount
+		if info.LastErrorMessage != "" {
+			fields["last_error"] = info.LastErrorMessage
+		}
+	}
+	tb.logger.WithFields(fields).Info("Telegram webhook registered")
+	return nil
+}
+
+// removeWebhook deletes a webhook left over from webhook mode, since Telegram refuses
+// getUpdates while one is set
+func (tb *TelegramBot) removeWebhook() error {
+	api, ok := tb.bot.(telegramWebhookAPI)
+	if !ok {
+		return nil
+	}
+	info, err := api.GetWebhookInfo()
+	if err != nil {
+		return fmt.Errorf("failed to get webhook info: %w", err)
+	}
+	if info.URL == "" {
+		return nil
+	}
+
+	if _, err := tb.bot.Request(tgbotapi.DeleteWebhookConfig{}); err != nil {
+		return fmt.Errorf("failed to delete webhook: %w", err)
+	}
+	tb.logger.WithField("url", info.URL).Info("Deleted Telegram webhook to use long polling")
+	return nil
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSetWebhookValidation(t *testing.T) {
+	tb := newTestTelegramBot(t, newFakeTelegram(t))
+
+	tests := []struct {
+		name   string
+		config WebhookConfig
+		valid  bool
+	}{
+		{"valid", WebhookConfig{URL: "https://bot.example.com/telegram/webhook", SecretToken: "s3cret_-token"}, true},
+		{"plain http", WebhookConfig{URL: "http://bot.example.com/telegram/webhook", SecretToken: "secret"}, false},
+		{"relative", WebhookConfig{URL: "/telegram/webhook", SecretToken: "secret"}, false},
+		{"no path", WebhookConfig{URL: "https://bot.example.com/", SecretToken: "secret"}, false},
+		{"no secret", WebhookConfig{URL: "https://bot.example.com/telegram/webhook"}, false},
+		{"invalid secret", WebhookConfig{URL: "https://bot.example.com/telegram/webhook", SecretToken: "not allowed!"}, false},
+	}
+	for _, tt := range tests {
+		if err := tb.SetWebhook(tt.config); (err == nil) != tt.valid {
+			t.Errorf("%s: expected valid %v, got error %v", tt.name, tt.valid, err)
+		}
+	}
+}
+
+func TestWebhookMode(t *testing.T) {
+	fake := newFakeTelegram(t)
+	tb := newTestTelegramBot(t, fake)
+
+	certPath := filepath.Join(t.TempDir(), "webhook.pem")
+	if err := os.WriteFile(certPath, []byte("-----BEGIN CERTIFICATE-----\n"), 0600); err != nil {
+		t.Fatalf("Failed to write certificate: %v", err)
+	}
+	err := tb.SetWebhook(WebhookConfig{
+		URL:             "https://bot.example.com/telegram/webhook",
+		SecretToken:     "secret",
+		CertificatePath: certPath,
+	})
+	if err != nil {
+		t.Fatalf("SetWebhook failed: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go tb.Start(ctx)
+
+	registration := fake.WaitFor(t, "setWebhook", "")
+	if registration.Params["url"] != "https://bot.example.com/telegram/webhook" || registration.Params["secret_token"] != "secret" {
+		t.Errorf("Unexpected registration %v", registration.Params)
+	}
+	if registration.Params["certificate"] == "" {
+		t.Error("Expected the self-signed certificate to be uploaded")
+	}
+	if !strings.Contains(registration.Params["allowed_updates"], "callback_query") {
+		t.Errorf("Unexpected allowed updates %q", registration.Params["allowed_updates"])
+	}
+
+	// The webhook is served on the health server
+	handler := createHealthCheckHandler(tb, nil, nil, nil, nil, nil, "", tb.logger)
+	body, _ := json.Marshal(messageUpdate(1, CommandStart))
+	post := func(method, secret string) int {
+		request := httptest.NewRequest(method, "/telegram/webhook", bytes.NewReader(body))
+		if secret != "" {
+			request.Header.Set(webhookSecretHeader, secret)
+		}
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		return recorder.Code
+	}
+
+	if code := post(http.MethodPost, ""); code != http.StatusUnauthorized {
+		t.Errorf("Missing secret: expected 401, got %d", code)
+	}
+	if code := post(http.MethodPost, "wrong"); code != http.StatusUnauthorized {
+		t.Errorf("Wrong secret: expected 401, got %d", code)
+	}
+	if code := post(http.MethodGet, "secret"); code != http.StatusMethodNotAllowed {
+		t.Errorf("GET: expected 405, got %d", code)
+	}
+	if _, ok := fake.Find("sendMessage", ""); ok {
+		t.Fatal("A rejected request reached the bot")
+	}
+
+	if code := post(http.MethodPost, "secret"); code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", code)
+	}
+	fake.WaitFor(t, "sendMessage", "")
+}
+
+func TestPollingModeRemovesWebhook(t *testing.T) {
+	fake := newFakeTelegram(t)
+	fake.SetWebhookURL("https://bot.example.com/telegram/webhook")
+	tb := newTestTelegramBot(t, fake)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go tb.Start(ctx)
+
+	fake.WaitFor(t, "deleteWebhook", "")
+}
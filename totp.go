@@ -0,0 +1,407 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// TOTP parameters used for enrollment; these match what authenticator apps expect by default
+const (
+	totpDigits     = 6
+	totpPeriod     = 30 * time.Second
+	totpSecretSize = 20
+)
+
+// Invalid codes are allowed a few free attempts, then each further failure locks the user
+// out for twice as long as the previous one, so the 10^6 codes cannot be brute forced
+const (
+	totpFreeAttempts = 3
+	totpBaseLockout  = 30 * time.Second
+	totpMaxLockout   = 15 * time.Minute
+)
+
+var (
+	errTOTPNotEnrolled        = errors.New("two-factor authentication is not enrolled")
+	errTOTPAlreadyEnrolled    = errors.New("two-factor authentication is already enrolled")
+	errTOTPInvalidCode        = errors.New("invalid two-factor code")
+	errTOTPEnrollmentRequired = errors.New("two-factor enrollment is required for this action")
+)
+
+// totpLockedError is returned while a user is locked out after too many invalid codes
+type totpLockedError struct {
+	wait time.Duration
+}
+
+func (e *totpLockedError) Error() string {
+	return fmt.Sprintf("too many invalid codes, try again in %s", e.wait)
+}
+
+// totpAlgorithm selects the HMAC hash function used by TOTP
+type totpAlgorithm string
+
+const (
+	totpSHA1   totpAlgorithm = "SHA1"
+	totpSHA256 totpAlgorithm = "SHA256"
+	totpSHA512 totpAlgorithm = "SHA512"
+)
+
+// hashFunc returns the hash constructor for the algorithm
+func (a totpAlgorithm) hashFunc() func() hash.Hash {
+	switch a {
+	case totpSHA256:
+		return sha256.New
+	case totpSHA512:
+		return sha512.New
+	default:
+		return sha1.New
+	}
+}
+
+// hotp computes an RFC 4226 HMAC-based one-time password for the given counter
+func hotp(key []byte, counter uint64, digits int, algorithm totpAlgorithm) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], counter)
+
+	mac := hmac.New(algorithm.hashFunc(), key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	// Dynamic truncation as described in RFC 4226 section 5.3
+	offset := sum[len(sum)-1] & 0x0f
+	code := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	modulo := uint32(1)
+	for i := 0; i < digits; i++ {
+		modulo *= 10
+	}
+
+	return fmt.Sprintf("%0*d", digits, code%modulo)
+}
+
+// totpCounter returns the RFC 6238 time step counter for t
+func totpCounter(t time.Time, period time.Duration) uint64 {
+	return uint64(t.Unix()) / uint64(period/time.Second)
+}
+
+// totpCode computes an RFC 6238 time-based one-time password
+func totpCode(key []byte, t time.Time, period time.Duration, digits int, algorithm totpAlgorithm) string {
+	return hotp(key, totpCounter(t, period), digits, algorithm)
+}
+
+// generateTOTPSecret returns a random base32-encoded secret suitable for authenticator apps
+func generateTOTPSecret() (string, error) {
+	secret := make([]byte, totpSecretSize)
+	if _, err := rand.Read(secret); err != nil {
+		return "", fmt.Errorf("failed to generate TOTP secret: %w", err)
+	}
+	return base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(secret), nil
+}
+
+// decodeTOTPSecret decodes a base32 secret, tolerating lowercase and missing padding
+func decodeTOTPSecret(secret string) ([]byte, error) {
+	secret = strings.ToUpper(strings.TrimRight(strings.TrimSpace(secret), "="))
+	return base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret)
+}
+
+// totpURI builds an otpauth:// provisioning URI understood by authenticator apps
+func totpURI(issuer, account, secret string) string {
+	label := url.PathEscape(issuer + ":" + account)
+	params := url.Values{}
+	params.Set("secret", secret)
+	params.Set("issuer", issuer)
+	params.Set("algorithm", string(totpSHA1))
+	params.Set("digits", fmt.Sprintf("%d", totpDigits))
+	params.Set("period", fmt.Sprintf("%d", int(totpPeriod/time.Second)))
+	return "otpauth://totp/" + label + "?" + params.Encode()
+}
+
+// TOTPConfig holds the tunable settings of the second factor
+type TOTPConfig struct {
+	Issuer           string        // Name shown in authenticator apps
+	GracePeriod      time.Duration // How long a verified code unlocks further protected actions
+	Skew             int           // Number of adjacent time steps accepted to tolerate clock drift
+	Required         bool          // Deny protected actions to users without an enrollment
+	ProtectedActions []Action      // Actions that require a fresh code
+}
+
+// totpEnrollment is the persisted second-factor state of a single user
+// The failure count and lockout are persisted too, so a restart does not reset brute-force protection
+type totpEnrollment struct {
+	Secret      string    `json:"secret"`
+	Confirmed   bool      `json:"confirmed"`
+	LastCounter uint64    `json:"last_counter"`
+	CreatedAt   time.Time `json:"created_at"`
+	Failures    int       `json:"failures,omitempty"`     // Consecutive invalid codes
+	LockedUntil time.Time `json:"locked_until,omitempty"` // No code is checked before this time
+}
+
+// TOTPManager stores per-user TOTP enrollments and tracks recent verifications
+type TOTPManager struct {
+	path        string
+	config      TOTPConfig
+	protected   map[Action]bool
+	logger      *logrus.Logger
+	enrollments map[int64]*totpEnrollment
+	verifiedAt  map[int64]time.Time
+	mutex       sync.Mutex
+	now         func() time.Time
+}
+
+// NewTOTPManager creates a TOTP manager persisting enrollments to path
+func NewTOTPManager(path string, config TOTPConfig, logger *logrus.Logger) (*TOTPManager, error) {
+	if config.Issuer == "" {
+		config.Issuer = "VPN Commander"
+	}
+	if config.Skew < 0 {
+		config.Skew = 0
+	}
+
+	tm := &TOTPManager{
+		path:        path,
+		config:      config,
+		protected:   make(map[Action]bool),
+		logger:      logger,
+		enrollments: make(map[int64]*totpEnrollment),
+		verifiedAt:  make(map[int64]time.Time),
+		now:         time.Now,
+	}
+	for _, action := range config.ProtectedActions {
+		tm.protected[action] = true
+	}
+
+	if err := loadJSONFile(path, &tm.enrollments); err != nil {
+		return nil, fmt.Errorf("failed to load TOTP enrollments: %w", err)
+	}
+
+	return tm, nil
+}
+
+// IsProtected reports whether an action requires a fresh second factor
+func (tm *TOTPManager) IsProtected(action Action) bool {
+	return tm.protected[action]
+}
+
+// IsEnrolled reports whether a user has a confirmed TOTP enrollment
+func (tm *TOTPManager) IsEnrolled(userID int64) bool {
+	tm.mutex.Lock()
+	defer tm.mutex.Unlock()
+	enrollment, exists := tm.enrollments[userID]
+	return exists && enrollment.Confirmed
+}
+
+// Enroll starts a new enrollment and returns the provisioning URI and secret
+// The enrollment stays inactive until confirmed with a valid code
+func (tm *TOTPManager) Enroll(userID int64, account string) (string, string, error) {
+	tm.mutex.Lock()
+	defer tm.mutex.Unlock()
+
+	if enrollment, exists := tm.enrollments[userID]; exists && enrollment.Confirmed {
+		return "", "", errTOTPAlreadyEnrolled
+	}
+
+	secret, err := generateTOTPSecret()
+	if err != nil {
+		return "", "", err
+	}
+
+	tm.enrollments[userID] = &totpEnrollment{
+		Secret:    secret,
+		CreatedAt: tm.now(),
+	}
+	if err := tm.save(); err != nil {
+		return "", "", err
+	}
+
+	tm.logger.WithField("user_id", userID).Info("TOTP enrollment started")
+	return totpURI(tm.config.Issuer, account, secret), secret, nil
+}
+
+// Confirm activates a pending enrollment once the user proves possession of the secret
+func (tm *TOTPManager) Confirm(userID int64, code string) error {
+	tm.mutex.Lock()
+	defer tm.mutex.Unlock()
+
+	enrollment, exists := tm.enrollments[userID]
+	if !exists {
+		return errTOTPNotEnrolled
+	}
+	if enrollment.Confirmed {
+		return errTOTPAlreadyEnrolled
+	}
+
+	if err := tm.attempt(userID, enrollment, code); err != nil {
+		return err
+	}
+
+	enrollment.Confirmed = true
+	tm.verifiedAt[userID] = tm.now()
+	if err := tm.save(); err != nil {
+		return err
+	}
+
+	tm.logger.WithField("user_id", userID).Info("TOTP enrollment confirmed")
+	return nil
+}
+
+// Disable removes a confirmed enrollment after validating a current code
+func (tm *TOTPManager) Disable(userID int64, code string) error {
+	tm.mutex.Lock()
+	defer tm.mutex.Unlock()
+
+	enrollment, exists := tm.enrollments[userID]
+	if !exists || !enrollment.Confirmed {
+		return errTOTPNotEnrolled
+	}
+
+	if err := tm.attempt(userID, enrollment, code); err != nil {
+		return err
+	}
+
+	delete(tm.enrollments, userID)
+	delete(tm.verifiedAt, userID)
+	if err := tm.save(); err != nil {
+		return err
+	}
+
+	tm.logger.WithField("user_id", userID).Info("TOTP enrollment disabled")
+	return nil
+}
+
+// Verify validates a code for an enrolled user and opens the grace window
+func (tm *TOTPManager) Verify(userID int64, code string) error {
+	tm.mutex.Lock()
+	defer tm.mutex.Unlock()
+
+	enrollment, exists := tm.enrollments[userID]
+	if !exists || !enrollment.Confirmed {
+		return errTOTPNotEnrolled
+	}
+
+	if err := tm.attempt(userID, enrollment, code); err != nil {
+		tm.logger.WithField("user_id", userID).WithError(err).Warn("TOTP verification failed")
+		return err
+	}
+
+	tm.verifiedAt[userID] = tm.now()
+	if err := tm.save(); err != nil {
+		tm.logger.WithError(err).Warn("Failed to persist TOTP counter")
+	}
+	return nil
+}
+
+// RequiresCode reports whether the user must enter a code before performing action
+// It returns errTOTPEnrollmentRequired when enrollment is mandatory but missing
+func (tm *TOTPManager) RequiresCode(userID int64, action Action) (bool, error) {
+	if !tm.IsProtected(action) {
+		return false, nil
+	}
+
+	tm.mutex.Lock()
+	defer tm.mutex.Unlock()
+
+	enrollment, exists := tm.enrollments[userID]
+	if !exists || !enrollment.Confirmed {
+		if tm.config.Required {
+			return false, errTOTPEnrollmentRequired
+		}
+		return false, nil
+	}
+
+	if verifiedAt, ok := tm.verifiedAt[userID]; ok && tm.now().Sub(verifiedAt) < tm.config.GracePeriod {
+		return false, nil
+	}
+	return true, nil
+}
+
+// attempt checks code unless the user is locked out, counting and persisting consecutive failures
+// Caller must hold tm.mutex
+func (tm *TOTPManager) attempt(userID int64, enrollment *totpEnrollment, code string) error {
+	now := tm.now()
+	if now.Before(enrollment.LockedUntil) {
+		return &totpLockedError{wait: enrollment.LockedUntil.Sub(now).Round(time.Second)}
+	}
+
+	if err := tm.check(enrollment, code); err != nil {
+		if !errors.Is(err, errTOTPInvalidCode) {
+			return err
+		}
+		enrollment.Failures++
+		if excess := enrollment.Failures - totpFreeAttempts; excess > 0 {
+			lockout := totpBaseLockout
+			for i := 1; i < excess && lockout < totpMaxLockout; i++ {
+				lockout *= 2
+			}
+			if lockout > totpMaxLockout {
+				lockout = totpMaxLockout
+			}
+			enrollment.LockedUntil = now.Add(lockout)
+			tm.logger.WithFields(logrus.Fields{
+				"user_id":  userID,
+				"failures": enrollment.Failures,
+				"lockout":  lockout,
+			}).Warn("Too many invalid TOTP codes, locking out")
+		}
+		if saveErr := tm.save(); saveErr != nil {
+			tm.logger.WithError(saveErr).Warn("Failed to persist TOTP failures")
+		}
+		return err
+	}
+
+	enrollment.Failures = 0
+	enrollment.LockedUntil = time.Time{}
+	return nil
+}
+
+// check validates code against the enrollment, rejecting replays of already used time steps
+// Caller must hold tm.mutex
+func (tm *TOTPManager) check(enrollment *totpEnrollment, code string) error {
+	code = strings.TrimSpace(code)
+	if len(code) != totpDigits {
+		return errTOTPInvalidCode
+	}
+
+	key, err := decodeTOTPSecret(enrollment.Secret)
+	if err != nil {
+		return fmt.Errorf("corrupted TOTP secret: %w", err)
+	}
+
+	current := totpCounter(tm.now(), totpPeriod)
+	for offset := -tm.config.Skew; offset <= tm.config.Skew; offset++ {
+		counter := uint64(int64(current) + int64(offset))
+		if counter <= enrollment.LastCounter {
+			continue
+		}
+
+		expected := hotp(key, counter, totpDigits, totpSHA1)
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			enrollment.LastCounter = counter
+			return nil
+		}
+	}
+
+	return errTOTPInvalidCode
+}
+
+// save persists enrollments to disk
+// Caller must hold tm.mutex
+func (tm *TOTPManager) save() error {
+	if err := saveJSONFile(tm.path, tm.enrollments); err != nil {
+		return fmt.Errorf("failed to save TOTP enrollments: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// RFC 6238 Appendix B test vectors
+func TestTOTPCodeRFC6238Vectors(t *testing.T) {
+	keys := map[totpAlgorithm][]byte{
+		totpSHA1:   []byte("12345678901234567890"),
+		totpSHA256: []byte("12345678901234567890123456789012"),
+		totpSHA512: []byte("1234567890123456789012345678901234567890123456789012345678901234"),
+	}
+
+	tests := []struct {
+		unix      int64
+		algorithm totpAlgorithm
+		expected  string
+	}{
+		{59, totpSHA1, "94287082"},
+		{59, totpSHA256, "46119246"},
+		{59, totpSHA512, "90693936"},
+		{1111111109, totpSHA1, "07081804"},
+		{1111111109, totpSHA256, "68084774"},
+		{1111111109, totpSHA512, "25091201"},
+		{1111111111, totpSHA1, "14050471"},
+		{1111111111, totpSHA256, "67062674"},
+		{1111111111, totpSHA512, "99943326"},
+		{1234567890, totpSHA1, "89005924"},
+		{1234567890, totpSHA256, "91819424"},
+		{1234567890, totpSHA512, "93441116"},
+		{2000000000, totpSHA1, "69279037"},
+		{2000000000, totpSHA256, "90698825"},
+		{2000000000, totpSHA512, "38618901"},
+		{20000000000, totpSHA1, "65353130"},
+		{20000000000, totpSHA256, "77737706"},
+		{20000000000, totpSHA512, "47863826"},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.algorithm), func(t *testing.T) {
+			code := totpCode(keys[tt.algorithm], time.Unix(tt.unix, 0), totpPeriod, 8, tt.algorithm)
+			if code != tt.expected {
+				t.Errorf("At %d expected %s, got %s", tt.unix, tt.expected, code)
+			}
+		})
+	}
+}
+
+// RFC 4226 Appendix D test vectors
+func TestHOTPRFC4226Vectors(t *testing.T) {
+	key := []byte("12345678901234567890")
+	expected := []string{
+		"755224", "287082", "359152", "969429", "338314",
+		"254676", "287922", "162583", "399871", "520489",
+	}
+
+	for counter, want := range expected {
+		if got := hotp(key, uint64(counter), 6, totpSHA1); got != want {
+			t.Errorf("Counter %d: expected %s, got %s", counter, want, got)
+		}
+	}
+}
+
+func TestTOTPManagerEnrollmentFlow(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+
+	path := filepath.Join(t.TempDir(), "totp.json")
+	config := TOTPConfig{
+		GracePeriod:      5 * time.Minute,
+		Skew:             1,
+		ProtectedActions: []Action{ActionStopService},
+	}
+
+	manager, err := NewTOTPManager(path, config, logger)
+	if err != nil {
+		t.Fatalf("NewTOTPManager failed: %v", err)
+	}
+
+	now := time.Unix(1700000000, 0)
+	manager.now = func() time.Time { return now }
+
+	const userID = 42
+	_, secret, err := manager.Enroll(userID, "alice")
+	if err != nil {
+		t.Fatalf("Enroll failed: %v", err)
+	}
+
+	if required, _ := manager.RequiresCode(userID, ActionStopService); required {
+		t.Error("Unconfirmed enrollment should not require a code")
+	}
+
+	key, _ := decodeTOTPSecret(secret)
+	code := totpCode(key, now, totpPeriod, totpDigits, totpSHA1)
+	if err := manager.Confirm(userID, code); err != nil {
+		t.Fatalf("Confirm failed: %v", err)
+	}
+
+	// Confirmation opens the grace window
+	if required, _ := manager.RequiresCode(userID, ActionStopService); required {
+		t.Error("Expected grace window right after confirmation")
+	}
+
+	now = now.Add(10 * time.Minute)
+	if required, _ := manager.RequiresCode(userID, ActionStopService); !required {
+		t.Error("Expected code to be required after grace window")
+	}
+	if required, _ := manager.RequiresCode(userID, ActionEnableVPN); required {
+		t.Error("Unprotected action should never require a code")
+	}
+
+	code = totpCode(key, now, totpPeriod, totpDigits, totpSHA1)
+	if err := manager.Verify(userID, code); err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+	if err := manager.Verify(userID, code); err != errTOTPInvalidCode {
+		t.Errorf("Expected replayed code to be rejected, got %v", err)
+	}
+
+	// Enrollments survive a restart
+	reloaded, err := NewTOTPManager(path, config, logger)
+	if err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	if !reloaded.IsEnrolled(userID) {
+		t.Error("Expected enrollment to be persisted")
+	}
+}
+
+func TestTOTPManagerRequired(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+
+	manager, err := NewTOTPManager(filepath.Join(t.TempDir(), "totp.json"), TOTPConfig{
+		Required:         true,
+		ProtectedActions: []Action{ActionStopService},
+	}, logger)
+	if err != nil {
+		t.Fatalf("NewTOTPManager failed: %v", err)
+	}
+
+	if _, err := manager.RequiresCode(1, ActionStopService); err != errTOTPEnrollmentRequired {
+		t.Errorf("Expected errTOTPEnrollmentRequired, got %v", err)
+	}
+}
+
+func TestTOTPManagerLockout(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.FatalLevel)
+
+	path := filepath.Join(t.TempDir(), "totp.json")
+	manager, err := NewTOTPManager(path, TOTPConfig{}, logger)
+	if err != nil {
+		t.Fatalf("NewTOTPManager failed: %v", err)
+	}
+	now := time.Unix(1700000000, 0)
+	manager.now = func() time.Time { return now }
+
+	const userID = 42
+	_, secret, _ := manager.Enroll(userID, "alice")
+	key, _ := decodeTOTPSecret(secret)
+	if err := manager.Confirm(userID, totpCode(key, now, totpPeriod, totpDigits, totpSHA1)); err != nil {
+		t.Fatalf("Confirm failed: %v", err)
+	}
+
+	now = now.Add(totpPeriod)
+	var locked *totpLockedError
+	for i := 0; i < totpFreeAttempts; i++ {
+		if err := manager.Verify(userID, "000000"); err != errTOTPInvalidCode {
+			t.Fatalf("Attempt %d: expected errTOTPInvalidCode, got %v", i+1, err)
+		}
+	}
+	if err := manager.Verify(userID, "000000"); err != errTOTPInvalidCode {
+		t.Fatalf("Expected the failure that triggers the lockout to be reported as invalid, got %v", err)
+	}
+
+	// Even the right code is refused while locked out
+	if err := manager.Verify(userID, totpCode(key, now, totpPeriod, totpDigits, totpSHA1)); !errors.As(err, &locked) {
+		t.Fatalf("Expected a lockout, got %v", err)
+	}
+
+	// The lockout survives a restart
+	manager, err = NewTOTPManager(path, TOTPConfig{}, logger)
+	if err != nil {
+		t.Fatalf("Reloading failed: %v", err)
+	}
+	manager.now = func() time.Time { return now }
+	if err := manager.Verify(userID, totpCode(key, now, totpPeriod, totpDigits, totpSHA1)); !errors.As(err, &locked) {
+		t.Fatalf("Expected the lockout after a restart, got %v", err)
+	}
+
+	// Each further failure doubles the lockout
+	now = now.Add(totpBaseLockout)
+	manager.Verify(userID, "000000")
+	now = now.Add(totpBaseLockout)
+	if err := manager.Verify(userID, "000000"); !errors.As(err, &locked) || locked.wait != totpBaseLockout {
+		t.Fatalf("Expected the second lockout to last %s more, got %v", totpBaseLockout, err)
+	}
+
+	now = now.Add(totpBaseLockout)
+	if err := manager.Verify(userID, totpCode(key, now, totpPeriod, totpDigits, totpSHA1)); err != nil {
+		t.Fatalf("Expected the right code after the lockout, got %v", err)
+	}
+	if err := manager.Verify(userID, "000000"); err != errTOTPInvalidCode {
+		t.Errorf("Expected a success to reset the counter, got %v", err)
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/sirupsen/logrus"
+)
+
+// Update processing defaults
+const (
+	defaultUpdateWorkers      = 8
+	defaultUpdateQueueSize    = 16
+	defaultUpdateDrainTimeout = 10 * time.Second
+)
+
+// UpdateDispatcher handles updates concurrently across chats while keeping each chat's updates in order
+// Every chat with pending updates gets its own queue, drained by one goroutine at a time so a slow
+// action only delays the chat that asked for it
+type UpdateDispatcher struct {
+	handle    func(tgbotapi.Update)
+	queueSize int
+	logger    *logrus.Logger
+	busy      func(tgbotapi.Update) // Tells the sender of a dropped update to slow down; may be nil
+	slots     chan struct{}         // Bounds the number of updates handled at once
+	mutex     sync.Mutex
+	queues    map[int64][]tgbotapi.Update // chatID -> pending updates; present while the chat is being drained
+	full      map[int64]bool              // Chats told their queue is full since it last shrank
+	closed    bool                        // No more updates are accepted
+	abandoned bool                        // Pending updates are dropped instead of handled
+	running   sync.WaitGroup
+}
+
+// NewUpdateDispatcher creates a dispatcher running at most workers handlers at once,
+// with up to queueSize updates waiting per chat
+func NewUpdateDispatcher(workers, queueSize int, handle func(tgbotapi.Update), logger *logrus.Logger) *UpdateDispatcher {
+	if workers <= 0 {
+		workers = defaultUpdateWorkers
+	}
+	if queueSize <= 0 {
+		queueSize = defaultUpdateQueueSize
+	}
+	return &UpdateDispatcher{
+		handle:    handle,
+		queueSize: queueSize,
+		logger:    logger,
+		slots:     make(chan struct{}, workers),
+		queues:    make(map[int64][]tgbotapi.Update),
+		full:      make(map[int64]bool),
+	}
+}
+
+// SetBusyHandler registers a callback invoked, once per chat until its queue shrinks, when an update
+// is dropped because the chat's queue is full
+func (d *UpdateDispatcher) SetBusyHandler(busy func(tgbotapi.Update)) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.busy = busy
+}
+
+// SetUpdateProcessing configures how many updates are handled at once, how many may wait per chat
+// and how long shutdown waits for queued updates
+func (tb *TelegramBot) SetUpdateProcessing(workers, queueSize int, drainTimeout time.Duration) {
+	if workers > 0 {
+		tb.updateWorkers = workers
+	}
+	if queueSize > 0 {
+		tb.updateQueueSize = queueSize
+	}
+	if drainTimeout > 0 {
+		tb.updateDrainTimeout = drainTimeout
+	}
+
+	tb.logger.WithFields(logrus.Fields{
+		"workers":       tb.updateWorkers,
+		"queue_size":    tb.updateQueueSize,
+		"drain_timeout": tb.updateDrainTimeout,
+	}).Info("Update processing configured")
+}
+
+// replyBusy tells an authorized sender that their update was dropped because their chat is still busy
+func (tb *TelegramBot) replyBusy(update tgbotapi.Update) {
+	switch {
+	case update.CallbackQuery != nil && update.CallbackQuery.From != nil:
+		if tb.isUserAuthorized(update.CallbackQuery.From.ID) {
+			tb.answerCallback(update.CallbackQuery.ID, translate(tb.userLanguage(update.CallbackQuery.From), msgBusy), true)
+		}
+	case update.Message != nil && update.Message.From != nil && update.Message.Chat != nil:
+		if tb.isUserAuthorized(update.Message.From.ID) {
+			tb.sendMessage(tgbotapi.NewMessage(update.Message.Chat.ID, translate(tb.userLanguage(update.Message.From), msgBusy)))
+		}
+	}
+}
+
+// Submit queues an update behind the earlier updates of its chat
+// When the chat's queue is full the update is dropped rather than waited for, so a chat flooding
+// a slow action cannot stall receiving for every other chat. It returns false if the update was
+// not queued because the queue was full, ctx ended or the dispatcher is draining.
+func (d *UpdateDispatcher) Submit(ctx context.Context, update tgbotapi.Update) bool {
+	chatID := updateChatID(update)
+
+	d.mutex.Lock()
+	if d.closed || ctx.Err() != nil {
+		d.mutex.Unlock()
+		d.logger.WithField("chat_id", chatID).Warn("Dropped update received while shutting down")
+		return false
+	}
+
+	queue, draining := d.queues[chatID]
+	if len(queue) >= d.queueSize {
+		busy := d.busy
+		if d.full[chatID] {
+			busy = nil
+		}
+		d.full[chatID] = true
+		d.mutex.Unlock()
+
+		d.logger.WithFields(logrus.Fields{
+			"chat_id":    chatID,
+			"queue_size": d.queueSize,
+		}).Warn("Update queue of chat is full, dropped update")
+		if busy != nil {
+			// Replying talks to Telegram; keep it off the receive loop
+			go busy(update)
+		}
+		return false
+	}
+
+	d.queues[chatID] = append(queue, update)
+	if !draining {
+		d.running.Add(1)
+		go d.drain(chatID)
+	}
+	d.mutex.Unlock()
+	return true
+}
+
+// drain handles the updates of a chat in order until its queue is empty
+func (d *UpdateDispatcher) drain(chatID int64) {
+	defer d.running.Done()
+
+	d.slots <- struct{}{}
+	defer func() { <-d.slots }()
+
+	for {
+		d.mutex.Lock()
+		queue := d.queues[chatID]
+		if len(queue) == 0 || d.abandoned {
+			delete(d.queues, chatID)
+			delete(d.full, chatID)
+			d.mutex.Unlock()
+			return
+		}
+		update := queue[0]
+		d.queues[chatID] = queue[1:]
+		delete(d.full, chatID)
+		d.mutex.Unlock()
+
+		d.handle(update)
+	}
+}
+
+// Drain stops accepting updates and waits until every queued update has been handled or ctx ends
+// It returns the number of queued updates per chat abandoned because ctx ended first; handlers
+// already running are not interrupted
+func (d *UpdateDispatcher) Drain(ctx context.Context) map[int64]int {
+	d.mutex.Lock()
+	d.closed = true
+	d.mutex.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		d.running.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.abandoned = true
+	abandoned := make(map[int64]int)
+	for chatID, queue := range d.queues {
+		if len(queue) > 0 {
+			abandoned[chatID] = len(queue)
+		}
+	}
+	return abandoned
+}
+
+// updateChatID returns the chat an update belongs to, or 0 for updates without one
+func updateChatID(update tgbotapi.Update) int64 {
+	switch {
+	case update.Message != nil && update.Message.Chat != nil:
+		return update.Message.Chat.ID
+	case update.CallbackQuery != nil && update.CallbackQuery.Message != nil && update.CallbackQuery.Message.Chat != nil:
+		return update.CallbackQuery.Message.Chat.ID
+	case update.CallbackQuery != nil && update.CallbackQuery.From != nil:
+		return update.CallbackQuery.From.ID
+	default:
+		return 0
+	}
+}
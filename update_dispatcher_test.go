@@ -0,0 +1,238 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/sirupsen/logrus"
+)
+
+// chatUpdate builds a text message update in chatID
+func chatUpdate(chatID int64, text string) tgbotapi.Update {
+	return tgbotapi.Update{Message: &tgbotapi.Message{
+		Chat: &tgbotapi.Chat{ID: chatID},
+		From: &tgbotapi.User{ID: chatID},
+		Text: text,
+	}}
+}
+
+// handledUpdates records the updates a dispatcher handles, blocking on texts listed in gates
+type handledUpdates struct {
+	mutex   sync.Mutex
+	handled []string
+	gates   map[string]chan struct{}
+	seen    chan string
+}
+
+func newHandledUpdates(gated ...string) *handledUpdates {
+	h := &handledUpdates{gates: make(map[string]chan struct{}), seen: make(chan string, 1000)}
+	for _, text := range gated {
+		h.gates[text] = make(chan struct{})
+	}
+	return h
+}
+
+func (h *handledUpdates) handle(update tgbotapi.Update) {
+	h.seen <- update.Message.Text
+	if gate, ok := h.gates[update.Message.Text]; ok {
+		<-gate
+	}
+	h.mutex.Lock()
+	h.handled = append(h.handled, update.Message.Text)
+	h.mutex.Unlock()
+}
+
+func (h *handledUpdates) waitSeen(t *testing.T, text string) {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case seen := <-h.seen:
+			if seen == text {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("Update %q was not handled", text)
+		}
+	}
+}
+
+func (h *handledUpdates) snapshot() []string {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return append([]string(nil), h.handled...)
+}
+
+func newTestDispatcher(workers, queueSize int, h *handledUpdates) *UpdateDispatcher {
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+	return NewUpdateDispatcher(workers, queueSize, h.handle, logger)
+}
+
+func TestDispatcherSlowChatDoesNotBlockOthers(t *testing.T) {
+	h := newHandledUpdates("restart")
+	d := newTestDispatcher(4, 8, h)
+	ctx := context.Background()
+
+	d.Submit(ctx, chatUpdate(1, "restart"))
+	d.Submit(ctx, chatUpdate(1, "status after restart"))
+	h.waitSeen(t, "restart")
+
+	// Another chat is served while the first one is busy
+	d.Submit(ctx, chatUpdate(2, "status"))
+	h.waitSeen(t, "status")
+
+	// The first chat's next update waits for the slow one
+	if handled := h.snapshot(); len(handled) != 1 || handled[0] != "status" {
+		t.Fatalf("Expected only the other chat to be handled, got %q", handled)
+	}
+
+	close(h.gates["restart"])
+	if abandoned := d.Drain(ctx); len(abandoned) != 0 {
+		t.Fatalf("Expected nothing abandoned, got %v", abandoned)
+	}
+	handled := h.snapshot()
+	if len(handled) != 3 || handled[1] != "restart" || handled[2] != "status after restart" {
+		t.Errorf("Unexpected order %q", handled)
+	}
+}
+
+func TestDispatcherPreservesOrderPerChat(t *testing.T) {
+	h := newHandledUpdates()
+	d := newTestDispatcher(2, 100, h)
+	ctx := context.Background()
+
+	for i := 0; i < 50; i++ {
+		for chatID := int64(1); chatID <= 3; chatID++ {
+			d.Submit(ctx, chatUpdate(chatID, fmt.Sprintf("%d:%d", chatID, i)))
+		}
+	}
+	d.Drain(ctx)
+
+	next := map[int64]int{}
+	for _, text := range h.snapshot() {
+		var chatID int64
+		var i int
+		fmt.Sscanf(text, "%d:%d", &chatID, &i)
+		if i != next[chatID] {
+			t.Fatalf("Chat %d: expected update %d, got %d", chatID, next[chatID], i)
+		}
+		next[chatID]++
+	}
+	for chatID, count := range next {
+		if count != 50 {
+			t.Errorf("Chat %d: expected 50 updates, got %d", chatID, count)
+		}
+	}
+}
+
+func TestDispatcherDropsWhenQueueFull(t *testing.T) {
+	h := newHandledUpdates("first")
+	d := newTestDispatcher(2, 1, h)
+	busy := make(chan string, 10)
+	d.SetBusyHandler(func(update tgbotapi.Update) { busy <- update.Message.Text })
+	ctx := context.Background()
+
+	d.Submit(ctx, chatUpdate(1, "first"))
+	h.waitSeen(t, "first")
+	d.Submit(ctx, chatUpdate(1, "second"))
+
+	// A full queue drops the update at once instead of stalling every other chat
+	submitted := make(chan bool)
+	go func() { submitted <- d.Submit(ctx, chatUpdate(1, "third")) }()
+	select {
+	case ok := <-submitted:
+		if ok {
+			t.Fatal("Expected the update to a full queue to be dropped")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Submit to a full queue blocked")
+	}
+	if d.Submit(ctx, chatUpdate(1, "fourth")) {
+		t.Fatal("Expected the update to a full queue to be dropped")
+	}
+	if !d.Submit(ctx, chatUpdate(2, "other chat")) {
+		t.Fatal("Expected another chat to be served")
+	}
+	h.waitSeen(t, "other chat")
+
+	// The chat is told once, not for every dropped update
+	select {
+	case text := <-busy:
+		if text != "third" {
+			t.Errorf("Expected the first dropped update to be answered, got %q", text)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("The sender of the dropped update was not told")
+	}
+	select {
+	case text := <-busy:
+		t.Errorf("Expected a single busy reply, also got one for %q", text)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(h.gates["first"])
+	d.Drain(ctx)
+	if handled := h.snapshot(); len(handled) != 3 || handled[0] != "other chat" || handled[2] != "second" {
+		t.Errorf("Expected the dropped updates not to be handled, got %q", handled)
+	}
+
+	// Submits with an ended context are refused
+	cancelCtx, cancel := context.WithCancel(ctx)
+	cancel()
+	if d.Submit(cancelCtx, chatUpdate(3, "cancelled")) {
+		t.Error("Expected the update to be dropped after cancellation")
+	}
+}
+
+func TestDispatcherDrain(t *testing.T) {
+	h := newHandledUpdates("stuck")
+	d := newTestDispatcher(1, 8, h)
+	ctx := context.Background()
+
+	d.Submit(ctx, chatUpdate(1, "stuck"))
+	h.waitSeen(t, "stuck")
+	d.Submit(ctx, chatUpdate(1, "queued"))
+	d.Submit(ctx, chatUpdate(2, "other chat"))
+
+	drainCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	if abandoned := d.Drain(drainCtx); len(abandoned) != 2 || abandoned[1] != 1 || abandoned[2] != 1 {
+		t.Errorf("Expected one abandoned update in each chat, got %v", abandoned)
+	}
+	if d.Submit(ctx, chatUpdate(3, "late")) {
+		t.Error("Expected updates to be refused after draining")
+	}
+
+	// Abandoned updates are not handled once the stuck handler returns
+	close(h.gates["stuck"])
+	d.running.Wait()
+	if handled := h.snapshot(); len(handled) != 1 || handled[0] != "stuck" {
+		t.Errorf("Unexpected handled updates %q", handled)
+	}
+}
+
+func TestUpdateChatID(t *testing.T) {
+	callback := tgbotapi.Update{CallbackQuery: &tgbotapi.CallbackQuery{
+		From:    &tgbotapi.User{ID: 7},
+		Message: &tgbotapi.Message{Chat: &tgbotapi.Chat{ID: 42}},
+	}}
+	inline := tgbotapi.Update{CallbackQuery: &tgbotapi.CallbackQuery{From: &tgbotapi.User{ID: 7}}}
+
+	if id := updateChatID(chatUpdate(5, "hi")); id != 5 {
+		t.Errorf("Message: expected 5, got %d", id)
+	}
+	if id := updateChatID(callback); id != 42 {
+		t.Errorf("Callback: expected 42, got %d", id)
+	}
+	if id := updateChatID(inline); id != 7 {
+		t.Errorf("Inline callback: expected 7, got %d", id)
+	}
+	if id := updateChatID(tgbotapi.Update{}); id != 0 {
+		t.Errorf("Empty update: expected 0, got %d", id)
+	}
+}
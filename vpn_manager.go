@@ -1,8 +1,15 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/sirupsen/logrus"
 )
@@ -16,11 +23,57 @@ const (
 	VPNStatusUnknown  VPNStatus = "unknown"
 )
 
+// ServiceState describes whether the Xray service managed by xkeen is running
+type ServiceState string
+
+const (
+	ServiceStateRunning ServiceState = "running"
+	ServiceStateStopped ServiceState = "stopped"
+	ServiceStateUnknown ServiceState = "unknown"
+)
+
+// Action identifies a router-changing operation performed through VPNManager
+type Action string
+
+const (
+	ActionEnableVPN      Action = "enable_vpn"
+	ActionDisableVPN     Action = "disable_vpn"
+	ActionStartService   Action = "start_service"
+	ActionStopService    Action = "stop_service"
+	ActionRestartService Action = "restart_service"
+	ActionFailover       Action = "failover"        // Automatic switch away from a dead VPN outbound
+	ActionFailback       Action = "failback"        // Automatic switch back once it recovers
+	ActionSelectOutbound Action = "select_outbound" // Default rule pointed at a chosen outbound
+	ActionRestoreBackup  Action = "restore_backup"  // Routing config replaced by one of its backups
+)
+
 // VPNManager manages VPN routing configuration on Xkeen router
 type VPNManager struct {
-	sshClient  *SSHClient
-	logger     *logrus.Logger
-	configPath string
+	router        RouterClient
+	logger        *logrus.Logger
+	configPath    string
+	outboundsPath string
+	auditLog      *AuditLog
+	metrics       *Metrics
+	mutations     atomic.Uint64 // Bumped whenever a router-changing operation starts or finishes
+	inFlight      atomic.Int64  // Number of router-changing operations currently running
+
+	routerMutex    sync.Mutex // Held by a router-changing operation from beginMutation until it ends
+	operationMutex sync.Mutex
+	operations     map[uint64]RouterOperation // Running router-changing operations by sequence number
+	operationSeq   uint64
+	operationDone  chan struct{} // Signalled when an operation finishes while Shutdown waits
+	closing        bool          // Set by Shutdown; new operations are refused
+}
+
+// ErrShuttingDown is returned for router changes requested after Shutdown started
+var ErrShuttingDown = errors.New("shutting down, router changes are no longer accepted")
+
+// RouterOperation describes a running router-changing operation
+type RouterOperation struct {
+	Action    Action
+	Actor     Actor
+	StartedAt time.Time
 }
 
 // XrayConfig represents the structure of Xray routing configuration
@@ -47,11 +100,12 @@ type Rule struct {
 }
 
 // NewVPNManager creates a new VPN manager instance
-func NewVPNManager(sshClient *SSHClient, logger *logrus.Logger) *VPNManager {
+func NewVPNManager(router RouterClient, logger *logrus.Logger) *VPNManager {
 	return &VPNManager{
-		sshClient:  sshClient,
-		logger:     logger,
-		configPath: "/opt/etc/xray/configs/05_routing.json",
+		router:        router,
+		logger:        logger,
+		configPath:    "/opt/etc/xray/configs/05_routing.json",
+		outboundsPath: defaultOutboundsPath,
 	}
 }
 
@@ -59,58 +113,96 @@ func NewVPNManager(sshClient *SSHClient, logger *logrus.Logger) *VPNManager {
 func (vm *VPNManager) GetStatus() (VPNStatus, error) {
 	vm.logger.Debug("Getting VPN status")
 
+	outboundTag, err := vm.GetActiveOutbound()
+	if err != nil {
+		return VPNStatusUnknown, err
+	}
+
+	status := statusForOutbound(outboundTag)
+	if status == VPNStatusUnknown {
+		vm.logger.WithField("outbound_tag", outboundTag).Warn("Unknown outbound tag")
+	} else {
+		vm.logger.WithField("status", status).Debug("VPN status retrieved")
+	}
+	return status, nil
+}
+
+// statusForOutbound maps the default rule's outbound tag to a routing status
+func statusForOutbound(outboundTag string) VPNStatus {
+	switch outboundTag {
+	case "vless-reality":
+		return VPNStatusEnabled
+	case "direct":
+		return VPNStatusDisabled
+	default:
+		return VPNStatusUnknown
+	}
+}
+
+// GetActiveOutbound returns the outbound tag of the target routing rule
+func (vm *VPNManager) GetActiveOutbound() (string, error) {
 	// Read the configuration file
-	configContent, err := vm.sshClient.ReadFile(vm.configPath)
+	configContent, err := vm.router.ReadFile(vm.configPath)
 	if err != nil {
-		return VPNStatusUnknown, fmt.Errorf("failed to read config file: %w", err)
+		return "", fmt.Errorf("failed to read config file: %w", err)
 	}
 
 	// Parse the configuration
 	var config XrayConfig
 	if err := json.Unmarshal([]byte(configContent), &config); err != nil {
-		return VPNStatusUnknown, fmt.Errorf("failed to parse config JSON: %w", err)
+		return "", fmt.Errorf("failed to parse config JSON: %w", err)
 	}
 
 	// Find the routing rule we're interested in
 	if config.Routing == nil {
-		return VPNStatusUnknown, fmt.Errorf("no routing configuration found")
+		return "", fmt.Errorf("no routing configuration found")
 	}
 
 	for _, rule := range config.Routing.Rules {
 		if vm.isTargetRule(rule) {
-			switch rule.OutboundTag {
-			case "vless-reality":
-				vm.logger.Debug("VPN status: enabled")
-				return VPNStatusEnabled, nil
-			case "direct":
-				vm.logger.Debug("VPN status: disabled")
-				return VPNStatusDisabled, nil
-			default:
-				vm.logger.WithField("outbound_tag", rule.OutboundTag).Warn("Unknown outbound tag")
-				return VPNStatusUnknown, nil
-			}
+			vm.metrics.SetRouting(vm.RouterName(), rule.OutboundTag)
+			return rule.OutboundTag, nil
 		}
 	}
 
-	return VPNStatusUnknown, fmt.Errorf("target routing rule not found")
+	return "", fmt.Errorf("target routing rule not found")
 }
 
 // EnableVPN switches routing to use VPN (vless-reality outbound)
-func (vm *VPNManager) EnableVPN() error {
+func (vm *VPNManager) EnableVPN(ctx context.Context) error {
 	vm.logger.Info("Enabling VPN routing")
-	return vm.setOutboundTag("vless-reality")
+	return vm.setOutboundTag(ctx, ActionEnableVPN, "vless-reality")
 }
 
 // DisableVPN switches routing to direct connection
-func (vm *VPNManager) DisableVPN() error {
+func (vm *VPNManager) DisableVPN(ctx context.Context) error {
 	vm.logger.Info("Disabling VPN routing")
-	return vm.setOutboundTag("direct")
+	return vm.setOutboundTag(ctx, ActionDisableVPN, "direct")
+}
+
+// SwitchOutbound points the default rule at an arbitrary outbound tag, recording action in the audit log
+func (vm *VPNManager) SwitchOutbound(ctx context.Context, action Action, outboundTag string) error {
+	vm.logger.WithFields(logrus.Fields{
+		"action":       action,
+		"outbound_tag": outboundTag,
+	}).Info("Switching default outbound")
+	return vm.setOutboundTag(ctx, action, outboundTag)
 }
 
 // setOutboundTag changes the outbound tag for the target routing rule
-func (vm *VPNManager) setOutboundTag(outboundTag string) error {
+func (vm *VPNManager) setOutboundTag(ctx context.Context, action Action, outboundTag string) (err error) {
+	end, err := vm.beginMutation(ctx, action)
+	if err != nil {
+		return err
+	}
+	defer end()
+
+	entry := vm.newAuditEntry(ctx, action)
+	defer func() { vm.recordAudit(entry, err) }()
+	defer func() { vm.metrics.ObserveConfigApply(err) }()
+
 	// Read current configuration
-	configContent, err := vm.sshClient.ReadFile(vm.configPath)
+	configContent, err := vm.router.ReadFile(vm.configPath)
 	if err != nil {
 		return fmt.Errorf("failed to read config file: %w", err)
 	}
@@ -145,6 +237,9 @@ func (vm *VPNManager) setOutboundTag(outboundTag string) error {
 		"new_outbound": outboundTag,
 	}).Info("Updating default routing rule")
 
+	entry.Before = lastRule.OutboundTag
+	entry.After = outboundTag
+
 	config.Routing.Rules[lastRuleIndex].OutboundTag = outboundTag
 
 	// Marshal the updated configuration
@@ -154,7 +249,7 @@ func (vm *VPNManager) setOutboundTag(outboundTag string) error {
 	}
 
 	// Write the updated configuration back to the file
-	if err := vm.sshClient.WriteFile(vm.configPath, string(updatedContent)); err != nil {
+	if err := vm.router.WriteFile(vm.configPath, string(updatedContent)); err != nil {
 		return fmt.Errorf("failed to write updated config: %w", err)
 	}
 
@@ -164,6 +259,7 @@ func (vm *VPNManager) setOutboundTag(outboundTag string) error {
 		// Don't return error here as the config was successfully updated
 	}
 
+	vm.metrics.SetRouting(vm.RouterName(), outboundTag)
 	vm.logger.WithField("outbound_tag", outboundTag).Info("VPN routing configuration updated successfully")
 	return nil
 }
@@ -194,7 +290,7 @@ func (vm *VPNManager) restartXrayService() error {
 	vm.logger.Info("Restarting Xray service using xkeen")
 
 	// Use xkeen command to restart
-	err := vm.sshClient.RestartService()
+	err := vm.router.RestartService()
 	if err != nil {
 		vm.logger.WithError(err).Error("Failed to restart Xray service with xkeen")
 		return err
@@ -209,7 +305,7 @@ func (vm *VPNManager) ValidateConfiguration() error {
 	vm.logger.Debug("Validating Xray configuration")
 
 	// Read the configuration file
-	configContent, err := vm.sshClient.ReadFile(vm.configPath)
+	configContent, err := vm.router.ReadFile(vm.configPath)
 	if err != nil {
 		return fmt.Errorf("failed to read config file: %w", err)
 	}
@@ -242,6 +338,12 @@ func (vm *VPNManager) ValidateConfiguration() error {
 	return nil
 }
 
+// CheckRouter verifies that commands can be run on the router
+func (vm *VPNManager) CheckRouter() error {
+	_, err := vm.router.ExecuteCommand("echo 'connection_test'")
+	return err
+}
+
 // GetConfigPath returns the path to the Xray configuration file
 func (vm *VPNManager) GetConfigPath() string {
 	return vm.configPath
@@ -253,21 +355,300 @@ func (vm *VPNManager) SetConfigPath(path string) {
 	vm.logger.WithField("config_path", path).Info("Configuration path updated")
 }
 
+// SetOutboundsPath sets a custom path to the Xray outbounds file
+func (vm *VPNManager) SetOutboundsPath(path string) {
+	vm.outboundsPath = path
+	vm.logger.WithField("outbounds_path", path).Info("Outbounds path updated")
+}
+
 // StartVPNService starts the VPN service using xkeen command
-func (vm *VPNManager) StartVPNService() error {
+func (vm *VPNManager) StartVPNService(ctx context.Context) (err error) {
+	end, err := vm.beginMutation(ctx, ActionStartService)
+	if err != nil {
+		return err
+	}
+	defer end()
+
+	entry := vm.newAuditEntry(ctx, ActionStartService)
+	entry.Before = string(vm.serviceStateForAudit())
+	defer func() {
+		if err == nil {
+			entry.After = string(ServiceStateRunning)
+		}
+		vm.recordAudit(entry, err)
+	}()
+
 	vm.logger.Info("Starting VPN service using xkeen")
-	return vm.sshClient.StartService()
+	return vm.router.StartService()
 }
 
 // StopVPNService stops the VPN service using xkeen command
-func (vm *VPNManager) StopVPNService() error {
+func (vm *VPNManager) StopVPNService(ctx context.Context) (err error) {
+	end, err := vm.beginMutation(ctx, ActionStopService)
+	if err != nil {
+		return err
+	}
+	defer end()
+
+	entry := vm.newAuditEntry(ctx, ActionStopService)
+	entry.Before = string(vm.serviceStateForAudit())
+	defer func() {
+		if err == nil {
+			entry.After = string(ServiceStateStopped)
+		}
+		vm.recordAudit(entry, err)
+	}()
+
 	vm.logger.Info("Stopping VPN service using xkeen")
-	return vm.sshClient.StopService()
+	return vm.router.StopService()
+}
+
+// RestartVPNService restarts the VPN service using xkeen command
+func (vm *VPNManager) RestartVPNService(ctx context.Context) (err error) {
+	end, err := vm.beginMutation(ctx, ActionRestartService)
+	if err != nil {
+		return err
+	}
+	defer end()
+
+	entry := vm.newAuditEntry(ctx, ActionRestartService)
+	entry.Before = string(vm.serviceStateForAudit())
+	defer func() {
+		if err == nil {
+			entry.After = string(ServiceStateRunning)
+		}
+		vm.recordAudit(entry, err)
+	}()
+
+	return vm.restartXrayService()
+}
+
+// GetRoutingRules returns the rules of the routing configuration in order
+func (vm *VPNManager) GetRoutingRules() ([]Rule, error) {
+	configContent, err := vm.router.ReadFile(vm.configPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var config XrayConfig
+	if err := json.Unmarshal([]byte(configContent), &config); err != nil {
+		return nil, fmt.Errorf("failed to parse config JSON: %w", err)
+	}
+	if config.Routing == nil {
+		return nil, fmt.Errorf("no routing configuration found")
+	}
+	return config.Routing.Rules, nil
+}
+
+// Perform runs a router-changing action by name
+func (vm *VPNManager) Perform(ctx context.Context, action Action) error {
+	switch action {
+	case ActionEnableVPN:
+		return vm.EnableVPN(ctx)
+	case ActionDisableVPN:
+		return vm.DisableVPN(ctx)
+	case ActionStartService:
+		return vm.StartVPNService(ctx)
+	case ActionStopService:
+		return vm.StopVPNService(ctx)
+	case ActionRestartService:
+		return vm.RestartVPNService(ctx)
+	default:
+		return fmt.Errorf("unknown action %q", action)
+	}
 }
 
 // GetVPNServiceStatus gets the current VPN service status using xkeen command
 func (vm *VPNManager) GetVPNServiceStatus() (string, error) {
 	vm.logger.Debug("Getting VPN service status using xkeen")
-	return vm.sshClient.GetServiceStatus()
+	return vm.router.GetServiceStatus()
+}
+
+// GetServiceState returns the parsed state of the VPN service
+func (vm *VPNManager) GetServiceState() (ServiceState, error) {
+	output, err := vm.GetVPNServiceStatus()
+	if err != nil {
+		return ServiceStateUnknown, err
+	}
+	state := parseServiceState(output)
+	vm.metrics.SetServiceState(vm.RouterName(), state)
+	return state, nil
+}
+
+// parseServiceState interprets `xkeen -status` output, which xkeen prints in Russian
+func parseServiceState(output string) ServiceState {
+	clean := strings.ReplaceAll(output, "\033[31m", "")
+	clean = strings.ReplaceAll(clean, "\033[0m", "")
+	clean = strings.ReplaceAll(clean, "[31m", "")
+	clean = strings.ReplaceAll(clean, "[0m", "")
+	clean = strings.TrimSpace(clean)
+
+	switch {
+	case strings.Contains(clean, "не запущен"):
+		return ServiceStateStopped
+	case clean != "":
+		return ServiceStateRunning
+	default:
+		return ServiceStateUnknown
+	}
+}
+
+// GetRouterUptime returns how long the router has been running
+func (vm *VPNManager) GetRouterUptime() (time.Duration, error) {
+	return vm.router.GetUptime()
 }
 
+// SetAuditLog enables audit recording of every router-changing action
+func (vm *VPNManager) SetAuditLog(auditLog *AuditLog) {
+	vm.auditLog = auditLog
+}
+
+// SetMetrics enables recording of routing, service state and config-apply metrics
+func (vm *VPNManager) SetMetrics(metrics *Metrics) {
+	vm.metrics = metrics
+}
+
+// RouterName returns the router address used to label audit entries
+func (vm *VPNManager) RouterName() string {
+	return vm.router.Host()
+}
+
+// newAuditEntry prepares an audit entry for action performed by the actor in ctx
+func (vm *VPNManager) newAuditEntry(ctx context.Context, action Action) *AuditEntry {
+	actor := actorFromContext(ctx)
+	return &AuditEntry{
+		UserID:   actor.UserID,
+		Username: actor.Username,
+		Source:   actor.Source,
+		Action:   action,
+		Router:   vm.RouterName(),
+	}
+}
+
+// recordAudit completes entry with the outcome of err and records it
+func (vm *VPNManager) recordAudit(entry *AuditEntry, err error) {
+	if vm.auditLog == nil {
+		return
+	}
+
+	entry.Outcome = AuditOutcomeSuccess
+	if err != nil {
+		entry.Outcome = AuditOutcomeFailure
+		entry.Error = err.Error()
+		entry.After = entry.Before // Nothing changed
+	}
+	vm.auditLog.Record(*entry)
+}
+
+// serviceStateForAudit captures the service state before a change, skipping the
+// extra router round-trip when auditing is disabled
+func (vm *VPNManager) serviceStateForAudit() ServiceState {
+	if vm.auditLog == nil {
+		return ServiceStateUnknown
+	}
+
+	state, err := vm.GetServiceState()
+	if err != nil {
+		vm.logger.WithError(err).Debug("Failed to capture service state for audit")
+	}
+	return state
+}
+
+// beginMutation marks the start of a router-changing operation and returns the function marking its end
+// Operations run one at a time, from reading the configuration to restarting the service, so
+// concurrent changes cannot overwrite each other. It fails with ErrShuttingDown once Shutdown has started
+func (vm *VPNManager) beginMutation(ctx context.Context, action Action) (func(), error) {
+	// Refuse before queueing behind an operation that shutdown may have abandoned
+	vm.operationMutex.Lock()
+	closing := vm.closing
+	vm.operationMutex.Unlock()
+	if closing {
+		return nil, ErrShuttingDown
+	}
+
+	vm.routerMutex.Lock()
+	vm.operationMutex.Lock()
+	defer vm.operationMutex.Unlock()
+
+	if vm.closing {
+		vm.routerMutex.Unlock()
+		return nil, ErrShuttingDown
+	}
+	if vm.operations == nil {
+		vm.operations = make(map[uint64]RouterOperation)
+	}
+	vm.operationSeq++
+	seq := vm.operationSeq
+	vm.operations[seq] = RouterOperation{
+		Action:    action,
+		Actor:     actorFromContext(ctx),
+		StartedAt: time.Now(),
+	}
+
+	vm.inFlight.Add(1)
+	vm.mutations.Add(1)
+	return func() {
+		vm.mutations.Add(1)
+		vm.inFlight.Add(-1)
+
+		vm.operationMutex.Lock()
+		defer vm.operationMutex.Unlock()
+		delete(vm.operations, seq)
+		vm.routerMutex.Unlock()
+		if vm.operationDone != nil {
+			select {
+			case vm.operationDone <- struct{}{}:
+			default:
+			}
+		}
+	}, nil
+}
+
+// Shutdown refuses further router changes and waits for the running ones to finish or ctx to end
+// It returns the operations still running when ctx ended, oldest first
+func (vm *VPNManager) Shutdown(ctx context.Context) []RouterOperation {
+	vm.operationMutex.Lock()
+	vm.closing = true
+	vm.operationDone = make(chan struct{}, 1)
+	vm.operationMutex.Unlock()
+
+	for {
+		vm.operationMutex.Lock()
+		running := len(vm.operations)
+		vm.operationMutex.Unlock()
+		if running == 0 {
+			return nil
+		}
+
+		vm.logger.WithField("operations", running).Info("Waiting for router operations to finish")
+		select {
+		case <-vm.operationDone:
+		case <-ctx.Done():
+			return vm.runningOperations()
+		}
+	}
+}
+
+// runningOperations returns the operations currently running, oldest first
+func (vm *VPNManager) runningOperations() []RouterOperation {
+	vm.operationMutex.Lock()
+	defer vm.operationMutex.Unlock()
+
+	seqs := make([]uint64, 0, len(vm.operations))
+	for seq := range vm.operations {
+		seqs = append(seqs, seq)
+	}
+	sort.Slice(seqs, func(i, j int) bool { return seqs[i] < seqs[j] })
+
+	operations := make([]RouterOperation, 0, len(seqs))
+	for _, seq := range seqs {
+		operations = append(operations, vm.operations[seq])
+	}
+	return operations
+}
+
+// MutationState returns a counter that changes with every router-changing operation
+// and whether any such operation is currently running
+func (vm *VPNManager) MutationState() (uint64, bool) {
+	return vm.mutations.Load(), vm.inFlight.Load() > 0
+}
@@ -1,16 +1,22 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/sirupsen/logrus"
+
+	"vpn-commander/internal/fakerouter"
 )
 
 func TestNewVPNManager(t *testing.T) {
 	logger := logrus.New()
 	logger.SetLevel(logrus.ErrorLevel) // Suppress logs during tests
 	
-	// Mock SSH client (we'd need to implement a mock for real tests)
+	// Only the constructor is exercised here; behaviour is tested against fakerouter below
 	sshClient := &SSHClient{
 		host:     "test-host",
 		username: "test-user", 
@@ -110,4 +116,247 @@ func TestIsTargetRule(t *testing.T) {
 			}
 		})
 	}
-}
\ No newline at end of file
+}
+// newFakeRouterManager returns a manager backed by an in-memory router whose default rule points at outbound
+func newFakeRouterManager(t *testing.T, outbound string) (*VPNManager, *fakerouter.Router) {
+	t.Helper()
+
+	logger := logrus.New()
+	logger.SetLevel(logrus.FatalLevel)
+
+	router := fakerouter.New(outbound)
+	router.Now = func() time.Time { return time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC) }
+	manager := NewVPNManager(router, logger)
+	manager.SetOutboundsPath(fakerouter.OutboundsPath)
+	return manager, router
+}
+
+func TestGetStatus(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  *string // nil removes the routing config
+		fail    error
+		want    VPNStatus
+		wantErr string
+	}{
+		{name: "vpn", config: ptr(fakerouter.RoutingConfig("vless-reality")), want: VPNStatusEnabled},
+		{name: "direct", config: ptr(fakerouter.RoutingConfig("direct")), want: VPNStatusDisabled},
+		{name: "other outbound", config: ptr(fakerouter.RoutingConfig("block")), want: VPNStatusUnknown},
+		{name: "missing file", wantErr: "failed to read config file"},
+		{name: "read error", config: ptr(fakerouter.RoutingConfig("direct")), fail: errors.New("connection reset"), wantErr: "connection reset"},
+		{name: "invalid json", config: ptr("{"), wantErr: "failed to parse config JSON"},
+		{name: "no routing", config: ptr(`{"outbounds": []}`), wantErr: "no routing configuration found"},
+		{
+			name:    "no default rule",
+			config:  ptr(`{"routing": {"rules": [{"inboundTag": ["redirect"], "network": "tcp,udp", "outboundTag": "direct"}]}}`),
+			wantErr: "target routing rule not found",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manager, router := newFakeRouterManager(t, "direct")
+			if tt.config == nil {
+				router.RemoveFile(fakerouter.RoutingPath)
+			} else {
+				router.SetFile(fakerouter.RoutingPath, *tt.config)
+			}
+			router.Fail(fakerouter.OpReadFile, tt.fail)
+
+			status, err := manager.GetStatus()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Expected error containing %q, got %v", tt.wantErr, err)
+				}
+				if status != VPNStatusUnknown {
+					t.Errorf("Expected %s on error, got %s", VPNStatusUnknown, status)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetStatus failed: %v", err)
+			}
+			if status != tt.want {
+				t.Errorf("Expected %s, got %s", tt.want, status)
+			}
+		})
+	}
+}
+
+func TestSetOutboundTag(t *testing.T) {
+	const lastRuleNotDefault = `{"routing": {"rules": [
+		{"inboundTag": ["redirect", "tproxy"], "network": "tcp,udp", "outboundTag": "direct"},
+		{"domain": ["geosite:ru"], "outboundTag": "direct"}
+	]}}`
+
+	tests := []struct {
+		name         string
+		initial      string
+		config       string // replaces the seeded routing config when set
+		switchTo     func(manager *VPNManager, ctx context.Context) error
+		failOp       fakerouter.Op
+		want         string
+		wantErr      string
+		wantRestarts int
+	}{
+		{name: "enable vpn", initial: "direct", switchTo: (*VPNManager).EnableVPN, want: "vless-reality", wantRestarts: 1},
+		{name: "disable vpn", initial: "vless-reality", switchTo: (*VPNManager).DisableVPN, want: "direct", wantRestarts: 1},
+		{
+			name:    "switch outbound",
+			initial: "direct",
+			switchTo: func(manager *VPNManager, ctx context.Context) error {
+				return manager.SwitchOutbound(ctx, ActionSelectOutbound, "block")
+			},
+			want:         "block",
+			wantRestarts: 1,
+		},
+		{name: "restart failure keeps the change", initial: "direct", switchTo: (*VPNManager).EnableVPN, failOp: fakerouter.OpRestart, want: "vless-reality"},
+		{name: "read failure", initial: "direct", switchTo: (*VPNManager).EnableVPN, failOp: fakerouter.OpReadFile, wantErr: "failed to read config file"},
+		{name: "write failure", initial: "direct", switchTo: (*VPNManager).EnableVPN, failOp: fakerouter.OpWriteFile, wantErr: "failed to write updated config"},
+		{name: "invalid json", config: "not json", switchTo: (*VPNManager).EnableVPN, wantErr: "failed to parse config JSON"},
+		{name: "no routing", config: `{}`, switchTo: (*VPNManager).EnableVPN, wantErr: "no routing configuration found"},
+		{name: "no rules", config: `{"routing": {"rules": []}}`, switchTo: (*VPNManager).EnableVPN, wantErr: "no routing rules found"},
+		{name: "last rule not default", config: lastRuleNotDefault, switchTo: (*VPNManager).EnableVPN, wantErr: "last rule is not the expected default routing rule"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manager, router := newFakeRouterManager(t, tt.initial)
+			if tt.config != "" {
+				router.SetFile(fakerouter.RoutingPath, tt.config)
+			}
+			before, _ := router.File(fakerouter.RoutingPath)
+			if tt.failOp != "" {
+				router.Fail(tt.failOp, errors.New("injected failure"))
+			}
+
+			err := tt.switchTo(manager, context.Background())
+
+			if restarts := router.Restarts(); restarts != tt.wantRestarts {
+				t.Errorf("Expected %d restarts, got %d", tt.wantRestarts, restarts)
+			}
+			after, _ := router.File(fakerouter.RoutingPath)
+			backups := router.Backups(fakerouter.RoutingPath)
+
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Expected error containing %q, got %v", tt.wantErr, err)
+				}
+				if after != before || len(backups) != 0 {
+					t.Errorf("A failed switch must leave the config alone, got %d backups and %q", len(backups), after)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Switch failed: %v", err)
+			}
+
+			outbound, err := manager.GetActiveOutbound()
+			if err != nil || outbound != tt.want {
+				t.Errorf("Expected the default rule to point at %s, got %q (%v)", tt.want, outbound, err)
+			}
+			if len(backups) != 1 || backups[0] != fakerouter.RoutingPath+".backup.20240501-120000" {
+				t.Fatalf("Expected one timestamped backup, got %v", backups)
+			}
+			if backup, _ := router.File(backups[0]); backup != before {
+				t.Errorf("Expected the backup to hold the previous config, got %q", backup)
+			}
+			rules, err := manager.GetRoutingRules()
+			if err != nil || len(rules) != 2 || rules[0].OutboundTag != "direct" {
+				t.Errorf("Expected the other rules to be kept, got %+v (%v)", rules, err)
+			}
+		})
+	}
+}
+
+func TestRouterChangesRunOneAtATime(t *testing.T) {
+	manager, router := newFakeRouterManager(t, "direct")
+
+	end, err := manager.beginMutation(context.Background(), ActionRestartService)
+	if err != nil {
+		t.Fatalf("beginMutation failed: %v", err)
+	}
+
+	done := make(chan error)
+	go func() { done <- manager.EnableVPN(context.Background()) }()
+	select {
+	case err := <-done:
+		t.Fatalf("Routing changed while another operation was running (%v)", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	if calls := router.Calls(); len(calls) != 0 {
+		t.Fatalf("Expected the router to be left alone meanwhile, got %v", calls)
+	}
+
+	end()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("EnableVPN failed: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("EnableVPN did not run once the other operation ended")
+	}
+	if outbound, _ := manager.GetActiveOutbound(); outbound != "vless-reality" {
+		t.Errorf("Expected vless-reality, got %q", outbound)
+	}
+}
+
+func TestServiceControl(t *testing.T) {
+	tests := []struct {
+		name        string
+		running     bool
+		perform     Action
+		failOp      fakerouter.Op
+		wantRunning bool
+		wantErr     bool
+	}{
+		{name: "start", perform: ActionStartService, wantRunning: true},
+		{name: "stop", running: true, perform: ActionStopService},
+		{name: "restart stopped", perform: ActionRestartService, wantRunning: true},
+		{name: "start failure", perform: ActionStartService, failOp: fakerouter.OpStart, wantErr: true},
+		{name: "stop failure", running: true, perform: ActionStopService, failOp: fakerouter.OpStop, wantRunning: true, wantErr: true},
+		{name: "restart failure", perform: ActionRestartService, failOp: fakerouter.OpRestart, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manager, router := newFakeRouterManager(t, "direct")
+			router.SetRunning(tt.running)
+			if tt.failOp != "" {
+				router.Fail(tt.failOp, errors.New("injected failure"))
+			}
+
+			err := manager.Perform(context.Background(), tt.perform)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Expected error %v, got %v", tt.wantErr, err)
+			}
+
+			want := ServiceStateStopped
+			if tt.wantRunning {
+				want = ServiceStateRunning
+			}
+			state, err := manager.GetServiceState()
+			if err != nil {
+				t.Fatalf("GetServiceState failed: %v", err)
+			}
+			if state != want {
+				t.Errorf("Expected service %s, got %s", want, state)
+			}
+		})
+	}
+}
+
+func TestGetServiceStateError(t *testing.T) {
+	manager, router := newFakeRouterManager(t, "direct")
+	router.Fail(fakerouter.OpStatus, errors.New("session closed"))
+
+	state, err := manager.GetServiceState()
+	if err == nil || state != ServiceStateUnknown {
+		t.Errorf("Expected an unknown state and an error, got %s (%v)", state, err)
+	}
+}
+
+func ptr[T any](value T) *T {
+	return &value
+}
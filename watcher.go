@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// RouterState is a snapshot of the router state the bot cares about
+// Empty fields mean the value could not be read
+type RouterState struct {
+	Outbound string
+	Service  ServiceState
+	At       time.Time
+}
+
+// StateChange describes one field that differs between two snapshots
+type StateChange struct {
+	Field  string
+	Before string
+	After  string
+}
+
+// diffRouterStates lists the fields that changed, ignoring fields unknown on either side
+func diffRouterStates(before, after RouterState) []StateChange {
+	var changes []StateChange
+	if before.Outbound != "" && after.Outbound != "" && before.Outbound != after.Outbound {
+		changes = append(changes, StateChange{Field: "routing", Before: before.Outbound, After: after.Outbound})
+	}
+	if before.Service != "" && after.Service != "" && before.Service != ServiceStateUnknown &&
+		after.Service != ServiceStateUnknown && before.Service != after.Service {
+		changes = append(changes, StateChange{Field: "service", Before: string(before.Service), After: string(after.Service)})
+	}
+	return changes
+}
+
+// StateWatcher polls the router and reports changes made outside the bot
+type StateWatcher struct {
+	vpnManager *VPNManager
+	interval   time.Duration
+	logger     *logrus.Logger
+	notify     func(changes []StateChange, current RouterState)
+	last       *RouterState
+	lastSeq    uint64
+	mutex      sync.Mutex
+}
+
+// NewStateWatcher creates a watcher polling every interval
+func NewStateWatcher(vpnManager *VPNManager, interval time.Duration, logger *logrus.Logger) *StateWatcher {
+	return &StateWatcher{
+		vpnManager: vpnManager,
+		interval:   interval,
+		logger:     logger,
+	}
+}
+
+// SetNotifier sets the callback invoked when drift is detected
+func (w *StateWatcher) SetNotifier(notify func(changes []StateChange, current RouterState)) {
+	w.notify = notify
+}
+
+// Current returns the last known router state
+func (w *StateWatcher) Current() (RouterState, bool) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.last == nil {
+		return RouterState{}, false
+	}
+	return *w.last, true
+}
+
+// Run polls until ctx is cancelled
+func (w *StateWatcher) Run(ctx context.Context) {
+	w.logger.WithField("interval", w.interval).Info("State watcher started")
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	w.Poll()
+	for {
+		select {
+		case <-ticker.C:
+			w.Poll()
+		case <-ctx.Done():
+			w.logger.Info("State watcher stopped")
+			return
+		}
+	}
+}
+
+// Poll takes a snapshot and notifies about drift from the last known state
+// Changes made through VPNManager while or since the previous poll only re-baseline
+func (w *StateWatcher) Poll() {
+	seqBefore, busyBefore := w.vpnManager.MutationState()
+	current := w.snapshot()
+	seqAfter, busyAfter := w.vpnManager.MutationState()
+
+	w.mutex.Lock()
+	previous := w.last
+	ownChange := busyBefore || busyAfter || seqBefore != seqAfter || seqBefore != w.lastSeq
+	w.lastSeq = seqAfter
+
+	// Keep the last known value of fields that could not be read this time
+	if previous != nil {
+		if current.Outbound == "" {
+			current.Outbound = previous.Outbound
+		}
+		if current.Service == ServiceStateUnknown {
+			current.Service = previous.Service
+		}
+	}
+	w.last = &current
+	w.mutex.Unlock()
+
+	if previous == nil || ownChange {
+		return
+	}
+
+	changes := diffRouterStates(*previous, current)
+	if len(changes) == 0 {
+		return
+	}
+
+	w.logger.WithField("changes", changes).Warn("Router state changed outside the bot")
+	if w.notify != nil {
+		w.notify(changes, current)
+	}
+}
+
+// snapshot reads the current router state, leaving fields empty on errors
+func (w *StateWatcher) snapshot() RouterState {
+	state := RouterState{At: time.Now(), Service: ServiceStateUnknown}
+
+	if outbound, err := w.vpnManager.GetActiveOutbound(); err != nil {
+		w.logger.WithError(err).Debug("State watcher failed to read routing")
+	} else {
+		state.Outbound = outbound
+	}
+
+	if service, err := w.vpnManager.GetServiceState(); err != nil {
+		w.logger.WithError(err).Debug("State watcher failed to read service state")
+	} else {
+		state.Service = service
+	}
+
+	return state
+}
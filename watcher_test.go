@@ -0,0 +1,46 @@
+package main
+
+import "testing"
+
+func TestDiffRouterStates(t *testing.T) {
+	tests := []struct {
+		name     string
+		before   RouterState
+		after    RouterState
+		expected []StateChange
+	}{
+		{
+			name:   "no change",
+			before: RouterState{Outbound: "direct", Service: ServiceStateRunning},
+			after:  RouterState{Outbound: "direct", Service: ServiceStateRunning},
+		},
+		{
+			name:   "routing and service changed",
+			before: RouterState{Outbound: "vless-reality", Service: ServiceStateRunning},
+			after:  RouterState{Outbound: "direct", Service: ServiceStateStopped},
+			expected: []StateChange{
+				{Field: "routing", Before: "vless-reality", After: "direct"},
+				{Field: "service", Before: "running", After: "stopped"},
+			},
+		},
+		{
+			name:   "unknown values are ignored",
+			before: RouterState{Outbound: "", Service: ServiceStateUnknown},
+			after:  RouterState{Outbound: "direct", Service: ServiceStateStopped},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changes := diffRouterStates(tt.before, tt.after)
+			if len(changes) != len(tt.expected) {
+				t.Fatalf("Expected %d changes, got %v", len(tt.expected), changes)
+			}
+			for i := range changes {
+				if changes[i] != tt.expected[i] {
+					t.Errorf("Expected %+v, got %+v", tt.expected[i], changes[i])
+				}
+			}
+		})
+	}
+}